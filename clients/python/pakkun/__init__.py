@@ -0,0 +1,8 @@
+"""
+    Python client for pakkun-server, see client.py
+"""
+
+from .client import (BY_NAME, BY_SIGNATURE, FULL_TEXT, MAX_LOOKUP, Client, PakkunError, PartialResultsWarning,
+                     records)
+
+__version__ = "0.1.0"
@@ -0,0 +1,210 @@
+"""
+    client.py
+
+    Python client for the pakkun-server HTTP API, the same calls as the Go client of
+    the server package, for querying the function index from notebooks:
+
+        import pakkun
+
+        client = pakkun.Client("http://localhost:8080", token="...")
+        for row in client.rows("parse", mode="name", limit=50):
+            print(row["File"]["Path"], row["Function"]["Name"])
+        df = client.dataframe("sort", mode="signature")
+
+    Only the standard library is needed, pandas only for dataframe.
+"""
+
+import json
+import time
+import urllib.error
+import urllib.parse
+import urllib.request
+import warnings
+
+# Search modes
+BY_NAME      = "name"
+BY_SIGNATURE = "signature"
+FULL_TEXT    = "text"
+
+# Largest batch the server accepts on /functions/lookup
+MAX_LOOKUP = 10000
+
+# Header with the status of one corpus of a federated server
+CORPUS_STATUS_HEADER = "X-Corpus-Status"
+
+
+class PakkunError(Exception):
+    """
+        The server answered with an error
+
+        status  - HTTP status code, e.g. 400
+        path    - Path of the request
+        message - What the server said
+    """
+
+    def __init__(self, status, path, message):
+        super().__init__("%s: %d: %s" % (path, status, message))
+        self.status  = status
+        self.path    = path
+        self.message = message
+
+
+class PartialResultsWarning(UserWarning):
+    """
+        Warned when some corpora of a federated server didn't answer. The results of the
+        others are still returned, statuses says which corpora answered and how.
+    """
+
+    def __init__(self, statuses):
+        failed = ["%s: %s" % (s["Corpus"], s.get("Error") or s["Status"]) for s in statuses if s["Status"] != "ok"]
+        super().__init__("partial results, " + "; ".join(failed))
+        self.statuses = statuses
+
+
+class Client(object):
+    """
+        url     - Base URL of the server, e.g. http://localhost:8080
+        token   - Bearer token sent with every request, None for none
+        timeout - Seconds to wait for each answer
+        retries - Times a request turned away by the rate limit is retried, after the
+                  wait the server asks for
+    """
+
+    def __init__(self, url, token=None, timeout=30, retries=3):
+        self.url      = url.rstrip("/")
+        self.token    = token
+        self.timeout  = timeout
+        self.retries  = retries
+        # Statuses of the corpora of a federated server for the last call, [] otherwise
+        self.statuses = []
+
+    def rows(self, text, mode=BY_NAME, asof=None, version=None, limit=None):
+        """
+            Search the server and return the matching functions, each a dict with its
+            Function, File, Repo and, if known, the Run that first saw it
+
+            asof    - Run id or date to search the corpus as of, None for its current state
+            version - Only search files written for this language version, e.g. python3
+            limit   - Most files to look at, None for the server's default
+        """
+        params = {"q": text, "mode": mode}
+        if asof:
+            params["asof"] = asof
+        if version:
+            params["version"] = version
+        if limit:
+            params["limit"] = str(limit)
+        return json.loads(self._get("/rows?" + urllib.parse.urlencode(params)))
+
+    def source(self, id):
+        """
+            Body of the function with the id, as text
+        """
+        return self._get("/functions/%d/source" % id).decode("utf-8")
+
+    def stats(self):
+        """
+            Language distribution, type frequencies and size histogram of the corpus
+        """
+        return json.loads(self._get("/stats"))
+
+    def lookup(self, ids):
+        """
+            Which of the function ids are already stored, as {"present": [...], "missing":
+            [...]}. Batches larger than the server accepts are split.
+        """
+        ids    = list(ids)
+        result = {"present": [], "missing": []}
+        for start in range(0, len(ids), MAX_LOOKUP):
+            body = json.dumps({"ids": ids[start:start + MAX_LOOKUP]}).encode("utf-8")
+            resp = json.loads(self._request("/functions/lookup", body))
+            result["present"] += resp["present"]
+            result["missing"] += resp["missing"]
+        return result
+
+    def dataframe(self, text, mode=BY_NAME, asof=None, version=None, limit=None):
+        """
+            rows as a pandas DataFrame, one flattened record per function, see records
+        """
+        import pandas
+        return pandas.DataFrame(records(self.rows(text, mode=mode, asof=asof, version=version, limit=limit)))
+
+    def _get(self, path):
+        return self._request(path, None)
+
+    def _request(self, path, body):
+        headers = {"Accept": "application/json"}
+        if body is not None:
+            headers["Content-Type"] = "application/json"
+        if self.token:
+            headers["Authorization"] = "Bearer " + self.token
+
+        for attempt in range(self.retries + 1):
+            req = urllib.request.Request(self.url + path, data=body, headers=headers)
+            try:
+                with urllib.request.urlopen(req, timeout=self.timeout) as resp:
+                    self._partial(resp.headers.get_all(CORPUS_STATUS_HEADER) or [])
+                    return resp.read()
+            except urllib.error.HTTPError as err:
+                if err.code == 429 and attempt < self.retries:
+                    time.sleep(float(err.headers.get("Retry-After") or 1))
+                    continue
+                raise PakkunError(err.code, path.split("?")[0], err.read().decode("utf-8", "replace").strip())
+
+    def _partial(self, headers):
+        """
+            Keep the corpus statuses of a federated server and warn if some didn't answer,
+            from headers like public; status=timeout; results=0; elapsed=2.001s; error=...
+        """
+        self.statuses = []
+        for header in headers:
+            fields = [f.strip() for f in header.split(";")]
+            status = {"Corpus": urllib.parse.unquote_plus(fields[0]), "Status": "", "Results": 0, "Elapsed": ""}
+            for field in fields[1:]:
+                key, _, value = field.partition("=")
+                if key == "status":
+                    status["Status"] = value
+                elif key == "results":
+                    status["Results"] = int(value)
+                elif key == "elapsed":
+                    status["Elapsed"] = value
+                elif key == "error":
+                    status["Error"] = urllib.parse.unquote_plus(value)
+            self.statuses.append(status)
+        if self.statuses:
+            warnings.warn(PartialResultsWarning(self.statuses))
+
+
+def records(rows):
+    """
+        Flatten rows into one dict per function, with the fields notebooks usually want
+        at the top level, e.g. for pandas.DataFrame
+    """
+    out = []
+    for row in rows:
+        fn   = row.get("Function", {})
+        file = row.get("File", {})
+        repo = row.get("Repo", {})
+        run  = row.get("Run") or {}
+        out.append({
+            "id":         fn.get("Id"),
+            "name":       fn.get("Name"),
+            "class":      fn.get("Class", ""),
+            "kind":       fn.get("Kind", ""),
+            "header":     fn.get("Header"),
+            "in_type":    fn.get("InType") or [],
+            "out_type":   fn.get("OutType") or [],
+            "doc":        fn.get("Doc", ""),
+            "source":     fn.get("Source"),
+            "start_line": fn.get("StartLine", 0),
+            "end_line":   fn.get("EndLine", 0),
+            "tokens":     fn.get("Tokens", 0),
+            "added_in":   fn.get("AddedIn", ""),
+            "path":       file.get("Path"),
+            "backend":    file.get("Backend"),
+            "repo":       repo.get("URL", ""),
+            "commit":     repo.get("Commit", ""),
+            "run":        run.get("Id", ""),
+            "corpus":     row.get("Corpus", ""),
+        })
+    return out
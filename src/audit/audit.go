@@ -0,0 +1,114 @@
+/*
+    audit.go
+
+    Append-only audit log of who ingested what and who queried or exported what, for
+    deployments where access to the corpus has to be traceable. One JSON object per
+    line:
+
+        {"time":"2026-10-15T12:00:00Z","actor":"jchen","action":"ingest","target":"/src/Foo.java","detail":"3 functions"}
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package audit
+
+import (
+    "encoding/json"
+    "os"
+    "os/user"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// Actions
+const (
+    Ingest   = "ingest"
+    Remove   = "remove"
+    Query    = "query"
+    Export   = "export"
+    View     = "view"
+    Lookup   = "lookup"
+    Stats    = "stats"
+    Parse    = "parse"
+    Backfill = "backfill"
+)
+
+/*
+    Time   - When it happened, UTC
+    Actor  - Who did it: a user name, a hashed API token or a client address
+    Action - One of the actions above
+    Target - What it was done to: a path, a query or a function id
+    Detail - Anything else worth keeping, e.g. the number of results
+*/
+type Event struct {
+    Time   time.Time `json:"time"`
+    Actor  string    `json:"actor"`
+    Action string    `json:"action"`
+    Target string    `json:"target"`
+    Detail string    `json:"detail,omitempty"`
+}
+
+/*
+    An audit log file. A nil *Log records nothing, so callers don't need to check
+    whether auditing is on.
+*/
+type Log struct {
+    mu  sync.Mutex
+    f   *os.File
+    enc *json.Encoder
+}
+
+/*
+    Open the log at path for appending, creating it readable by its owner only
+*/
+func Open(path string) (*Log, error) {
+    f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+    if err != nil {
+        return nil, err
+    }
+    return &Log{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+/*
+    Append an event that happened now. Each event is synced to disk before Record
+    returns.
+*/
+func (l *Log) Record(actor string, action string, target string, detail string) error {
+    if l == nil {
+        return nil
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if err := l.enc.Encode(Event{Time: time.Now().UTC(), Actor: actor, Action: action, Target: target, Detail: detail}); err != nil {
+        return err
+    }
+    return l.f.Sync()
+}
+
+func (l *Log) Close() error {
+    if l == nil {
+        return nil
+    }
+    return l.f.Close()
+}
+
+/*
+    Name of the user running the process, for events that don't come from a client
+*/
+func CurrentUser() string {
+    currentOnce.Do(func() {
+        if u, err := user.Current(); err == nil {
+            current = u.Username
+        } else {
+            current = "uid:" + strconv.Itoa(os.Getuid())
+        }
+    })
+    return current
+}
+
+var (
+    currentOnce sync.Once
+    current     string
+)
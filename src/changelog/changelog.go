@@ -0,0 +1,356 @@
+/*
+    changelog.go
+
+    The API changes of every repository between two runs: public functions added,
+    removed, and changed with their old and new signature. Runs record when each function
+    appeared and disappeared, so the functions of any past run are known, and those of the
+    two runs are told apart by package (or file, for languages without packages), class,
+    name and signature. A function only edited inside keeps its signature and isn't a
+    change; one moved to another file of the same package isn't either.
+
+        pakkun -changelog CHANGES.md -since 2026-10-01
+
+    writes it as Markdown, -changelog-format json as JSON for release tooling.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package changelog
+
+import (
+    "docgen"
+    "encoding/json"
+    "fmt"
+    "io"
+    "parse"
+    "sort"
+    "store"
+    "strings"
+)
+
+/*
+    A function added, removed or changed
+
+    Name - Its name, with its package and class if they're known
+    Path - File it's in, or was in if it was removed
+    Line - Line it starts on in that file
+    Old  - Its signature before, empty if it was added
+    New  - Its signature after, empty if it was removed
+*/
+type Change struct {
+    Name string `json:"name"`
+    Path string `json:"path"`
+    Line int    `json:"line,omitempty"`
+    Old  string `json:"old,omitempty"`
+    New  string `json:"new,omitempty"`
+}
+
+type RepoChanges struct {
+    Repo    string   `json:"repo"`
+    Added   []Change `json:"added"`
+    Removed []Change `json:"removed"`
+    Changed []Change `json:"changed"`
+}
+
+/*
+    From  - Run the changes are since
+    To    - Run they're up to, empty for the current functions
+    Repos - Repositories with changes, by name
+*/
+type Changelog struct {
+    From  string        `json:"from"`
+    To    string        `json:"to"`
+    Repos []RepoChanges `json:"repos"`
+}
+
+/*
+    Private - Also list functions that aren't public, see docgen.Public
+*/
+type Options struct {
+    Private bool
+}
+
+// Formats Write can write
+var Formats = []string{"markdown", "json"}
+
+// Repository name of files that weren't read from one
+const localRepo = "local"
+
+/*
+    What tells functions apart between runs: overloads share it and are told apart by
+    their signature
+*/
+type key struct {
+    repo  string
+    scope string
+    class string
+    name  string
+}
+
+type version struct {
+    signature string
+    path      string
+    line      int
+}
+
+/*
+    Collects the functions of both runs, file by file
+*/
+type Builder struct {
+    from   string
+    to     string
+    opts   Options
+    before map[key][]version
+    after  map[key][]version
+}
+
+func NewBuilder(from string, to string, opts Options) *Builder {
+    return &Builder{from: from, to: to, opts: opts, before: map[key][]version{}, after: map[key][]version{}}
+}
+
+/*
+    Add the functions file had in either run
+*/
+func (b *Builder) Add(file parse.File) {
+    repo := file.Repo
+    if repo == "" {
+        repo = localRepo
+    }
+    scope := file.Package
+    if scope == "" {
+        scope = file.Path
+    }
+
+    before := parse.AliveAt(b.from)
+    after  := parse.Alive
+    if b.to != "" {
+        after = parse.AliveAt(b.to)
+    }
+    for _, fn := range file.Funcs {
+        if !b.opts.Private && !docgen.Public(file.Path, fn) {
+            continue
+        }
+        k := key{repo: repo, scope: scope, class: fn.Class, name: fn.Name}
+        v := version{signature: signature(fn), path: file.Path, line: fn.StartLine}
+        if before(fn) {
+            b.before[k] = append(b.before[k], v)
+        }
+        if after(fn) {
+            b.after[k] = append(b.after[k], v)
+        }
+    }
+}
+
+/*
+    The changes between the runs, repositories in order and their changes by name
+*/
+func (b *Builder) Changelog() Changelog {
+    repos := map[string]*RepoChanges{}
+    get   := func(name string) *RepoChanges {
+        if r, ok := repos[name]; ok {
+            return r
+        }
+        repos[name] = &RepoChanges{Repo: name, Added: []Change{}, Removed: []Change{}, Changed: []Change{}}
+        return repos[name]
+    }
+
+    keys := map[key]bool{}
+    for k := range b.before {
+        keys[k] = true
+    }
+    for k := range b.after {
+        keys[k] = true
+    }
+    for k := range keys {
+        removed, added := unmatched(b.before[k], b.after[k])
+        if len(removed) == 0 && len(added) == 0 {
+            continue
+        }
+        r    := get(k.repo)
+        name := qualified(k)
+
+        // Overloads left on both sides are paired in the order they're written
+        for len(removed) > 0 && len(added) > 0 {
+            r.Changed = append(r.Changed, Change{Name: name, Path: added[0].path, Line: added[0].line,
+                                                 Old: removed[0].signature, New: added[0].signature})
+            removed, added = removed[1:], added[1:]
+        }
+        for _, v := range added {
+            r.Added = append(r.Added, Change{Name: name, Path: v.path, Line: v.line, New: v.signature})
+        }
+        for _, v := range removed {
+            r.Removed = append(r.Removed, Change{Name: name, Path: v.path, Line: v.line, Old: v.signature})
+        }
+    }
+
+    log := Changelog{From: b.from, To: b.to, Repos: []RepoChanges{}}
+    for _, r := range repos {
+        for _, changes := range [][]Change{r.Added, r.Removed, r.Changed} {
+            sort.Slice(changes, func(i, j int) bool {
+                a, b := changes[i], changes[j]
+                if a.Name != b.Name {
+                    return a.Name < b.Name
+                }
+                return a.Path < b.Path || (a.Path == b.Path && a.Line < b.Line)
+            })
+        }
+        log.Repos = append(log.Repos, *r)
+    }
+    sort.Slice(log.Repos, func(i, j int) bool { return log.Repos[i].Repo < log.Repos[j].Repo })
+    return log
+}
+
+/*
+    The versions of before whose signature after doesn't have, i.e. removed, and those of
+    after before doesn't have, i.e. added, each in the order they're written
+*/
+func unmatched(before []version, after []version) ([]version, []version) {
+    missing := func(vs []version, others []version) []version {
+        count := map[string]int{}
+        for _, v := range others {
+            count[v.signature]++
+        }
+        left := []version{}
+        for _, v := range vs {
+            if count[v.signature] > 0 {
+                count[v.signature]--
+            } else {
+                left = append(left, v)
+            }
+        }
+        sort.SliceStable(left, func(i, j int) bool {
+            return left[i].path < left[j].path || (left[i].path == left[j].path && left[i].line < left[j].line)
+        })
+        return left
+    }
+    return missing(before, after), missing(after, before)
+}
+
+/*
+    The signature of fn as written, or its header without the opening brace
+*/
+func signature(fn parse.Function) string {
+    if fn.Signature != "" {
+        return fn.Signature
+    }
+    return strings.Join(strings.Fields(strings.TrimSuffix(strings.TrimSpace(fn.Header), "{")), " ")
+}
+
+/*
+    The name of the functions of k with their package and class, e.g. java.util.List.add.
+    Files aren't part of it, they're given apart.
+*/
+func qualified(k key) string {
+    name := k.name
+    if k.class != "" && !strings.HasPrefix(name, k.class+".") {
+        name = k.class + "." + name
+    }
+    if k.scope != "" && !strings.ContainsAny(k.scope, "/\\") {
+        name = k.scope + "." + name
+    }
+    return name
+}
+
+/*
+    The changelog of the functions saved in files between the runs from and to, to empty
+    for the current functions
+*/
+func Generate(files store.Lister, from string, to string, opts Options) (Changelog, error) {
+    b   := NewBuilder(from, to, opts)
+    err := files.Each(func(file parse.File) error {
+        b.Add(file)
+        return nil
+    })
+    if err != nil {
+        return Changelog{}, err
+    }
+    return b.Changelog(), nil
+}
+
+/*
+    Ids of the last n runs saved in runs, the latest first
+*/
+func LastRuns(runs store.RunStore, n int) ([]string, error) {
+    saved, err := runs.Runs(n)
+    if err != nil {
+        return nil, err
+    }
+    ids := []string{}
+    for _, run := range saved {
+        ids = append(ids, run.Id)
+    }
+    return ids, nil
+}
+
+/*
+    Write the changelog to w in a format of Formats
+*/
+func (c Changelog) Write(w io.Writer, format string) error {
+    switch format {
+    case "markdown", "md", "":
+        return c.markdown(w)
+    case "json":
+        out, err := json.MarshalIndent(c, "", "    ")
+        if err != nil {
+            return err
+        }
+        _, err = fmt.Fprintf(w, "%s\n", out)
+        return err
+    }
+    return fmt.Errorf("unknown changelog format %q, expected %s", format, strings.Join(Formats, " or "))
+}
+
+func (c Changelog) markdown(w io.Writer) error {
+    to := c.To
+    if to == "" {
+        to = "now"
+    }
+    fmt.Fprintf(w, "# API changes from %s to %s\n", c.From, to)
+    if len(c.Repos) == 0 {
+        fmt.Fprintf(w, "\nNo public function was added, removed or changed.\n")
+    }
+    for _, r := range c.Repos {
+        fmt.Fprintf(w, "\n## %s\n", r.Repo)
+        sections := []struct {
+            title   string
+            changes []Change
+        }{{"Added", r.Added}, {"Removed", r.Removed}, {"Changed", r.Changed}}
+        for _, section := range sections {
+            if len(section.changes) == 0 {
+                continue
+            }
+            fmt.Fprintf(w, "\n### %s\n\n", section.title)
+            for _, change := range section.changes {
+                fmt.Fprintf(w, "- %s", code(change.Name))
+                switch {
+                case change.Old != "" && change.New != "":
+                    fmt.Fprintf(w, ": %s → %s", code(change.Old), code(change.New))
+                case change.New != "":
+                    fmt.Fprintf(w, ": %s", code(change.New))
+                default:
+                    fmt.Fprintf(w, ": %s", code(change.Old))
+                }
+                fmt.Fprintf(w, " (%s", change.Path)
+                if change.Line > 0 {
+                    fmt.Fprintf(w, ":%d", change.Line)
+                }
+                fmt.Fprintf(w, ")\n")
+            }
+        }
+    }
+    return nil
+}
+
+/*
+    s as Markdown inline code, with a fence longer than any run of backticks in it
+*/
+func code(s string) string {
+    fence := "`"
+    for strings.Contains(s, fence) {
+        fence += "`"
+    }
+    if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+        s = " " + s + " "
+    }
+    return fence + s + fence
+}
@@ -0,0 +1,388 @@
+/*
+    classroom.go
+
+    Education mode: comparing the functions of student submissions to each other, for
+    instructors looking for shared work. Every submission is parsed, its functions are
+    grouped by assignment and name, since students implement the functions the
+    assignment asks for, and each function is compared with the functions of the same
+    name in the other submissions of that assignment, never with the same student's
+    own. Pairs of students are then ranked by how similar their functions are:
+
+        pakkun -classroom submissions/ -classroom-layout assignment/student
+
+    Submissions are directories, or archives, named after their student, in dir itself
+    or in a directory per assignment. Code handed out with the assignment can be given
+    as Starter so what every student was given isn't counted as shared.
+
+    Dependencies:        exuberant ctags
+    Operating systems:   GNU Linux, OS X
+*/
+
+package classroom
+
+import (
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "parse"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// How submissions are laid out in the directory compared
+const (
+    ByStudent    = "student"
+    ByAssignment = "assignment/student"
+)
+
+var Layouts = []string{ByStudent, ByAssignment}
+
+/*
+    Layout    - ByStudent for a directory of submissions of one assignment, ByAssignment
+                for a directory per assignment holding its submissions. ByStudent if empty
+    Extension - Only files ending in it are parsed, e.g. .java
+    Starter   - Directory of the code handed out, "" if there's none. What functions have
+                in common with it isn't counted.
+    MinTokens - Functions shorter than this many tokens are left out, short ones look
+                alike whoever writes them
+    Threshold - Least similarity, 0 to 1, of the functions reported as matching
+    Parse     - Options files are parsed with, on top of every type being desired
+*/
+type Options struct {
+    Layout    string
+    Extension string
+    Starter   string
+    MinTokens int
+    Threshold float64
+    Parse     []parse.Option
+}
+
+/*
+    A function of a submission
+
+    Path - Relative to the directory compared, or to the archive it's in after a colon
+*/
+type Function struct {
+    Name string `json:"name"`
+    Path string `json:"path"`
+    Line int    `json:"line"`
+
+    prints map[uint64]bool
+}
+
+/*
+    Two functions of the same name that look alike
+
+    Similarity - Share of their fingerprints they have in common, 0 to 1
+    Shared     - Fingerprints they have in common
+*/
+type Match struct {
+    Function   string   `json:"function"`
+    A          Function `json:"a"`
+    B          Function `json:"b"`
+    Similarity float64  `json:"similarity"`
+    Shared     int      `json:"shared"`
+}
+
+/*
+    Two students of an assignment
+
+    Score     - Similarity of their most similar functions of each name, averaged over
+                the names both wrote
+    Functions - Names both wrote
+    Matches   - Their functions at least Options.Threshold similar, the most similar first
+*/
+type Pair struct {
+    Assignment string  `json:"assignment,omitempty"`
+    A          string  `json:"a"`
+    B          string  `json:"b"`
+    Score      float64 `json:"score"`
+    Functions  int     `json:"functions"`
+    Matches    []Match `json:"matches"`
+}
+
+/*
+    Submissions - Submissions compared
+    Functions   - Functions compared, after those too short or only handed out
+    Pairs       - Pairs with at least one match, the most similar first
+*/
+type Report struct {
+    Submissions int    `json:"submissions"`
+    Functions   int    `json:"functions"`
+    Pairs       []Pair `json:"pairs"`
+}
+
+/*
+    A submission: the student, the assignment it's for ("" for ByStudent) and where it is
+*/
+type submission struct {
+    Student    string
+    Assignment string
+    Path       string
+}
+
+/*
+    Compare the submissions in dir
+*/
+func Compare(dir string, opts Options) (Report, error) {
+    subs, err := submissions(dir, opts.Layout)
+    if err != nil {
+        return Report{}, err
+    }
+
+    handedOut := map[uint64]bool{}
+    if opts.Starter != "" {
+        funcs, err := functions(opts.Starter, opts.Starter, opts)
+        if err != nil {
+            return Report{}, fmt.Errorf("starter code: %v", err)
+        }
+        for _, fn := range funcs {
+            for h := range fn.prints {
+                handedOut[h] = true
+            }
+        }
+    }
+
+    // Functions of each assignment and name, by student
+    type group map[string][]Function
+    groups := map[string]group{}
+    report := Report{Submissions: len(subs), Pairs: []Pair{}}
+    for _, sub := range subs {
+        funcs, err := functions(sub.Path, dir, opts)
+        if err != nil {
+            log.Printf("failed to read the submission of %s: %v\n", sub.Student, err)
+            continue
+        }
+        for _, fn := range funcs {
+            for h := range fn.prints {
+                if handedOut[h] {
+                    delete(fn.prints, h)
+                }
+            }
+            if len(fn.prints) == 0 {
+                continue
+            }
+            key := sub.Assignment + "\x00" + fn.Name
+            if groups[key] == nil {
+                groups[key] = group{}
+            }
+            groups[key][sub.Student] = append(groups[key][sub.Student], fn)
+            report.Functions++
+        }
+    }
+
+    pairs := map[string]*Pair{}
+    for key, byStudent := range groups {
+        assignment := strings.SplitN(key, "\x00", 2)[0]
+        students   := []string{}
+        for student := range byStudent {
+            students = append(students, student)
+        }
+        sort.Strings(students)
+
+        for i, a := range students {
+            for _, b := range students[i+1:] {
+                best := bestMatch(byStudent[a], byStudent[b])
+                k    := assignment + "\x00" + a + "\x00" + b
+                p, ok := pairs[k]
+                if !ok {
+                    p        = &Pair{Assignment: assignment, A: a, B: b, Matches: []Match{}}
+                    pairs[k] = p
+                }
+                p.Functions++
+                p.Score += best.Similarity
+                if best.Similarity >= opts.Threshold && best.Shared > 0 {
+                    p.Matches = append(p.Matches, best)
+                }
+            }
+        }
+    }
+
+    for _, p := range pairs {
+        if len(p.Matches) == 0 {
+            continue
+        }
+        p.Score /= float64(p.Functions)
+        sort.Slice(p.Matches, func(i, j int) bool {
+            if p.Matches[i].Similarity != p.Matches[j].Similarity {
+                return p.Matches[i].Similarity > p.Matches[j].Similarity
+            }
+            return p.Matches[i].Function < p.Matches[j].Function
+        })
+        report.Pairs = append(report.Pairs, *p)
+    }
+    sort.Slice(report.Pairs, func(i, j int) bool {
+        a, b := report.Pairs[i], report.Pairs[j]
+        switch {
+        case a.Score != b.Score:
+            return a.Score > b.Score
+        case len(a.Matches) != len(b.Matches):
+            return len(a.Matches) > len(b.Matches)
+        case a.Assignment != b.Assignment:
+            return a.Assignment < b.Assignment
+        case a.A != b.A:
+            return a.A < b.A
+        }
+        return a.B < b.B
+    })
+    return report, nil
+}
+
+/*
+    The most similar of the functions of a and b, overloads being the same name
+*/
+func bestMatch(a []Function, b []Function) Match {
+    best := Match{Similarity: -1}
+    for _, fa := range a {
+        for _, fb := range b {
+            sim, shared := similarity(fa.prints, fb.prints)
+            if sim > best.Similarity {
+                best = Match{Function: fa.Name, A: fa, B: fb, Similarity: sim, Shared: shared}
+            }
+        }
+    }
+    return best
+}
+
+/*
+    The submissions in dir, skipping hidden entries and the __MACOSX folders of archives
+    made on a Mac
+*/
+func submissions(dir string, layout string) ([]submission, error) {
+    switch layout {
+    case ByStudent, "":
+        return entries(dir, "")
+    case ByAssignment:
+        assignments, err := ioutil.ReadDir(dir)
+        if err != nil {
+            return nil, err
+        }
+        subs := []submission{}
+        for _, a := range assignments {
+            if !a.IsDir() || ignored(a.Name()) {
+                continue
+            }
+            found, err := entries(filepath.Join(dir, a.Name()), a.Name())
+            if err != nil {
+                return nil, err
+            }
+            subs = append(subs, found...)
+        }
+        return subs, nil
+    }
+    return nil, fmt.Errorf("unknown classroom layout %q, expected %s", layout, strings.Join(Layouts, " or "))
+}
+
+func entries(dir string, assignment string) ([]submission, error) {
+    infos, err := ioutil.ReadDir(dir)
+    if err != nil {
+        return nil, err
+    }
+    subs := []submission{}
+    for _, info := range infos {
+        path := filepath.Join(dir, info.Name())
+        if ignored(info.Name()) || !(info.IsDir() || parse.IsArchive(path)) {
+            continue
+        }
+        student := info.Name()
+        for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+            student = strings.TrimSuffix(student, ext)
+        }
+        subs = append(subs, submission{Student: student, Assignment: assignment, Path: path})
+    }
+    return subs, nil
+}
+
+func ignored(name string) bool {
+    return strings.HasPrefix(name, ".") || name == "__MACOSX"
+}
+
+/*
+    The functions of the files ending in opts.Extension under path, a directory or an
+    archive, with their paths relative to root
+*/
+func functions(path string, root string, opts Options) ([]Function, error) {
+    types   := map[string]bool{parse.AnyType: true}
+    popts   := parse.NewOptions(append([]parse.Option{parse.WithTypes(types), parse.WithSkip(parse.DefaultSkipRules)},
+                                                      opts.Parse...)...)
+    funcs   := []Function{}
+    addFile := func(file parse.File, rel string) {
+        ext := filepath.Ext(file.Path)
+        for _, fn := range file.Funcs {
+            // Build targets, CI scripts and service definitions aren't code a student writes
+            if fn.Kind != "" && fn.Kind != parse.KindConstructor && fn.Kind != parse.KindDestructor {
+                continue
+            }
+            toks := tokens(fn.Source, ext)
+            if len(toks) < opts.MinTokens {
+                continue
+            }
+            funcs = append(funcs, Function{Name: fn.Name, Path: rel, Line: fn.StartLine, prints: fingerprint(toks)})
+        }
+    }
+    // Files of the archive that couldn't be parsed are only logged, as on disk
+    addArchive := func(archive string) {
+        files, err := parse.ParseArchive(archive, opts.Extension, popts)
+        for _, err := range parse.Errors(err) {
+            if !parse.IsSkipped(err) {
+                log.Printf("failed to read archive %s: %v\n", archive, err)
+            }
+        }
+        rel := relative(root, archive)
+        for _, file := range files {
+            addFile(file, rel+":"+file.Path)
+        }
+    }
+
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, err
+    }
+    if !info.IsDir() {
+        addArchive(path)
+        return funcs, nil
+    }
+
+    paths := []string{}
+    err = filepath.Walk(path, func(p string, f os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if p != path && ignored(f.Name()) {
+            if f.IsDir() {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        switch {
+        case f.IsDir():
+        case strings.HasSuffix(p, opts.Extension):
+            paths = append(paths, p)
+        case parse.IsArchive(p):
+            addArchive(p)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    for _, r := range parse.ParseFiles(paths, popts) {
+        if r.Err != nil {
+            if r.Err != parse.ErrNoFuncs && !parse.IsSkipped(r.Err) {
+                log.Printf("failed to parse %s: %v\n", r.Path, r.Err)
+            }
+            continue
+        }
+        addFile(r.File, relative(root, r.Path))
+    }
+    return funcs, nil
+}
+
+func relative(root string, path string) string {
+    if rel, err := filepath.Rel(root, path); err == nil {
+        return filepath.ToSlash(rel)
+    }
+    return path
+}
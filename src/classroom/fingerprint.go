@@ -0,0 +1,188 @@
+/*
+    fingerprint.go
+
+    Fingerprints of function bodies that survive the usual disguises of copied code.
+    Bodies are scanned into tokens with comments and whitespace dropped, identifiers
+    other than keywords become I, numbers N and string literals S, so renaming variables,
+    reformatting or rewording comments changes nothing. The fingerprint is the set of
+    hashes of every run of Shingle tokens, and two bodies are as similar as the share
+    of runs they have in common.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, Erlang, Go, Java, Javascript, Kotlin, Lisp, Lua and Python
+*/
+
+package classroom
+
+import (
+    "hash/fnv"
+    "strings"
+)
+
+// Tokens in each run hashed into a fingerprint
+const Shingle = 5
+
+/*
+    Comment syntax of a language
+
+    Line  - Starts a comment running to the end of the line
+    Block - Opens and closes a block comment, empty if there's none
+    Quote - Single quotes delimit strings or characters, not atoms or quoted forms
+*/
+type syntax struct {
+    Line  string
+    Block [2]string
+    Quote bool
+}
+
+var cSyntax = syntax{Line: "//", Block: [2]string{"/*", "*/"}, Quote: true}
+
+var syntaxes = map[string]syntax{
+    "py":  {Line: "#", Quote: true},
+    "lua": {Line: "--", Block: [2]string{"--[[", "]]"}, Quote: true},
+    "lsp": {Line: ";", Block: [2]string{"#|", "|#"}},
+    "erl": {Line: "%"},
+}
+
+// Keywords of the supported languages, kept as themselves since they carry the structure
+var keywords = map[string]bool{}
+
+func init() {
+    for _, k := range strings.Fields(`if else elif elsif for foreach while do until unless repeat switch case
+            default break continue return goto try catch except finally throw throws raise new delete class
+            struct def function fun lambda yield in is not and or then end local let var const static
+            void true false null nil None True False this self super import from with as pass assert
+            cond defun setq when receive after of begin`) {
+        keywords[k] = true
+    }
+}
+
+/*
+    Tokens of source, a function body written in the language of the extension ext
+*/
+func tokens(source string, ext string) []string {
+    lang, ok := syntaxes[strings.TrimPrefix(ext, ".")]
+    if !ok {
+        lang = cSyntax
+    }
+
+    toks := []string{}
+    for i := 0; i < len(source); {
+        rest := source[i:]
+        c    := source[i]
+        switch {
+        case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+            i++
+        case lang.Block[0] != "" && strings.HasPrefix(rest, lang.Block[0]):
+            i = closing(source, i+len(lang.Block[0]), lang.Block[1])
+        case strings.HasPrefix(rest, lang.Line):
+            if end := strings.IndexByte(rest, '\n'); end >= 0 {
+                i += end
+            } else {
+                i = len(source)
+            }
+        case strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, `'''`):
+            i    = closing(source, i+3, rest[:3])
+            toks = append(toks, "S")
+        case c == '"' || c == '`' || (c == '\'' && lang.Quote):
+            i    = quoted(source, i)
+            toks = append(toks, "S")
+        case isWord(c) && !isDigit(c):
+            end := i
+            for end < len(source) && isWord(source[end]) {
+                end++
+            }
+            if word := source[i:end]; keywords[word] {
+                toks = append(toks, word)
+            } else {
+                toks = append(toks, "I")
+            }
+            i = end
+        case isDigit(c):
+            for i < len(source) && (isWord(source[i]) || source[i] == '.') {
+                i++
+            }
+            toks = append(toks, "N")
+        default:
+            toks = append(toks, string(c))
+            i++
+        }
+    }
+    return toks
+}
+
+func isWord(c byte) bool {
+    return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+    return c >= '0' && c <= '9'
+}
+
+/*
+    Offset just past the first end in source from start, or its length if there's none
+*/
+func closing(source string, start int, end string) int {
+    if j := strings.Index(source[start:], end); j >= 0 {
+        return start + j + len(end)
+    }
+    return len(source)
+}
+
+/*
+    Offset just past the string literal opening at start, which ends at the same quote
+    not escaped, or at the end of the line if it's never closed
+*/
+func quoted(source string, start int) int {
+    quote := source[start]
+    for i := start + 1; i < len(source); i++ {
+        switch source[i] {
+        case '\\':
+            i++
+        case quote:
+            return i + 1
+        case '\n':
+            if quote != '`' {
+                return i
+            }
+        }
+    }
+    return len(source)
+}
+
+/*
+    Hashes of every run of Shingle tokens of toks, or of toks as a whole if it's shorter
+*/
+func fingerprint(toks []string) map[uint64]bool {
+    prints := map[uint64]bool{}
+    for i := 0; i == 0 || i+Shingle <= len(toks); i++ {
+        end := i + Shingle
+        if end > len(toks) {
+            end = len(toks)
+        }
+        h := fnv.New64a()
+        h.Write([]byte(strings.Join(toks[i:end], "\x00")))
+        prints[h.Sum64()] = true
+    }
+    return prints
+}
+
+/*
+    Share of the fingerprints of a and b they have in common, 0 to 1, and how many that is
+*/
+func similarity(a map[uint64]bool, b map[uint64]bool) (float64, int) {
+    if len(a) > len(b) {
+        a, b = b, a
+    }
+    shared := 0
+    for h := range a {
+        if b[h] {
+            shared++
+        }
+    }
+    union := len(a) + len(b) - shared
+    if union == 0 {
+        return 0, 0
+    }
+    return float64(shared) / float64(union), shared
+}
@@ -0,0 +1,54 @@
+/*
+    report.go
+
+    Writing the similarity report: CSV with a row per matching pair of functions, the
+    pairs of students in rank order, for spreadsheets, or the whole Report as JSON.
+*/
+
+package classroom
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+// Formats Write can write
+var Formats = []string{"csv", "json"}
+
+/*
+    Write the report to w in a format of Formats
+*/
+func (r Report) Write(w io.Writer, format string) error {
+    switch format {
+    case "csv", "":
+        return r.csv(w)
+    case "json":
+        enc := json.NewEncoder(w)
+        enc.SetIndent("", "    ")
+        return enc.Encode(r)
+    }
+    return fmt.Errorf("unknown classroom format %q, expected %s", format, strings.Join(Formats, " or "))
+}
+
+func (r Report) csv(w io.Writer) error {
+    out := csv.NewWriter(w)
+    out.Write([]string{"rank", "assignment", "student_a", "student_b", "score", "functions", "function",
+                       "similarity", "path_a", "line_a", "path_b", "line_b"})
+    for i, p := range r.Pairs {
+        for _, m := range p.Matches {
+            out.Write([]string{strconv.Itoa(i + 1), p.Assignment, p.A, p.B, ratio(p.Score), strconv.Itoa(p.Functions),
+                               m.Function, ratio(m.Similarity), m.A.Path, strconv.Itoa(m.A.Line), m.B.Path,
+                               strconv.Itoa(m.B.Line)})
+        }
+    }
+    out.Flush()
+    return out.Error()
+}
+
+func ratio(f float64) string {
+    return strconv.FormatFloat(f, 'f', 3, 64)
+}
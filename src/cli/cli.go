@@ -0,0 +1,300 @@
+/*
+    cli.go
+
+    Shell completions and man pages for pakkun and pakkun-server, generated from their
+    flags so they can't drift from them. Values some flags take, like kinds, languages or
+    collections of the store, are only known at run time: the completion scripts ask the
+    command itself for them with
+
+        pakkun -complete <flag> <word typed so far>
+
+    which Command.Completing answers before the flags are parsed.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package cli
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+)
+
+/*
+    Name        - Name the command is run as, e.g. pakkun
+    Summary     - One line saying what it does, for the man page and zsh
+    Description - Paragraphs about it for the man page, separated by blank lines
+    Flags       - Its flags, usually flag.CommandLine
+    Values      - Values of flags only known at run time, given the word typed so far.
+                  Flags without any complete file names, but for true and false ones
+    ExitCodes   - Exit codes and what they mean, for the man page
+*/
+type Command struct {
+    Name        string
+    Summary     string
+    Description string
+    Flags       *flag.FlagSet
+    Values      map[string]func(word string) []string
+    ExitCodes   []ExitCode
+}
+
+type ExitCode struct {
+    Code    int
+    Meaning string
+}
+
+// Formats Write can generate
+var Formats = []string{"bash", "zsh", "fish", "man"}
+
+/*
+    Write the completion script for a shell of Formats, or the man page, to w
+*/
+func (c Command) Write(w io.Writer, format string) error {
+    switch format {
+    case "bash":
+        return c.bash(w)
+    case "zsh":
+        return c.zsh(w)
+    case "fish":
+        return c.fish(w)
+    case "man":
+        return c.man(w)
+    }
+    return fmt.Errorf("can't generate %q, only %s", format, strings.Join(Formats, ", "))
+}
+
+/*
+    If args ask for completions, i.e. are -complete <flag> [word], write the candidates
+    to w one per line and return true
+*/
+func (c Command) Completing(args []string, w io.Writer) bool {
+    if len(args) < 2 || args[0] != "-complete" {
+        return false
+    }
+    word := ""
+    if len(args) > 2 {
+        word = args[2]
+    }
+    for _, candidate := range c.Complete(strings.TrimLeft(args[1], "-"), word) {
+        fmt.Fprintln(w, candidate)
+    }
+    return true
+}
+
+/*
+    Values of the flag name starting with word. Lists are comma-separated, so only the
+    part after the last comma is completed and the rest kept.
+*/
+func (c Command) Complete(name string, word string) []string {
+    head, last := "", word
+    if i := strings.LastIndex(word, ","); i >= 0 {
+        head, last = word[:i+1], word[i+1:]
+    }
+
+    var values []string
+    if fn, ok := c.Values[name]; ok {
+        values = fn(last)
+    } else if c.isSwitch(name) {
+        values = []string{"true", "false"}
+    }
+
+    candidates := []string{}
+    for _, v := range values {
+        if strings.HasPrefix(v, last) {
+            candidates = append(candidates, head+v)
+        }
+    }
+    sort.Strings(candidates)
+    return candidates
+}
+
+/*
+    True if the values of the flag name are known, false if they're file names
+*/
+func (c Command) completes(name string) bool {
+    _, ok := c.Values[name]
+    return ok || c.isSwitch(name)
+}
+
+/*
+    True for flags taking true or false, declared as strings since pakkun reads its
+    arguments in pairs
+*/
+func (c Command) isSwitch(name string) bool {
+    f := c.Flags.Lookup(name)
+    return f != nil && (f.DefValue == "true" || f.DefValue == "false") && !isBool(f)
+}
+
+/*
+    True for flag.Bool flags, which take no value
+*/
+func isBool(f *flag.Flag) bool {
+    b, ok := f.Value.(interface{ IsBoolFlag() bool })
+    return ok && b.IsBoolFlag()
+}
+
+func (c Command) flags() []*flag.Flag {
+    flags := []*flag.Flag{}
+    c.Flags.VisitAll(func(f *flag.Flag) {
+        flags = append(flags, f)
+    })
+    return flags
+}
+
+func (c Command) bash(w io.Writer) error {
+    fn       := "_" + identifier(c.Name)
+    names    := []string{}
+    dynamic  := []string{}
+    switches := []string{}
+    for _, f := range c.flags() {
+        names = append(names, "-"+f.Name)
+        if isBool(f) {
+            switches = append(switches, "-"+f.Name)
+        } else if c.completes(f.Name) {
+            dynamic = append(dynamic, "-"+f.Name)
+        }
+    }
+
+    fmt.Fprintf(w, "# bash completion for %s, source it or put it in /etc/bash_completion.d\n", c.Name)
+    fmt.Fprintf(w, "%s() {\n", fn)
+    fmt.Fprintf(w, "    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+    fmt.Fprintf(w, "    local IFS=$'\\n'\n")
+    if len(dynamic) > 0 {
+        fmt.Fprintf(w, "    case $prev in\n")
+        fmt.Fprintf(w, "        %s)\n", strings.Join(dynamic, "|"))
+        fmt.Fprintf(w, "            COMPREPLY=($(%s -complete \"${prev#-}\" \"$cur\" 2>/dev/null))\n", c.Name)
+        fmt.Fprintf(w, "            return;;\n")
+        fmt.Fprintf(w, "    esac\n")
+    }
+    if len(switches) > 0 {
+        fmt.Fprintf(w, "    case $prev in %s) ;; -*) COMPREPLY=($(compgen -f -- \"$cur\")); return;; esac\n", strings.Join(switches, "|"))
+    } else {
+        fmt.Fprintf(w, "    if [[ $prev == -* ]]; then COMPREPLY=($(compgen -f -- \"$cur\")); return; fi\n")
+    }
+    fmt.Fprintf(w, "    COMPREPLY=($(IFS=' '; compgen -W '%s' -- \"$cur\"))\n", strings.Join(names, " "))
+    fmt.Fprintf(w, "}\n")
+    _, err := fmt.Fprintf(w, "complete -o filenames -F %s %s\n", fn, c.Name)
+    return err
+}
+
+func (c Command) zsh(w io.Writer) error {
+    fn := "_" + identifier(c.Name)
+    fmt.Fprintf(w, "#compdef %s\n", c.Name)
+    fmt.Fprintf(w, "# zsh completion for %s, put it in a directory of $fpath as %s\n\n", c.Name, fn)
+    fmt.Fprintf(w, "%s() {\n", fn)
+    fmt.Fprintf(w, "    local state\n")
+    fmt.Fprintf(w, "    _arguments")
+    for _, f := range c.flags() {
+        spec := "-" + f.Name + "[" + zshEscape(f.Usage) + "]"
+        switch {
+        case isBool(f):
+        case c.completes(f.Name):
+            spec += ": :->value"
+        default:
+            spec += ": :_files"
+        }
+        fmt.Fprintf(w, " \\\n        '%s'", strings.Replace(spec, "'", `'\''`, -1))
+    }
+    fmt.Fprintf(w, "\n\n")
+    fmt.Fprintf(w, "    if [[ $state == value ]]; then\n")
+    fmt.Fprintf(w, "        local -a values\n")
+    fmt.Fprintf(w, "        values=(${(f)\"$(%s -complete ${words[CURRENT-1]#-} \"$PREFIX\" 2>/dev/null)\"})\n", c.Name)
+    fmt.Fprintf(w, "        compadd -Q -- $values\n")
+    fmt.Fprintf(w, "    fi\n")
+    fmt.Fprintf(w, "}\n\n")
+    _, err := fmt.Fprintf(w, "%s \"$@\"\n", fn)
+    return err
+}
+
+func zshEscape(s string) string {
+    return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func (c Command) fish(w io.Writer) error {
+    fmt.Fprintf(w, "# fish completion for %s, put it in ~/.config/fish/completions/%s.fish\n", c.Name, c.Name)
+    for _, f := range c.flags() {
+        line := fmt.Sprintf("complete -c %s -o %s -d %s", c.Name, f.Name, fishQuote(f.Usage))
+        switch {
+        case isBool(f):
+        case c.completes(f.Name):
+            line += fmt.Sprintf(" -x -a %s", fishQuote(fmt.Sprintf("(%s -complete %s (commandline -ct))", c.Name, f.Name)))
+        default:
+            line += " -r -F"
+        }
+        if _, err := fmt.Fprintln(w, line); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func fishQuote(s string) string {
+    return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func (c Command) man(w io.Writer) error {
+    fmt.Fprintf(w, ".TH %s 1 \"\" \"%s\" \"User Commands\"\n", strings.ToUpper(roff(c.Name)), roff(c.Name))
+    fmt.Fprintf(w, ".SH NAME\n%s \\- %s\n", roff(c.Name), roff(c.Summary))
+    fmt.Fprintf(w, ".SH SYNOPSIS\n.B %s\n[\\fIoptions\\fR]\n", roff(c.Name))
+
+    if c.Description != "" {
+        fmt.Fprintf(w, ".SH DESCRIPTION\n")
+        for i, paragraph := range strings.Split(strings.TrimSpace(c.Description), "\n\n") {
+            if i > 0 {
+                fmt.Fprintf(w, ".PP\n")
+            }
+            fmt.Fprintf(w, "%s\n", roff(strings.Join(strings.Fields(paragraph), " ")))
+        }
+    }
+
+    fmt.Fprintf(w, ".SH OPTIONS\n")
+    for _, f := range c.flags() {
+        fmt.Fprintf(w, ".TP\n")
+        if isBool(f) {
+            fmt.Fprintf(w, ".B \\-%s\n", roff(f.Name))
+        } else {
+            fmt.Fprintf(w, ".BI \\-%s \" value\"\n", roff(f.Name))
+        }
+        usage := f.Usage
+        if f.DefValue != "" && !isBool(f) {
+            usage += fmt.Sprintf(" (default %s)", f.DefValue)
+        }
+        fmt.Fprintf(w, "%s\n", roff(usage))
+    }
+
+    if len(c.ExitCodes) > 0 {
+        fmt.Fprintf(w, ".SH EXIT STATUS\n")
+        for _, code := range c.ExitCodes {
+            fmt.Fprintf(w, ".TP\n.B %d\n%s\n", code.Code, roff(code.Meaning))
+        }
+    }
+    _, err := fmt.Fprintf(w, ".SH SEE ALSO\n.BR ctags (1)\n")
+    return err
+}
+
+/*
+    s escaped for roff, so backslashes, dashes and lines starting with a dot print as
+    they are
+*/
+func roff(s string) string {
+    s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+    if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+        s = `\&` + s
+    }
+    return s
+}
+
+/*
+    name usable as a shell function name, e.g. pakkun_server for pakkun-server
+*/
+func identifier(name string) string {
+    return strings.Map(func(r rune) rune {
+        if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+            return r
+        }
+        return '_'
+    }, name)
+}
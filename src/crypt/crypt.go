@@ -0,0 +1,227 @@
+/*
+    crypt.go
+
+    Encryption at rest of the function bodies pakkun stores, so proprietary source isn't
+    kept in plaintext in the database. Bodies are sealed with AES-GCM and stored as
+
+        enc:<key id>:<base64 of nonce and ciphertext>
+
+    The key id lets keys be rotated: new bodies are sealed with the current key, older
+    ones are opened with the key they were sealed with. Keys come from a KeyProvider,
+    a key file by default. Implement KeyProvider to fetch them from a KMS instead.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package crypt
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "parse"
+    "strconv"
+    "strings"
+)
+
+// Prefix of sealed values
+const prefix = "enc:"
+
+/*
+    Where keys come from. Keys are 16, 24 or 32 bytes long, for AES-128, AES-192 or
+    AES-256.
+*/
+type KeyProvider interface {
+    // Key new values are sealed with, and its id
+    CurrentKey() (string, []byte, error)
+
+    // Key with the given id, to open values sealed before a rotation
+    Key(id string) ([]byte, error)
+}
+
+/*
+    Current - Id of the key new values are sealed with
+    Keys    - Keys by id
+*/
+type Keyring struct {
+    Current string
+    Keys    map[string][]byte
+}
+
+func (k *Keyring) CurrentKey() (string, []byte, error) {
+    key, err := k.Key(k.Current)
+    return k.Current, key, err
+}
+
+func (k *Keyring) Key(id string) ([]byte, error) {
+    key, ok := k.Keys[id]
+    if !ok {
+        return nil, fmt.Errorf("no key %q", id)
+    }
+    return key, nil
+}
+
+/*
+    Load a keyring from a JSON file of base64 keys by id:
+
+        {"current": "2026-10", "keys": {"2026-09": "<base64>", "2026-10": "<base64>"}}
+*/
+func LoadKeyring(path string) (*Keyring, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var file struct {
+        Current string            `json:"current"`
+        Keys    map[string]string `json:"keys"`
+    }
+    if err := json.Unmarshal(data, &file); err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+
+    ring := &Keyring{Current: file.Current, Keys: map[string][]byte{}}
+    for id, encoded := range file.Keys {
+        if strings.Contains(id, ":") {
+            return nil, fmt.Errorf("%s: key id %q can't contain ':'", path, id)
+        }
+        key, err := base64.StdEncoding.DecodeString(encoded)
+        if err != nil {
+            return nil, fmt.Errorf("%s: key %q: %v", path, id, err)
+        }
+        if n := len(key); n != 16 && n != 24 && n != 32 {
+            return nil, fmt.Errorf("%s: key %q is %d bytes, not 16, 24 or 32", path, id, n)
+        }
+        ring.Keys[id] = key
+    }
+    if _, ok := ring.Keys[ring.Current]; !ok {
+        return nil, fmt.Errorf("%s: no key for current id %q", path, ring.Current)
+    }
+    return ring, nil
+}
+
+/*
+    Seals and opens values with the keys of a KeyProvider. A nil *Cipher leaves values
+    as they are, so callers don't need to check whether encryption is on.
+*/
+type Cipher struct {
+    Keys KeyProvider
+}
+
+func New(keys KeyProvider) *Cipher {
+    return &Cipher{Keys: keys}
+}
+
+/*
+    True if s was sealed
+*/
+func IsSealed(s string) bool {
+    return strings.HasPrefix(s, prefix)
+}
+
+/*
+    Encrypt plain with the current key. context is authenticated but not stored, the
+    same context has to be given to Open, so a sealed value can't be moved elsewhere.
+    Empty and already sealed values are returned as they are.
+*/
+func (c *Cipher) Seal(plain string, context string) (string, error) {
+    if c == nil || plain == "" || IsSealed(plain) {
+        return plain, nil
+    }
+
+    id, key, err := c.Keys.CurrentKey()
+    if err != nil {
+        return "", err
+    }
+    aead, err := newAEAD(key)
+    if err != nil {
+        return "", err
+    }
+
+    nonce := make([]byte, aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return "", err
+    }
+    sealed := aead.Seal(nonce, nonce, []byte(plain), []byte(context))
+    return prefix + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+/*
+    Decrypt a value sealed with the same context. Values that aren't sealed, e.g.
+    stored before encryption was turned on, are returned as they are.
+*/
+func (c *Cipher) Open(s string, context string) (string, error) {
+    if c == nil || !IsSealed(s) {
+        return s, nil
+    }
+
+    parts := strings.SplitN(strings.TrimPrefix(s, prefix), ":", 2)
+    if len(parts) != 2 {
+        return "", fmt.Errorf("malformed sealed value")
+    }
+    key, err := c.Keys.Key(parts[0])
+    if err != nil {
+        return "", err
+    }
+    aead, err := newAEAD(key)
+    if err != nil {
+        return "", err
+    }
+
+    sealed, err := base64.StdEncoding.DecodeString(parts[1])
+    if err != nil {
+        return "", err
+    }
+    if len(sealed) < aead.NonceSize() {
+        return "", fmt.Errorf("sealed value too short")
+    }
+    plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(context))
+    if err != nil {
+        return "", fmt.Errorf("key %q: %v", parts[0], err)
+    }
+    return string(plain), nil
+}
+
+/*
+    Seal the source of every function, bound to its id
+*/
+func (c *Cipher) SealFuncs(funcs []parse.Function) error {
+    for i := range funcs {
+        source, err := c.Seal(funcs[i].Source, funcContext(funcs[i]))
+        if err != nil {
+            return fmt.Errorf("function %d: %v", funcs[i].Id, err)
+        }
+        funcs[i].Source = source
+    }
+    return nil
+}
+
+/*
+    Open the source of every function sealed by SealFuncs
+*/
+func (c *Cipher) OpenFuncs(funcs []parse.Function) error {
+    for i := range funcs {
+        source, err := c.Open(funcs[i].Source, funcContext(funcs[i]))
+        if err != nil {
+            return fmt.Errorf("function %d: %v", funcs[i].Id, err)
+        }
+        funcs[i].Source = source
+    }
+    return nil
+}
+
+func funcContext(fn parse.Function) string {
+    return "function " + strconv.FormatUint(uint64(fn.Id), 10)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
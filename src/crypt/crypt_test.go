@@ -0,0 +1,120 @@
+package crypt
+
+import (
+    "bytes"
+    "parse"
+    "strings"
+    "testing"
+)
+
+func testRing() *Keyring {
+    return &Keyring{Current: "k1", Keys: map[string][]byte{
+        "k1": bytes.Repeat([]byte{1}, 16),
+        "k2": bytes.Repeat([]byte{2}, 32),
+    }}
+}
+
+/*
+    Values come back as they were sealed, and only with the context they were sealed with
+*/
+func TestSealOpen(t *testing.T) {
+    c     := New(testRing())
+    tests := []struct {
+        name    string
+        plain   string
+        context string
+        open    string
+        fails   bool
+    }{
+        {"round trip", "int f() { return 1; }", "function 1", "function 1", false},
+        {"unicode", "def f():\n    return \"café\"", "function 2", "function 2", false},
+        {"wrong context", "int f() { return 1; }", "function 1", "function 2", true},
+        {"empty context", "int f() { return 1; }", "function 1", "", true},
+    }
+
+    for _, test := range tests {
+        sealed, err := c.Seal(test.plain, test.context)
+        if err != nil {
+            t.Fatalf("%s: %v", test.name, err)
+        }
+        if !IsSealed(sealed) || strings.Contains(sealed, test.plain) {
+            t.Errorf("%s: %q isn't sealed", test.name, sealed)
+        }
+
+        plain, err := c.Open(sealed, test.open)
+        if test.fails {
+            if err == nil {
+                t.Errorf("%s: opened with the wrong context to %q", test.name, plain)
+            }
+        } else if err != nil || plain != test.plain {
+            t.Errorf("%s: got %q, %v, want %q", test.name, plain, err, test.plain)
+        }
+    }
+}
+
+/*
+    Empty, already sealed and unsealed values are left alone, as is everything with a nil
+    Cipher
+*/
+func TestSealPassThrough(t *testing.T) {
+    c := New(testRing())
+
+    if s, err := c.Seal("", "function 1"); s != "" || err != nil {
+        t.Errorf("sealed the empty string to %q, %v", s, err)
+    }
+    sealed, _ := c.Seal("x", "function 1")
+    if s, err := c.Seal(sealed, "function 1"); s != sealed || err != nil {
+        t.Errorf("sealed a sealed value again to %q, %v", s, err)
+    }
+    if s, err := c.Open("plain", "function 1"); s != "plain" || err != nil {
+        t.Errorf("opened an unsealed value to %q, %v", s, err)
+    }
+
+    var none *Cipher
+    if s, err := none.Seal("x", "function 1"); s != "x" || err != nil {
+        t.Errorf("nil Cipher sealed to %q, %v", s, err)
+    }
+}
+
+/*
+    After the current key changes, values sealed with the old one still open, new ones
+    are sealed with the new one, and values whose key is gone fail
+*/
+func TestKeyRotation(t *testing.T) {
+    ring   := testRing()
+    c      := New(ring)
+    old, _ := c.Seal("old body", "function 1")
+
+    ring.Current = "k2"
+    current, _  := c.Seal("new body", "function 1")
+    if !strings.HasPrefix(current, prefix+"k2:") {
+        t.Errorf("got %q, want it sealed with k2", current)
+    }
+    if plain, err := c.Open(old, "function 1"); err != nil || plain != "old body" {
+        t.Errorf("got %q, %v for a value sealed before the rotation", plain, err)
+    }
+
+    delete(ring.Keys, "k1")
+    if plain, err := c.Open(old, "function 1"); err == nil {
+        t.Errorf("opened a value whose key is gone to %q", plain)
+    }
+    if plain, err := c.Open(current, "function 1"); err != nil || plain != "new body" {
+        t.Errorf("got %q, %v", plain, err)
+    }
+}
+
+/*
+    Function bodies are bound to their function: a body moved to another one doesn't open
+*/
+func TestSealFuncs(t *testing.T) {
+    c     := New(testRing())
+    funcs := []parse.Function{{Id: 1, Source: "a"}, {Id: 2, Source: "b"}}
+    if err := c.SealFuncs(funcs); err != nil {
+        t.Fatal(err)
+    }
+
+    funcs[0].Source, funcs[1].Source = funcs[1].Source, funcs[0].Source
+    if err := c.OpenFuncs(funcs); err == nil {
+        t.Errorf("opened bodies swapped between functions: %q, %q", funcs[0].Source, funcs[1].Source)
+    }
+}
@@ -0,0 +1,209 @@
+/*
+    comment.go
+
+    Doc comments taken apart into their description and block tags, whether Javadoc and
+    JSDoc (@param, @return, @throws), Doxygen (\param), Sphinx (:param x:) or Google
+    style docstrings (Args:, Returns:, Raises:), so they render as parameter and return
+    lists rather than as text.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package docgen
+
+import (
+    "regexp"
+    "strings"
+)
+
+/*
+    A block tag of a doc comment, e.g. @param n the count
+
+    Name - What it's about, e.g. the parameter or exception, or the tag itself, e.g. since,
+           for tags about nothing in particular
+    Text - What it says
+*/
+type Tag struct {
+    Name string
+    Text string
+}
+
+/*
+    Text    - Paragraphs of the description
+    Params  - Parameters, in the order they're documented
+    Returns - What's returned, empty if it isn't documented
+    Throws  - Exceptions and errors raised
+    Tags    - Any other block tags, e.g. since, see or deprecated
+*/
+type Comment struct {
+    Text    []string
+    Params  []Tag
+    Returns string
+    Throws  []Tag
+    Tags    []Tag
+}
+
+// Tags about parameters, the return value and exceptions, by the name each style uses
+var (
+    paramTags  = map[string]bool{"param":true, "arg":true, "argument":true, "parameter":true, "tparam":true}
+    returnTags = map[string]bool{"return":true, "returns":true}
+    throwTags  = map[string]bool{"throws":true, "throw":true, "exception":true, "raise":true, "raises":true}
+
+    // Doxygen tags marking the description itself
+    descriptionTags = map[string]bool{"brief":true, "details":true, "short":true}
+)
+
+// Google style sections and the tag their entries are
+var sections = map[string]string{"args":"param", "arguments":"param", "parameters":"param", "params":"param",
+                                 "returns":"return", "return":"return", "yields":"return",
+                                 "raises":"raises", "throws":"raises"}
+
+var (
+    // @param, \param
+    blockTag = regexp.MustCompile(`^[@\\](\w+)\s*(.*)$`)
+    // :param n: text, :raises ValueError: text
+    sphinxTag = regexp.MustCompile(`^:(\w+)(?:\s+([^:]+))?:\s*(.*)$`)
+    // name (type): text, in a Google style section
+    sectionEntry = regexp.MustCompile(`^(\*{0,2}\w+)\s*(?:\([^)]*\))?\s*:\s*(.*)$`)
+    // {@code x}, {@link x}, {@literal x}
+    inlineTag = regexp.MustCompile(`\{@\w+\s+([^}]*)\}`)
+    // HTML Javadoc is written in, paragraphs and line breaks, and the rest
+    htmlParagraph = regexp.MustCompile(`(?i)</?(?:p|pre|ul|ol)\s*/?>`)
+    htmlBreak     = regexp.MustCompile(`(?i)</?(?:br|li)\s*/?>`)
+    htmlTag       = regexp.MustCompile(`(?i)</?(?:code|tt|b|i|em|strong|var|a(?:\s[^>]*)?)\s*/?>`)
+    // A JSDoc type, @param {number} n
+    jsType = regexp.MustCompile(`^\{[^}]*\}\s*`)
+)
+
+/*
+    Take doc, a Function.Doc, apart
+*/
+func ParseComment(doc string) Comment {
+    var c Comment
+    doc = inlineTag.ReplaceAllString(doc, "$1")
+    doc = htmlParagraph.ReplaceAllString(doc, "\n\n")
+    doc = htmlBreak.ReplaceAllString(doc, "\n")
+    doc = htmlTag.ReplaceAllString(doc, "")
+
+    paragraph    := []string{}
+    endParagraph := func() {
+        if len(paragraph) > 0 {
+            c.Text    = append(c.Text, strings.Join(paragraph, " "))
+            paragraph = nil
+        }
+    }
+
+    // Continuation lines are added to the last tag. Entries of a Google style section are
+    // indented under it, and their continuation lines further still
+    var last *string
+    section, sectionIndent, entryIndent := "", 0, -1
+    for _, raw := range strings.Split(doc, "\n") {
+        line   := strings.TrimSpace(raw)
+        indent := len(raw) - len(strings.TrimLeft(raw, " \t"))
+
+        if section != "" && line != "" && indent <= sectionIndent {
+            section = ""
+        }
+        if tag, ok := sections[strings.ToLower(strings.TrimSuffix(line, ":"))]; ok && strings.HasSuffix(line, ":") {
+            endParagraph()
+            section, sectionIndent, entryIndent, last = tag, indent, -1, nil
+            continue
+        }
+
+        if line == "" {
+            endParagraph()
+            if section == "" {
+                last = nil
+            }
+        } else if section != "" {
+            if entryIndent < 0 {
+                entryIndent = indent
+            }
+            entry := sectionEntry.FindStringSubmatch(line)
+            switch {
+            case indent > entryIndent && last != nil:
+                *last += " " + line
+            case section == "return":
+                last = c.add(section, "", line)
+            case entry != nil:
+                last = c.add(section, entry[1], entry[2])
+            case last != nil:
+                *last += " " + line
+            }
+        } else if m := blockTag.FindStringSubmatch(line); m != nil && descriptionTags[strings.ToLower(m[1])] {
+            paragraph = append(paragraph, m[2])
+        } else if m := blockTag.FindStringSubmatch(line); m != nil {
+            endParagraph()
+            last = c.add(strings.ToLower(m[1]), "", m[2])
+        } else if m := sphinxTag.FindStringSubmatch(line); m != nil {
+            endParagraph()
+            last = c.add(strings.ToLower(m[1]), strings.TrimSpace(m[2]), m[3])
+        } else if last != nil {
+            *last += " " + line
+        } else {
+            paragraph = append(paragraph, line)
+        }
+    }
+    endParagraph()
+    return c
+}
+
+/*
+    Add the tag to c and return its text, for continuation lines. name is what the tag is
+    about if the style gives it apart from the text, e.g. Sphinx, otherwise it's the first
+    word of text.
+*/
+func (c *Comment) add(tag string, name string, text string) *string {
+    text = strings.TrimSpace(text)
+    firstWord := func() {
+        if name != "" {
+            return
+        }
+        text = jsType.ReplaceAllString(text, "")
+        if fields := strings.SplitN(text, " ", 2); len(fields) == 2 {
+            name, text = fields[0], strings.TrimSpace(fields[1])
+        } else {
+            name, text = text, ""
+        }
+    }
+
+    switch {
+    case paramTags[tag]:
+        firstWord()
+        c.Params = append(c.Params, Tag{Name: strings.Trim(name, "[]"), Text: text})
+        return &c.Params[len(c.Params)-1].Text
+    case returnTags[tag]:
+        text = jsType.ReplaceAllString(text, "")
+        if c.Returns != "" {
+            c.Returns += " "
+        }
+        c.Returns += text
+        return &c.Returns
+    case throwTags[tag]:
+        firstWord()
+        c.Throws = append(c.Throws, Tag{Name: name, Text: text})
+        return &c.Throws[len(c.Throws)-1].Text
+    case tag == "type" || tag == "rtype":
+        // Sphinx types, the signature has them
+        return nil
+    }
+    if name != "" {
+        text = strings.TrimSpace(name + " " + text)
+    }
+    c.Tags = append(c.Tags, Tag{Name: tag, Text: text})
+    return &c.Tags[len(c.Tags)-1].Text
+}
+
+/*
+    The first sentence of the description, for lists of functions
+*/
+func (c Comment) Summary() string {
+    if len(c.Text) == 0 {
+        return ""
+    }
+    text := c.Text[0]
+    if i := strings.Index(text, ". "); i >= 0 {
+        return text[:i+1]
+    }
+    return text
+}
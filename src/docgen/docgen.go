@@ -0,0 +1,343 @@
+/*
+    docgen.go
+
+    A static documentation site of the public functions pakkun saved, one part per
+    repository, grouped by package, or by file for languages without packages, and then
+    by class, with the doc comment of every function taken apart into its description,
+    parameters, return value and exceptions. Whatever the language, ctags or the regex
+    fallback found it, so it's a documentation generator for all of them at once:
+
+        pakkun -docgen site
+
+    writes site/index.html, site/<repo>/index.html and a page per package. From Go, Add
+    parsed files to a Site and Write it.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package docgen
+
+import (
+    "fmt"
+    "html/template"
+    "os"
+    "parse"
+    "path/filepath"
+    "sort"
+    "store"
+    "strings"
+    "unicode"
+)
+
+/*
+    Title   - Title of the site's index page
+    Private - Also document functions that aren't public
+*/
+type Options struct {
+    Title   string
+    Private bool
+}
+
+/*
+    What Write wrote
+*/
+type Stats struct {
+    Repos     int `json:"repos"`
+    Pages     int `json:"pages"`
+    Functions int `json:"functions"`
+}
+
+// Repository name of files that weren't read from one
+const localRepo = "local"
+
+/*
+    The functions to document, by repository
+*/
+type Site struct {
+    opts  Options
+    repos map[string]*repo
+}
+
+type repo struct {
+    name   string
+    groups map[string]*group
+}
+
+/*
+    The functions of a package, or of a file when they're in none
+
+    key     - Package, or path of the file
+    file    - key is a path
+    classes - Functions by class, "" for those in none
+*/
+type group struct {
+    key     string
+    file    bool
+    classes map[string][]entry
+}
+
+type entry struct {
+    Function parse.Function
+    Path     string
+    Doc      Comment
+}
+
+func New(opts Options) *Site {
+    if opts.Title == "" {
+        opts.Title = "Documentation"
+    }
+    return &Site{opts: opts, repos: map[string]*repo{}}
+}
+
+/*
+    Add the functions of file to document, the public ones unless Options.Private. Their
+    bodies aren't kept.
+*/
+func (s *Site) Add(file parse.File) {
+    name := file.Repo
+    if name == "" {
+        name = localRepo
+    }
+    r, ok := s.repos[name]
+    if !ok {
+        r             = &repo{name: name, groups: map[string]*group{}}
+        s.repos[name] = r
+    }
+
+    key := file.Package
+    if key == "" {
+        key = file.Path
+    }
+    g, ok := r.groups[key]
+    if !ok {
+        g             = &group{key: key, file: file.Package == "", classes: map[string][]entry{}}
+        r.groups[key] = g
+    }
+
+    for _, fn := range file.FilterFuncs(parse.Alive) {
+        if !s.opts.Private && !Public(file.Path, fn) {
+            continue
+        }
+        fn.Source           = ""
+        g.classes[fn.Class] = append(g.classes[fn.Class], entry{Function: fn, Path: file.Path, Doc: ParseComment(fn.Doc)})
+    }
+}
+
+/*
+    True if fn can be called from outside its file, package or class: declared public
+    or protected, or in languages without such keywords, not static in C, not starting
+    with an underscore in Python or Javascript, and capitalized in Go
+*/
+func Public(path string, fn parse.Function) bool {
+    ext := strings.TrimPrefix(filepath.Ext(path), ".")
+    switch fn.Visibility {
+    case "public", "protected", "protected internal":
+        return true
+    case "":
+    default:
+        return false
+    }
+
+    name := fn.Name
+    if i := strings.LastIndexAny(name, ".:"); i >= 0 {
+        name = name[i+1:]
+    }
+    switch ext {
+    case "java", "cs":
+        // Package private, or private in C#
+        return false
+    case "c", "h":
+        for _, m := range fn.Modifiers {
+            if m == "static" {
+                return false
+            }
+        }
+    case "go":
+        return name != "" && unicode.IsUpper([]rune(name)[0])
+    }
+    return !strings.HasPrefix(name, "_") || (strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__"))
+}
+
+/*
+    Write the site to dir
+*/
+func (s *Site) Write(dir string) (Stats, error) {
+    stats := Stats{}
+    index := indexPage{Title: s.opts.Title}
+    repos := map[string]bool{}
+
+    for _, r := range s.sortedRepos() {
+        page  := repoPage{Title: s.opts.Title, Repo: r.name, Slug: unique(slug(repoPath(r.name)), repos)}
+        names := displayNames(r)
+        files := map[string]bool{"index": true}
+        for _, g := range sortedGroups(r, names) {
+            gp := groupPage{Title: s.opts.Title, Repo: r.name, Name: names[g.key], File: g.file}
+            for _, class := range sortedClasses(g) {
+                entries := g.classes[class]
+                sort.SliceStable(entries, func(i, j int) bool {
+                    a, b := entries[i].Function, entries[j].Function
+                    return a.Name < b.Name || (a.Name == b.Name && a.StartLine < b.StartLine)
+                })
+                gp.Classes    = append(gp.Classes, classSection{Name: class, Entries: entries})
+                gp.Functions += len(entries)
+            }
+            if gp.Functions == 0 {
+                continue
+            }
+            gp.Slug = unique(slug(gp.Name), files)
+
+            if err := render(filepath.Join(dir, page.Slug, gp.Slug+".html"), groupTmpl, gp); err != nil {
+                return stats, err
+            }
+            page.Groups     = append(page.Groups, gp)
+            page.Functions += gp.Functions
+            stats.Pages++
+        }
+        if page.Functions == 0 {
+            continue
+        }
+
+        if err := render(filepath.Join(dir, page.Slug, "index.html"), repoTmpl, page); err != nil {
+            return stats, err
+        }
+        index.Repos      = append(index.Repos, page)
+        stats.Functions += page.Functions
+        stats.Repos++
+        stats.Pages++
+    }
+
+    if err := render(filepath.Join(dir, "index.html"), indexTmpl, index); err != nil {
+        return stats, err
+    }
+    stats.Pages++
+    return stats, nil
+}
+
+/*
+    Document the functions saved in files into dir
+*/
+func Generate(files store.Lister, dir string, opts Options) (Stats, error) {
+    site := New(opts)
+    err  := files.Each(func(file parse.File) error {
+        site.Add(file)
+        return nil
+    })
+    if err != nil {
+        return Stats{}, err
+    }
+    return site.Write(dir)
+}
+
+func (s *Site) sortedRepos() []*repo {
+    repos := []*repo{}
+    for _, r := range s.repos {
+        repos = append(repos, r)
+    }
+    sort.Slice(repos, func(i, j int) bool { return repos[i].name < repos[j].name })
+    return repos
+}
+
+func sortedGroups(r *repo, names map[string]string) []*group {
+    groups := []*group{}
+    for _, g := range r.groups {
+        groups = append(groups, g)
+    }
+    sort.Slice(groups, func(i, j int) bool { return names[groups[i].key] < names[groups[j].key] })
+    return groups
+}
+
+/*
+    Classes of g in order, functions in none first
+*/
+func sortedClasses(g *group) []string {
+    classes := []string{}
+    for class := range g.classes {
+        classes = append(classes, class)
+    }
+    sort.Strings(classes)
+    return classes
+}
+
+/*
+    Names groups of r are shown by: their package, or the path of their file relative to
+    the directory all its files are in
+*/
+func displayNames(r *repo) map[string]string {
+    names := map[string]string{}
+    root  := ""
+    for _, g := range r.groups {
+        if !g.file {
+            continue
+        }
+        dir := filepath.Dir(g.key)
+        if root == "" {
+            root = dir
+        }
+        for root != "." && root != string(filepath.Separator) && !strings.HasPrefix(dir+string(filepath.Separator), root+string(filepath.Separator)) {
+            root = filepath.Dir(root)
+        }
+    }
+    for key, g := range r.groups {
+        names[key] = key
+        if rel, err := filepath.Rel(root, key); g.file && root != "" && err == nil {
+            names[key] = filepath.ToSlash(rel)
+        }
+    }
+    return names
+}
+
+/*
+    name of a repository without its scheme and .git, e.g. github.com/a/b for
+    https://github.com/a/b.git
+*/
+func repoPath(name string) string {
+    if i := strings.Index(name, "://"); i >= 0 {
+        name = name[i+3:]
+    }
+    return strings.TrimSuffix(name, ".git")
+}
+
+/*
+    s usable as a file name: letters, digits, dots, dashes and underscores, the rest
+    turned into underscores
+*/
+func slug(s string) string {
+    s = strings.Map(func(r rune) rune {
+        if r == '.' || r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return r
+        }
+        return '_'
+    }, strings.Trim(s, "/"))
+    if s == "" || strings.HasPrefix(s, ".") {
+        s = "_" + s
+    }
+    return s
+}
+
+/*
+    name, or name with a number after it if it's taken already, e.g. a_b.go from a/b.go
+    and a_b.go both
+*/
+func unique(name string, taken map[string]bool) string {
+    try := name
+    for i := 2; taken[strings.ToLower(try)]; i++ {
+        try = fmt.Sprintf("%s-%d", name, i)
+    }
+    taken[strings.ToLower(try)] = true
+    return try
+}
+
+func render(path string, tmpl *template.Template, data interface{}) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return err
+    }
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    if err := tmpl.Execute(f, data); err != nil {
+        f.Close()
+        return fmt.Errorf("%s: %v", path, err)
+    }
+    return f.Close()
+}
@@ -0,0 +1,144 @@
+/*
+    pages.go
+
+    Templates of the documentation site. Pages link to each other relatively, so the site
+    can be served from anywhere or opened from disk.
+*/
+
+package docgen
+
+import (
+    "fmt"
+    "html/template"
+    "strings"
+)
+
+type indexPage struct {
+    Title string
+    Repos []repoPage
+}
+
+type repoPage struct {
+    Title     string
+    Repo      string
+    Slug      string
+    Groups    []groupPage
+    Functions int
+}
+
+/*
+    Name - Package, or path of the file
+    File - Name is a path
+*/
+type groupPage struct {
+    Title     string
+    Repo      string
+    Name      string
+    Slug      string
+    File      bool
+    Classes   []classSection
+    Functions int
+}
+
+type classSection struct {
+    Name    string
+    Entries []entry
+}
+
+var funcs = template.FuncMap{
+    "anchor": anchor,
+    "join":   strings.Join,
+}
+
+/*
+    Id of the section of a function on its page, its name and the line it's on, since
+    overloads share the name
+*/
+func anchor(e entry) string {
+    return fmt.Sprintf("%s-%d", slug(e.Function.Name), e.Function.StartLine)
+}
+
+/*
+    The header of e as it's shown, its signature as written if it's known
+*/
+func (e entry) Header() string {
+    if e.Function.Signature != "" {
+        return e.Function.Signature
+    }
+    return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(e.Function.Header), "{"))
+}
+
+const layout = `
+{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+    body { font-family: sans-serif; max-width: 960px; margin: 2em auto; }
+    pre  { background: #f6f8fa; padding: 0.8em; white-space: pre-wrap; word-break: break-all; }
+    .path { color: #666; font-size: 0.9em; }
+    .fn { margin-bottom: 2em; }
+    .modifiers { color: #666; }
+    dt { font-family: monospace; }
+    dd { margin-bottom: 0.4em; }
+</style>
+</head>
+<body>
+{{end}}
+{{define "foot"}}<p class="path">Generated by pakkun</p>
+</body>
+</html>
+{{end}}`
+
+var indexTmpl = template.Must(template.New("index").Funcs(funcs).Parse(layout + `
+{{template "head" .}}
+<h1>{{.Title}}</h1>
+{{if not .Repos}}<p>No public functions were found.</p>{{end}}
+<ul>
+{{range .Repos}}<li><a href="{{.Slug}}/index.html">{{.Repo}}</a> <span class="path">{{.Functions}} function(s)</span></li>
+{{end}}</ul>
+{{template "foot"}}`))
+
+var repoTmpl = template.Must(template.New("repo").Funcs(funcs).Parse(layout + `
+{{template "head" .}}
+<p class="path"><a href="../index.html">{{.Title}}</a></p>
+<h1>{{.Repo}}</h1>
+<table>
+{{range .Groups}}<tr>
+    <td><a href="{{.Slug}}.html">{{.Name}}</a></td>
+    <td class="path">{{.Functions}} function(s){{range .Classes}}{{if .Name}}, {{.Name}}{{end}}{{end}}</td>
+</tr>
+{{end}}</table>
+{{template "foot"}}`))
+
+var groupTmpl = template.Must(template.New("group").Funcs(funcs).Parse(layout + `
+{{template "head" .}}
+<p class="path"><a href="../index.html">{{.Title}}</a> / <a href="index.html">{{.Repo}}</a></p>
+<h1>{{if .File}}{{.Name}}{{else}}package {{.Name}}{{end}}</h1>
+{{range .Classes}}
+<ul>
+{{range .Entries}}<li><a href="#{{anchor .}}">{{if .Function.Class}}{{.Function.Class}}.{{end}}{{.Function.Name}}</a>{{with .Doc.Summary}} <span class="path">{{.}}</span>{{end}}</li>
+{{end}}</ul>
+{{end}}
+{{range .Classes}}
+{{if .Name}}<h2>{{.Name}}</h2>{{end}}
+{{range .Entries}}
+<div class="fn" id="{{anchor .}}">
+    <h3>{{.Function.Name}}</h3>
+    <pre>{{.Header}}</pre>
+    <div class="path">{{.Path}}{{if .Function.StartLine}}:{{.Function.StartLine}}{{end}}{{if or .Function.Visibility .Function.Modifiers}} <span class="modifiers">{{.Function.Visibility}} {{join .Function.Modifiers " "}}</span>{{end}}</div>
+    {{range .Doc.Text}}<p>{{.}}</p>
+    {{end}}
+    {{if .Doc.Params}}<h4>Parameters</h4>
+    <dl>{{range .Doc.Params}}<dt>{{.Name}}</dt><dd>{{.Text}}</dd>{{end}}</dl>{{end}}
+    {{if .Doc.Returns}}<h4>Returns</h4>
+    <p>{{.Doc.Returns}}</p>{{end}}
+    {{if .Doc.Throws}}<h4>Throws</h4>
+    <dl>{{range .Doc.Throws}}<dt>{{.Name}}</dt><dd>{{.Text}}</dd>{{end}}</dl>{{end}}
+    {{range .Doc.Tags}}<p><b>{{.Name}}</b> {{.Text}}</p>
+    {{end}}
+</div>
+{{end}}
+{{end}}
+{{template "foot"}}`))
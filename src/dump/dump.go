@@ -0,0 +1,112 @@
+/*
+    dump.go
+
+    Export of the whole corpus as JSON Lines, one function per line. Sorted exports are
+    ordered by repository, path and function id, through an external merge sort, so they
+    are byte for byte reproducible and can be far larger than memory.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package dump
+
+import (
+    "bufio"
+    "crypt"
+    "encoding/json"
+    "fmt"
+    "io"
+    "parse"
+    "store"
+)
+
+/*
+    One line of an export
+*/
+type Record struct {
+    Repo     string         `json:"repo,omitempty"`
+    Commit   string         `json:"commit,omitempty"`
+    Path     string         `json:"path"`
+    Function parse.Function `json:"function"`
+    Part     *Part          `json:"part,omitempty"`
+}
+
+/*
+    Sorted - Order records by repository, path and function id. Otherwise they come in
+             the order of the store, which isn't reproducible
+    Sort   - Memory budget, temporary directory and workers of the sort
+    AsOf   - Run id to export the corpus as of, empty for its current state
+    Cipher - Opens function bodies sealed by search.Encryption, nil if they're stored
+             in plaintext
+    Split  - Split long bodies into overlapping windows, one record each, see split.go
+*/
+type Options struct {
+    Sorted bool
+    Sort   SortOptions
+    AsOf   string
+    Cipher *crypt.Cipher
+    Split  SplitOptions
+}
+
+/*
+    Write every function saved in files to w and return how many records there were
+*/
+func Corpus(files store.Lister, w io.Writer, opts Options) (int, error) {
+    visible := parse.Alive
+    if opts.AsOf != "" {
+        visible = parse.AliveAt(opts.AsOf)
+    }
+
+    var sorter *Sorter
+    out := bufio.NewWriter(w)
+    if opts.Sorted {
+        sorter = NewSorter(opts.Sort)
+        defer sorter.Close()
+    }
+
+    count := 0
+    err   := files.Each(func(file parse.File) error {
+        if err := opts.Cipher.OpenFuncs(file.Funcs); err != nil {
+            return fmt.Errorf("%s: %v", file.Path, err)
+        }
+
+        for _, fn := range file.Funcs {
+            if !visible(fn) {
+                continue
+            }
+            rec := Record{Repo: file.Repo, Commit: file.Commit, Path: file.Path, Function: fn}
+            for _, rec := range split(rec, opts.Split) {
+                line, err := json.Marshal(rec)
+                if err != nil {
+                    return err
+                }
+
+                if sorter != nil {
+                    key := fmt.Sprintf("%s\x00%s\x00%019d", file.Repo, file.Path, fn.Id)
+                    if rec.Part != nil {
+                        key += fmt.Sprintf("\x00%06d", rec.Part.Index)
+                    }
+                    err = sorter.Add(key, line)
+                } else {
+                    out.Write(line)
+                    err = out.WriteByte('\n')
+                }
+                if err != nil {
+                    return err
+                }
+                count++
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return count, err
+    }
+
+    if sorter != nil {
+        if _, err := sorter.WriteTo(out); err != nil {
+            return count, err
+        }
+    }
+    return count, out.Flush()
+}
@@ -0,0 +1,389 @@
+/*
+    sort.go
+
+    External merge sort with bounded memory. Lines are buffered until the memory budget
+    is used up, then the buffer is sorted by a worker and written to a temporary run file
+    while the next one fills. The runs are merged at the end, a few at a time if there
+    are too many to open at once.
+
+    Ties between equal keys are broken by the lines themselves, so the output is the same
+    whatever order lines are added in and however many workers sort them.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package dump
+
+import (
+    "bufio"
+    "bytes"
+    "container/heap"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "runtime"
+    "sort"
+    "sync"
+)
+
+// Runs merged at once, so the number of open files stays bounded
+const fanIn = 64
+
+// Memory budget when none is given
+const defaultMemory = 256 << 20
+
+/*
+    MaxMemory - Bytes of lines held in memory at once, split between the buffer being
+                filled and the ones being sorted. 256 MB if zero
+    TempDir   - Where runs are written, the system temporary directory if empty
+    Workers   - Buffers sorted at once, the number of CPUs if zero
+*/
+type SortOptions struct {
+    MaxMemory int64
+    TempDir   string
+    Workers   int
+}
+
+type item struct {
+    key  string
+    line []byte
+}
+
+func less(a item, b item) bool {
+    if a.key != b.key {
+        return a.key < b.key
+    }
+    return bytes.Compare(a.line, b.line) < 0
+}
+
+/*
+    Sorts lines by key, spilling to disk past the memory budget
+*/
+type Sorter struct {
+    opts  SortOptions
+    limit int64
+    buf   []item
+    size  int64
+    dir   string
+
+    wg    sync.WaitGroup
+    slots chan struct{}
+    mu    sync.Mutex
+    runs  []string
+    err   error
+}
+
+func NewSorter(opts SortOptions) *Sorter {
+    if opts.MaxMemory <= 0 {
+        opts.MaxMemory = defaultMemory
+    }
+    if opts.Workers <= 0 {
+        opts.Workers = runtime.NumCPU()
+    }
+    return &Sorter{
+        opts:  opts,
+        limit: opts.MaxMemory / int64(opts.Workers+1),
+        slots: make(chan struct{}, opts.Workers),
+    }
+}
+
+/*
+    Add a line to be sorted by key. line is copied, it may be reused by the caller.
+*/
+func (s *Sorter) Add(key string, line []byte) error {
+    if err := s.failed(); err != nil {
+        return err
+    }
+
+    s.buf   = append(s.buf, item{key, append([]byte(nil), line...)})
+    s.size += int64(len(key) + len(line))
+    if s.size >= s.limit {
+        return s.spill()
+    }
+    return nil
+}
+
+/*
+    Write every line in order to w, each followed by a newline, and remove the runs.
+    The Sorter can't be used after.
+*/
+func (s *Sorter) WriteTo(w io.Writer) (int64, error) {
+    defer s.Close()
+
+    // Everything fit in memory, no need for the disk
+    if len(s.runs) == 0 {
+        sortItems(s.buf)
+        return writeItems(w, s.buf)
+    }
+
+    if err := s.spill(); err != nil {
+        return 0, err
+    }
+    s.wg.Wait()
+    if err := s.failed(); err != nil {
+        return 0, err
+    }
+
+    runs := s.runs
+    for len(runs) > fanIn {
+        merged := []string{}
+        for i := 0; i < len(runs); i += fanIn {
+            end := i + fanIn
+            if end > len(runs) {
+                end = len(runs)
+            }
+            path, err := s.mergeToRun(runs[i:end])
+            if err != nil {
+                return 0, err
+            }
+            merged = append(merged, path)
+        }
+        runs = merged
+    }
+
+    counter := &countingWriter{w: w}
+    out     := bufio.NewWriter(counter)
+    err     := merge(runs, func(it item) error {
+        out.Write(it.line)
+        return out.WriteByte('\n')
+    })
+    if err == nil {
+        err = out.Flush()
+    }
+    return counter.n, err
+}
+
+/*
+    Hand the buffer to a worker to sort and write as a run
+*/
+func (s *Sorter) spill() error {
+    if len(s.buf) == 0 {
+        return nil
+    }
+    if s.dir == "" {
+        dir, err := ioutil.TempDir(s.opts.TempDir, "pakkun-sort-")
+        if err != nil {
+            return err
+        }
+        s.dir = dir
+    }
+
+    buf := s.buf
+    s.mu.Lock()
+    path  := fmt.Sprintf("%s/run-%06d", s.dir, len(s.runs))
+    s.runs = append(s.runs, path)
+    s.mu.Unlock()
+    s.buf, s.size = nil, 0
+
+    s.slots <- struct{}{}
+    s.wg.Add(1)
+    go func() {
+        defer func() { <-s.slots; s.wg.Done() }()
+        sortItems(buf)
+        if err := writeRun(path, buf); err != nil {
+            s.fail(err)
+        }
+    }()
+    return nil
+}
+
+/*
+    Merge runs into a new run and remove them
+*/
+func (s *Sorter) mergeToRun(runs []string) (string, error) {
+    s.mu.Lock()
+    path  := fmt.Sprintf("%s/run-%06d", s.dir, len(s.runs))
+    s.runs = append(s.runs, path)
+    s.mu.Unlock()
+
+    f, err := os.Create(path)
+    if err != nil {
+        return "", err
+    }
+    out := bufio.NewWriter(f)
+    err  = merge(runs, func(it item) error { return writeItem(out, it) })
+    if err == nil {
+        err = out.Flush()
+    }
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    for _, run := range runs {
+        os.Remove(run)
+    }
+    return path, err
+}
+
+func (s *Sorter) fail(err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.err == nil {
+        s.err = err
+    }
+}
+
+func (s *Sorter) failed() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.err
+}
+
+/*
+    Remove the runs. WriteTo does it, this is for giving up before writing.
+*/
+func (s *Sorter) Close() {
+    s.wg.Wait()
+    if s.dir != "" {
+        os.RemoveAll(s.dir)
+    }
+}
+
+func sortItems(items []item) {
+    sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+}
+
+func writeItems(w io.Writer, items []item) (int64, error) {
+    out := bufio.NewWriter(w)
+    n   := int64(0)
+    for _, it := range items {
+        out.Write(it.line)
+        out.WriteByte('\n')
+        n += int64(len(it.line) + 1)
+    }
+    return n, out.Flush()
+}
+
+/*
+    Runs hold the key and the line of each item, both prefixed with their length
+*/
+func writeRun(path string, items []item) error {
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    out := bufio.NewWriter(f)
+    for _, it := range items {
+        if err = writeItem(out, it); err != nil {
+            break
+        }
+    }
+    if err == nil {
+        err = out.Flush()
+    }
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    return err
+}
+
+func writeItem(w *bufio.Writer, it item) error {
+    var n [binary.MaxVarintLen64]byte
+    w.Write(n[:binary.PutUvarint(n[:], uint64(len(it.key)))])
+    w.WriteString(it.key)
+    w.Write(n[:binary.PutUvarint(n[:], uint64(len(it.line)))])
+    _, err := w.Write(it.line)
+    return err
+}
+
+func readItem(r *bufio.Reader) (item, error) {
+    key, err := readChunk(r)
+    if err != nil {
+        return item{}, err
+    }
+    line, err := readChunk(r)
+    if err == io.EOF {
+        err = io.ErrUnexpectedEOF
+    }
+    return item{string(key), line}, err
+}
+
+func readChunk(r *bufio.Reader) ([]byte, error) {
+    n, err := binary.ReadUvarint(r)
+    if err != nil {
+        return nil, err
+    }
+    chunk := make([]byte, n)
+    _, err = io.ReadFull(r, chunk)
+    return chunk, err
+}
+
+type cursor struct {
+    it   item
+    in   *bufio.Reader
+    file *os.File
+}
+
+type cursors []*cursor
+
+func (c cursors) Len() int            { return len(c) }
+func (c cursors) Less(i, j int) bool  { return less(c[i].it, c[j].it) }
+func (c cursors) Swap(i, j int)       { c[i], c[j] = c[j], c[i] }
+func (c *cursors) Push(x interface{}) { *c = append(*c, x.(*cursor)) }
+func (c *cursors) Pop() interface{} {
+    old  := *c
+    last := old[len(old)-1]
+    *c    = old[:len(old)-1]
+    return last
+}
+
+/*
+    Call emit with the items of the runs in order
+*/
+func merge(runs []string, emit func(item) error) error {
+    h := &cursors{}
+    defer func() {
+        for _, c := range *h {
+            c.file.Close()
+        }
+    }()
+
+    for _, run := range runs {
+        f, err := os.Open(run)
+        if err != nil {
+            return err
+        }
+        c       := &cursor{in: bufio.NewReader(f), file: f}
+        it, err := readItem(c.in)
+        if err == io.EOF {
+            f.Close()
+            continue
+        } else if err != nil {
+            f.Close()
+            return err
+        }
+        c.it = it
+        heap.Push(h, c)
+    }
+
+    for h.Len() > 0 {
+        c := (*h)[0]
+        if err := emit(c.it); err != nil {
+            return err
+        }
+
+        it, err := readItem(c.in)
+        if err == io.EOF {
+            c.file.Close()
+            heap.Pop(h)
+            continue
+        } else if err != nil {
+            return err
+        }
+        c.it = it
+        heap.Fix(h, 0)
+    }
+    return nil
+}
+
+type countingWriter struct {
+    w io.Writer
+    n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+    n, err := c.w.Write(p)
+    c.n   += int64(n)
+    return n, err
+}
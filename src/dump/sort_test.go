@@ -0,0 +1,76 @@
+package dump
+
+import (
+    "bytes"
+    "fmt"
+    "io/ioutil"
+    "math/rand"
+    "os"
+    "sort"
+    "strings"
+    "testing"
+)
+
+/*
+    Lines come out sorted by key, then by line, whether they fit in memory, spill to a
+    few runs, or to more runs than are merged at once, and the runs are removed after
+*/
+func TestSorter(t *testing.T) {
+    tests := []struct {
+        name    string
+        lines   int
+        memory  int64
+        workers int
+        runs    int // Least runs spilled
+    }{
+        {"in memory", 1000, 1 << 20, 2, 0},
+        {"spilled", 1000, 4 << 10, 2, 2},
+        {"one worker", 1000, 4 << 10, 1, 2},
+        {"more runs than fanIn", 5000, 1 << 10, 3, fanIn + 1},
+    }
+
+    for _, test := range tests {
+        dir, err := ioutil.TempDir("", "sort-test-")
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        // Few keys, so ties between equal keys are broken by the lines
+        r     := rand.New(rand.NewSource(1))
+        s     := NewSorter(SortOptions{MaxMemory: test.memory, TempDir: dir, Workers: test.workers})
+        items := []item{}
+        for i := 0; i < test.lines; i++ {
+            it := item{fmt.Sprintf("key%02d", r.Intn(50)), []byte(fmt.Sprintf("line %d", r.Int()))}
+            items = append(items, it)
+            if err := s.Add(it.key, it.line); err != nil {
+                t.Fatalf("%s: %v", test.name, err)
+            }
+        }
+        if len(s.runs) < test.runs || (test.runs == 0 && len(s.runs) > 0) {
+            t.Errorf("%s: spilled %d runs, want %d or more, none if 0", test.name, len(s.runs), test.runs)
+        }
+
+        var out bytes.Buffer
+        n, err := s.WriteTo(&out)
+        if err != nil {
+            t.Fatalf("%s: %v", test.name, err)
+        }
+        if n != int64(out.Len()) {
+            t.Errorf("%s: WriteTo returned %d, wrote %d bytes", test.name, n, out.Len())
+        }
+
+        sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+        want := []string{}
+        for _, it := range items {
+            want = append(want, string(it.line))
+        }
+        if out.String() != strings.Join(want, "\n")+"\n" {
+            t.Errorf("%s: lines out of order", test.name)
+        }
+
+        if left, _ := ioutil.ReadDir(dir); len(left) > 0 {
+            t.Errorf("%s: %d files left in the temporary directory", test.name, len(left))
+        }
+        os.RemoveAll(dir)
+    }
+}
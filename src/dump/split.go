@@ -0,0 +1,112 @@
+/*
+    split.go
+
+    Splitting of long function bodies into overlapping windows, for models with a context
+    limit. Windows end on a line break where there is one in their second half, so lines
+    are only cut when they're longer than half a window. The same body is always split
+    the same way.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package dump
+
+import (
+    "strings"
+    "unicode/utf8"
+)
+
+/*
+    MaxBytes - Longest window, bodies up to this long aren't split. 0 to never split
+    Overlap  - Bytes each window repeats from the end of the previous one, at most half
+               of MaxBytes
+*/
+type SplitOptions struct {
+    MaxBytes int
+    Overlap  int
+}
+
+/*
+    Where a window is in the body it was cut from
+
+    Index  - Position of the window, from 0
+    Count  - Number of windows of the body
+    Parent - Id of the function the body belongs to. Windows keep it as their Function.Id
+    Start  - Byte offset of the window in the body
+    End    - Byte offset just past the window
+*/
+type Part struct {
+    Index  int    `json:"index"`
+    Count  int    `json:"count"`
+    Parent uint64 `json:"parent"`
+    Start  int    `json:"start"`
+    End    int    `json:"end"`
+}
+
+/*
+    Byte ranges of the windows of s, nil if it fits in one
+*/
+func windows(s string, opts SplitOptions) [][2]int {
+    max, overlap := opts.MaxBytes, opts.Overlap
+    if max <= 0 || len(s) <= max {
+        return nil
+    }
+    if overlap > max/2 {
+        overlap = max/2
+    }
+    if overlap < 0 {
+        overlap = 0
+    }
+
+    spans := [][2]int{}
+    for start := 0; ; {
+        end := start + max
+        if end >= len(s) {
+            return append(spans, [2]int{start, len(s)})
+        }
+
+        half := start + max/2
+        if nl := strings.LastIndexByte(s[half:end], '\n'); nl >= 0 {
+            end = half + nl + 1
+        } else {
+            for end > half && !utf8.RuneStart(s[end]) {
+                end--
+            }
+        }
+        spans = append(spans, [2]int{start, end})
+
+        // The next window starts on a line in the overlap if there is one
+        next := end - overlap
+        if nl := strings.IndexByte(s[next:end], '\n'); overlap > 0 && nl >= 0 && next+nl+1 < end {
+            next += nl + 1
+        }
+        for next > start && next < end && !utf8.RuneStart(s[next]) {
+            next--
+        }
+        if next <= start {
+            next = end
+        }
+        start = next
+    }
+}
+
+/*
+    rec split into one record per window of its function body, or just rec if the body fits
+    in one. Highlights cover the whole body, windows don't keep them.
+*/
+func split(rec Record, opts SplitOptions) []Record {
+    spans := windows(rec.Function.Source, opts)
+    if spans == nil {
+        return []Record{rec}
+    }
+
+    records := make([]Record, len(spans))
+    for i, span := range spans {
+        part                    := rec
+        part.Function.Source     = rec.Function.Source[span[0]:span[1]]
+        part.Function.Highlights = nil
+        part.Part                = &Part{Index: i, Count: len(spans), Parent: rec.Function.Id, Start: span[0], End: span[1]}
+        records[i]               = part
+    }
+    return records
+}
@@ -0,0 +1,167 @@
+/*
+    gitsrc.go
+
+    Parsing of git repositories at a specific commit, for reproducible indexing of
+    open-source corpora. Files are read through git plumbing, so the working tree is
+    never checked out or modified.
+
+    Dependencies:        git, exuberant ctags
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, Erlang, Lisp, Lua, Java, Javascript, and Python
+*/
+
+package gitsrc
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os/exec"
+    "parse"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+/*
+    Longest a clone may take, or the archive of a tree being parsed, after which git is
+    killed. Other git commands get parse.CommandTimeout.
+*/
+var Timeout = time.Hour
+
+/*
+    Dir - Path to the repository (bare or not)
+    URL - Remote the repository was cloned from, empty for purely local repositories
+*/
+type Repo struct {
+    Dir string
+    URL string
+}
+
+/*
+    Open an existing repository
+*/
+func Open(dir string) (*Repo, error) {
+    repo := &Repo{Dir: dir}
+    if _, err := repo.git("rev-parse", "--git-dir"); err != nil {
+        return nil, err
+    }
+
+    // No origin is fine, the URL is only informative
+    url, _  := repo.git("config", "--get", "remote.origin.url")
+    repo.URL = url
+    return repo, nil
+}
+
+/*
+    Clone url into dir and return the repository. The clone is bare since files are read
+    through plumbing. If dir is empty, a temporary directory is used and the caller is
+    responsible for removing it.
+*/
+func Clone(url string, dir string) (*Repo, error) {
+    if dir == "" {
+        tmp, err := ioutil.TempDir("", "pakkun-git-")
+        if err != nil {
+            return nil, err
+        }
+        dir = tmp
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+    defer cancel()
+    if _, err := (&Repo{}).gitContext(ctx, "clone", "--bare", "--quiet", url, dir); err != nil {
+        return nil, err
+    }
+    return &Repo{Dir: dir, URL: url}, nil
+}
+
+/*
+    Return the full commit SHA ref points to
+*/
+func (r *Repo) Resolve(ref string) (string, error) {
+    return r.git("rev-parse", "--verify", ref+"^{commit}")
+}
+
+/*
+    Parse every file ending in extension in the tree of ref with opts. Each File records
+    the repository URL, or its directory without one, and the commit SHA it was read at,
+    and its Id covers the repository. As with parse.ParseTar, files are returned even
+    with an error, which joins those of the files that couldn't be parsed.
+*/
+func (r *Repo) Parse(ref string, extension string, opts parse.Options) ([]parse.File, error) {
+    sha, err := r.Resolve(ref)
+    if err != nil {
+        return nil, err
+    }
+
+    // Stream the tree as a tar archive straight into the parser
+    ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+    defer cancel()
+    archive          := exec.CommandContext(ctx, "git", "-C", r.Dir, "archive", "--format=tar", sha)
+    archive.WaitDelay = time.Second
+    parse.KillGroup(archive)
+    stdout, err      := archive.StdoutPipe()
+    if err != nil {
+        return nil, err
+    }
+    var stderr bytes.Buffer
+    archive.Stderr = &stderr
+
+    if err := archive.Start(); err != nil {
+        return nil, err
+    }
+
+    // git is always waited on, once it has written the rest of the archive nobody reads
+    files, perr := parse.ParseTar(stdout, extension, opts)
+    io.Copy(ioutil.Discard, stdout)
+    if err := archive.Wait(); err != nil {
+        if ctx.Err() == context.DeadlineExceeded {
+            err = fmt.Errorf("git archive %s: killed after %v", sha, Timeout)
+        } else {
+            err = fmt.Errorf("git archive %s: %v: %s", sha, err, strings.TrimSpace(stderr.String()))
+        }
+        perr = errors.Join(perr, err)
+    }
+
+    repo := r.URL
+    if repo == "" {
+        repo, _ = filepath.Abs(r.Dir)
+    }
+    for i := range files {
+        files[i].Repo   = repo
+        files[i].Commit = sha
+        files[i].Id     = parse.FileId(files[i], opts.IdHash)
+    }
+    return files, perr
+}
+
+/*
+    The content of the file at path in the tree of commit
+*/
+func (r *Repo) ReadFile(commit string, path string) ([]byte, error) {
+    return parse.RunCommand(context.Background(), nil, "git", "-C", r.Dir, "show", commit+":"+path)
+}
+
+/*
+    Run a git command in the repository and return its trimmed output
+*/
+func (r *Repo) git(args ...string) (string, error) {
+    return r.gitContext(context.Background(), args...)
+}
+
+/*
+    git, killed when ctx is done, see parse.RunCommand
+*/
+func (r *Repo) gitContext(ctx context.Context, args ...string) (string, error) {
+    if r.Dir != "" {
+        args = append([]string{"-C", r.Dir}, args...)
+    }
+    out, err := parse.RunCommand(ctx, nil, "git", args...)
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimSpace(string(out)), nil
+}
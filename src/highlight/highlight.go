@@ -0,0 +1,57 @@
+/*
+    highlight.go
+
+    Syntax highlighting metadata for extracted functions, so UIs and reports can
+    render colored code without lexing it again.
+
+    Dependencies:        chroma (https://github.com/alecthomas/chroma)
+    Operating systems:   GNU Linux, OS X
+*/
+
+package highlight
+
+import (
+    "parse"
+    "github.com/alecthomas/chroma"
+    "github.com/alecthomas/chroma/lexers"
+)
+
+/*
+    Attach highlight spans to every function in the file. The lexer is picked from the
+    file name. Returns false if no lexer matches, in which case the file is left as is.
+*/
+func File(f *parse.File) bool {
+    lexer := lexers.Match(f.Name)
+    if lexer == nil {
+        return false
+    }
+    lexer = chroma.Coalesce(lexer)
+
+    for i := range f.Funcs {
+        f.Funcs[i].Highlights = Spans(lexer, f.Funcs[i].Source)
+    }
+    return true
+}
+
+/*
+    Lex src and return the byte span and token type of every token. Plain text and
+    whitespace are left out since there's nothing to color.
+*/
+func Spans(lexer chroma.Lexer, src string) []parse.Span {
+    spans := []parse.Span{}
+
+    it, err := lexer.Tokenise(nil, src)
+    if err != nil {
+        return spans
+    }
+
+    offset := 0
+    for _, token := range it.Tokens() {
+        end := offset + len(token.Value)
+        if token.Type != chroma.Text && token.Type != chroma.Whitespace {
+            spans = append(spans, parse.Span{Start: offset, End: end, Type: token.Type.String()})
+        }
+        offset = end
+    }
+    return spans
+}
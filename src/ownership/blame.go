@@ -0,0 +1,210 @@
+/*
+    blame.go
+
+    Who wrote each line of a file and when, from git blame, and which team owns it, from
+    the CODEOWNERS file of its repository. Files are blamed in the work tree they're in,
+    or at the commit they were read at for repositories with a clone given in
+    Options.Clones.
+
+    Dependencies:        git
+    Operating systems:   GNU Linux, OS X
+*/
+
+package ownership
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "io/ioutil"
+    "parse"
+    "path"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+/*
+    The author of a line
+
+    Author - Name, "Not Committed Yet" for lines changed since the last commit
+    Email  - Address, without the angle brackets
+    Time   - When the line was last changed
+*/
+type Line struct {
+    Author string
+    Email  string
+    Time   time.Time
+}
+
+/*
+    A git tree files are blamed in: a work tree if Rev is empty, or a commit of the
+    repository at Dir
+*/
+type tree struct {
+    Dir string
+    Rev string
+}
+
+/*
+    The work tree the file at path is in, false if it's in none
+*/
+func workTree(path string) (tree, bool) {
+    out, err := git(filepath.Dir(path), "rev-parse", "--show-toplevel")
+    if err != nil {
+        return tree{}, false
+    }
+    return tree{Dir: strings.TrimSpace(string(out))}, true
+}
+
+/*
+    The lines of the file at path, relative to the root of t
+*/
+func (t tree) blame(path string) ([]Line, error) {
+    args := []string{"blame", "--line-porcelain"}
+    if t.Rev != "" {
+        args = append(args, t.Rev)
+    }
+    out, err := git(t.Dir, append(args, "--", path)...)
+    if err != nil {
+        return nil, err
+    }
+    return parseBlame(out), nil
+}
+
+/*
+    The file at path, relative to the root of t
+*/
+func (t tree) read(path string) ([]byte, error) {
+    if t.Rev == "" {
+        return ioutil.ReadFile(filepath.Join(t.Dir, filepath.FromSlash(path)))
+    }
+    return git(t.Dir, "show", t.Rev+":"+path)
+}
+
+/*
+    Parse git blame --line-porcelain, which repeats the headers of the commit of every
+    line before the line itself:
+
+        <sha> <line before> <line now>
+        author Ada Lovelace
+        author-mail <ada@example.com>
+        author-time 1760572800
+        ...
+        <tab>the line
+*/
+func parseBlame(out []byte) []Line {
+    lines := []Line{}
+    var line Line
+    buff := bufio.NewScanner(bytes.NewReader(out))
+    buff.Buffer(nil, 1024*1024)
+    for buff.Scan() {
+        text := buff.Text()
+        switch {
+        case strings.HasPrefix(text, "\t"):
+            lines = append(lines, line)
+            line  = Line{}
+        case strings.HasPrefix(text, "author "):
+            line.Author = strings.TrimPrefix(text, "author ")
+        case strings.HasPrefix(text, "author-mail "):
+            line.Email = strings.Trim(strings.TrimPrefix(text, "author-mail "), "<>")
+        case strings.HasPrefix(text, "author-time "):
+            if sec, err := strconv.ParseInt(strings.TrimPrefix(text, "author-time "), 10, 64); err == nil {
+                line.Time = time.Unix(sec, 0).UTC()
+            }
+        }
+    }
+    return lines
+}
+
+/*
+    One line of a CODEOWNERS file: the files matching Pattern are owned by Owners,
+    teams (@org/team), users (@user) or email addresses
+*/
+type rule struct {
+    Pattern string
+    Owners  []string
+}
+
+// Where GitHub and GitLab look for it, in order
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+/*
+    The rules of the CODEOWNERS file of t, none if it has none
+*/
+func (t tree) codeowners() []rule {
+    for _, p := range codeownersPaths {
+        if content, err := t.read(p); err == nil {
+            return parseCodeowners(content)
+        }
+    }
+    return nil
+}
+
+func parseCodeowners(content []byte) []rule {
+    rules := []rule{}
+    for _, line := range strings.Split(string(content), "\n") {
+        if i := strings.Index(line, "#"); i >= 0 {
+            line = line[:i]
+        }
+        fields := strings.Fields(line)
+        // GitLab sections, [Docs], and patterns without owners own nothing
+        if len(fields) < 2 || strings.HasPrefix(fields[0], "[") {
+            continue
+        }
+        rules = append(rules, rule{Pattern: fields[0], Owners: fields[1:]})
+    }
+    return rules
+}
+
+/*
+    Owners of the file at path, relative to the root of its repository, by the last
+    rule matching it as in .gitignore: a pattern with a slash other than at its end is
+    relative to the root, one without matches at any depth, and one matching a
+    directory owns everything under it
+*/
+func owners(rules []rule, file string) []string {
+    for i := len(rules) - 1; i >= 0; i-- {
+        if matches(rules[i].Pattern, file) {
+            return rules[i].Owners
+        }
+    }
+    return nil
+}
+
+func matches(pattern string, file string) bool {
+    dir      := strings.HasSuffix(pattern, "/")
+    pattern   = strings.TrimSuffix(pattern, "/")
+    anchored := strings.Contains(pattern, "/") && !strings.HasPrefix(pattern, "**/")
+    pattern   = strings.TrimPrefix(strings.TrimPrefix(pattern, "**/"), "/")
+    if pattern == "" {
+        return true
+    }
+    // Any number of directories is approximated by none
+    pattern = strings.Replace(pattern, "/**/", "/", -1)
+
+    parts := strings.Split(file, "/")
+    for start := range parts {
+        if anchored && start > 0 {
+            break
+        }
+        // The pattern may match the file itself or any directory it's under
+        for end := start + 1; end <= len(parts); end++ {
+            if dir && end == len(parts) {
+                break
+            }
+            if ok, _ := path.Match(pattern, strings.Join(parts[start:end], "/")); ok {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+/*
+    Run git in dir, killed after parse.CommandTimeout, and return its output
+*/
+func git(dir string, args ...string) ([]byte, error) {
+    return parse.RunCommand(context.Background(), nil, "git", append([]string{"-C", dir}, args...)...)
+}
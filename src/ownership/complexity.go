@@ -0,0 +1,119 @@
+/*
+    complexity.go
+
+    Cyclomatic complexity of a function body: one, plus one for every branch, loop,
+    case, handler and short-circuit operator in it. Comments and string literals are
+    blanked out first, so an "if" in either isn't counted.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, Erlang, Go, Java, Javascript, Kotlin, Lisp, Lua and Python
+*/
+
+package ownership
+
+import (
+    "regexp"
+    "strings"
+)
+
+// Keywords and operators that add a path through a function
+var decisions = regexp.MustCompile(`\b(?:if|elif|elsif|for|foreach|while|until|unless|case|catch|except|when|and|or|cond)\b|&&|\|\|`)
+
+/*
+    Comment syntax of a language
+
+    Line  - Starts a comment running to the end of the line
+    Block - Opens and closes a block comment, empty if there's none
+    Quote - Single quotes delimit strings or characters, not atoms or quoted forms
+*/
+type syntax struct {
+    Line  string
+    Block [2]string
+    Quote bool
+}
+
+var cSyntax = syntax{Line: "//", Block: [2]string{"/*", "*/"}, Quote: true}
+
+var syntaxes = map[string]syntax{
+    "py":  {Line: "#", Quote: true},
+    "lua": {Line: "--", Block: [2]string{"--[[", "]]"}, Quote: true},
+    "lsp": {Line: ";", Block: [2]string{"#|", "|#"}},
+    "erl": {Line: "%"},
+}
+
+/*
+    Cyclomatic complexity of source, the body of a function written in the language of
+    the extension ext
+*/
+func Complexity(source string, ext string) int {
+    return 1 + len(decisions.FindAllStringIndex(code(source, ext), -1))
+}
+
+/*
+    source with its comments and string literals turned into spaces
+*/
+func code(source string, ext string) string {
+    lang, ok := syntaxes[strings.TrimPrefix(ext, ".")]
+    if !ok {
+        lang = cSyntax
+    }
+
+    out := []byte(source)
+    for i := 0; i < len(out); {
+        end := i
+        switch rest := source[i:]; {
+        case lang.Block[0] != "" && strings.HasPrefix(rest, lang.Block[0]):
+            end = closing(source, i+len(lang.Block[0]), lang.Block[1])
+        case strings.HasPrefix(rest, lang.Line):
+            if end = strings.IndexByte(rest, '\n'); end < 0 {
+                end = len(source)
+            } else {
+                end += i
+            }
+        case strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, `'''`):
+            end = closing(source, i+3, rest[:3])
+        case rest[0] == '"' || rest[0] == '`' || (rest[0] == '\'' && lang.Quote):
+            end = quoted(source, i)
+        default:
+            i++
+            continue
+        }
+        for ; i < end; i++ {
+            if out[i] != '\n' {
+                out[i] = ' '
+            }
+        }
+    }
+    return string(out)
+}
+
+/*
+    Offset just past the first end in source from start, or its length if there's none
+*/
+func closing(source string, start int, end string) int {
+    if j := strings.Index(source[start:], end); j >= 0 {
+        return start + j + len(end)
+    }
+    return len(source)
+}
+
+/*
+    Offset just past the string literal opening at start, which ends at the same quote
+    not escaped, or at the end of the line if it's never closed
+*/
+func quoted(source string, start int) int {
+    quote := source[start]
+    for i := start + 1; i < len(source); i++ {
+        switch source[i] {
+        case '\\':
+            i++
+        case quote:
+            return i + 1
+        case '\n':
+            if quote != '`' {
+                return i
+            }
+        }
+    }
+    return len(source)
+}
@@ -0,0 +1,348 @@
+/*
+    ownership.go
+
+    Who owns the functions pakkun saved, how complex they are and how long ago they were
+    last changed, to decide what to refactor first and who to ask about it. Every
+    function is attributed to the author of most of its lines by git blame, and to the
+    team owning its file by CODEOWNERS. Owners are summed up by team and author, with
+    the complexity of their functions spread over how old they are, the heatmap:
+
+        pakkun -ownership owners.html -ownership-format html
+
+    Files are blamed as their work tree is when the report is made. Those that can't be
+    blamed, outside of any repository, are dated by the run that first saved their
+    functions and owned by no one.
+
+    Dependencies:        git
+    Operating systems:   GNU Linux, OS X
+*/
+
+package ownership
+
+import (
+    "crypt"
+    "fmt"
+    "parse"
+    "path/filepath"
+    "sort"
+    "store"
+    "strings"
+    "time"
+    "utils"
+)
+
+// Author and team of functions that have none
+const (
+    Unknown = "unknown"
+    Unowned = "unowned"
+)
+
+/*
+    Now    - Ages are counted up to it, the time the report is made if zero
+    Clones - Local clone of each repository URL, so files read at a commit of it are
+             blamed at that commit. Files of other repositories are blamed where they are.
+    Cipher - Opens function bodies sealed by search.Encryption, nil if they're stored
+             in the clear
+*/
+type Options struct {
+    Now    time.Time
+    Clones map[string]string
+    Cipher *crypt.Cipher
+}
+
+/*
+    A function and its owner
+
+    Function   - Its name, with its class if it has one
+    Lines      - Lines it spans
+    Team       - Owners of its file by CODEOWNERS, separated by spaces
+    Complexity - Cyclomatic complexity, see Complexity
+    Changed    - When its last line to change did, zero if it's not known
+    Age        - Days since Changed, -1 if it's not known
+*/
+type Row struct {
+    Repo       string    `json:"repo"`
+    Path       string    `json:"path"`
+    Function   string    `json:"function"`
+    Line       int       `json:"line"`
+    Lines      int       `json:"lines"`
+    Author     string    `json:"author"`
+    Email      string    `json:"email,omitempty"`
+    Team       string    `json:"team"`
+    Complexity int       `json:"complexity"`
+    Changed    time.Time `json:"changed"`
+    Age        int       `json:"age"`
+}
+
+/*
+    Ages functions are grouped by in the heatmap, up to Days old. The last has no limit.
+*/
+type Bucket struct {
+    Name string
+    Days int
+}
+
+var Buckets = []Bucket{
+    {Name: "under a month", Days: 30},
+    {Name: "1 to 6 months", Days: 182},
+    {Name: "6 to 12 months", Days: 365},
+    {Name: "1 to 2 years", Days: 730},
+    {Name: "over 2 years", Days: 0},
+}
+
+/*
+    What an author owns in a team
+
+    Complexity - Summed over their functions
+    Max        - Of their most complex function
+    Heat       - Complexity of their functions by Buckets, then functions of unknown age
+*/
+type Owner struct {
+    Team       string `json:"team"`
+    Author     string `json:"author"`
+    Email      string `json:"email,omitempty"`
+    Functions  int    `json:"functions"`
+    Lines      int    `json:"lines"`
+    Complexity int    `json:"complexity"`
+    Max        int    `json:"max"`
+    Heat       []int  `json:"heat"`
+}
+
+/*
+    Rows   - Functions, the most complex first
+    Owners - The most complex code first
+*/
+type Report struct {
+    Generated time.Time `json:"generated"`
+    Rows      []Row     `json:"rows"`
+    Owners    []Owner   `json:"owners"`
+}
+
+/*
+    Collects the functions of the report, file by file
+*/
+type Builder struct {
+    opts  Options
+    rows  []Row
+    trees map[string]*tree
+    rules map[tree][]rule
+}
+
+func NewBuilder(opts Options) *Builder {
+    if opts.Now.IsZero() {
+        opts.Now = time.Now().UTC()
+    }
+    return &Builder{opts: opts, trees: map[string]*tree{}, rules: map[tree][]rule{}}
+}
+
+/*
+    Add the current functions of file, blaming it to find their owners
+*/
+func (b *Builder) Add(file parse.File) {
+    funcs := file.FilterFuncs(parse.Alive)
+    if len(funcs) == 0 {
+        return
+    }
+
+    var lines []Line
+    team := Unowned
+    if t, path, ok := b.locate(file); ok {
+        lines, _ = t.blame(path)
+        if names := owners(b.codeowners(t), path); len(names) > 0 {
+            team = strings.Join(names, " ")
+        }
+    }
+
+    ext := filepath.Ext(file.Path)
+    for _, fn := range funcs {
+        end := fn.EndLine
+        if end < fn.StartLine {
+            end = fn.StartLine + strings.Count(strings.TrimRight(fn.Source, "\n"), "\n")
+        }
+        row := Row{Repo: file.Repo, Path: file.Path, Function: fn.Name, Line: fn.StartLine,
+                   Lines: end - fn.StartLine + 1, Team: team, Complexity: Complexity(fn.Source, ext), Age: -1}
+        if fn.Class != "" && !strings.HasPrefix(fn.Name, fn.Class+".") {
+            row.Function = fn.Class + "." + fn.Name
+        }
+
+        if fn.StartLine > 0 && end <= len(lines) {
+            row.Author, row.Email, row.Changed = author(lines[fn.StartLine-1:end])
+        } else {
+            row.Author = Unknown
+            if added, err := utils.RunTime(fn.AddedIn); err == nil {
+                row.Changed = added
+            }
+        }
+        if !row.Changed.IsZero() {
+            row.Age = int(b.opts.Now.Sub(row.Changed).Hours() / 24)
+        }
+        b.rows = append(b.rows, row)
+    }
+}
+
+/*
+    The tree file can be blamed in and its path there, false if it can't be
+*/
+func (b *Builder) locate(file parse.File) (tree, string, bool) {
+    if dir, ok := b.opts.Clones[file.Repo]; ok && file.Commit != "" {
+        return tree{Dir: dir, Rev: file.Commit}, filepath.ToSlash(file.Path), true
+    }
+
+    dir := filepath.Dir(file.Path)
+    t, seen := b.trees[dir]
+    if !seen {
+        if found, ok := workTree(file.Path); ok {
+            t = &found
+        }
+        b.trees[dir] = t
+    }
+    if t == nil {
+        return tree{}, "", false
+    }
+
+    // git resolves symbolic links in the root it reports, the path may not have them resolved
+    path := file.Path
+    rel, err := filepath.Rel(t.Dir, path)
+    if err != nil || strings.HasPrefix(rel, "..") {
+        if path, err = filepath.EvalSymlinks(path); err == nil {
+            rel, err = filepath.Rel(t.Dir, path)
+        }
+    }
+    if err != nil || strings.HasPrefix(rel, "..") {
+        return tree{}, "", false
+    }
+    return *t, filepath.ToSlash(rel), true
+}
+
+func (b *Builder) codeowners(t tree) []rule {
+    rules, ok := b.rules[t]
+    if !ok {
+        rules      = t.codeowners()
+        b.rules[t] = rules
+    }
+    return rules
+}
+
+/*
+    The author of most of lines, ties going to whoever changed them last, and when the
+    last of them changed
+*/
+func author(lines []Line) (string, string, time.Time) {
+    type tally struct {
+        line  Line
+        count int
+        last  time.Time
+    }
+    tallies := map[string]*tally{}
+    changed := time.Time{}
+    for _, line := range lines {
+        key := strings.ToLower(line.Email)
+        if key == "" {
+            key = line.Author
+        }
+        t, ok := tallies[key]
+        if !ok {
+            t            = &tally{line: line}
+            tallies[key] = t
+        }
+        t.count++
+        if line.Time.After(t.last) {
+            t.last = line.Time
+        }
+        if line.Time.After(changed) {
+            changed = line.Time
+        }
+    }
+
+    var best *tally
+    for _, t := range tallies {
+        if best == nil || t.count > best.count || (t.count == best.count && t.last.After(best.last)) {
+            best = t
+        }
+    }
+    if best == nil {
+        return Unknown, "", changed
+    }
+    return best.line.Author, best.line.Email, changed
+}
+
+/*
+    The report of the functions added so far
+*/
+func (b *Builder) Report() Report {
+    rows := append([]Row{}, b.rows...)
+    sort.SliceStable(rows, func(i, j int) bool {
+        if rows[i].Complexity != rows[j].Complexity {
+            return rows[i].Complexity > rows[j].Complexity
+        }
+        return rows[i].Path < rows[j].Path || (rows[i].Path == rows[j].Path && rows[i].Line < rows[j].Line)
+    })
+
+    byKey := map[string]*Owner{}
+    keys  := []string{}
+    for _, row := range rows {
+        key := row.Team + "\x00" + strings.ToLower(row.Email)
+        if row.Email == "" {
+            key = row.Team + "\x00" + row.Author
+        }
+        o, ok := byKey[key]
+        if !ok {
+            o          = &Owner{Team: row.Team, Author: row.Author, Email: row.Email, Heat: make([]int, len(Buckets)+1)}
+            byKey[key] = o
+            keys       = append(keys, key)
+        }
+        o.Functions++
+        o.Lines      += row.Lines
+        o.Complexity += row.Complexity
+        if row.Complexity > o.Max {
+            o.Max = row.Complexity
+        }
+        o.Heat[bucket(row.Age)] += row.Complexity
+    }
+
+    report := Report{Generated: b.opts.Now, Rows: rows, Owners: []Owner{}}
+    for _, key := range keys {
+        report.Owners = append(report.Owners, *byKey[key])
+    }
+    sort.SliceStable(report.Owners, func(i, j int) bool {
+        a, c := report.Owners[i], report.Owners[j]
+        if a.Complexity != c.Complexity {
+            return a.Complexity > c.Complexity
+        }
+        return a.Team < c.Team || (a.Team == c.Team && a.Author < c.Author)
+    })
+    return report
+}
+
+/*
+    Index of the bucket of Buckets for age in days, len(Buckets) if it's not known
+*/
+func bucket(age int) int {
+    if age < 0 {
+        return len(Buckets)
+    }
+    for i, b := range Buckets {
+        if b.Days == 0 || age < b.Days {
+            return i
+        }
+    }
+    return len(Buckets) - 1
+}
+
+/*
+    The report of the current functions saved in files
+*/
+func Generate(files store.Lister, opts Options) (Report, error) {
+    b   := NewBuilder(opts)
+    err := files.Each(func(file parse.File) error {
+        if err := opts.Cipher.OpenFuncs(file.Funcs); err != nil {
+            return fmt.Errorf("%s: %v", file.Path, err)
+        }
+        b.Add(file)
+        return nil
+    })
+    if err != nil {
+        return Report{}, err
+    }
+    return b.Report(), nil
+}
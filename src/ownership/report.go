@@ -0,0 +1,152 @@
+/*
+    report.go
+
+    Writing the ownership report: CSV with a row per function, for spreadsheets, or a
+    single HTML page with the heatmap of owners by age and the most complex functions.
+*/
+
+package ownership
+
+import (
+    "encoding/csv"
+    "fmt"
+    "html/template"
+    "io"
+    "strconv"
+    "strings"
+)
+
+// Formats Write can write
+var Formats = []string{"csv", "html"}
+
+// Functions listed under the heatmap, the most complex ones
+const hotspots = 50
+
+/*
+    Write the report to w in a format of Formats
+*/
+func (r Report) Write(w io.Writer, format string) error {
+    switch format {
+    case "csv", "":
+        return r.csv(w)
+    case "html":
+        return pageTmpl.Execute(w, r.page())
+    }
+    return fmt.Errorf("unknown ownership format %q, expected %s", format, strings.Join(Formats, " or "))
+}
+
+func (r Report) csv(w io.Writer) error {
+    out := csv.NewWriter(w)
+    out.Write([]string{"repo", "path", "function", "line", "lines", "author", "email", "team", "complexity", "changed", "age_days"})
+    for _, row := range r.Rows {
+        changed, age := "", ""
+        if !row.Changed.IsZero() {
+            changed, age = row.Changed.Format("2006-01-02"), strconv.Itoa(row.Age)
+        }
+        out.Write([]string{row.Repo, row.Path, row.Function, strconv.Itoa(row.Line), strconv.Itoa(row.Lines),
+                           row.Author, row.Email, row.Team, strconv.Itoa(row.Complexity), changed, age})
+    }
+    out.Flush()
+    return out.Error()
+}
+
+type page struct {
+    Generated string
+    Columns   []string
+    Owners    []ownerRow
+    Hotspots  []Row
+    Functions int
+}
+
+/*
+    An owner with the heat of each cell, 0 to 9 relative to the hottest cell of the
+    report
+*/
+type ownerRow struct {
+    Owner
+    Average string
+    Cells   []cell
+}
+
+type cell struct {
+    Complexity int
+    Level      int
+}
+
+func (r Report) page() page {
+    p := page{Generated: r.Generated.Format("2006-01-02"), Functions: len(r.Rows)}
+    for _, b := range Buckets {
+        p.Columns = append(p.Columns, b.Name)
+    }
+    p.Columns = append(p.Columns, "unknown age")
+
+    hottest := 0
+    for _, o := range r.Owners {
+        for _, heat := range o.Heat {
+            if heat > hottest {
+                hottest = heat
+            }
+        }
+    }
+    for _, o := range r.Owners {
+        row := ownerRow{Owner: o, Average: fmt.Sprintf("%.1f", float64(o.Complexity)/float64(o.Functions))}
+        for _, heat := range o.Heat {
+            c := cell{Complexity: heat}
+            if heat > 0 {
+                c.Level = 1 + 8*heat/hottest
+            }
+            row.Cells = append(row.Cells, c)
+        }
+        p.Owners = append(p.Owners, row)
+    }
+
+    p.Hotspots = r.Rows
+    if len(p.Hotspots) > hotspots {
+        p.Hotspots = p.Hotspots[:hotspots]
+    }
+    return p
+}
+
+var pageTmpl = template.Must(template.New("ownership").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Code ownership</title>
+<style>
+    body  { font-family: sans-serif; margin: 2em; }
+    table { border-collapse: collapse; margin-bottom: 2em; }
+    th, td { border: 1px solid #ddd; padding: 0.3em 0.6em; text-align: right; }
+    th, td.name { text-align: left; }
+    .path { color: #666; font-size: 0.9em; }
+    .h0 { background: #fff; }
+    .h1 { background: #fff5f0; } .h2 { background: #fee0d2; } .h3 { background: #fcbba1; }
+    .h4 { background: #fc9272; } .h5 { background: #fb6a4a; } .h6 { background: #ef3b2c; color: #fff; }
+    .h7 { background: #cb181d; color: #fff; } .h8 { background: #a50f15; color: #fff; } .h9 { background: #67000d; color: #fff; }
+</style>
+</head>
+<body>
+<h1>Code ownership</h1>
+<p class="path">{{.Functions}} function(s) on {{.Generated}}. Cells sum the cyclomatic complexity of each owner's functions by when they last changed.</p>
+<table>
+<tr><th>Team</th><th>Author</th><th>Functions</th><th>Lines</th><th>Average</th><th>Max</th>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Owners}}<tr>
+    <td class="name">{{.Team}}</td>
+    <td class="name">{{.Author}}{{with .Email}} <span class="path">{{.}}</span>{{end}}</td>
+    <td>{{.Functions}}</td><td>{{.Lines}}</td><td>{{.Average}}</td><td>{{.Max}}</td>
+    {{range .Cells}}<td class="h{{.Level}}">{{if .Complexity}}{{.Complexity}}{{end}}</td>{{end}}
+</tr>
+{{end}}</table>
+<h2>Most complex functions</h2>
+<table>
+<tr><th>Function</th><th>Complexity</th><th>Lines</th><th>Author</th><th>Team</th><th>Last changed</th></tr>
+{{range .Hotspots}}<tr>
+    <td class="name">{{.Function}} <span class="path">{{.Path}}:{{.Line}}</span></td>
+    <td>{{.Complexity}}</td><td>{{.Lines}}</td>
+    <td class="name">{{.Author}}</td><td class="name">{{.Team}}</td>
+    <td>{{if not .Changed.IsZero}}{{.Changed.Format "2006-01-02"}}{{end}}</td>
+</tr>
+{{end}}</table>
+<p class="path">Generated by pakkun</p>
+</body>
+</html>
+`))
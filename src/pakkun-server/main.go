@@ -0,0 +1,238 @@
+/*
+    main.go
+
+    pakkun-server serves the function index saved by pakkun over HTTP, with a web UI
+    for searching by name, signature or full text.
+
+    Dependencies:        mongodb driver for go (http://labix.org/mgo)
+    Operating systems:   GNU Linux, OS X
+*/
+
+package main
+
+import (
+    "audit"
+    "cli"
+    "crypt"
+    "flag"
+    "io/ioutil"
+    "log"
+    "net/http"
+    "os"
+    "server"
+    "store"
+    "strings"
+    "time"
+    "utils"
+    "gopkg.in/mgo.v2"
+)
+
+/*
+    pakkun-server as its completions and man page describe it. Databases and collections
+    are completed from the local MongoDB.
+*/
+func command() cli.Command {
+    namespaces := func() map[string][]string {
+        return utils.Namespaces(time.Second)
+    }
+    return cli.Command{
+        Name:        "pakkun-server",
+        Summary:     "serve the function index saved by pakkun over HTTP",
+        Description: `pakkun-server answers searches of the functions saved by pakkun by name, signature
+                      or full text, over HTTP with a web UI, or over JSON-RPC on stdin and stdout with
+                      -stdio.
+
+                      With -corpora it searches several collections at once, and answers without those
+                      that fail or take longer than -corpus-timeout.`,
+        Flags:       flag.CommandLine,
+        Values:      map[string]func(string) []string{
+            "db": func(string) []string {
+                dbs := []string{}
+                for db := range namespaces() {
+                    dbs = append(dbs, db)
+                }
+                return dbs
+            },
+            "collection": func(string) []string {
+                seen := map[string]bool{}
+                for _, collections := range namespaces() {
+                    for _, c := range collections {
+                        seen[c] = true
+                    }
+                }
+                collections := []string{}
+                for c := range seen {
+                    collections = append(collections, c)
+                }
+                return collections
+            },
+            // Corpora are name=database.collection, the namespace is completed once named
+            "corpora": func(word string) []string {
+                i := strings.Index(word, "=")
+                if i < 0 {
+                    return nil
+                }
+                pairs := []string{}
+                for db, collections := range namespaces() {
+                    for _, c := range collections {
+                        pairs = append(pairs, word[:i+1]+db+"."+c)
+                    }
+                }
+                return pairs
+            },
+            "rank": func(string) []string {
+                return []string{"bm25", "recency", "stars", "quality"}
+            },
+            "completion": func(string) []string {
+                return cli.Formats
+            },
+        },
+    }
+}
+
+func main() {
+    addr       := flag.String("addr", ":8080", "Address to listen on")
+    db         := flag.String("db", "github_repos", "MongoDB database holding the index")
+    collection := flag.String("collection", "source", "MongoDB collection holding the index")
+    elastic    := flag.String("elastic", "", "Search the Elasticsearch store at this URL instead of -db and -collection, e.g. http://localhost:9200")
+    elasticIdx := flag.String("elastic-index", "pakkun", "Prefix of the indices of -elastic")
+    cacheSize  := flag.Int("cache", 4096, "Number of functions to keep in memory")
+    rank       := flag.String("rank", "", "Weighted rankers ordering results, e.g. bm25=1,recency=0.5")
+    starsFile  := flag.String("stars", "", "JSON file of stars per repository URL, for the stars ranker")
+    rate       := flag.Float64("rate", 0, "Requests per second allowed per token or address, 0 for no limit")
+    burst      := flag.Int("burst", 20, "Requests a client may make at once before -rate applies")
+    rateTokens := flag.String("rate-tokens", "", "File of the bearer tokens -rate and -audit tell clients apart by, one per line, others are known by address")
+    keyFile    := flag.String("key-file", "", "JSON keyring the stored function bodies were encrypted with")
+    auditFile  := flag.String("audit", "", "File to append an audit log of queries and views to")
+    stdio      := flag.Bool("stdio", false, "Serve JSON-RPC on stdin and stdout for editor extensions instead of HTTP")
+    name       := flag.String("name", "local", "Name results from -db and -collection are attributed to when -corpora is set")
+    corpora    := flag.String("corpora", "", "More corpora to search along with it, e.g. public=public_repos.source,team=team.source")
+    timeout    := flag.Duration("corpus-timeout", 0, "Longest wait for a corpus of -corpora before answering without it, 0 for no limit")
+    completion := flag.String("completion", "", "Print the completion script of bash, zsh or fish, or the man page with man, and exit")
+    // Completion scripts ask for the values of flags with -complete <flag> <word>
+    if command().Completing(os.Args[1:], os.Stdout) {
+        return
+    }
+    flag.Parse()
+
+    if *completion != "" {
+        if err := command().Write(os.Stdout, *completion); err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+
+    // MongoDB is only dialed when something is served from it
+    var session *mgo.Session
+    mongo := func() *mgo.Session {
+        if session == nil {
+            var err error
+            if session, err = utils.ConnectDB(); err != nil {
+                log.Fatal(err)
+            }
+        }
+        return session
+    }
+    defer func() {
+        if session != nil {
+            session.Close()
+        }
+    }()
+
+    var cipher *crypt.Cipher
+    if *keyFile != "" {
+        keys, err := crypt.LoadKeyring(*keyFile)
+        if err != nil {
+            log.Fatal(err)
+        }
+        cipher = crypt.New(keys)
+    }
+
+    var primary server.Index
+    if *elastic != "" {
+        primary = &server.ElasticIndex{Store: &store.Elastic{URL: *elastic, Index: *elasticIdx}, Cipher: cipher}
+    } else {
+        primary = &server.MongoIndex{Session: mongo(), DB: *db, Collection: *collection, Cipher: cipher}
+    }
+    if *corpora != "" {
+        federation := &server.Federation{Corpora: []server.Corpus{{Name: *name, Index: primary}}, Timeout: *timeout}
+        for _, pair := range strings.Split(*corpora, ",") {
+            nameAndSource := strings.SplitN(pair, "=", 2)
+            source        := strings.SplitN(nameAndSource[len(nameAndSource)-1], ".", 2)
+            if len(nameAndSource) != 2 || len(source) != 2 {
+                log.Fatalf("bad corpus %q, expected name=database.collection", pair)
+            }
+            corpus := &server.MongoIndex{Session: mongo(), DB: source[0], Collection: source[1], Cipher: cipher}
+            federation.Corpora = append(federation.Corpora, server.Corpus{Name: nameAndSource[0], Index: corpus})
+        }
+        primary = federation
+    }
+    index := server.NewCache(primary, *cacheSize)
+
+    var stars server.Stars
+    if *starsFile != "" {
+        var err error
+        if stars, err = server.LoadStars(*starsFile); err != nil {
+            log.Fatal(err)
+        }
+    }
+
+    var ranker server.Ranker
+    if *rank != "" {
+        ranking, err := server.ParseRanking(*rank, stars)
+        if err != nil {
+            log.Fatal(err)
+        }
+        ranker = ranking
+    }
+
+    var auditLog *audit.Log
+    if *auditFile != "" {
+        var err error
+        if auditLog, err = audit.Open(*auditFile); err != nil {
+            log.Fatal(err)
+        }
+        defer auditLog.Close()
+    }
+
+    if *stdio {
+        // Same types as pakkun indexes with, for re-parsing files being edited
+        types := map[string]bool{"int":true, "double":true, "float":true, "boolean":true, "long":true,
+                                 "short":true, "byte":true, "public":false, "private":false, "protected":false,
+                                 "static":false, "strictfp":false, "native":false, "String":false, "void":false}
+        rpc   := &server.RPC{Index: index, Ranker: ranker, Types: types, Audit: auditLog}
+        if err := rpc.Serve(os.Stdin, os.Stdout); err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+
+    // Tokens tell clients apart, for the rate limit and the audit log
+    var authenticate func(token string) bool
+    if *rateTokens != "" {
+        data, err := ioutil.ReadFile(*rateTokens)
+        if err != nil {
+            log.Fatal(err)
+        }
+        authenticate = server.TokenSet(strings.Split(string(data), "\n"))
+    }
+
+    s             := server.New(index)
+    s.Ranker       = ranker
+    s.Audit        = auditLog
+    s.Authenticate = authenticate
+
+    var handler http.Handler = s
+    if *rate > 0 {
+        limiter             := server.NewRateLimiter(*rate, *burst)
+        limiter.Authenticate = authenticate
+        handler              = limiter.Wrap(s)
+    }
+
+    if *elastic != "" {
+        log.Printf("serving %s on %s\n", *elastic, *addr)
+    } else {
+        log.Printf("serving %s.%s on %s\n", *db, *collection, *addr)
+    }
+    log.Fatal(http.ListenAndServe(*addr, handler))
+}
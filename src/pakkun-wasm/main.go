@@ -0,0 +1,169 @@
+//go:build js && wasm
+// +build js,wasm
+
+/*
+    main.go
+
+    pakkun-wasm is the extractor built for WebAssembly, so browser tools can extract the
+    functions of pasted code client-side with the same logic as pakkun, see
+    parse.ParseBytes. There's no ctags in the browser, functions are found by the regex
+    backend. Build it with
+
+        GOOS=js GOARCH=wasm go build -o pakkun.wasm pakkun-wasm
+
+    and load it with pakkun.js, next to this file, which documents the JavaScript API.
+*/
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "parse"
+    "syscall/js"
+    "time"
+)
+
+/*
+    Options of extract, as JavaScript passes them
+
+    Types              - Types of the functions to extract, every type if empty
+    Flatten            - Remove the newlines and tabs of bodies instead of keeping them verbatim
+    NoSource           - Don't extract function bodies
+    Constructors       - Also extract constructors and destructors
+    Abstract           - Also list abstract and interface methods
+    NoSkip             - Also extract from minified, generated and binary source, which
+                         pakkun skips by default
+    MaxSize            - Most bytes of source extracted from, none if 0
+    MaxFuncs           - Most functions extracted, none if 0
+    Timeout            - Milliseconds extraction may take, none if 0
+*/
+type options struct {
+    Types              []string `json:"types"`
+    Flatten            bool     `json:"flatten"`
+    NoSource           bool     `json:"noSource"`
+    Constructors       bool     `json:"constructors"`
+    Abstract           bool     `json:"abstract"`
+    NoSkip             bool     `json:"noSkip"`
+    MaxSize            int64    `json:"maxSize"`
+    MaxFuncs           int      `json:"maxFuncs"`
+    Timeout            int64    `json:"timeout"`
+}
+
+func (o options) parse() parse.Options {
+    types := map[string]bool{}
+    for _, t := range o.Types {
+        types[t] = true
+    }
+    if len(types) == 0 {
+        types[parse.AnyType] = true
+    }
+
+    opts := []parse.Option{parse.WithTypes(types), parse.WithBackend(parse.Regex), parse.WithLimits(parse.Limits{
+        MaxFileSize: o.MaxSize,
+        MaxFuncs:    o.MaxFuncs,
+        Timeout:     time.Duration(o.Timeout) * time.Millisecond,
+    })}
+    if !o.NoSkip {
+        opts = append(opts, parse.WithSkip(parse.DefaultSkipRules))
+    }
+    if o.Flatten {
+        opts = append(opts, parse.WithFlatten())
+    }
+    if o.NoSource {
+        opts = append(opts, parse.WithoutSource())
+    }
+    if o.Constructors {
+        opts = append(opts, parse.WithConstructors())
+    }
+    if o.Abstract {
+        opts = append(opts, parse.WithAbstract())
+    }
+    return parse.NewOptions(opts...)
+}
+
+/*
+    extract(name, source, options) from JavaScript, options being JSON. Returns JSON,
+    {"file": <parse.File>} or {"error": "...", "code": "..."}. A file without functions
+    isn't an error, its Funcs are empty.
+*/
+func extract(this js.Value, args []js.Value) interface{} {
+    if len(args) < 2 {
+        return failure("extract takes a file name, its source and options", "usage")
+    }
+    var o options
+    if len(args) > 2 && args[2].Type() == js.TypeString && args[2].String() != "" {
+        if err := json.Unmarshal([]byte(args[2].String()), &o); err != nil {
+            return failure("bad options: "+err.Error(), "usage")
+        }
+    }
+
+    name      := args[0].String()
+    file, err := parse.ParseBytes(name, []byte(args[1].String()), o.parse())
+    switch {
+    case err == parse.ErrNoFuncs:
+        file = parse.File{Name: name, Path: name, Funcs: []parse.Function{}, Backend: parse.Regex}
+    case parse.IsLimit(err):
+        return failure(err.Error(), "limit")
+    case parse.IsSkipped(err):
+        return failure(err.Error(), "skipped")
+    case err != nil:
+        return failure(err.Error(), "failed")
+    }
+
+    out, err := encode(map[string]interface{}{"file": file})
+    if err != nil {
+        return failure(err.Error(), "failed")
+    }
+    return out
+}
+
+func failure(msg string, code string) string {
+    out, _ := json.Marshal(map[string]string{"error": msg, "code": code})
+    return string(out)
+}
+
+/*
+    v as JSON with the ids as strings. They're 63 bits, more than a JavaScript number
+    holds exactly.
+*/
+func encode(v interface{}) (string, error) {
+    out, err := json.Marshal(v)
+    if err != nil {
+        return "", err
+    }
+    dec := json.NewDecoder(bytes.NewReader(out))
+    dec.UseNumber()
+    var generic interface{}
+    if err := dec.Decode(&generic); err != nil {
+        return "", err
+    }
+    out, err = json.Marshal(quoteIds(generic))
+    return string(out), err
+}
+
+func quoteIds(v interface{}) interface{} {
+    switch v := v.(type) {
+    case map[string]interface{}:
+        for k, field := range v {
+            if n, ok := field.(json.Number); ok && (k == "id" || k == "Id" || k == "ContentId") {
+                v[k] = n.String()
+                continue
+            }
+            v[k] = quoteIds(field)
+        }
+    case []interface{}:
+        for i := range v {
+            v[i] = quoteIds(v[i])
+        }
+    }
+    return v
+}
+
+func main() {
+    js.Global().Set("pakkunWasm", js.ValueOf(map[string]interface{}{
+        "extract": js.FuncOf(extract),
+        "version": parse.ExtractorVersion,
+    }))
+    select {}
+}
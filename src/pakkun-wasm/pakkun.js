@@ -0,0 +1,95 @@
+/*
+    pakkun.js
+
+    Loads pakkun.wasm and extracts the functions of source code in the browser, with the
+    same logic as pakkun. wasm_exec.js, from lib/wasm of the Go installation that built
+    pakkun.wasm, has to be loaded first:
+
+        <script src="wasm_exec.js"></script>
+        <script src="pakkun.js"></script>
+        <script>
+            Pakkun.load("pakkun.wasm").then(pakkun => {
+                const file = pakkun.extract("Sort.java", source, {types: ["int", "void"]});
+                for (const fn of file.Funcs) {
+                    console.log(fn.Name, fn.StartLine, fn.Header);
+                }
+            });
+        </script>
+
+    extract returns the parse.File pakkun would save, with its fields as the server's
+    JSON names them, and the ids as strings since they're 63 bits. Options, all optional:
+
+        types              - Types of the functions to extract, every type if empty
+        flatten            - Remove the newlines and tabs of bodies instead of keeping them verbatim
+        noSource           - Don't extract function bodies
+        constructors       - Also extract constructors and destructors
+        abstract           - Also list abstract and interface methods
+        noSkip             - Also extract from minified, generated and binary source,
+                             which pakkun skips by default
+        maxSize            - Most bytes of source extracted from, none if 0
+        maxFuncs           - Most functions extracted, none if 0
+        timeout            - Milliseconds extraction may take, none if 0
+
+    Failures throw a PakkunError with a code: limit when the source is over maxSize,
+    maxFuncs or timeout, skipped when it's minified, generated or binary, failed otherwise.
+*/
+
+(function (root) {
+    "use strict";
+
+    class PakkunError extends Error {
+        constructor(message, code) {
+            super(message);
+            this.name = "PakkunError";
+            this.code = code;
+        }
+    }
+
+    /*
+        Instantiate the module at url, or given as bytes, and return the extractor. Its
+        version is parse.ExtractorVersion, the same as the pakkun it matches.
+    */
+    async function load(url) {
+        if (typeof root.Go !== "function") {
+            throw new PakkunError("wasm_exec.js must be loaded before pakkun.js", "usage");
+        }
+        const go = new root.Go();
+
+        let result;
+        if (typeof url !== "string") {
+            result = await WebAssembly.instantiate(url, go.importObject);
+        } else if (WebAssembly.instantiateStreaming) {
+            // Servers that don't send application/wasm make streaming fail
+            try {
+                result = await WebAssembly.instantiateStreaming(fetch(url), go.importObject);
+            } catch (err) {
+                result = await WebAssembly.instantiate(await (await fetch(url)).arrayBuffer(), go.importObject);
+            }
+        } else {
+            result = await WebAssembly.instantiate(await (await fetch(url)).arrayBuffer(), go.importObject);
+        }
+        go.run(result.instance);
+
+        const wasm = root.pakkunWasm;
+        delete root.pakkunWasm;
+        return {
+            version: wasm.version,
+            extract(name, source, options) {
+                if (typeof name !== "string" || typeof source !== "string") {
+                    throw new PakkunError("extract takes a file name and its source as strings", "usage");
+                }
+                const out = JSON.parse(wasm.extract(name, source, JSON.stringify(options || {})));
+                if (out.error) {
+                    throw new PakkunError(out.error, out.code);
+                }
+                return out.file;
+            },
+        };
+    }
+
+    const Pakkun = {load, PakkunError};
+    if (typeof module === "object" && module.exports) {
+        module.exports = Pakkun;
+    }
+    root.Pakkun = Pakkun;
+})(typeof globalThis !== "undefined" ? globalThis : this);
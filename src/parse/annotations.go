@@ -0,0 +1,151 @@
+/*
+    annotations.go
+
+    Java annotations, Python decorators and C# attributes attached to functions, e.g.
+    @Override, @app.route("/") or [TestMethod]. They often say what a function is for.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C#, Java, Javascript, Kotlin, Python and Typescript
+*/
+
+package parse
+
+import (
+    "regexp"
+    "strings"
+)
+
+// Annotations and attributes leading a line, one per match
+var (
+    leadingAnnotation = regexp.MustCompile(`^\s*(@[\w.]+(?:\s*\([^)]*\))?)`)
+    leadingAttribute  = regexp.MustCompile(`^\s*(\[[^\]]*\])`)
+)
+
+// Languages marking functions with @ annotations or decorators
+var annotationLangs = map[string]bool{"java":true, "kt":true, "py":true, "js":true, "ts":true, "scala":true}
+
+/*
+    True if text, a trimmed line, is an annotation, decorator or attribute of the
+    language ext
+*/
+func isAnnotation(text string, ext string) bool {
+    switch {
+    case annotationLangs[ext]:
+        return strings.HasPrefix(text, "@")
+    case ext == "cs":
+        return strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]")
+    }
+    return false
+}
+
+/*
+    Annotations of fn in the order they're written: those on the lines right above the
+    header and those leading the header line itself
+*/
+func annotations(content []byte, lines []int, fn Function, ext string) []string {
+    if fn.StartLine <= 0 || fn.StartLine > len(lines) || (!annotationLangs[ext] && ext != "cs") {
+        return nil
+    }
+
+    first := fn.StartLine - 1
+    for first > 0 && isAnnotation(strings.TrimSpace(lineText(content, lines, first-1)), ext) {
+        first--
+    }
+
+    pattern := leadingAnnotation
+    if ext == "cs" {
+        pattern = leadingAttribute
+    }
+
+    found := []string{}
+    for l := first; l < fn.StartLine; l++ {
+        text := lineText(content, lines, l)
+        for {
+            m := pattern.FindStringSubmatchIndex(text)
+            if m == nil {
+                break
+            }
+            found = append(found, strings.Join(strings.Fields(text[m[2]:m[3]]), " "))
+            text  = text[m[1]:]
+        }
+    }
+
+    if len(found) == 0 {
+        return nil
+    }
+    return found
+}
+
+/*
+    Drop the annotations with arguments and the attributes leading a header, whose
+    parentheses would be taken for the parameter list. Annotations without arguments are
+    left for parseJavaFuncHeader, which looks for @Nullable among them.
+*/
+func dropAnnotationArgs(header string, ext string) string {
+    pattern := leadingAnnotation
+    switch {
+    case ext == "cs":
+        pattern = leadingAttribute
+    case !annotationLangs[ext]:
+        return header
+    }
+
+    kept := []string{}
+    for {
+        m := pattern.FindStringSubmatchIndex(header)
+        if m == nil {
+            return strings.Join(append(kept, strings.TrimLeft(header, " \t")), " ")
+        }
+        if a := header[m[2]:m[3]]; ext != "cs" && !strings.Contains(a, "(") {
+            kept = append(kept, a)
+        }
+        header = header[m[1]:]
+    }
+}
+
+/*
+    Split the throws clause off a Java header: public int f(int x) throws IOException {
+    is public int f(int x) { and [IOException]
+*/
+func throwsClause(header string) (string, []string) {
+    open := strings.Index(header, "(")
+    if open < 0 {
+        return header, nil
+    }
+    depth, close := 0, -1
+    for i := open; i < len(header) && close < 0; i++ {
+        switch header[i] {
+        case '(':
+            depth++
+        case ')':
+            if depth--; depth == 0 {
+                close = i
+            }
+        }
+    }
+    if close < 0 {
+        return header, nil
+    }
+
+    rest  := header[close+1:]
+    words := strings.Fields(rest)
+    if len(words) == 0 || words[0] != "throws" {
+        return header, nil
+    }
+
+    // The clause runs up to the body or the ; of an abstract method
+    clause := rest[strings.Index(rest, "throws")+len("throws"):]
+    end    := strings.IndexAny(clause, "{;")
+    tail   := ""
+    if end >= 0 {
+        clause, tail = clause[:end], " "+clause[end:]
+    }
+
+    throws := []string{}
+    for _, t := range splitTopLevel(clause) {
+        if t = strings.TrimSpace(t); t != "" {
+            throws = append(throws, normalizeGenerics(t))
+        }
+    }
+    return header[:close+1] + strings.TrimRight(tail, " \t"), throws
+}
@@ -0,0 +1,186 @@
+/*
+    archive.go
+
+    Parsing of source archives (zip, tar, tar.gz) such as GitHub zipballs, without
+    extracting the whole archive to disk.
+
+    Dependencies:        exuberant ctags
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bufio"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "strings"
+)
+
+var archiveExts = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+/*
+    True if path looks like an archive ParseArchive can read
+*/
+func IsArchive(path string) bool {
+    for _, ext := range archiveExts {
+        if strings.HasSuffix(path, ext) {
+            return true
+        }
+    }
+    return false
+}
+
+/*
+    Parse every file in the archive at path ending in extension with opts. File.Path is the path
+    inside the archive, e.g. owner-repo-sha/src/Foo.java for a GitHub zipball, and
+    File.Archive is path. Files are returned even with an error, which joins those of
+    the files that couldn't be parsed and the one that stopped the archive from being
+    read, if any, see Errors.
+*/
+func ParseArchive(path string, extension string, opts Options) ([]File, error) {
+    files, err := parseArchive(path, extension, opts)
+    for i := range files {
+        files[i].Archive = path
+        files[i].Id      = FileId(files[i], opts.IdHash)
+    }
+    return files, err
+}
+
+func parseArchive(path string, extension string, opts Options) ([]File, error) {
+    if strings.HasSuffix(path, ".zip") {
+        r, err := zip.OpenReader(path)
+        if err != nil {
+            return nil, err
+        }
+        defer r.Close()
+
+        return ParseFS(&r.Reader, extension, opts)
+    }
+
+    if !IsArchive(path) {
+        return nil, fmt.Errorf("%s is not a supported archive", path)
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    var r io.Reader = f
+    if !strings.HasSuffix(path, ".tar") {
+        gz, err := gzip.NewReader(f)
+        if err != nil {
+            return nil, err
+        }
+        defer gz.Close()
+        r = gz
+    }
+
+    return ParseTar(r, extension, opts)
+}
+
+/*
+    Parse every file ending in extension in the uncompressed tar stream r with opts. Entries are
+    streamed one at a time, so only the file currently being parsed is ever written out
+    for ctags. As with ParseFS, entries that can't be parsed don't stop the others. A
+    stream that can't be read does, its error joined to theirs.
+*/
+func ParseTar(r io.Reader, extension string, opts Options) ([]File, error) {
+    tr    := tar.NewReader(r)
+    files := []File{}
+    errs  := []error{}
+
+    for {
+        hdr, err := tr.Next()
+        if err == io.EOF {
+            return files, errors.Join(errs...)
+        }
+        if err != nil {
+            return files, errors.Join(append(errs, err)...)
+        }
+
+        if hdr.Typeflag != tar.TypeReg {
+            continue
+        }
+
+        // Files whose extension doesn't say are told by their content
+        name    := strings.TrimPrefix(hdr.Name, "./")
+        r       := bufio.NewReaderSize(tr, sniffSize)
+        head, _ := r.Peek(sniffSize)
+        if !HasLanguage(name, head, extension) {
+            continue
+        }
+        if err := tooLarge(name, hdr.Size, opts.Limits); err != nil {
+            errs = append(errs, err)
+            continue
+        }
+        file, err := ParseReader(name, r, opts)
+        if err == nil {
+            files = append(files, file)
+        } else if err != ErrNoFuncs {
+            errs = append(errs, err)
+        }
+    }
+}
+
+/*
+    The content of the file at name inside the archive at path, as ParseArchive named it
+*/
+func ReadArchiveFile(path string, name string) ([]byte, error) {
+    if strings.HasSuffix(path, ".zip") {
+        r, err := zip.OpenReader(path)
+        if err != nil {
+            return nil, err
+        }
+        defer r.Close()
+
+        f, err := r.Open(name)
+        if err != nil {
+            return nil, err
+        }
+        defer f.Close()
+        return ioutil.ReadAll(f)
+    }
+
+    if !IsArchive(path) {
+        return nil, fmt.Errorf("%s is not a supported archive", path)
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    var r io.Reader = f
+    if !strings.HasSuffix(path, ".tar") {
+        gz, err := gzip.NewReader(f)
+        if err != nil {
+            return nil, err
+        }
+        defer gz.Close()
+        r = gz
+    }
+
+    tr := tar.NewReader(r)
+    for {
+        hdr, err := tr.Next()
+        if err == io.EOF {
+            return nil, fmt.Errorf("%s: no %s in the archive", path, name)
+        }
+        if err != nil {
+            return nil, err
+        }
+        if hdr.Typeflag == tar.TypeReg && strings.TrimPrefix(hdr.Name, "./") == name {
+            return ioutil.ReadAll(tr)
+        }
+    }
+}
@@ -0,0 +1,177 @@
+/*
+    backend.go
+
+    Choosing what finds the functions in a file: ctags, the regex fallback, or
+    tree-sitter when built with it.
+
+    Dependencies:        exuberant ctags
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, Erlang, Lisp, Lua, Java, Javascript, and Python
+*/
+
+package parse
+
+import (
+    "context"
+)
+
+/*
+    Backend that found the functions of a file
+*/
+type Backend string
+
+const (
+    Ctags      Backend = "ctags"
+    Regex      Backend = "regex"
+    TreeSitter Backend = "tree-sitter"
+)
+
+/*
+    Types     - Valid types. Valid if the key exists, desired if its value is true.
+                AnyType stands for the types not listed
+    Backend   - What finds the functions. Empty picks ctags if it's installed and the regex
+                fallback otherwise. TreeSitter needs pakkun built with -tags treesitter and
+                falls back the same way without it.
+    Kinds     - ctags kind letters to extract, keyed by file extension, e.g. {"java": "mci"}
+                to also capture classes and interfaces. Languages not listed get their
+                functions (or methods). Kinds other than functions and methods end up in
+                File.Symbols. Only used by the ctags backend.
+    Limits    - Size, function count and time limits per file, none if zero
+    Observer  - Notified before and after each file is parsed, if set
+    CtagsPath - ctags binary to run, ctags from $PATH if empty
+    NoSource  - Don't extract function bodies. Functions whose braces don't balance are
+                kept, since that's only found out while extracting
+    Flatten   - Remove the newlines and tabs of function bodies found by brace matching
+                or tree-sitter, as older versions did. They are kept verbatim otherwise
+    Patterns  - Project-defined patterns, see patterns.go. Their matches are added to
+                what the backend finds
+    Constructors - Also extract constructors and destructors, see constructors.go
+    Abstract  - Also list abstract and interface methods, which have no body, with
+                Function.Abstract set. They are skipped otherwise
+    Classes   - Also extract classes, structs, enums and interfaces into File.Classes and
+                set the Function.Class of their functions. Their tags go there instead of
+                File.Symbols. Only used by the ctags backend
+    Cache     - Where parse results are looked up before parsing and saved after, see
+                cache.go. Nothing is cached if nil
+    Symbols   - Also extract global variables, constants, macros and typedefs into
+                File.Symbols. Only used by the ctags backend
+    Context   - Also record the fields of the class of every function and the signatures
+                of the other functions in it in Function.Context, see context.go. Fields
+                come from the ctags backend
+    Tokenizer - Counts Function.Tokens, see tokens.go. Not counted if nil
+    Entities  - What to extract, see entities.go. Overrides Constructors, Classes and
+                Symbols when given. Functions and methods if empty
+    IdHash    - Hash of function and file Ids, see ids.go. FNV64 if empty
+    Skip      - Binary, minified and generated files to skip, see skip.go. None if zero
+    Batch     - Files ParseFiles passes to each ctags run, see batch.go. BatchSize if 0
+    KeepContent - Return the content ParseFiles read of every file in Result.Content, so
+                callers needing it, e.g. to count calls, don't read the file again
+*/
+type Options struct {
+    Types     map[string]bool
+    Backend   Backend
+    Kinds     map[string]string
+    Limits    Limits
+    Observer  Observer
+    CtagsPath string
+    NoSource  bool
+    Patterns  []Pattern
+    Cache     Cache
+    Tokenizer Tokenizer
+    Entities  []Entity
+    IdHash    IdHash
+    Skip      SkipRules
+    Batch     int
+
+    KeepContent bool
+
+    Flatten      bool
+    Constructors bool
+    Abstract     bool
+    Classes      bool
+    Symbols      bool
+    Context      bool
+
+    // Tags of the files of a batch ctags already ran on, by path, see ParseFiles
+    batched map[string][]tag
+}
+
+// Set by treesitter.go when built with -tags treesitter
+var treeSitterTags func(content []byte, ext string) ([]tag, bool)
+
+/*
+    ctags binary to run
+*/
+func (opts Options) ctags() string {
+    if opts.CtagsPath != "" {
+        return opts.CtagsPath
+    }
+    return "ctags"
+}
+
+/*
+    ctags kind letters of global variables, constants, macros and typedefs, added to the
+    function kinds with Options.Symbols
+*/
+var symbolKinds = map[string]string{"c":"vdt", "h":"vdt", "cpp":"vdt", "hpp":"vdt", "cu":"vdt", "cuh":"vdt",
+                                    "cl":"vdt", "hlsl":"vdt", "glsl":"vdt", "py":"v", "js":"v"}
+
+/*
+    ctags kind letters to extract from files with extension ext, "" for the defaults
+*/
+func (opts Options) kinds(ext string) string {
+    kinds := opts.Kinds[ext]
+    add   := func(extra string) {
+        if extra == "" {
+            return
+        }
+        if kinds == "" {
+            kinds = defaultKinds[ext]
+        }
+        kinds += extra
+    }
+    if opts.Classes || opts.Context {
+        add(classKinds[ext])
+    }
+    if opts.Symbols {
+        add(symbolKinds[ext])
+    }
+    return kinds
+}
+
+/*
+    True if tags of kind (a long kind name, as ctags prints it) are functions
+*/
+func isFuncKind(kind string, ext string) bool {
+    return kind == "function" || kind == "method" || kind == getFuncTerm(ext)
+}
+
+/*
+    Return the tags of the file at path, content, and the backend that found them. Only
+    ctags reads the file again, the other backends work on content. The search stops
+    early, with whatever was found so far, if ctx is done. An error if ctags fails.
+*/
+func findTags(ctx context.Context, path string, content []byte, ext string, opts Options) ([]tag, Backend, error) {
+    if tags, ok := opts.batched[path]; ok {
+        return tags, Ctags, nil
+    }
+    switch opts.Backend {
+    case Ctags:
+        tags, err := runCtags(ctx, opts.ctags(), path, ext, opts.kinds(ext))
+        return tags, Ctags, err
+    case Regex:
+        return regexTags(ctx, content, ext), Regex, nil
+    case TreeSitter:
+        if treeSitterTags != nil {
+            if tags, ok := treeSitterTags(content, ext); ok {
+                return tags, TreeSitter, nil
+            }
+        }
+    }
+
+    if ctagsInstalled(opts.ctags()) {
+        tags, err := runCtags(ctx, opts.ctags(), path, ext, opts.kinds(ext))
+        return tags, Ctags, err
+    }
+    return regexTags(ctx, content, ext), Regex, nil
+}
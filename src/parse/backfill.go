@@ -0,0 +1,113 @@
+/*
+    backfill.go
+
+    Extractors that can run again over an already parsed file, so a field added after
+    the corpus was built can be filled in without parsing everything again:
+
+        parse.Backfill(&file, content, []string{"doc", "imports"})
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// The content given doesn't match the file anymore, its functions aren't where they were
+var ErrStale = errors.New("file changed since it was parsed")
+
+/*
+    Fill one field of file from its content and line offsets
+*/
+type backfiller func(file *File, content []byte, lines []int, ext string)
+
+var backfillers = map[string]backfiller{
+    "doc": func(file *File, content []byte, lines []int, ext string) {
+        for i := range file.Funcs {
+            file.Funcs[i].Doc = docComment(content, lines, file.Funcs[i], ext)
+        }
+    },
+    "annotations": func(file *File, content []byte, lines []int, ext string) {
+        for i := range file.Funcs {
+            file.Funcs[i].Annotations = annotations(content, lines, file.Funcs[i], ext)
+        }
+    },
+    "modifiers": func(file *File, content []byte, lines []int, ext string) {
+        for i := range file.Funcs {
+            file.Funcs[i].Visibility, file.Funcs[i].Modifiers = headerModifiers(file.Funcs[i].Header, ext)
+        }
+    },
+    "imports": func(file *File, content []byte, lines []int, ext string) {
+        file.Imports = imports(content, lines, ext)
+    },
+    "package": func(file *File, content []byte, lines []int, ext string) {
+        file.Package = packageName(content, lines, ext)
+    },
+    "version": func(file *File, content []byte, lines []int, ext string) {
+        file.Version = langVersion(content, ext)
+    },
+    "language": func(file *File, content []byte, lines []int, ext string) {
+        file.Language = languageNames[ext]
+    },
+}
+
+/*
+    Names of the fields Backfill can fill, sorted
+*/
+func BackfillFields() []string {
+    fields := []string{}
+    for field := range backfillers {
+        fields = append(fields, field)
+    }
+    sort.Strings(fields)
+    return fields
+}
+
+/*
+    Run the extractors of fields over content, the current content of file, and set what
+    they find on file. Returns ErrStale, leaving file as it is, if the functions of file
+    aren't on the lines they were saved at anymore. Content is normalized to UTF-8 with \n
+    line endings first, as it was when the file was parsed. Tombstones are of content
+    that's gone and are left as they are.
+*/
+func Backfill(file *File, content []byte, fields []string) error {
+    for _, field := range fields {
+        if _, ok := backfillers[field]; !ok {
+            return fmt.Errorf("can't backfill %s, only %s", field, strings.Join(BackfillFields(), ", "))
+        }
+    }
+
+    _, _, content = normalize(content)
+    lines        := lineOffsets(content)
+    live         := []int{}
+    for i, fn := range file.Funcs {
+        if !Alive(fn) {
+            continue
+        }
+        if fn.StartLine > len(lines) || (fn.StartLine > 0 && !strings.Contains(lineText(content, lines, fn.StartLine-1), fn.Name)) {
+            return ErrStale
+        }
+        live = append(live, i)
+    }
+
+    // The extractors only see the live functions
+    funcs     := file.Funcs
+    file.Funcs = make([]Function, len(live))
+    for j, i := range live {
+        file.Funcs[j] = funcs[i]
+    }
+    ext := detectExt(file.Path)
+    for _, field := range fields {
+        backfillers[field](file, content, lines, ext)
+    }
+    for j, i := range live {
+        funcs[i] = file.Funcs[j]
+    }
+    file.Funcs = funcs
+    return nil
+}
@@ -0,0 +1,324 @@
+/*
+    batch.go
+
+    Parsing many files with one ctags run. On repositories of tens of thousands of small
+    files, starting ctags once per file costs more than what ctags does with them, so
+    ParseFiles reads a batch of files, settles those it can without ctags (cache hits,
+    skipped files, service definitions, ...), runs ctags once per language over the rest
+    with -L - and hands every file its own tags back:
+
+        results := parse.ParseFiles(paths, parse.NewOptions(parse.WithTypes(types)))
+
+    Files are otherwise parsed exactly as ParseFileWith would. A batch ctags run that
+    fails, outlives the timeout of its files put together, or prints a line too long to
+    read, is given up on and its files run ctags on their own.
+
+    Dependencies:        exuberant ctags
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "runtime"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Files passed to each ctags run of ParseFiles, unless Options.Batch says otherwise
+const BatchSize = 256
+
+// Bytes of content ParseFiles keeps in memory at once, batches are cut short beyond it
+var BatchBytes = 64 << 20
+
+/*
+    A file of a batch
+
+    key   - Its key in Options.Cache, empty without one
+    done  - What it parsed to is known already
+    alone - It's mapped rather than read, see MapSize, and parsed on its own. Large
+            files gain nothing from sharing a ctags run.
+    kept  - Its content for Result.Content, with Options.KeepContent
+*/
+type batchFile struct {
+    path    string
+    fname   string
+    content []byte
+    kept    []byte
+    release func()
+    key     string
+    done    bool
+    alone   bool
+    file    File
+    err     error
+}
+
+/*
+    ParseFileWith on every path, with ctags run once per language for opts.Batch files
+    rather than once per file. Results are in the order of paths.
+*/
+func ParseFiles(paths []string, opts Options) []Result {
+    opts    = opts.withEntities()
+    results := make([]Result, 0, len(paths))
+    for len(paths) > 0 {
+        files := readBatch(paths, opts)
+        parseBatch(files, opts)
+        for _, f := range files {
+            file, err := finishFile(f.path, f.file, f.err, opts)
+            results    = append(results, Result{Path: f.path, File: file, Err: err, Content: f.kept})
+        }
+        paths = paths[len(files):]
+    }
+    return results
+}
+
+/*
+    Read the files of the next batch from paths, at least one, and settle those that
+    don't need ctags
+*/
+func readBatch(paths []string, opts Options) []*batchFile {
+    size := opts.Batch
+    if size <= 0 {
+        size = BatchSize
+    }
+
+    files := []*batchFile{}
+    held  := 0
+    for _, path := range paths {
+        if len(files) == size || (len(files) > 0 && held >= BatchBytes) {
+            break
+        }
+        if opts.Observer != nil {
+            opts.Observer.FileStarted(path)
+        }
+
+        f     := &batchFile{path: path, fname: fileName(path)}
+        files  = append(files, f)
+        content, release, mapped, err := openFile(path, opts.Limits)
+        if err != nil {
+            f.err, f.done = err, true
+            continue
+        }
+        if opts.KeepContent {
+            f.kept = content
+            if mapped {
+                f.kept = append([]byte(nil), content...)
+            }
+        }
+        if mapped {
+            release()
+            f.alone = true
+            continue
+        }
+
+        f.key, f.file, f.done, f.err = lookupCached(path, f.fname, content, opts)
+        if !f.done {
+            if err := opts.Skip.check(path, content); err != nil {
+                f.err, f.done = err, true
+            }
+        }
+        if f.done {
+            release()
+            continue
+        }
+        f.content, f.release = content, release
+        held += len(content)
+    }
+    return files
+}
+
+/*
+    Run ctags over the files of the batch that need it, then parse every file left
+*/
+func parseBatch(files []*batchFile, opts Options) {
+    // One ctags run per set of options, i.e. per language
+    groups := map[string][]string{}
+    args   := map[string][]string{}
+    for _, f := range files {
+        if f.done || f.alone {
+            continue
+        }
+        if a, ok := batchArgs(f.path, f.content, opts); ok {
+            k        := strings.Join(a, "\x00")
+            groups[k] = append(groups[k], f.path)
+            args[k]   = a
+        }
+    }
+
+    batched := map[string][]tag{}
+    for k, paths := range groups {
+        // A single file gains nothing from it, and keeps its own timeout
+        if len(paths) < 2 {
+            continue
+        }
+        tags, err := runCtagsBatch(opts.ctags(), paths, args[k], opts.Limits.Timeout)
+        if err != nil {
+            log.Printf("ctags failed on a batch of %d files, running it on each: %v\n", len(paths), err)
+            continue
+        }
+        for path, t := range tags {
+            batched[path] = t
+        }
+    }
+    withTags        := opts
+    withTags.batched = batched
+
+    // Files are parsed by a fixed pool of workers, each into its own slot
+    jobs := make(chan *batchFile)
+    var wg sync.WaitGroup
+    for w := 0; w < runtime.NumCPU(); w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for f := range jobs {
+                if f.alone {
+                    f.file, f.err = parseFileWith(f.path, opts)
+                    continue
+                }
+                f.file, f.err = parseContent(f.path, f.fname, f.content, withTags)
+                storeCached(f.key, f.path, f.file, f.err, opts)
+                f.release()
+            }
+        }()
+    }
+    for _, f := range files {
+        if !f.done {
+            jobs <- f
+        }
+    }
+    close(jobs)
+    wg.Wait()
+}
+
+/*
+    Options ctags would be run with on the file at path, content, and true if it would
+    be run on it at all. Files parsed from a normalized copy aren't batched, ctags reads
+    the copy.
+*/
+func batchArgs(path string, content []byte, opts Options) ([]string, bool) {
+    if strings.ContainsAny(path, "\r\n") {
+        return nil, false
+    }
+    ext := contentExt(path, content)
+    if isIDL(ext) || isCI(ext) || buildLang(path) != "" {
+        return nil, false
+    }
+    switch opts.Backend {
+    case Regex:
+        return nil, false
+    case TreeSitter:
+        if treeSitterTags != nil {
+            return nil, false
+        }
+    }
+    if _, err := lookCtags(opts.ctags()); err != nil {
+        return nil, false
+    }
+    if enc, endings, _ := normalize(content); enc != "" || endings != "" {
+        return nil, false
+    }
+    return ctagsArgs(opts.ctags(), path, ext, opts.kinds(ext)), true
+}
+
+/*
+    Run the ctags at bin once on every path, passing them with -L -, and return the tags
+    of each path. timeout is that of a single file, 0 for CommandTimeout for the batch.
+*/
+func runCtagsBatch(bin string, paths []string, args []string, timeout time.Duration) (map[string][]tag, error) {
+    ctx := context.Background()
+    if timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout*time.Duration(len(paths)))
+        defer cancel()
+    }
+
+    useJSON := ctagsJSON(bin)
+    if useJSON {
+        args = append([]string{"--output-format=json", "--fields=+nKS", "-f", "-"}, args...)
+    } else {
+        args = append([]string{"-x"}, args...)
+    }
+    stdin    := strings.NewReader(strings.Join(paths, "\n") + "\n")
+    out, err := RunCommand(ctx, stdin, bin, append(args, "-L", "-")...)
+    if err != nil {
+        return nil, err
+    }
+
+    tags := map[string][]tag{}
+    for _, path := range paths {
+        tags[path] = []tag{}
+    }
+    buff := bufio.NewScanner(bytes.NewReader(out))
+    buff.Buffer(nil, ctagsLineMax)
+    for buff.Scan() {
+        if useJSON {
+            if t, ok := batchJSONTag(buff.Bytes()); ok {
+                if _, known := tags[t.Path]; known {
+                    tags[t.Path] = append(tags[t.Path], t.tag())
+                }
+            }
+            continue
+        }
+        line := buff.Text()
+        path := ctagsLinePath(line, tags)
+        if path == "" {
+            continue
+        }
+        if t, ok := parseCtagsLine(line, path); ok {
+            tags[path] = append(tags[path], t)
+        }
+    }
+    if err := buff.Err(); err != nil {
+        return nil, WithCode(ECommand, fmt.Errorf("failed to read the ctags output of a batch: %w", err))
+    }
+    return tags, nil
+}
+
+func batchJSONTag(line []byte) (jsonTag, bool) {
+    var t jsonTag
+    if err := json.Unmarshal(line, &t); err != nil || t.Type != "tag" {
+        return jsonTag{}, false
+    }
+    return t, true
+}
+
+/*
+    The path of paths a line of ctags -x output is about, the longest that fits since
+    paths may have spaces, or "" if it's none of them
+*/
+func ctagsLinePath(line string, paths map[string][]tag) string {
+    k := lineField(strings.Fields(line))
+    if k < 0 {
+        return ""
+    }
+
+    // The path follows the line number
+    rest := line
+    for i := 0; i <= k; i++ {
+        rest = strings.TrimLeft(rest, " \t")
+        if end := strings.IndexAny(rest, " \t"); end >= 0 {
+            rest = rest[end:]
+        } else {
+            rest = ""
+        }
+    }
+    rest = strings.TrimLeft(rest, " \t")
+
+    path := ""
+    for end := 1; end <= len(rest); end++ {
+        if end < len(rest) && rest[end] != ' ' && rest[end] != '\t' {
+            continue
+        }
+        if _, ok := paths[rest[:end]]; ok {
+            path = rest[:end]
+        }
+    }
+    return path
+}
@@ -0,0 +1,123 @@
+/*
+    braces.go
+
+    Scanning source for braces while skipping string and character literals and
+    comments, so a "}" in a string or a commented-out brace doesn't end a function early.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, Go, Java, Javascript, Kotlin, Rust and Typescript
+*/
+
+package parse
+
+import (
+    "bytes"
+)
+
+/*
+    LineComment  - Starts a comment running to the end of the line
+    BlockComment - Start and end of a comment that may span lines
+    Quotes       - Characters delimiting literals with backslash escapes
+    RawQuotes    - Characters delimiting literals without escapes, e.g. Go `raw strings`
+    TextBlocks   - True if the language has triple-quoted text blocks
+*/
+type syntax struct {
+    LineComment  string
+    BlockComment [2]string
+    Quotes       string
+    RawQuotes    string
+    TextBlocks   bool
+}
+
+var cSyntax = syntax{"//", [2]string{"/*", "*/"}, "\"'", "", false}
+
+// Keyed by file extension. Languages not listed use cSyntax
+var syntaxes = map[string]syntax{
+    "java": {"//", [2]string{"/*", "*/"}, "\"'", "", true},
+    "kt":   {"//", [2]string{"/*", "*/"}, "\"'", "", true},
+    "cs":   {"//", [2]string{"/*", "*/"}, "\"'", "", false},
+    "go":   {"//", [2]string{"/*", "*/"}, "\"'", "`", false},
+    "js":   {"//", [2]string{"/*", "*/"}, "\"'", "`", false},
+    "ts":   {"//", [2]string{"/*", "*/"}, "\"'", "`", false},
+    // ' also starts Rust lifetimes, so only " is treated as a quote
+    "rs":   {"//", [2]string{"/*", "*/"}, "\"", "", false},
+}
+
+func syntaxFor(ext string) syntax {
+    if s, ok := syntaxes[ext]; ok {
+        return s
+    }
+    return cSyntax
+}
+
+/*
+    If a comment or literal starts at i, return the index just past it. Otherwise return i.
+    Unterminated comments and literals run to the end of arr.
+*/
+func (s syntax) skip(arr []byte, i int) int {
+    rest := arr[i:]
+
+    switch {
+    case s.LineComment != "" && bytes.HasPrefix(rest, []byte(s.LineComment)):
+        if end := bytes.IndexByte(rest, '\n'); end >= 0 {
+            return i + end
+        }
+        return len(arr)
+
+    case s.BlockComment[0] != "" && bytes.HasPrefix(rest, []byte(s.BlockComment[0])):
+        open := len(s.BlockComment[0])
+        if end := bytes.Index(rest[open:], []byte(s.BlockComment[1])); end >= 0 {
+            return i + open + end + len(s.BlockComment[1])
+        }
+        return len(arr)
+
+    case s.TextBlocks && bytes.HasPrefix(rest, []byte(`"""`)):
+        if end := bytes.Index(rest[3:], []byte(`"""`)); end >= 0 {
+            return i + 3 + end + 3
+        }
+        return len(arr)
+
+    case bytes.IndexByte([]byte(s.RawQuotes), arr[i]) >= 0:
+        if end := bytes.IndexByte(rest[1:], arr[i]); end >= 0 {
+            return i + 1 + end + 1
+        }
+        return len(arr)
+
+    case bytes.IndexByte([]byte(s.Quotes), arr[i]) >= 0:
+        quote := arr[i]
+        for j := i + 1; j < len(arr); j++ {
+            switch arr[j] {
+            case '\\':
+                j++
+            case quote:
+                return j + 1
+            case '\n':
+                // Literals don't span lines, so this quote wasn't one (e.g. an apostrophe
+                // in a preprocessor #error line). Count it as a plain character.
+                if quote == '\'' {
+                    return i + 1
+                }
+            }
+        }
+        return len(arr)
+    }
+
+    return i
+}
+
+/*
+    Index of the first { at or after i outside comments and literals, -1 if there's none
+*/
+func (s syntax) openBrace(arr []byte, i int) int {
+    for i < len(arr) {
+        if next := s.skip(arr, i); next != i {
+            i = next
+            continue
+        }
+        if arr[i] == '{' {
+            return i
+        }
+        i++
+    }
+    return -1
+}
@@ -0,0 +1,39 @@
+package parse
+
+import (
+    "testing"
+)
+
+/*
+    Braces in literals and comments don't end a function early, and the function ends
+    at the brace that closes it
+*/
+func TestBalance(t *testing.T) {
+    tests := []struct {
+        name string
+        ext  string
+        src  string
+        want string
+    }{
+        {"string", "c", `int f() { puts("}"); return 0; } int g() {}`, `int f() { puts("}"); return 0; }`},
+        {"escaped quote", "c", `int f() { puts("\"}"); } x`, `int f() { puts("\"}"); }`},
+        {"char", "java", `int f() { char c = '}'; return c; } }`, `int f() { char c = '}'; return c; }`},
+        {"line comment", "cpp", "int f() { // }\n    return 0;\n}\n}", "int f() { // }\n    return 0;\n}"},
+        {"block comment", "cs", "int F() { /* } */ return 0; } }", "int F() { /* } */ return 0; }"},
+        {"raw string", "go", "func f() string { return `}` } }", "func f() string { return `}` }"},
+        {"text block", "java", "String f() { return \"\"\"\n}\n\"\"\"; } }", "String f() { return \"\"\"\n}\n\"\"\"; }"},
+        {"apostrophe in #error", "c", "int f() {\n#error don't\n    return 0;\n} }", "int f() {\n#error don't\n    return 0;\n}"},
+        {"nested", "c", "int f() { if (x) { y(); } } }", "int f() { if (x) { y(); } }"},
+        {"unbalanced", "c", `int f() { puts("}");`, ""},
+    }
+
+    for _, test := range tests {
+        got, end := balance([]byte(test.src), 0, test.ext)
+        if got != test.want {
+            t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+        }
+        if end != len(test.want) {
+            t.Errorf("%s: got end %d, want %d", test.name, end, len(test.want))
+        }
+    }
+}
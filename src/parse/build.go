@@ -0,0 +1,186 @@
+/*
+    build.go
+
+    Build logic: Makefile targets and CMake function() and macro() definitions, saved as
+    functions so they can be searched like the code they build.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: Make and CMake
+*/
+
+package parse
+
+import (
+    "path/filepath"
+    "regexp"
+    "strings"
+)
+
+// Function.Kind of Makefile targets and of CMake functions and macros
+const (
+    KindTarget = "target"
+    KindMacro  = "macro"
+)
+
+var cmakeStart = regexp.MustCompile(`(?i)^\s*(function|macro)\s*\(\s*([\w.+-]+)`)
+var cmakeEnd   = regexp.MustCompile(`(?i)^\s*end(function|macro)\s*\(`)
+
+/*
+    "make" or "cmake" if name is the file name of a build file of either, "" otherwise
+*/
+func buildLang(name string) string {
+    base := filepath.Base(name)
+    switch {
+    case base == "Makefile" || base == "makefile" || base == "GNUmakefile" || strings.HasSuffix(base, ".mk"):
+        return "make"
+    case base == "CMakeLists.txt" || strings.HasSuffix(base, ".cmake"):
+        return "cmake"
+    }
+    return ""
+}
+
+/*
+    Parse the targets of a Makefile or the functions and macros of a CMake file. Build
+    logic has no types, so everything found is kept whatever opts.Types says.
+*/
+func parseBuildFile(path string, fname string, content []byte, opts Options) (File, error) {
+
+    lines := strings.Split(strings.Replace(string(content), "\r\n", "\n", -1), "\n")
+    var funcs []Function
+    if buildLang(path) == "make" {
+        funcs = makeTargets(lines)
+    } else {
+        funcs = cmakeCommands(lines)
+    }
+
+    // Lines were split the same way as lineOffsets does, so their numbers line up
+    offsets := lineOffsets(content)
+    for i := range funcs {
+        funcs[i].StartOffset, funcs[i].EndOffset = lineSpan(content, offsets, funcs[i].line, funcs[i].EndLine)
+        funcs[i].locate(offsets, len(content))
+    }
+
+    if len(funcs) == 0 {
+        return File{}, ErrNoFuncs
+    }
+    return File{Id: hash(path), Name: fname, Path: path, Funcs: funcs, Backend: Regex}, nil
+}
+
+/*
+    Rules of a Makefile, one Function per target with the prerequisites as its header and
+    the recipe as its source. Special targets like .PHONY and define ... endef blocks
+    are skipped.
+*/
+func makeTargets(lines []string) []Function {
+    funcs  := []Function{}
+    define := false
+
+    for i := 0; i < len(lines); i++ {
+        line := lines[i]
+        word := strings.Fields(line)
+
+        if len(word) > 0 && (word[0] == "define" || word[0] == "endef") {
+            define = word[0] == "define"
+            continue
+        }
+        if define || line == "" || line[0] == '\t' || line[0] == '#' || line[0] == ' ' {
+            continue
+        }
+
+        // Rule lines may continue with a trailing backslash
+        start := i
+        rule  := line
+        for strings.HasSuffix(rule, "\\") && i+1 < len(lines) {
+            i++
+            rule = strings.TrimSuffix(rule, "\\") + " " + lines[i]
+        }
+
+        colon := strings.Index(rule, ":")
+        if colon <= 0 || strings.Contains(rule[:colon], "=") {
+            continue
+        }
+        rest := strings.TrimLeft(rule[colon+1:], ":")
+
+        // Variable assignments: x := y, x ::= y, and target-specific variables: t: X = y
+        if strings.HasPrefix(rest, "=") || strings.Contains(strings.Split(rest, ";")[0], "=") {
+            continue
+        }
+
+        // The recipe is every following line starting with a tab, with blank lines and
+        // comments in between
+        end := i
+        for j := i + 1; j < len(lines); j++ {
+            if strings.HasPrefix(lines[j], "\t") {
+                end = j
+            } else if strings.TrimSpace(lines[j]) != "" && !strings.HasPrefix(lines[j], "#") {
+                break
+            }
+        }
+        source := strings.Join(lines[start:end+1], "\n")
+        header := strings.Join(strings.Fields(rule), " ")
+
+        for _, target := range strings.Fields(rule[:colon]) {
+            if strings.HasPrefix(target, ".") {
+                continue
+            }
+            funcs = append(funcs, Function{
+                Id:     hash(target+header),
+                Name:   target,
+                Kind:   KindTarget,
+                Header: header,
+                Source: source,
+                line:   start+1,
+
+                EndLine: end+1,
+            })
+        }
+        i = end
+    }
+    return funcs
+}
+
+/*
+    function() and macro() definitions of a CMake file, up to their endfunction() or
+    endmacro()
+*/
+func cmakeCommands(lines []string) []Function {
+    funcs := []Function{}
+
+    for i := 0; i < len(lines); i++ {
+        m := cmakeStart.FindStringSubmatch(lines[i])
+        if m == nil {
+            continue
+        }
+
+        // Arguments may span lines up to the closing parenthesis
+        header := lines[i]
+        for j := i + 1; !strings.Contains(header, ")") && j < len(lines); j++ {
+            header += " " + lines[j]
+        }
+        if k := strings.Index(header, ")"); k >= 0 {
+            header = header[:k+1]
+        }
+
+        end := i
+        for end < len(lines) && !cmakeEnd.MatchString(lines[end]) {
+            end++
+        }
+        if end == len(lines) {
+            continue
+        }
+
+        header = strings.Join(strings.Fields(header), " ")
+        funcs  = append(funcs, Function{
+            Id:     hash(m[2]+header),
+            Name:   m[2],
+            Kind:   KindMacro,
+            Header: header,
+            Source: strings.Join(lines[i:end+1], "\n"),
+            line:   i+1,
+
+            EndLine: end+1,
+        })
+        i = end
+    }
+    return funcs
+}
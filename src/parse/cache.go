@@ -0,0 +1,153 @@
+/*
+    cache.go
+
+    Cache of parse results, so unchanged files aren't parsed again on every run. Entries
+    are keyed by the content of the file together with the version of the extractor and
+    a fingerprint of the options, so upgrading pakkun, upgrading ctags or changing the
+    types map never serves a stale extraction:
+
+        parse.ParseFile(path, parse.WithTypes(types), parse.WithCache(parse.DirCache("/var/cache/pakkun")))
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+)
+
+/*
+    Version of the extractor. Bump it with every change that extracts something different
+    from the same file, it invalidates every cached result.
+*/
+const ExtractorVersion = "2026.10.16.13"
+
+/*
+    Where parse results are kept. Implementations must be safe for concurrent use.
+*/
+type Cache interface {
+    Get(key string) (CacheEntry, bool)
+    Put(key string, entry CacheEntry) error
+}
+
+/*
+    File    - What the file parsed to. Its Id, Name and Path are those of the file that
+              was parsed, files with the same content elsewhere get their own
+    NoFuncs - The file had no function of the desired types
+*/
+type CacheEntry struct {
+    File    File
+    NoFuncs bool `json:",omitempty"`
+}
+
+/*
+    Cache keeping one JSON file per entry in a directory
+*/
+type DirCache string
+
+func (d DirCache) Get(key string) (CacheEntry, bool) {
+    var entry CacheEntry
+    data, err := ioutil.ReadFile(d.path(key))
+    if err != nil || json.Unmarshal(data, &entry) != nil {
+        return CacheEntry{}, false
+    }
+    return entry, true
+}
+
+/*
+    Write the entry to a temporary file first, so readers never see half of it
+*/
+func (d DirCache) Put(key string, entry CacheEntry) error {
+    data, err := json.Marshal(entry)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(string(d), 0755); err != nil {
+        return err
+    }
+
+    tmp, err := ioutil.TempFile(string(d), key+".*.tmp")
+    if err != nil {
+        return err
+    }
+    _, err = tmp.Write(data)
+    if cerr := tmp.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        os.Remove(tmp.Name())
+        return err
+    }
+    return os.Rename(tmp.Name(), d.path(key))
+}
+
+func (d DirCache) path(key string) string {
+    return filepath.Join(string(d), key+".json")
+}
+
+/*
+    Key of the file at path, content, parsed with opts
+*/
+func cacheKey(path string, content []byte, opts Options) string {
+    h := sha256.New()
+    h.Write([]byte(ExtractorVersion + "\x00" + extractor(path, content, opts) + "\x00" + filepath.Ext(path) + "\x00"))
+    h.Write([]byte(opts.fingerprint()))
+    h.Write([]byte{0})
+    h.Write(content)
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+/*
+    What would find the functions of the file at path, with its version when it's ctags
+*/
+func extractor(path string, content []byte, opts Options) string {
+    ext := contentExt(path, content)
+    switch {
+    case isIDL(ext) || isCI(ext) || buildLang(path) != "":
+        return string(Regex)
+    case opts.Backend == TreeSitter && treeSitterTags != nil:
+        return string(TreeSitter)
+    case opts.Backend == Ctags || (opts.Backend != Regex && ctagsInstalled(opts.ctags())):
+        return string(Ctags) + " " + ctagsVersion(opts.ctags())
+    }
+    return string(Regex)
+}
+
+/*
+    Options that change what is extracted. Limits other than the function count and
+    the observer only decide whether a file is parsed at all.
+*/
+func (opts Options) fingerprint() string {
+    tokenizer := ""
+    if opts.Tokenizer != nil {
+        tokenizer = opts.Tokenizer.Name()
+    }
+    data, _ := json.Marshal(struct {
+        Types              map[string]bool
+        Backend            Backend
+        Kinds              map[string]string
+        CtagsPath          string
+        NoSource           bool
+        Patterns           []Pattern
+        Flatten            bool
+        Constructors       bool
+        Abstract           bool
+        Classes            bool
+        Symbols            bool
+        Context            bool
+        Tokenizer          string
+        Entities           []Entity
+        IdHash             IdHash
+        MaxFuncs           int
+        Skip               SkipRules
+    }{opts.Types, opts.Backend, opts.Kinds, opts.CtagsPath, opts.NoSource, opts.Patterns,
+      opts.Flatten, opts.Constructors, opts.Abstract, opts.Classes, opts.Symbols, opts.Context, tokenizer,
+      opts.Entities, opts.IdHash, opts.Limits.MaxFuncs, opts.Skip})
+    return string(data)
+}
@@ -0,0 +1,220 @@
+/*
+    cheaders.go
+
+    C function definitions that don't fit on one line: return types on a line of their
+    own, and K&R style definitions that declare parameter types between the ) and the {
+
+        static int
+        add(a, b)
+            int a;
+            int b;
+        {
+
+    and modern C++ headers with attributes, specifiers and trailing return types.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++
+*/
+
+package parse
+
+import (
+    "strings"
+)
+
+// Extensions of C and C++ sources and headers, and of their GPU dialects
+var cLike = map[string]bool{"c":true, "h":true, "cpp":true, "hpp":true, "cu":true, "cuh":true, "cl":true,
+                            "hlsl":true, "glsl":true}
+
+// Storage class allowed in K&R parameter declarations, not part of the type
+const register = "register"
+
+/*
+    True if line n (1-based) of content looks like the return type of a definition starting
+    on the next line: a few words that don't end a statement, a block or a comment
+*/
+func returnTypeLine(content []byte, lines []int, n int) bool {
+    end := len(content)
+    if n < len(lines) {
+        end = lines[n]
+    }
+    line := strings.TrimSpace(string(content[lines[n-1]:end]))
+
+    if line == "" || len(strings.Fields(line)) > 4 || strings.ContainsAny(line, "(=;{}") {
+        return false
+    }
+    for _, prefix := range []string{"#", "//", "/*", "*"} {
+        if strings.HasPrefix(line, prefix) {
+            return false
+        }
+    }
+    return !strings.HasSuffix(line, "*/") && !strings.HasSuffix(line, ",") && !strings.HasSuffix(line, ":")
+}
+
+/*
+    Rewrite a K&R definition header as the equivalent prototype so its parameter types can
+    be checked like any other header:
+
+        add(a, b) int a; int b;   ->   int add(int a, int b)
+
+    Parameters without a declaration and a missing return type default to int, as in K&R C.
+    Any other header is returned unchanged.
+*/
+func krPrototype(header string) string {
+    open  := strings.Index(header, "(")
+    close := strings.Index(header, ")")
+    if open < 0 || close < open {
+        return header
+    }
+
+    decls := strings.TrimSpace(header[close+1:])
+    if len(decls) < 2 || !strings.HasSuffix(decls, ";") || strings.ContainsAny(decls, "=()") {
+        return header
+    }
+
+    // K&R parameter lists only name the parameters
+    names := strings.Split(header[open+1:close], ",")
+    for _, name := range names {
+        name = strings.TrimSpace(name)
+        if len(strings.Fields(name)) != 1 || strings.ContainsAny(name, "*&[.") || name == "void" {
+            return header
+        }
+    }
+
+    types := map[string]string{}
+    for _, decl := range strings.Split(decls, ";") {
+        // int a, *b, c[] declares three parameters of base type int
+        parts := strings.Split(decl, ",")
+        words := []string{}
+        for _, w := range strings.Fields(parts[0]) {
+            if w != register {
+                words = append(words, w)
+            }
+        }
+        if len(words) < 2 {
+            continue
+        }
+        base    := strings.Join(words[:len(words)-1], " ")
+        parts[0] = words[len(words)-1]
+
+        for _, p := range parts {
+            p      = strings.TrimSpace(p)
+            name  := strings.TrimLeft(p, "*")
+            stars := p[:len(p)-len(name)]
+            dims  := strings.Count(name, "[")
+            name   = strings.TrimSpace(strings.Split(name, "[")[0])
+            types[name] = base + stars + strings.Repeat("[]", dims)
+        }
+    }
+
+    params := []string{}
+    for _, name := range names {
+        name = strings.TrimSpace(name)
+        typ, ok := types[name]
+        if !ok {
+            typ = "int"
+        }
+        params = append(params, typ+" "+name)
+    }
+
+    prefix := strings.TrimSpace(header[:open])
+    if len(strings.Fields(prefix)) == 1 {
+        prefix = "int " + prefix
+    }
+    return prefix + "(" + strings.Join(params, ", ") + ")"
+}
+
+// C++ specifiers before the return type that aren't part of it
+var cppSpecifiers = map[string]bool{"constexpr":true, "consteval":true, "constinit":true, "inline":true,
+                                    "virtual":true, "explicit":true, "friend":true, "extern":true}
+
+/*
+    Rewrite a modern C++ header into the plain form the header parser understands:
+
+        [[nodiscard]] constexpr auto f(int a) const noexcept -> int   ->   int f(int a)
+
+    Attributes, specifiers that aren't types, and qualifiers after the parameter list
+    (const, noexcept, override, final, ref-qualifiers, = 0, ...) are dropped, and a trailing
+    return type replaces auto. A terminating ; is kept so declarations are still rejected.
+*/
+func cppPrototype(header string) string {
+    header = strings.TrimSpace(header)
+
+    // [[nodiscard]], [[gnu::always_inline]], ...
+    for {
+        i := strings.Index(header, "[[")
+        j := strings.Index(header, "]]")
+        if i < 0 || j < i {
+            break
+        }
+        header = header[:i] + " " + header[j+2:]
+    }
+
+    open := strings.Index(header, "(")
+    if open < 0 {
+        return header
+    }
+    close, depth := -1, 0
+    for i := open; i < len(header) && close < 0; i++ {
+        switch header[i] {
+        case '(':
+            depth++
+        case ')':
+            depth--
+            if depth == 0 {
+                close = i
+            }
+        }
+    }
+    if close < 0 {
+        return header
+    }
+
+    tail := strings.TrimSpace(strings.Split(header[close+1:], "{")[0])
+    term := ""
+    if strings.HasSuffix(tail, ";") {
+        term = ";"
+        tail = strings.TrimSuffix(tail, ";")
+    }
+
+    words := []string{}
+    for _, w := range strings.Fields(header[:open]) {
+        if !cppSpecifiers[w] {
+            words = append(words, w)
+        }
+    }
+
+    // auto f() -> int
+    if i := strings.Index(tail, "->"); i >= 0 {
+        ret := strings.TrimSpace(tail[i+2:])
+        if j := strings.Index(ret, "="); j >= 0 {
+            ret = strings.TrimSpace(ret[:j])
+        }
+        for k := 0; k < len(words)-1; k++ {
+            if words[k] == "auto" {
+                words[k] = ret
+            }
+        }
+    }
+
+    return strings.Join(words, " ") + header[open:close+1] + term
+}
+
+/*
+    C writes pointer returns on the name or on their own: char *name(, char * name(.
+    Move the stars onto the return type words so each word is a type.
+*/
+func cReturnWords(words []string, fname string) ([]string, string) {
+    name  := strings.TrimLeft(fname, "*&")
+    words  = append(words, fname[:len(fname)-len(name)])
+
+    merged := []string{}
+    for _, w := range words {
+        if strings.Trim(w, "*&") == "" && len(merged) > 0 {
+            merged[len(merged)-1] += w
+        } else if w != "" {
+            merged = append(merged, w)
+        }
+    }
+    return merged, name
+}
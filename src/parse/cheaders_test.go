@@ -0,0 +1,83 @@
+package parse
+
+import (
+    "strings"
+    "testing"
+)
+
+/*
+    K&R headers are rewritten as the prototypes they stand for
+*/
+func TestKRPrototype(t *testing.T) {
+    tests := []struct {
+        header string
+        want   string
+    }{
+        {"int add(a, b) int a; int b;", "int add(int a, int b)"},
+        {"long sum(n, v) int n; long *v;", "long sum(int n, long* v)"},
+        {"add(a, b) int a; int b;", "int add(int a, int b)"},
+        {"int f(a, b) int a;", "int f(int a, int b)"},
+        {"int g(a) register char a;", "int g(char a)"},
+        {"int h(int a, int b)", "int h(int a, int b)"},
+    }
+
+    for _, test := range tests {
+        if got := krPrototype(test.header); got != test.want {
+            t.Errorf("krPrototype(%q) = %q, want %q", test.header, got, test.want)
+        }
+    }
+}
+
+/*
+    C definitions written over several lines are found whole, with their header on one
+    line and their body verbatim, or flattened with a space for every line break
+*/
+func TestMultiLineHeaders(t *testing.T) {
+    tests := []struct {
+        name   string
+        src    string
+        header string
+        source string
+        flat   string
+    }{
+        {"K&R", "int\nadd(a, b)\nint a; int b;\n{\n\treturn a + b;\n}\n",
+         "int add(a, b) int a; int b;",
+         "int\nadd(a, b)\nint a; int b;\n{\n\treturn a + b;\n}",
+         "int add(a, b) int a; int b; { return a + b; }"},
+        {"GNU style", "static long\nmul(long a, long b)\n{\n  return a * b;\n}\n",
+         "static long mul(long a, long b)",
+         "static long\nmul(long a, long b)\n{\n  return a * b;\n}",
+         "static long mul(long a, long b) { return a * b; }"},
+        {"parameters over lines", "int clamp(int v,\n          int lo,\n          int hi) {\n\treturn v;\n}\n",
+         "int clamp(int v, int lo, int hi)",
+         "int clamp(int v,\n          int lo,\n          int hi) {\n\treturn v;\n}",
+         "int clamp(int v, int lo, int hi) { return v; }"},
+    }
+
+    types := map[string]bool{"int": true, "long": true}
+    for _, test := range tests {
+        for _, flat := range []bool{false, true} {
+            file, err := ParseReader("test.c", strings.NewReader(test.src), Options{Types: types, Backend: Regex, Flatten: flat})
+            if err != nil {
+                t.Errorf("%s: %v", test.name, err)
+                continue
+            }
+            if len(file.Funcs) != 1 {
+                t.Errorf("%s: got %d functions, want 1", test.name, len(file.Funcs))
+                continue
+            }
+
+            fn   := file.Funcs[0]
+            want := test.source
+            if flat {
+                want = test.flat
+            }
+            if fn.Header != test.header {
+                t.Errorf("%s: got header %q, want %q", test.name, fn.Header, test.header)
+            }
+            if fn.Source != want {
+                t.Errorf("%s: got source %q, want %q", test.name, fn.Source, want)
+            }
+        }
+    }
+}
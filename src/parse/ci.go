@@ -0,0 +1,282 @@
+/*
+    ci.go
+
+    Script blocks embedded in CI pipeline configs, saved as pseudo-functions so shell
+    logic hidden in pipelines is searchable alongside regular code.
+
+        GitHub Actions   jobs.<job>.steps[].run
+        GitLab CI        <job>.script, <job>.before_script, <job>.after_script
+
+    Only the subset of YAML these files use is understood: block mappings, block and flow
+    sequences, plain and quoted scalars, and | or > block scalars.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: YAML
+*/
+
+package parse
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Function.Kind of CI script blocks
+const KindScript = "script"
+
+// Function.Flags naming the CI system a script block was found in
+const (
+    GitHubActions = "github-actions"
+    GitLabCI      = "gitlab-ci"
+)
+
+// GitLab keys at the top level that aren't jobs
+var gitlabReserved = map[string]bool{"stages":true, "variables":true, "default":true, "include":true,
+                                     "workflow":true, "image":true, "services":true, "cache":true}
+
+var gitlabScripts = []string{"before_script", "script", "after_script"}
+
+func isCI(ext string) bool {
+    return ext == "yml" || ext == "yaml"
+}
+
+/*
+    One non-blank, non-comment line of YAML
+*/
+type yamlLine struct {
+    No     int
+    Indent int
+    Text   string
+}
+
+func (l yamlLine) key() (string, string, bool) {
+    text := strings.TrimPrefix(l.Text, "- ")
+    i    := strings.Index(text, ":")
+    if i < 0 || (i+1 < len(text) && text[i+1] != ' ') {
+        return "", "", false
+    }
+    return strings.Trim(strings.TrimSpace(text[:i]), `"'`), strings.TrimSpace(text[i+1:]), true
+}
+
+func yamlLines(content []byte) []yamlLine {
+    lines := []yamlLine{}
+    for i, line := range strings.Split(strings.Replace(string(content), "\t", "    ", -1), "\n") {
+        text := strings.TrimSpace(line)
+        if text == "" || strings.HasPrefix(text, "#") {
+            // Kept as empty lines so block scalars keep their blank lines
+            lines = append(lines, yamlLine{No: i+1, Indent: -1})
+            continue
+        }
+        lines = append(lines, yamlLine{No: i+1, Indent: len(line)-len(strings.TrimLeft(line, " ")), Text: text})
+    }
+    return lines
+}
+
+/*
+    Index of the next line after i that isn't blank, len(lines) if none
+*/
+func nextLine(lines []yamlLine, i int) int {
+    for i++; i < len(lines) && lines[i].Indent < 0; i++ {
+    }
+    return i
+}
+
+/*
+    Return the value of the key on lines[i] as text, one line per sequence item, and the
+    index of the first line after it. indent is the indentation of the key.
+*/
+func yamlValue(lines []yamlLine, i int, indent int, inline string) (string, int) {
+    // Block scalar, | or > with an optional chomping indicator
+    if inline != "" && (inline[0] == '|' || inline[0] == '>') {
+        text  := []string{}
+        base  := -1
+        end   := i + 1
+        for j := i + 1; j < len(lines); j++ {
+            if lines[j].Indent < 0 {
+                text = append(text, "")
+                continue
+            }
+            if lines[j].Indent <= indent {
+                break
+            }
+            if base < 0 {
+                base = lines[j].Indent
+            }
+            text = append(text, strings.Repeat(" ", lines[j].Indent-base) + lines[j].Text)
+            end  = j + 1
+        }
+        return strings.TrimRight(strings.Join(text, "\n"), "\n"), end
+    }
+
+    // Flow sequence: [a, b]
+    if strings.HasPrefix(inline, "[") && strings.HasSuffix(inline, "]") {
+        items := []string{}
+        for _, item := range strings.Split(inline[1:len(inline)-1], ",") {
+            items = append(items, unquote(item))
+        }
+        return strings.Join(items, "\n"), i + 1
+    }
+    if inline != "" {
+        return unquote(inline), i + 1
+    }
+
+    // Block sequence, which may be indented as much as the key itself
+    items := []string{}
+    j     := nextLine(lines, i)
+    for j < len(lines) && lines[j].Indent >= indent && strings.HasPrefix(lines[j].Text, "- ") {
+        itemIndent := lines[j].Indent
+        item, next := yamlValue(lines, j, itemIndent, strings.TrimSpace(lines[j].Text[2:]))
+
+        // Plain scalars may continue on more indented lines
+        for next < len(lines) && lines[next].Indent > itemIndent && !strings.ContainsAny(lines[j].Text[2:3], "|>") {
+            item += " " + lines[next].Text
+            next  = nextLine(lines, next)
+        }
+        items = append(items, item)
+        j     = nextLine(lines, next-1)
+    }
+    return strings.Join(items, "\n"), j
+}
+
+func unquote(s string) string {
+    s = strings.TrimSpace(s)
+    if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+        return s[1:len(s)-1]
+    }
+    return s
+}
+
+/*
+    Return the indices of the lines that are direct children of the mapping entry on
+    lines[i], i.e. the keys one level deeper up to the end of the entry
+*/
+func children(lines []yamlLine, i int) []int {
+    kids  := []int{}
+    depth := -1
+    for j := nextLine(lines, i); j < len(lines) && lines[j].Indent > lines[i].Indent; j = nextLine(lines, j) {
+        if depth < 0 {
+            depth = lines[j].Indent
+        }
+        if lines[j].Indent == depth {
+            kids = append(kids, j)
+        }
+    }
+    return kids
+}
+
+/*
+    Parse the script blocks of a GitHub Actions workflow or GitLab CI config. Script blocks
+    have no types, so they are kept whatever opts.Types says.
+*/
+func parseCIFile(path string, fname string, content []byte, opts Options) (File, error) {
+    lines   := yamlLines(content)
+    offsets := lineOffsets(content)
+    funcs   := []Function{}
+
+    // first and next index lines: the key and the first line after its value
+    add := func(job string, header string, src string, first int, next int, system string) {
+        if strings.TrimSpace(src) == "" {
+            return
+        }
+        last := next - 1
+        for last > first && lines[last].Indent < 0 {
+            last--
+        }
+
+        fn := Function{
+            Id:     hash(job+header+src),
+            Name:   job,
+            Kind:   KindScript,
+            Header: header,
+            Source: src,
+            Flags:  []string{system},
+            line:   lines[first].No,
+        }
+        fn.StartOffset, fn.EndOffset = lineSpan(content, offsets, lines[first].No, lines[last].No)
+        fn.locate(offsets, len(content))
+        funcs = append(funcs, fn)
+    }
+
+    top := []int{}
+    for i, l := range lines {
+        if l.Indent == 0 {
+            top = append(top, i)
+        }
+    }
+
+    for _, i := range top {
+        key, _, ok := lines[i].key()
+        if !ok {
+            continue
+        }
+
+        // GitHub Actions: jobs.<job>.steps[].run
+        if key == "jobs" {
+            for _, j := range children(lines, i) {
+                job, _, _ := lines[j].key()
+                for _, k := range children(lines, j) {
+                    if name, _, _ := lines[k].key(); name != "steps" {
+                        continue
+                    }
+                    step, items := 0, -1
+                    for s := nextLine(lines, k); s < len(lines) && lines[s].Indent >= lines[k].Indent; s = nextLine(lines, s) {
+                        item := strings.HasPrefix(lines[s].Text, "- ")
+                        if lines[s].Indent == lines[k].Indent && !item {
+                            break
+                        }
+                        if !item || (items >= 0 && lines[s].Indent != items) {
+                            continue
+                        }
+                        items = lines[s].Indent
+                        step++
+                        stepName, run, runLine, runEnd := fmt.Sprintf("step %d", step), "", -1, 0
+
+                        // Keys of the step: on the "- " line and the lines aligned with it
+                        indent := lines[s].Indent + 2
+                        for t := s; t < len(lines); t = nextLine(lines, t) {
+                            if t > s && lines[t].Indent <= lines[s].Indent {
+                                break
+                            }
+                            if t > s && lines[t].Indent != indent {
+                                continue
+                            }
+                            switch k, v, _ := lines[t].key(); k {
+                            case "name":
+                                stepName = unquote(v)
+                            case "run":
+                                run, runEnd = yamlValue(lines, t, indent, v)
+                                runLine     = t
+                            }
+                        }
+                        if runLine >= 0 {
+                            add(job, job+": "+stepName, run, runLine, runEnd, GitHubActions)
+                        }
+                    }
+                }
+            }
+            continue
+        }
+
+        // GitLab CI: <job>.script
+        if gitlabReserved[key] {
+            continue
+        }
+        for _, j := range children(lines, i) {
+            name, v, ok := lines[j].key()
+            if !ok {
+                continue
+            }
+            for _, s := range gitlabScripts {
+                if name == s {
+                    src, next := yamlValue(lines, j, lines[j].Indent, v)
+                    add(key, key+": "+name, src, j, next, GitLabCI)
+                }
+            }
+        }
+    }
+
+    if len(funcs) == 0 {
+        return File{}, ErrNoFuncs
+    }
+    return File{Id: hash(path), Name: fname, Path: path, Funcs: funcs, Backend: Regex}, nil
+}
@@ -0,0 +1,184 @@
+/*
+    classes.go
+
+    Classes, structs, enums and interfaces, with their fields and the functions declared
+    in them. They come from the class kinds of ctags, so only with the ctags backend, and
+    only when asked for with WithClasses.
+
+    Dependencies:        exuberant or universal ctags
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C# and Java
+*/
+
+package parse
+
+/*
+    Name    - Class name
+    Kind    - class, struct, union, enum or interface, as ctags reports it
+    Scope   - Enclosing class (or namespace, if ctags reports it), empty at the top level
+    Line    - Line the class is declared on
+    EndLine - Line the class ends on, 0 if its braces weren't found
+    Fields  - Names of its fields, struct members or enum constants, in order
+    Methods - Ids of its functions in File.Funcs, in order
+*/
+type Class struct {
+    Name    string
+    Kind    string
+    Scope   string   `json:",omitempty" bson:",omitempty"`
+    Line    int
+    EndLine int      `json:",omitempty" bson:",omitempty"`
+    Fields  []string `json:",omitempty" bson:",omitempty"`
+    Methods []uint64 `json:",omitempty" bson:",omitempty"`
+}
+
+/*
+    ctags kind letters of classes and their fields, added to the function kinds with
+    Options.Classes
+*/
+var classKinds = map[string]string{"java":"cgief", "cs":"cgisef", "c":"sugem", "h":"sugem", "cl":"sugem",
+                                   "glsl":"sugem", "cpp":"csugem", "hpp":"csugem", "cu":"csugem",
+                                   "cuh":"csugem", "hlsl":"csugem"}
+
+// Long names of class and field kinds, as ctags prints them
+var (
+    classKindNames = map[string]bool{"class":true, "struct":true, "union":true, "enum":true, "interface":true}
+    fieldKindNames = map[string]bool{"field":true, "member":true, "enumerator":true, "enum constant":true}
+)
+
+/*
+    True if tags of kind go in File.Classes rather than File.Symbols
+*/
+func isClassKind(kind string) bool {
+    return classKindNames[kind] || fieldKindNames[kind]
+}
+
+/*
+    Build the classes of a file from its class and field tags. A field belongs to the
+    innermost class around its line, or to the class named by its scope when the braces
+    of the class weren't found.
+*/
+func buildClasses(tags []tag, content []byte, lines []int, ext string) []Class {
+    classes := []Class{}
+    for _, t := range tags {
+        if !classKindNames[t.Kind] {
+            continue
+        }
+        classes = append(classes, Class{Name: t.Name, Kind: t.Kind, Scope: t.Scope, Line: t.Line,
+                                        EndLine: classEnd(content, lines, t.Line, ext)})
+    }
+
+    // Classes nested in another are found by their span when ctags doesn't report scopes
+    for i := range classes {
+        if classes[i].Scope == "" {
+            if outer := enclosingClass(classes, classes[i].Line, i); outer >= 0 {
+                classes[i].Scope = classes[outer].qualifiedName()
+            }
+        }
+    }
+
+    for _, t := range tags {
+        if !fieldKindNames[t.Kind] {
+            continue
+        }
+        if i := classOf(classes, t.Line, t.Scope); i >= 0 {
+            classes[i].Fields = append(classes[i].Fields, t.Name)
+        }
+    }
+    return classes
+}
+
+/*
+    Attach every function of file to the class it's declared in, setting Function.Class
+    and Class.Methods
+*/
+func attachMethods(file *File) {
+    for i, fn := range file.Funcs {
+        line := fn.StartLine
+        if line == 0 {
+            line = fn.line
+        }
+        if c := classOf(file.Classes, line, fn.scope); c >= 0 {
+            file.Funcs[i].Class     = file.Classes[c].qualifiedName()
+            file.Classes[c].Methods = append(file.Classes[c].Methods, fn.Id)
+        }
+    }
+}
+
+/*
+    Index of the innermost class whose braces contain line, or of the class named by the
+    last part of scope, -1 if there is none
+*/
+func classOf(classes []Class, line int, scope string) int {
+    if i := enclosingClass(classes, line, -1); i >= 0 {
+        return i
+    }
+    if scope == "" {
+        return -1
+    }
+
+    name := scope
+    for i := len(scope) - 1; i >= 0; i-- {
+        if scope[i] == '.' || scope[i] == ':' {
+            name = scope[i+1:]
+            break
+        }
+    }
+    for i, c := range classes {
+        if c.Name == name {
+            return i
+        }
+    }
+    return -1
+}
+
+/*
+    Index of the innermost class other than skip whose braces contain line, -1 if none
+*/
+func enclosingClass(classes []Class, line int, skip int) int {
+    inner := -1
+    for i, c := range classes {
+        if i != skip && c.EndLine > 0 && c.Line <= line && line <= c.EndLine &&
+           (inner < 0 || c.Line >= classes[inner].Line) {
+            inner = i
+        }
+    }
+    return inner
+}
+
+/*
+    Line of the } closing the class declared on line, 0 if it has no body, e.g. a forward
+    declaration, or its braces don't balance
+*/
+func classEnd(content []byte, lines []int, line int, ext string) int {
+    if line <= 0 || line > len(lines) {
+        return 0
+    }
+
+    lang := syntaxFor(ext)
+    for i := lines[line-1]; i < len(content); i++ {
+        if next := lang.skip(content, i); next != i {
+            i = next - 1
+            continue
+        }
+        switch content[i] {
+        case ';':
+            return 0
+        case '{':
+            if _, end := balance(content, lines[line-1], ext); end > 0 {
+                return lineOf(lines, end-1)
+            }
+            return 0
+        }
+    }
+    return 0
+}
+
+/*
+    Name of the class with the classes it's nested in, e.g. Outer.Inner
+*/
+func (c Class) qualifiedName() string {
+    if c.Scope == "" {
+        return c.Name
+    }
+    return c.Scope + "." + c.Name
+}
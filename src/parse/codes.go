@@ -0,0 +1,182 @@
+/*
+    codes.go
+
+    Codes for what goes wrong while indexing, so failures can be counted and tracked
+    across large crawls instead of grepped from free-text logs. The same code is used in
+    the log line, the summary and Run record of the run, the Warnings of the file and the
+    error answers of the server. E_ codes are errors, the file wasn't saved. W_ codes are
+    warnings, the file was handled but some of it, or all of it on purpose, was left out.
+
+    Codes are never renamed or reused once released, so counts stay comparable across
+    runs. New ones are added as new causes are told apart.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+)
+
+/*
+    What went wrong, e.g. E_TIMEOUT
+*/
+type Code string
+
+const (
+    ECtagsMissing   Code = "E_CTAGS_MISSING"   // ctags isn't installed where it was looked for
+    ECtagsUnusable  Code = "E_CTAGS_UNUSABLE"  // ctags found isn't universal or exuberant ctags
+    ECommand        Code = "E_COMMAND_FAILED"  // ctags, git or another command failed
+    ETimeout        Code = "E_TIMEOUT"         // Limits.Timeout, or a command killed for taking too long
+    EFileTooLarge   Code = "E_FILE_TOO_LARGE"  // Limits.MaxFileSize
+    ETooManyFuncs   Code = "E_TOO_MANY_FUNCS"  // Limits.MaxFuncs
+    ERead           Code = "E_READ"            // the file couldn't be read
+    EArchive        Code = "E_ARCHIVE"         // an archive couldn't be read
+    EIdCollision    Code = "E_ID_COLLISION"    // the file's Id is taken by another path
+    EStale          Code = "E_STALE"           // the file changed since it was saved, see ErrStale
+    EQuota          Code = "E_QUOTA"           // the storage quota of its repository is used up
+    EEncrypt        Code = "E_ENCRYPT"         // its functions couldn't be encrypted
+    EStore          Code = "E_STORE"           // the store failed to read or write it
+    ESpill          Code = "E_SPILL"           // it couldn't be spilled to disk or read back
+    EConfig         Code = "E_CONFIG"          // an invalid flag or configuration file
+    EUnknown        Code = "E_UNKNOWN"         // none of the above
+
+    WNoFuncs          Code = "W_NO_FUNCS"          // no function of the desired types
+    WSkippedBinary    Code = "W_SKIPPED_BINARY"    // left out by Skip
+    WSkippedMinified  Code = "W_SKIPPED_MINIFIED"  // left out by Skip
+    WSkippedGenerated Code = "W_SKIPPED_GENERATED" // left out by Skip
+    WExcludedVersion  Code = "W_EXCLUDED_VERSION"  // written for a language version excluded
+    WDuplicateRepo    Code = "W_DUPLICATE_REPO"    // a repository that is a near copy of another
+    WUnbalanced       Code = "W_UNBALANCED"        // a function dropped for its unbalanced braces
+    WUnknownType      Code = "W_UNKNOWN_TYPE"      // a function dropped for a type not in Options.Types
+)
+
+/*
+    True for W_ codes
+*/
+func (c Code) Warning() bool {
+    return strings.HasPrefix(string(c), "W_")
+}
+
+/*
+    An error given a code of its own, for failures CodeOf can't tell apart by their type,
+    e.g. a store or quota error
+*/
+type CodedError struct {
+    Code Code
+    Err  error
+}
+
+func (e *CodedError) Error() string {
+    return e.Err.Error()
+}
+
+func (e *CodedError) Unwrap() error {
+    return e.Err
+}
+
+/*
+    err with code, nil if err is
+*/
+func WithCode(code Code, err error) error {
+    if err == nil {
+        return nil
+    }
+    return &CodedError{Code: code, Err: err}
+}
+
+/*
+    The code of err, told from the errors it is or wraps. Empty for nil, E_UNKNOWN for
+    errors of no known kind.
+*/
+func CodeOf(err error) Code {
+    var (
+        coded     *CodedError
+        limit     *LimitError
+        skip      *SkipError
+        ctags     *CtagsError
+        command   *CommandError
+        collision *CollisionError
+        single    Collision
+        pathErr   *os.PathError
+    )
+    switch {
+    case err == nil:
+        return ""
+    case errors.As(err, &coded):
+        return coded.Code
+    case errors.As(err, &limit):
+        switch limit.Limit {
+        case LimitFileSize:
+            return EFileTooLarge
+        case LimitFuncs:
+            return ETooManyFuncs
+        }
+        return ETimeout
+    case errors.As(err, &skip):
+        switch skip.Skip {
+        case SkipBinary:
+            return WSkippedBinary
+        case SkipMinified:
+            return WSkippedMinified
+        }
+        return WSkippedGenerated
+    case errors.As(err, &ctags):
+        if ctags.Path == "" {
+            return ECtagsMissing
+        }
+        return ECtagsUnusable
+    case errors.As(err, &command):
+        if command.Timeout > 0 {
+            return ETimeout
+        }
+        return ECommand
+    case errors.As(err, &collision), errors.As(err, &single):
+        return EIdCollision
+    case errors.Is(err, ErrNoFuncs):
+        return WNoFuncs
+    case errors.Is(err, ErrStale):
+        return EStale
+    case errors.As(err, &pathErr):
+        return ERead
+    }
+    return EUnknown
+}
+
+/*
+    err prefixed with its code, for logs and reports, e.g. [E_TIMEOUT] a.java: timeout
+    exceeded, gave up after 5s
+*/
+func Coded(err error) string {
+    return fmt.Sprintf("[%s] %v", CodeOf(err), err)
+}
+
+/*
+    Code   - What was left out of the file, a W_ code
+    Count  - How many times in the file
+    Line   - Line of the first, 0 if unknown
+    Detail - What the first was, e.g. the unknown type or the function dropped
+*/
+type Warning struct {
+    Code   Code
+    Count  int
+    Line   int    `json:",omitempty" bson:",omitempty"`
+    Detail string `json:",omitempty" bson:",omitempty"`
+}
+
+/*
+    Add a warning with code to warnings, counted in the one already there for code if any
+*/
+func warn(warnings []Warning, code Code, line int, detail string) []Warning {
+    for i := range warnings {
+        if warnings[i].Code == code {
+            warnings[i].Count++
+            return warnings
+        }
+    }
+    return append(warnings, Warning{Code: code, Count: 1, Line: line, Detail: detail})
+}
@@ -0,0 +1,162 @@
+/*
+    collisions.go
+
+    Detection of Id collisions in a batch of parsed files. Ids are 63-bit hashes, so two
+    different files or functions can end up with the same one, and stores keyed by Id
+    would silently keep only one of them. Add every file of the batch and check what
+    was found:
+
+        collisions := parse.NewCollisions()
+        for _, file := range files {
+            collisions.Add(file)
+        }
+        if err := collisions.Err(); err != nil {
+            log.Println(err)
+        }
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "fmt"
+    "strings"
+    "sync"
+)
+
+const (
+    CollisionFile     = "file"
+    CollisionFunction = "function"
+)
+
+/*
+    Two different files or functions with the same Id
+
+    Kind  - CollisionFile or CollisionFunction
+    Id    - The Id they share
+    Paths - Path of the one seen first, then of the other, see File.Origin
+    Names - Names of the functions, empty for files
+*/
+type Collision struct {
+    Kind  string
+    Id    uint64
+    Paths [2]string
+    Names [2]string
+}
+
+func (c Collision) String() string {
+    if c.Kind == CollisionFile {
+        return fmt.Sprintf("file id %d of %s and %s", c.Id, c.Paths[0], c.Paths[1])
+    }
+    return fmt.Sprintf("function id %d of %s in %s and %s in %s", c.Id, c.Names[0], c.Paths[0], c.Names[1], c.Paths[1])
+}
+
+/*
+    A single collision is also an error, e.g. for the file skipped because of it
+*/
+func (c Collision) Error() string {
+    return c.String()
+}
+
+/*
+    Every collision of a batch
+*/
+type CollisionError struct {
+    Collisions []Collision
+}
+
+// Collisions listed by Error, the rest are only counted
+const collisionsShown = 5
+
+func (e *CollisionError) Error() string {
+    shown := []string{}
+    for i := 0; i < len(e.Collisions) && i < collisionsShown; i++ {
+        shown = append(shown, e.Collisions[i].String())
+    }
+    if more := len(e.Collisions) - len(shown); more > 0 {
+        shown = append(shown, fmt.Sprintf("and %d more", more))
+    }
+    return fmt.Sprintf("%d id collisions: %s", len(e.Collisions), strings.Join(shown, "; "))
+}
+
+type seenFunc struct {
+    path    string
+    name    string
+    content uint64
+}
+
+/*
+    The Ids seen in a batch and the collisions among them. Safe for concurrent use.
+*/
+type Collisions struct {
+    mu    sync.Mutex
+    files map[uint64]string
+    funcs map[uint64]seenFunc
+    found []Collision
+}
+
+func NewCollisions() *Collisions {
+    return &Collisions{files: map[uint64]string{}, funcs: map[uint64]seenFunc{}}
+}
+
+/*
+    Record the Ids of file and its functions and return the collisions they make with
+    the Ids seen before. A function found again, in the same or another file, has the
+    same Id and isn't one: functions only collide if their names or ContentIds differ.
+*/
+func (c *Collisions) Add(file File) []Collision {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    found := []Collision{}
+    origin := file.Origin()
+    if path, ok := c.files[file.Id]; ok && path != origin {
+        found = append(found, Collision{Kind: CollisionFile, Id: file.Id, Paths: [2]string{path, origin}})
+    } else {
+        c.files[file.Id] = origin
+    }
+
+    for _, fn := range file.Funcs {
+        seen, ok := c.funcs[fn.Id]
+        if !ok {
+            c.funcs[fn.Id] = seenFunc{path: origin, name: fn.Name, content: fn.ContentId}
+            continue
+        }
+        differ := seen.content != 0 && fn.ContentId != 0 && seen.content != fn.ContentId
+        if seen.name != fn.Name || differ {
+            found = append(found, Collision{Kind: CollisionFunction, Id: fn.Id, Paths: [2]string{seen.path, origin},
+                                            Names: [2]string{seen.name, fn.Name}})
+        }
+    }
+
+    c.found = append(c.found, found...)
+    return found
+}
+
+/*
+    Record a collision found elsewhere, e.g. against a file saved by an earlier batch,
+    unless it was already found
+*/
+func (c *Collisions) Report(collision Collision) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for _, found := range c.found {
+        if found == collision {
+            return
+        }
+    }
+    c.found = append(c.found, collision)
+}
+
+/*
+    A *CollisionError with every collision found so far, nil if there were none
+*/
+func (c *Collisions) Err() error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if len(c.found) == 0 {
+        return nil
+    }
+    return &CollisionError{Collisions: append([]Collision{}, c.found...)}
+}
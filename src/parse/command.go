@@ -0,0 +1,104 @@
+/*
+    command.go
+
+    Running external commands, ctags and git, so that none can block its caller forever:
+    every command runs under a deadline and is killed when it passes, along with the
+    processes it started where there are process groups. Its pipes are waited on only
+    briefly after it exits, in case a child it left behind holds them open, and a
+    non-zero exit comes back as an error with what the command printed on stderr.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "io"
+    "os/exec"
+    "strings"
+    "time"
+)
+
+// Longest a command may run when its caller gives it no deadline of its own
+var CommandTimeout = 10 * time.Minute
+
+// Longest ctags may take to answer --version, --list-features or --list-kinds
+const probeTimeout = 10 * time.Second
+
+// How long the pipes of a command are waited on after it exits or is killed
+const pipeDelay = time.Second
+
+/*
+    Returned when an external command fails to start, exits non-zero or is killed
+
+    Args    - The command and its arguments
+    Err     - Why it failed, an *exec.ExitError if it ran
+    Stderr  - What it printed on stderr, trimmed
+    Timeout - The deadline it was killed at, 0 if it wasn't
+*/
+type CommandError struct {
+    Args    []string
+    Err     error
+    Stderr  string
+    Timeout time.Duration
+}
+
+func (e *CommandError) Error() string {
+    msg := fmt.Sprintf("%s: %v", strings.Join(e.Args, " "), e.Err)
+    if e.Timeout > 0 {
+        msg = fmt.Sprintf("%s: killed after %v", strings.Join(e.Args, " "), e.Timeout)
+    }
+    if e.Stderr != "" {
+        msg += ": " + e.Stderr
+    }
+    return msg
+}
+
+func (e *CommandError) Unwrap() error {
+    return e.Err
+}
+
+/*
+    Run bin with args, reading stdin if it isn't nil, and return what it printed on
+    stdout. It's killed when ctx is done, or after CommandTimeout if ctx has no deadline,
+    along with its children. The error is a *CommandError.
+*/
+func RunCommand(ctx context.Context, stdin io.Reader, bin string, args ...string) ([]byte, error) {
+    timeout := CommandTimeout
+    if deadline, ok := ctx.Deadline(); ok {
+        timeout = time.Until(deadline)
+    } else {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+        defer cancel()
+    }
+
+    var stdout, stderr bytes.Buffer
+    cmd          := exec.CommandContext(ctx, bin, args...)
+    cmd.Stdin     = stdin
+    cmd.Stdout    = &stdout
+    cmd.Stderr    = &stderr
+    cmd.WaitDelay = pipeDelay
+    KillGroup(cmd)
+
+    if err := cmd.Run(); err != nil {
+        cerr := &CommandError{Args: append([]string{bin}, args...), Err: err, Stderr: strings.TrimSpace(stderr.String())}
+        if ctx.Err() == context.DeadlineExceeded {
+            cerr.Timeout = timeout.Round(time.Millisecond)
+        }
+        return stdout.Bytes(), cerr
+    }
+    return stdout.Bytes(), nil
+}
+
+/*
+    Run the ctags at bin with args to ask about itself, killing it after probeTimeout
+*/
+func probeCtags(bin string, args ...string) ([]byte, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+    defer cancel()
+    return RunCommand(ctx, nil, bin, args...)
+}
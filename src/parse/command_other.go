@@ -0,0 +1,21 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+/*
+    command_other.go
+
+    Only the command itself is killed where pakkun doesn't make process groups, see
+    command.go.
+*/
+
+package parse
+
+import (
+    "os/exec"
+)
+
+/*
+    Have cmd, once started, killed with the processes it started when its context is done
+*/
+func KillGroup(cmd *exec.Cmd) {
+}
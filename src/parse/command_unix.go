@@ -0,0 +1,28 @@
+//go:build linux || darwin
+// +build linux darwin
+
+/*
+    command_unix.go
+
+    Commands run in a process group of their own, so killing one also kills whatever
+    it started, see command.go.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "os/exec"
+    "syscall"
+)
+
+/*
+    Have cmd, once started, killed with the processes it started when its context is done
+*/
+func KillGroup(cmd *exec.Cmd) {
+    cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+    cmd.Cancel      = func() error {
+        return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+    }
+}
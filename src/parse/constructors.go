@@ -0,0 +1,93 @@
+/*
+    constructors.go
+
+    Constructors and destructors. They have no return type, so parseJavaFuncHeader
+    never takes them for functions. They are only extracted when asked for with
+    WithConstructors, and tell themselves apart from methods by Function.Kind.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C++, C# and Java
+*/
+
+package parse
+
+import (
+    "strings"
+)
+
+// Function.Kind of constructors and destructors (C++ destructors, C# finalizers)
+const (
+    KindConstructor = "constructor"
+    KindDestructor  = "destructor"
+)
+
+// Languages with constructors
+var constructorLangs = map[string]bool{"java":true, "cs":true, "cpp":true, "hpp":true, "h":true, "cu":true, "cuh":true}
+
+/*
+    Parse the header of a constructor or destructor: Foo(int a), Foo::Foo(int a), ~Foo().
+    Return its name, its desired parameter types and its kind. ok is false if the header
+    has a return type, is named after another class than its scope, or has a parameter
+    type that isn't valid.
+*/
+func parseConstructor(header string, scope string, ext string, funcTypes map[string]bool) (string, []Type, string, bool) {
+    header = strings.TrimSpace(strings.Split(header, "//")[0])
+    split := strings.SplitN(header, "(", 2)
+    if !constructorLangs[ext] || strings.HasSuffix(header, ";") || len(split) != 2 {
+        return "", nil, "", false
+    }
+
+    words := typeFields(split[0])
+    if len(words) == 0 {
+        return "", nil, "", false
+    }
+    fname   := words[len(words)-1]
+    _, words = stripAnnotations(words[:len(words)-1])
+
+    // Anything but modifiers and type parameters in front of the name is a return type
+    vars := map[string]string{}
+    for _, w := range words {
+        if strings.HasPrefix(w, "<") {
+            vars = typeParams(w)
+        } else if !isDeclModifier(ext, w) {
+            return "", nil, "", false
+        }
+    }
+
+    // Foo::~Foo is qualified by its class, otherwise the class is the innermost scope
+    class, name := "", fname
+    if parts := strings.Split(fname, "::"); len(parts) > 1 {
+        class, name = eraseGenerics(parts[len(parts)-2]), parts[len(parts)-1]
+    } else if scope != "" {
+        class = scope[strings.LastIndexAny(scope, ".:")+1:]
+    }
+
+    kind := KindConstructor
+    if strings.HasPrefix(name, "~") {
+        kind = KindDestructor
+        name = name[1:]
+    }
+    if name == "" || (class != "" && name != class) {
+        return "", nil, "", false
+    }
+    for i := 0; i < len(name); i++ {
+        if !isIdent(name[i]) {
+            return "", nil, "", false
+        }
+    }
+
+    in := []Type{}
+    for _, p := range splitTopLevel(strings.Split(split[1], ")")[0]) {
+        if strings.TrimSpace(p) == "" || strings.TrimSpace(p) == "void" {
+            continue
+        }
+        typ := ParseType(paramType(p, ext))
+        eraseTypeVar(&typ, vars)
+        if desired, valid := lookupType(funcTypes, typ); valid && desired {
+            in = append(in, typ)
+        } else if !valid {
+            return "", nil, "", false
+        }
+    }
+    return fname, in, kind, true
+}
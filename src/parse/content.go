@@ -0,0 +1,62 @@
+/*
+    content.go
+
+    Reading the file being parsed once. Every step works on that one copy, offsets into
+    it are all it keeps, and spans are copied out as strings only for what's saved. Files
+    of MapSize bytes or more, usually generated sources hundreds of megabytes long, are
+    mapped into memory rather than read, so their content is paged in from the page cache
+    as it's looked at instead of taking that much of the heap.
+
+    A mapped file that's truncated while it's parsed faults when the part gone is read.
+    The fault is turned into an error for the file rather than crashing pakkun.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "fmt"
+    "io/ioutil"
+    "runtime/debug"
+    "sync"
+)
+
+// Files this large or larger are mapped rather than read, 0 to always read them
+var MapSize int64 = 4 << 20
+
+/*
+    The content of the file at path, size bytes long, and a function releasing it that
+    may be called more than once. Mapped is true if it was mapped, see MapSize.
+*/
+func readContent(path string, size int64) (content []byte, release func(), mapped bool, err error) {
+    if MapSize > 0 && size >= MapSize && canMap {
+        content, unmap, err := mapFile(path, size)
+        if err == nil {
+            var once sync.Once
+            return content, func() { once.Do(unmap) }, true, nil
+        }
+        // Fall back to reading it, e.g. on file systems that can't be mapped
+    }
+    content, err = ioutil.ReadFile(path)
+    return content, func() {}, false, err
+}
+
+/*
+    Run parse on content mapped from the file at path, returning an error rather than
+    crashing if the file is truncated under it
+*/
+func parseMapped(path string, parse func() (File, error)) (file File, err error) {
+    defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+    defer func() {
+        r := recover()
+        if r == nil {
+            return
+        }
+        if _, ok := r.(interface{ Addr() uintptr }); !ok {
+            panic(r)
+        }
+        file, err = File{}, fmt.Errorf("%s: changed while it was parsed, %v", path, r)
+    }()
+    return parse()
+}
@@ -0,0 +1,77 @@
+/*
+    context.go
+
+    What surrounds a function, for datasets that show a model the code around what it
+    completes: the field declarations of its class and the signatures, not bodies, of
+    the other functions of the class. Both come cheap once the file is parsed. Classes
+    and their fields come from the class kinds of ctags, so with other backends every
+    function is taken to be at the top level of its file, and has no fields.
+
+    Dependencies:        exuberant or universal ctags
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C# and Java
+*/
+
+package parse
+
+import (
+    "strings"
+)
+
+/*
+    Fields   - Declarations of the fields of the function's class, as written on their
+               line, in order
+    Siblings - Signatures of the other functions of its class, or of the file for
+               functions outside any class, in order. The Header of those without one
+*/
+type FuncContext struct {
+    Fields   []string `json:",omitempty" bson:",omitempty"`
+    Siblings []string `json:",omitempty" bson:",omitempty"`
+}
+
+/*
+    Set the Context of every function of file from the class and field tags
+*/
+func addContext(file *File, tags []tag, content []byte, lines []int, ext string) {
+    classes := buildClasses(tags, content, lines, ext)
+
+    // Fields declared together, int a, b;, share a line and are listed once
+    fields := map[int][]string{}
+    seen   := map[int]bool{}
+    for _, t := range tags {
+        if !fieldKindNames[t.Kind] || seen[t.Line] {
+            continue
+        }
+        if c := classOf(classes, t.Line, t.Scope); c >= 0 {
+            fields[c] = append(fields[c], strings.TrimSpace(t.Text))
+            seen[t.Line] = true
+        }
+    }
+
+    // Functions by the class they're in, -1 for the top level
+    class   := make([]int, len(file.Funcs))
+    members := map[int][]int{}
+    for i, fn := range file.Funcs {
+        line := fn.StartLine
+        if line == 0 {
+            line = fn.line
+        }
+        class[i]          = classOf(classes, line, fn.scope)
+        members[class[i]] = append(members[class[i]], i)
+    }
+
+    for i := range file.Funcs {
+        ctx := &FuncContext{Fields: fields[class[i]]}
+        for _, j := range members[class[i]] {
+            if j == i {
+                continue
+            }
+            sig := file.Funcs[j].Signature
+            if sig == "" {
+                sig = file.Funcs[j].Header
+            }
+            ctx.Siblings = append(ctx.Siblings, sig)
+        }
+        file.Funcs[i].Context = ctx
+    }
+}
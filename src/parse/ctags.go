@@ -0,0 +1,309 @@
+/*
+    ctags.go
+
+    Running ctags and reading its cross reference (-x) output.
+
+    Dependencies:        exuberant ctags
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, Erlang, Lisp, Lua, Java, Javascript, and Python
+*/
+
+package parse
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+/*
+    Name      - Tag name
+    Kind      - ctags kind, e.g. method or function
+    Line      - Line number of the tag in the file
+    Text      - Source line the tag was found on, with runs of whitespace collapsed
+    Signature - Parameter list, only reported by universal ctags
+    Scope     - Enclosing class, namespace, ..., only reported by universal ctags and tree-sitter
+    Source    - Function source, only set by backends that know exact function boundaries
+    Start     - Byte offset of the function in the file, when Source is set
+    End       - Byte offset just past the function, when Source is set
+*/
+type tag struct {
+    Name      string
+    Kind      string
+    Line      int
+    Text      string
+    Signature string
+    Scope     string
+    Source    string
+    Start     int
+    End       int
+}
+
+// Whether each ctags binary is universal ctags with JSON output, detected on first use
+var (
+    jsonMu        sync.Mutex
+    jsonSupported = map[string]bool{}
+
+    versionMu sync.Mutex
+    versions  = map[string]string{}
+)
+
+/*
+    First line of ctags --version for the ctags at bin, e.g. Universal Ctags 6.0.0, ""
+    if it can't be run
+*/
+func CtagsVersion(bin string) string {
+    return ctagsVersion(bin)
+}
+
+/*
+    First line of ctags --version for the ctags at bin, "" if it can't be run
+*/
+func ctagsVersion(bin string) string {
+    versionMu.Lock()
+    defer versionMu.Unlock()
+
+    if version, ok := versions[bin]; ok {
+        return version
+    }
+    out, _        := probeCtags(bin, "--version")
+    versions[bin] = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+    return versions[bin]
+}
+
+/*
+    True if the ctags at bin is universal ctags built with JSON output. Exuberant ctags is
+    unmaintained and only has the text cross reference format.
+*/
+func ctagsJSON(bin string) bool {
+    jsonMu.Lock()
+    defer jsonMu.Unlock()
+
+    if supported, ok := jsonSupported[bin]; ok {
+        return supported
+    }
+
+    supported := false
+    if strings.Contains(ctagsVersion(bin), "Universal Ctags") {
+        features, _ := probeCtags(bin, "--list-features")
+        supported    = strings.Contains(string(features), "json")
+    }
+    jsonSupported[bin] = supported
+    return supported
+}
+
+// ctags language names, keyed by file extension
+var ctagsLangs = map[string]string{"c":"C", "h":"C", "cpp":"C++", "hpp":"C++", "cs":"C#", "erl":"Erlang",
+                                   "java":"Java", "js":"JavaScript", "lsp":"Lisp", "lua":"Lua", "py":"Python",
+                                   "cu":"C++", "cuh":"C++", "cl":"C", "hlsl":"C++", "glsl":"C"}
+
+/*
+    ctags kind letters selected when Options.Kinds doesn't name the language: functions,
+    or methods for languages where functions live in classes
+*/
+var defaultKinds = map[string]string{"c":"f", "h":"f", "cpp":"f", "hpp":"f", "cs":"m", "erl":"f",
+                                     "java":"m", "js":"f", "lsp":"f", "lua":"f", "py":"f", "cu":"f", "cuh":"f",
+                                     "cl":"f", "hlsl":"f", "glsl":"f"}
+
+/*
+    Kind letters pakkun selects for the language of ext that the ctags at bin doesn't list,
+    e.g. m if it can't tag Java methods. An error if it can't list them at all.
+*/
+func MissingCtagsKinds(bin string, ext string) (string, error) {
+    lang, ok := ctagsLangs[ext]
+    if !ok {
+        return "", fmt.Errorf("ctags doesn't know .%s files", ext)
+    }
+    out, err := probeCtags(bin, "--list-kinds="+lang)
+    if err != nil {
+        return "", err
+    }
+
+    // One kind per line, its letter first, e.g. "m  methods"
+    listed := map[rune]bool{}
+    for _, line := range strings.Split(string(out), "\n") {
+        if line = strings.TrimSpace(line); line != "" {
+            listed[rune(line[0])] = true
+        }
+    }
+    missing := ""
+    for _, kind := range defaultKinds[ext] {
+        if !listed[kind] {
+            missing += string(kind)
+        }
+    }
+    return missing, nil
+}
+
+/*
+    Return the option selecting kinds for the language of ext, or "" if ctags doesn't
+    know the language. Exuberant spells it --java-kinds=m, universal --kinds-Java=m.
+*/
+func ctagsKindsFlag(bin string, ext string, kinds string) string {
+    lang, ok := ctagsLangs[ext]
+    if !ok {
+        return ""
+    }
+    if kinds == "" {
+        kinds = defaultKinds[ext]
+    }
+
+    if ctagsJSON(bin) {
+        return "--kinds-" + lang + "=" + kinds
+    }
+    return "--" + strings.ToLower(lang) + "-kinds=" + kinds
+}
+
+/*
+    Run the ctags at bin on path and return the tags of the selected kind letters, or the language's
+    default kinds if kinds is empty. JSON output is preferred when available since it's
+    structured. ctags is killed if ctx is done first, see RunCommand, and an error returned
+    if it fails.
+*/
+func runCtags(ctx context.Context, bin string, path string, ext string, kinds string) ([]tag, error) {
+    args := ctagsArgs(bin, path, ext, kinds)
+    if ctagsJSON(bin) {
+        return runCtagsJSON(ctx, bin, path, args)
+    }
+
+    out, err := RunCommand(ctx, nil, bin, append(append([]string{"-x"}, args...), path)...)
+    if err != nil {
+        return nil, err
+    }
+
+    tags := []tag{}
+    buff := bufio.NewScanner(bytes.NewReader(out))
+    buff.Buffer(nil, ctagsLineMax)
+    for buff.Scan() {
+        if t, ok := parseCtagsLine(buff.Text(), path); ok {
+            tags = append(tags, t)
+        }
+    }
+    return tags, outputError(path, buff.Err())
+}
+
+// Longest line of ctags output read. ctags -x prints the whole source line of each tag
+const ctagsLineMax = 1024 * 1024
+
+/*
+    err of reading the ctags output for path, E_COMMAND_FAILED, nil if it was read whole.
+    Tags past a line too long to read would be lost, so the file fails instead.
+*/
+func outputError(path string, err error) error {
+    if err == nil {
+        return nil
+    }
+    return WithCode(ECommand, fmt.Errorf("%s: failed to read the ctags output: %w", path, err))
+}
+
+/*
+    Options ctags is run with on the file at path, parsed as ext
+*/
+func ctagsArgs(bin string, path string, ext string, kinds string) []string {
+    args := []string{}
+    if flag := ctagsKindsFlag(bin, ext, kinds); flag != "" {
+        args = append(args, flag)
+    }
+
+    // ctags doesn't know the GPU dialects by their extensions, they are read as C or C++.
+    // Neither does it know files whose language was detected from their content
+    detected := ext != strings.TrimPrefix(filepath.Ext(path), ".")
+    if lang, ok := ctagsLangs[ext]; ok && (isGPU(ext) || detected) {
+        args = append(args, "--language-force="+lang)
+    }
+    return args
+}
+
+/*
+    Parse one line of ctags -x output:
+
+        testG            method        6 test/foobar.java public static double testG(int i, int j, int k) {
+*/
+func parseCtagsLine(line string, path string) (tag, bool) {
+    fields := strings.Fields(line)
+    k      := lineField(fields)
+    if k < 0 {
+        return tag{}, false
+    }
+    lineNo, _ := strconv.Atoi(fields[k])
+
+    // The path may contain spaces, so find it rather than counting on it being one field
+    text := strings.Join(fields[k+2:], " ")
+    if i := strings.Index(line, path); i >= 0 {
+        text = strings.Join(strings.Fields(line[i+len(path):]), " ")
+    }
+
+    return tag{Name: fields[0], Kind: strings.Join(fields[1:k], " "), Line: lineNo, Text: text}, true
+}
+
+/*
+    Index of the line number in the fields of a line of ctags -x output, -1 if it has none
+*/
+func lineField(fields []string) int {
+    if len(fields) < 4 {
+        return -1
+    }
+
+    // Some kind names are two words, e.g. enum constant
+    k := 2
+    for k < len(fields)-2 {
+        if _, err := strconv.Atoi(fields[k]); err == nil {
+            break
+        }
+        k++
+    }
+    if _, err := strconv.Atoi(fields[k]); err != nil {
+        return -1
+    }
+    return k
+}
+
+/*
+    One line of universal ctags --output-format=json
+*/
+type jsonTag struct {
+    Type      string `json:"_type"`
+    Name      string `json:"name"`
+    Pattern   string `json:"pattern"`
+    Line      int    `json:"line"`
+    Kind      string `json:"kind"`
+    Signature string `json:"signature"`
+    Scope     string `json:"scope"`
+    Path      string `json:"path"`
+}
+
+var patternEscapes = strings.NewReplacer("\\\\", "\\", "\\/", "/", "\\?", "?")
+
+func runCtagsJSON(ctx context.Context, bin string, path string, args []string) ([]tag, error) {
+    args      = append([]string{"--output-format=json", "--fields=+nKS", "-f", "-"}, args...)
+    out, err := RunCommand(ctx, nil, bin, append(args, path)...)
+    if err != nil {
+        return nil, err
+    }
+
+    tags := []tag{}
+    buff := bufio.NewScanner(bytes.NewReader(out))
+    buff.Buffer(nil, ctagsLineMax)
+    for buff.Scan() {
+        var t jsonTag
+        if err := json.Unmarshal(buff.Bytes(), &t); err != nil || t.Type != "tag" {
+            continue
+        }
+        tags = append(tags, t.tag())
+    }
+    return tags, outputError(path, buff.Err())
+}
+
+func (t jsonTag) tag() tag {
+    // The pattern is the source line as a search command: /^  int f() {$/
+    text := strings.TrimSuffix(strings.TrimPrefix(t.Pattern, "/^"), "$/")
+    text  = strings.Join(strings.Fields(patternEscapes.Replace(text)), " ")
+
+    return tag{Name: t.Name, Kind: t.Kind, Line: t.Line, Text: text, Signature: t.Signature, Scope: t.Scope}
+}
\ No newline at end of file
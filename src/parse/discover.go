@@ -0,0 +1,175 @@
+/*
+    discover.go
+
+    Finding the ctags binary and checking it's one pakkun can use. Several programs are
+    installed as ctags: exuberant and universal ctags understand -x and the kind options
+    pakkun runs them with, while BSD ctags and the ctags of Emacs don't, and run with
+    them print nothing. Those are reported here rather than found out as files with no
+    functions:
+
+        if err := parse.Available(parse.WithCtagsPath(bin)); err != nil {
+            log.Fatal(err)
+        }
+
+    Dependencies:        exuberant ctags
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "fmt"
+    "log"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "sync"
+)
+
+/*
+    Flavor of ctags, the program behind a ctags binary
+*/
+type CtagsFlavor string
+
+const (
+    UniversalCtags CtagsFlavor = "universal"
+    ExuberantCtags CtagsFlavor = "exuberant"
+)
+
+/*
+    A usable ctags binary
+
+    Path    - Where it is, resolved from $PATH if it was given by name
+    Version - First line of its --version
+    Flavor  - Universal or exuberant
+    JSON    - It writes JSON output, which pakkun reads in preference to -x
+*/
+type CtagsBinary struct {
+    Path    string
+    Version string
+    Flavor  CtagsFlavor
+    JSON    bool
+}
+
+/*
+    Returned when the ctags binary can't be used, saying how to fix it
+
+    Bin     - The binary as given, ctags unless Options.CtagsPath says otherwise
+    Path    - Where it was found, "" if it wasn't
+    Version - First line of its --version, "" if that failed
+*/
+type CtagsError struct {
+    Bin     string
+    Path    string
+    Version string
+}
+
+const installCtags = "install universal-ctags (apt install universal-ctags, brew install universal-ctags)"
+
+func (e *CtagsError) Error() string {
+    switch {
+    case e.Path == "" && e.Bin == "ctags":
+        return "ctags isn't in $PATH, " + installCtags + " or give the path of one"
+    case e.Path == "":
+        return fmt.Sprintf("ctags %s not found or not executable, give the path of universal or exuberant ctags", e.Bin)
+    case e.Version == "":
+        // BSD ctags has no --version
+        return fmt.Sprintf("%s --version failed, it's likely BSD ctags, which pakkun can't use. %s", e.Path, e.fix())
+    }
+    return fmt.Sprintf("%s is %s, not universal or exuberant ctags, which pakkun can't use. %s", e.Path, e.Version, e.fix())
+}
+
+func (e *CtagsError) fix() string {
+    if e.Bin == "ctags" {
+        return "To fix it " + installCtags + " ahead of it in $PATH, or give the path of one"
+    }
+    return "To fix it give the path of universal or exuberant ctags, or " + installCtags
+}
+
+var (
+    binariesMu sync.Mutex
+    binaries   = map[string]ctagsLookup{}
+)
+
+type ctagsLookup struct {
+    binary CtagsBinary
+    err    error
+}
+
+/*
+    The ctags binary files would be parsed with, Options.CtagsPath or ctags from $PATH,
+    or a *CtagsError saying why it can't be used
+*/
+func CtagsInfo(opts ...Option) (CtagsBinary, error) {
+    return lookCtags(NewOptions(opts...).ctags())
+}
+
+/*
+    nil if the ctags binary files would be parsed with can be used, a *CtagsError saying
+    how to fix it if not
+*/
+func Available(opts ...Option) error {
+    _, err := CtagsInfo(opts...)
+    return err
+}
+
+/*
+    Find and check the ctags at bin, once per binary
+*/
+func lookCtags(bin string) (CtagsBinary, error) {
+    binariesMu.Lock()
+    defer binariesMu.Unlock()
+
+    if found, ok := binaries[bin]; ok {
+        return found.binary, found.err
+    }
+    binary, err  := checkCtags(bin)
+    binaries[bin] = ctagsLookup{binary: binary, err: err}
+    return binary, err
+}
+
+func checkCtags(bin string) (CtagsBinary, error) {
+    path, err := exec.LookPath(bin)
+    if err != nil {
+        return CtagsBinary{}, &CtagsError{Bin: bin}
+    }
+    if abs, err := filepath.Abs(path); err == nil {
+        path = abs
+    }
+
+    version := ctagsVersion(bin)
+    binary  := CtagsBinary{Path: path, Version: version}
+    switch {
+    case strings.Contains(version, "Universal Ctags"):
+        binary.Flavor = UniversalCtags
+    case strings.Contains(version, "Exuberant Ctags"):
+        binary.Flavor = ExuberantCtags
+    default:
+        return CtagsBinary{}, &CtagsError{Bin: bin, Path: path, Version: version}
+    }
+    binary.JSON = ctagsJSON(bin)
+    return binary, nil
+}
+
+var (
+    warnedMu sync.Mutex
+    warned   = map[string]bool{}
+)
+
+/*
+    True if the ctags at bin can be used. The backend is picked automatically with it, so
+    a ctags that's installed but can't be used is logged, once, before falling back to
+    the regex backend.
+*/
+func ctagsInstalled(bin string) bool {
+    _, err := lookCtags(bin)
+    if cerr, ok := err.(*CtagsError); ok && cerr.Path != "" {
+        warnedMu.Lock()
+        if !warned[bin] {
+            warned[bin] = true
+            log.Printf("%v. Using the regex fallback meanwhile\n", err)
+        }
+        warnedMu.Unlock()
+    }
+    return err == nil
+}
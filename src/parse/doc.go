@@ -0,0 +1,166 @@
+/*
+    doc.go
+
+    Documentation of functions: the Javadoc or other comment right above the header, or
+    the docstring opening a Python function, so descriptions can be searched along with
+    the code.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, Erlang, Lisp, Lua, Java, Javascript, and Python
+*/
+
+package parse
+
+import (
+    "strings"
+)
+
+// Line comment prefix by file extension. Languages not listed use //
+var lineComments = map[string]string{"py":"#", "rb":"#", "sh":"#", "pl":"#", "r":"#", "lua":"--",
+                                     "erl":"%", "lsp":";", "lisp":";", "el":";", "clj":";"}
+
+func lineComment(ext string) string {
+    if c, ok := lineComments[ext]; ok {
+        return c
+    }
+    return "//"
+}
+
+/*
+    Documentation of fn, found in the file content with the given line offsets. Empty if
+    there's none or the function's position is unknown.
+*/
+func docComment(content []byte, lines []int, fn Function, ext string) string {
+    if fn.StartLine <= 0 || fn.StartLine > len(lines) {
+        return ""
+    }
+    if ext == "py" {
+        if doc := docstring(content, lines, fn.StartLine-1); doc != "" {
+            return doc
+        }
+    }
+
+    // Annotations and decorators may sit between the comment and the header
+    j := fn.StartLine - 2
+    for j >= 0 && isAnnotation(strings.TrimSpace(lineText(content, lines, j)), ext) {
+        j--
+    }
+    if j < 0 {
+        return ""
+    }
+
+    text := strings.TrimSpace(lineText(content, lines, j))
+    if strings.HasSuffix(text, "*/") && (blockComments[ext] || ext == "ts" || ext == "go" || ext == "kt" || ext == "rs") {
+        // Up to the line opening the comment, which must open it on a line of its own
+        k := j
+        for k >= 0 && !strings.Contains(lineText(content, lines, k), "/*") {
+            k--
+        }
+        if k < 0 || !strings.HasPrefix(strings.TrimSpace(lineText(content, lines, k)), "/*") {
+            return ""
+        }
+        comment := []string{}
+        for i := k; i <= j; i++ {
+            comment = append(comment, lineText(content, lines, i))
+        }
+        return cleanComment(comment, "")
+    }
+
+    prefix := lineComment(ext)
+    k      := j
+    for k >= 0 && strings.HasPrefix(strings.TrimSpace(lineText(content, lines, k)), prefix) {
+        k--
+    }
+    comment := []string{}
+    for i := k + 1; i <= j; i++ {
+        comment = append(comment, lineText(content, lines, i))
+    }
+    return cleanComment(comment, prefix)
+}
+
+/*
+    Strip the markers of a comment given line by line: the block comment delimiters,
+    the * leading each line of a Javadoc, or the line comment prefix
+*/
+func cleanComment(comment []string, prefix string) string {
+    text := []string{}
+    for _, line := range comment {
+        line = strings.TrimSpace(line)
+        if prefix == "" {
+            line = strings.TrimPrefix(line, "/*")
+            line = strings.TrimSuffix(line, "*/")
+            line = strings.TrimLeft(line, "*!")
+        } else {
+            for strings.HasPrefix(line, prefix) {
+                line = strings.TrimPrefix(line, prefix)
+            }
+            line = strings.TrimPrefix(line, "/")
+        }
+        text = append(text, strings.TrimSpace(line))
+    }
+    return strings.TrimSpace(strings.Join(text, "\n"))
+}
+
+/*
+    Docstring of the Python function whose header starts on line l (0-based)
+*/
+func docstring(content []byte, lines []int, l int) string {
+    // The header may span lines, up to the one ending in :
+    for l < len(lines) && !strings.HasSuffix(strings.TrimSpace(lineText(content, lines, l)), ":") {
+        l++
+    }
+    l++
+    for l < len(lines) && strings.TrimSpace(lineText(content, lines, l)) == "" {
+        l++
+    }
+    if l >= len(lines) {
+        return ""
+    }
+
+    start := lines[l]
+    for start < len(content) && (content[start] == ' ' || content[start] == '\t') {
+        start++
+    }
+    // String prefixes, e.g. r"""..."""
+    rest := string(content[start:])
+    if p := strings.TrimLeft(rest, "rRuUbB"); len(rest)-len(p) <= 2 {
+        rest = p
+    }
+
+    for _, quote := range []string{`"""`, `'''`, `"`, `'`} {
+        if !strings.HasPrefix(rest, quote) {
+            continue
+        }
+        end := strings.Index(rest[len(quote):], quote)
+        if end < 0 {
+            return ""
+        }
+        return cleanDocstring(rest[len(quote):len(quote)+end])
+    }
+    return ""
+}
+
+/*
+    Remove the indentation docstring lines after the first share, like inspect.cleandoc
+*/
+func cleanDocstring(doc string) string {
+    lines  := strings.Split(doc, "\n")
+    indent := -1
+    for _, line := range lines[1:] {
+        if strings.TrimSpace(line) == "" {
+            continue
+        }
+        if n := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || n < indent {
+            indent = n
+        }
+    }
+    lines[0] = strings.TrimSpace(lines[0])
+    for i := 1; i < len(lines) && indent > 0; i++ {
+        if len(lines[i]) >= indent {
+            lines[i] = lines[i][indent:]
+        } else {
+            lines[i] = strings.TrimSpace(lines[i])
+        }
+    }
+    return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,169 @@
+/*
+    encoding.go
+
+    Source files that aren't plain UTF-8 with \n line endings: with a byte order mark, in
+    UTF-16 or Latin-1, or with Windows \r\n or old Mac \r line endings. Backends and the
+    offset math assume UTF-8 without a BOM, and a \r left at the end of a line ends up in
+    headers and makes them differ from the text they're looked for in. These files are
+    transcoded and their line endings turned into \n before they're parsed, so every
+    offset, line and body is of the normalized text. File.Encoding and File.LineEndings
+    record what the file was.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "bytes"
+    "encoding/binary"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "unicode/utf16"
+    "unicode/utf8"
+)
+
+const (
+    EncodingUTF8BOM = "utf-8-bom"
+    EncodingUTF16LE = "utf-16le"
+    EncodingUTF16BE = "utf-16be"
+    EncodingLatin1  = "latin-1"
+
+    LineEndingsCRLF = "crlf"
+    LineEndingsCR   = "cr"
+)
+
+var (
+    bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+    bomUTF16LE = []byte{0xff, 0xfe}
+    bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+/*
+    The encoding of content and content as UTF-8. The encoding is empty for UTF-8 without
+    a BOM, content is then returned as it is.
+*/
+func toUTF8(content []byte) (string, []byte) {
+    switch {
+    case bytes.HasPrefix(content, bomUTF8):
+        return EncodingUTF8BOM, content[len(bomUTF8):]
+    case bytes.HasPrefix(content, bomUTF16LE):
+        return EncodingUTF16LE, decodeUTF16(content[2:], binary.LittleEndian)
+    case bytes.HasPrefix(content, bomUTF16BE):
+        return EncodingUTF16BE, decodeUTF16(content[2:], binary.BigEndian)
+    }
+
+    // UTF-16 without a BOM is mostly ASCII with a zero byte next to every character
+    if enc := sniffUTF16(content); enc == EncodingUTF16LE {
+        return enc, decodeUTF16(content, binary.LittleEndian)
+    } else if enc == EncodingUTF16BE {
+        return enc, decodeUTF16(content, binary.BigEndian)
+    }
+
+    if utf8.Valid(content) {
+        return "", content
+    }
+
+    // Any byte is a Latin-1 character, so it's what's left
+    out := make([]byte, 0, len(content)+len(content)/8)
+    for _, b := range content {
+        out = utf8.AppendRune(out, rune(b))
+    }
+    return EncodingLatin1, out
+}
+
+func decodeUTF16(content []byte, order binary.ByteOrder) []byte {
+    units := make([]uint16, len(content)/2)
+    for i := range units {
+        units[i] = order.Uint16(content[2*i:])
+    }
+    out := make([]byte, 0, len(content))
+    for _, r := range utf16.Decode(units) {
+        out = utf8.AppendRune(out, r)
+    }
+    return out
+}
+
+/*
+    EncodingUTF16LE or EncodingUTF16BE if most characters at the start of content have a
+    zero byte on the same side, empty otherwise
+*/
+func sniffUTF16(content []byte) string {
+    n := len(content)
+    if n > sniffSize {
+        n = sniffSize
+    }
+    n -= n % 2
+    if n < 4 {
+        return ""
+    }
+
+    even, odd := 0, 0
+    for i := 0; i < n; i += 2 {
+        if content[i] == 0 {
+            even++
+        }
+        if content[i+1] == 0 {
+            odd++
+        }
+    }
+    pairs := n / 2
+    switch {
+    case odd*10 > pairs*7 && even*10 < pairs:
+        return EncodingUTF16LE
+    case even*10 > pairs*7 && odd*10 < pairs:
+        return EncodingUTF16BE
+    }
+    return ""
+}
+
+/*
+    The line endings of content, LineEndingsCRLF, LineEndingsCR or empty for \n, and
+    content with all of them turned into \n. Files mixing them are told by the first.
+*/
+func toLF(content []byte) (string, []byte) {
+    i := bytes.IndexByte(content, '\r')
+    if i < 0 {
+        return "", content
+    }
+    endings := LineEndingsCR
+    if i+1 < len(content) && content[i+1] == '\n' {
+        endings = LineEndingsCRLF
+    }
+    content = bytes.Replace(content, []byte("\r\n"), []byte("\n"), -1)
+    return endings, bytes.Replace(content, []byte("\r"), []byte("\n"), -1)
+}
+
+/*
+    content as it's parsed: UTF-8 with \n line endings, see toUTF8 and toLF
+*/
+func normalize(content []byte) (string, string, []byte) {
+    enc, content     := toUTF8(content)
+    endings, content := toLF(content)
+    return enc, endings, content
+}
+
+/*
+    If content, that of the file at path, isn't UTF-8 with \n line endings, write it
+    normalized to a temporary directory under the same name, so the language is still
+    told from it, and return its encoding, line endings, the copy's path and the copy.
+    The caller removes the directory. An empty path means the file can be read as it is.
+*/
+func normalizeFile(path string, content []byte) (string, string, string, []byte, error) {
+    enc, endings, content := normalize(content)
+    if enc == "" && endings == "" {
+        return "", "", "", nil, nil
+    }
+
+    dir, err := ioutil.TempDir("", "pakkun-")
+    if err != nil {
+        return "", "", "", nil, err
+    }
+    tmp := filepath.Join(dir, filepath.Base(path))
+    if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+        os.RemoveAll(dir)
+        return "", "", "", nil, err
+    }
+    return enc, endings, tmp, content, nil
+}
@@ -0,0 +1,126 @@
+package parse
+
+import (
+    "encoding/binary"
+    "strings"
+    "testing"
+    "unicode/utf16"
+)
+
+// s in UTF-16 in the given byte order, after bom
+func utf16Bytes(s string, order binary.ByteOrder, bom []byte) []byte {
+    out := append([]byte(nil), bom...)
+    for _, u := range utf16.Encode([]rune(s)) {
+        unit := make([]byte, 2)
+        order.PutUint16(unit, u)
+        out = append(out, unit...)
+    }
+    return out
+}
+
+/*
+    Files with a BOM, in UTF-16 or in Latin-1 come out as UTF-8 without a BOM, along
+    with what they were
+*/
+func TestToUTF8(t *testing.T) {
+    src := "int café(int a) {\n    return a;\n}\n"
+    tests := []struct {
+        name    string
+        content []byte
+        enc     string
+    }{
+        {"utf-8", []byte(src), ""},
+        {"utf-8 bom", append(append([]byte(nil), bomUTF8...), src...), EncodingUTF8BOM},
+        {"utf-16le bom", utf16Bytes(src, binary.LittleEndian, bomUTF16LE), EncodingUTF16LE},
+        {"utf-16be bom", utf16Bytes(src, binary.BigEndian, bomUTF16BE), EncodingUTF16BE},
+        {"utf-16le", utf16Bytes(src, binary.LittleEndian, nil), EncodingUTF16LE},
+        {"utf-16be", utf16Bytes(src, binary.BigEndian, nil), EncodingUTF16BE},
+        {"latin-1", []byte(strings.Replace(src, "é", "\xe9", 1)), EncodingLatin1},
+    }
+
+    for _, test := range tests {
+        enc, content := toUTF8(test.content)
+        if enc != test.enc {
+            t.Errorf("%s: got encoding %q, want %q", test.name, enc, test.enc)
+        }
+        if string(content) != src {
+            t.Errorf("%s: got %q, want %q", test.name, content, src)
+        }
+    }
+}
+
+/*
+    A UTF-16 file with a BOM is parsed like its UTF-8 text, and says it was UTF-16
+*/
+func TestParseUTF16(t *testing.T) {
+    src     := "int add(int a, int b) {\n    return a + b;\n}\n"
+    content := utf16Bytes(src, binary.LittleEndian, bomUTF16LE)
+
+    file, err := ParseReader("add.c", strings.NewReader(string(content)), Options{Types: map[string]bool{"int": true}, Backend: Regex})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if file.Encoding != EncodingUTF16LE {
+        t.Errorf("got encoding %q, want %q", file.Encoding, EncodingUTF16LE)
+    }
+    if len(file.Funcs) != 1 || file.Funcs[0].Source != strings.TrimSpace(src) {
+        t.Errorf("got %+v, want add with its body", file.Funcs)
+    }
+}
+
+/*
+    \r\n and \r line endings become \n, and the first one found is what the file had
+*/
+func TestToLF(t *testing.T) {
+    tests := []struct {
+        content string
+        endings string
+        want    string
+    }{
+        {"a\nb\n", "", "a\nb\n"},
+        {"a\r\nb\r\n", LineEndingsCRLF, "a\nb\n"},
+        {"a\rb\r", LineEndingsCR, "a\nb\n"},
+        {"a\r\nb\rc\n", LineEndingsCRLF, "a\nb\nc\n"},
+    }
+
+    for _, test := range tests {
+        endings, content := toLF([]byte(test.content))
+        if endings != test.endings || string(content) != test.want {
+            t.Errorf("toLF(%q) = %q, %q, want %q, %q", test.content, endings, content, test.endings, test.want)
+        }
+    }
+}
+
+/*
+    Functions of a file with \r\n or \r line endings have the lines, offsets and bodies
+    they have in the same file with \n line endings, without a \r anywhere
+*/
+func TestCRLFOffsets(t *testing.T) {
+    src   := "// adds\nint add(int a, int b) {\n    return a + b;\n}\n\nint neg(int a) {\n    return -a;\n}\n"
+    types := map[string]bool{"int": true}
+
+    want, err := ParseReader("f.c", strings.NewReader(src), Options{Types: types, Backend: Regex})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for _, endings := range []string{"\r\n", "\r"} {
+        file, err := ParseReader("f.c", strings.NewReader(strings.Replace(src, "\n", endings, -1)), Options{Types: types, Backend: Regex})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(file.Funcs) != len(want.Funcs) {
+            t.Fatalf("%q: got %d functions, want %d", endings, len(file.Funcs), len(want.Funcs))
+        }
+        for i, fn := range file.Funcs {
+            w := want.Funcs[i]
+            if fn.StartOffset != w.StartOffset || fn.EndOffset != w.EndOffset || fn.StartLine != w.StartLine {
+                t.Errorf("%q: %s at %d-%d line %d, want %d-%d line %d", endings, fn.Name, fn.StartOffset,
+                         fn.EndOffset, fn.StartLine, w.StartOffset, w.EndOffset, w.StartLine)
+            }
+            if fn.Header != w.Header || fn.Source != w.Source || strings.Contains(fn.Source, "\r") {
+                t.Errorf("%q: got %q %q, want %q %q", endings, fn.Header, fn.Source, w.Header, w.Source)
+            }
+        }
+    }
+}
@@ -0,0 +1,107 @@
+/*
+    entities.go
+
+    Selection of what is extracted by what it is rather than by ctags kind letters, the
+    same for every language:
+
+        parse.ParseFile(path, parse.WithTypes(types), parse.WithEntities(parse.EntityMethods, parse.EntityClasses))
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "fmt"
+    "strings"
+)
+
+/*
+    Something that can be extracted from a file
+*/
+type Entity string
+
+const (
+    // Functions outside of any class or namespace
+    EntityFunctions    Entity = "functions"
+    // Functions declared in a class, struct, interface or namespace
+    EntityMethods      Entity = "methods"
+    // Constructors and destructors, see constructors.go
+    EntityConstructors Entity = "constructors"
+    // Classes, structs, enums and interfaces, see classes.go
+    EntityClasses      Entity = "classes"
+    // Global variables, constants, macros and typedefs
+    EntityVariables    Entity = "variables"
+)
+
+var entities = []Entity{EntityFunctions, EntityMethods, EntityConstructors, EntityClasses, EntityVariables}
+
+/*
+    Names of the entities ParseEntities accepts
+*/
+func EntityNames() []string {
+    names := []string{}
+    for _, e := range entities {
+        names = append(names, string(e))
+    }
+    return names
+}
+
+/*
+    Parse a comma-separated list of entities, e.g. functions,classes
+*/
+func ParseEntities(list string) ([]Entity, error) {
+    selected := []Entity{}
+    for _, name := range strings.Split(list, ",") {
+        e, ok := Entity(strings.TrimSpace(name)), false
+        for _, known := range entities {
+            ok = ok || e == known
+        }
+        if !ok {
+            return nil, fmt.Errorf("unknown kind %q, expected one of %v", name, entities)
+        }
+        selected = append(selected, e)
+    }
+    return selected, nil
+}
+
+/*
+    True if e is to be extracted. Without Options.Entities, functions and methods always
+    are and the rest as Constructors, Classes and Symbols say.
+*/
+func (opts Options) wants(e Entity) bool {
+    if len(opts.Entities) == 0 {
+        return e == EntityFunctions || e == EntityMethods
+    }
+    for _, selected := range opts.Entities {
+        if selected == e {
+            return true
+        }
+    }
+    return false
+}
+
+/*
+    opts with Constructors, Classes and Symbols set from Entities, if given
+*/
+func (opts Options) withEntities() Options {
+    if len(opts.Entities) > 0 {
+        opts.Constructors = opts.wants(EntityConstructors)
+        opts.Classes      = opts.wants(EntityClasses)
+        opts.Symbols      = opts.wants(EntityVariables)
+    }
+    return opts
+}
+
+/*
+    True if the function fn, found by the tag t, is among the entities selected
+*/
+func (opts Options) wantsFunc(t tag, fn *Function) bool {
+    switch {
+    case fn.Kind == KindConstructor || fn.Kind == KindDestructor:
+        return opts.Constructors
+    case t.Kind == "method" || t.Scope != "":
+        return opts.wants(EntityMethods)
+    }
+    return opts.wants(EntityFunctions)
+}
@@ -0,0 +1,165 @@
+/*
+    generics.go
+
+    Generic types in headers, e.g. List<String> foo(Map<Integer, List<Foo>> m). The
+    spaces and commas inside type arguments mustn't split the type, and consumers often
+    only care about the erased type, Map for Map<Integer, List<Foo>>.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C++, C#, Java, Kotlin and Typescript
+*/
+
+package parse
+
+import (
+    "strings"
+)
+
+/*
+    Split s at whitespace outside angle brackets, like strings.Fields but keeping
+    Map<Integer, Foo> as one field
+*/
+func typeFields(s string) []string {
+    fields := []string{}
+    depth  := 0
+    field  := []rune{}
+    for _, c := range s {
+        switch {
+        case c == '<':
+            depth++
+        case c == '>' && depth > 0:
+            depth--
+        case (c == ' ' || c == '\t' || c == '\n') && depth == 0:
+            if len(field) > 0 {
+                fields = append(fields, string(field))
+                field  = field[:0]
+            }
+            continue
+        }
+        field = append(field, c)
+    }
+    if len(field) > 0 {
+        fields = append(fields, string(field))
+    }
+
+    // Type arguments may be separated from their type: List <String>
+    joined := []string{}
+    for _, f := range fields {
+        if strings.HasPrefix(f, "<") && len(joined) > 0 && !strings.HasSuffix(joined[len(joined)-1], ">") &&
+           isTypeName(joined[len(joined)-1]) {
+            joined[len(joined)-1] += f
+            continue
+        }
+        joined = append(joined, f)
+    }
+    return joined
+}
+
+/*
+    True for words that can take type arguments, i.e. not modifiers or annotations
+*/
+func isTypeName(w string) bool {
+    switch w {
+    case "public", "private", "protected", "internal", "static", "final", "abstract", "synchronized",
+         "native", "strictfp", "default", "virtual", "override", "sealed", "async", "extern", "unsafe":
+        return false
+    }
+    return !strings.HasPrefix(w, "@")
+}
+
+/*
+    Write the type arguments of a generic type the same way whatever the source did:
+    Map<Integer, List<Foo>>
+*/
+func normalizeGenerics(t string) string {
+    if !strings.Contains(t, "<") {
+        return t
+    }
+    t = strings.Join(strings.Fields(t), " ")
+    t = strings.NewReplacer(" <", "<", "< ", "<", " >", ">", " ,", ",").Replace(t)
+    return strings.Replace(strings.Replace(t, ",", ", ", -1), ",  ", ", ", -1)
+}
+
+/*
+    Remove the type arguments of a type: Map<Integer, List<Foo>>[] is Map[]
+*/
+func eraseGenerics(t string) string {
+    erased := []rune{}
+    depth  := 0
+    for _, c := range t {
+        switch {
+        case c == '<':
+            depth++
+        case c == '>' && depth > 0:
+            depth--
+        case depth == 0:
+            erased = append(erased, c)
+        }
+    }
+    return strings.TrimSpace(string(erased))
+}
+
+/*
+    Type parameters declared by a generic method, <T extends Comparable<T>, U>, mapped to
+    their erasure: the first bound, or Object if they have none
+*/
+func typeParams(decl string) map[string]string {
+    params := map[string]string{}
+    decl    = strings.TrimSpace(decl)
+    if !strings.HasPrefix(decl, "<") || !strings.HasSuffix(decl, ">") {
+        return params
+    }
+
+    for _, p := range splitTopLevel(decl[1:len(decl)-1]) {
+        words := typeFields(p)
+        if len(words) == 0 {
+            continue
+        }
+        params[words[0]] = "Object"
+        if len(words) > 2 && words[1] == "extends" {
+            params[words[0]] = eraseGenerics(strings.Split(strings.Join(words[2:], " "), "&")[0])
+        }
+    }
+    return params
+}
+
+/*
+    Erase type variables of a generic method to their bound: T[] is Comparable[] for
+    <T extends Comparable<T>>. typ.Erased is left alone for other types.
+*/
+func eraseTypeVar(typ *Type, vars map[string]string) {
+    name := strings.TrimRight(typ.Name, "[]")
+    if bound, ok := vars[name]; ok {
+        typ.Erased = bound + typ.Name[len(name):]
+    }
+}
+
+/*
+    Key of a types map standing for every type the map doesn't list, e.g. {"*": true,
+    "void": false} for all functions that return something
+*/
+const AnyType = "*"
+
+/*
+    Whether typ is desired and valid. Generic types can be listed as written,
+    List<String>, or by their erasure, List, to accept any type arguments. Arrays,
+    pointers and references not listed as written, int[] or long*, fall back to their
+    base type. Types listed none of these ways are looked up as AnyType.
+*/
+func lookupType(funcTypes map[string]bool, typ Type) (bool, bool) {
+    if desired, valid := funcTypes[typ.Name]; valid {
+        return desired, valid
+    }
+    if typ.Erased != "" {
+        if desired, valid := funcTypes[typ.Erased]; valid {
+            return desired, valid
+        }
+    }
+    if typ.Base != "" && typ.Base != typ.Name {
+        if desired, valid := funcTypes[typ.Base]; valid {
+            return desired, valid
+        }
+    }
+    desired, valid := funcTypes[AnyType]
+    return desired, valid
+}
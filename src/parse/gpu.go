@@ -0,0 +1,136 @@
+/*
+    gpu.go
+
+    GPU dialects of C and C++. Kernel and entry point qualifiers (__global__, __kernel,
+    [numthreads(8,8,1)], ...) aren't types, so they are taken off the header and kept in
+    Function.Flags, and parameter qualifiers like OpenCL address spaces are dropped.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: CUDA, OpenCL, HLSL, and GLSL
+*/
+
+package parse
+
+import (
+    "strings"
+)
+
+// Flag set on shader entry points, which are marked by attributes and semantics or by name
+const EntryPoint = "entry"
+
+// Qualifiers before the return type, recorded as flags. Keyed by file extension
+var kernelQualifiers = map[string][]string{
+    "cu":   {"__global__", "__device__", "__host__", "__noinline__", "__forceinline__"},
+    "cl":   {"__kernel", "kernel", "inline"},
+    "hlsl": {"inline", "precise"},
+    "glsl": {"highp", "mediump", "lowp", "precise"},
+}
+
+// Parameter qualifiers that aren't part of the type
+var paramQualifiers = map[string][]string{
+    "cl":   {"__global", "global", "__local", "local", "__constant", "constant", "__private", "private",
+             "__read_only", "read_only", "__write_only", "write_only", "__read_write", "read_write"},
+    "hlsl": {"in", "out", "inout", "uniform", "precise"},
+    "glsl": {"in", "out", "inout", "highp", "mediump", "lowp", "precise"},
+}
+
+func init() {
+    kernelQualifiers["cuh"] = kernelQualifiers["cu"]
+}
+
+func isGPU(ext string) bool {
+    _, ok := kernelQualifiers[ext]
+    return ok
+}
+
+func contains(words []string, w string) bool {
+    for _, v := range words {
+        if v == w {
+            return true
+        }
+    }
+    return false
+}
+
+/*
+    Take the dialect qualifiers off a GPU header and return them as flags:
+
+        __global__ void add(float *a, int n)                  ->  void add(float *a, int n)
+        __kernel void add(__global const float *a)            ->  void add(const float *a)
+        [numthreads(8,8,1)] void main(uint3 id : SV_DispatchThreadID)  ->  void main(uint3 id)
+
+    Headers of other languages are returned unchanged.
+*/
+func gpuHeader(header string, ext string) (string, []string) {
+    if !isGPU(ext) {
+        return header, nil
+    }
+    flags := []string{}
+    entry := false
+
+    // HLSL attributes: [numthreads(8,8,1)] [shader("compute")]
+    header = strings.TrimSpace(header)
+    for ext == "hlsl" && strings.HasPrefix(header, "[") {
+        end := strings.Index(header, "]")
+        if end < 0 {
+            break
+        }
+        flags  = append(flags, header[:end+1])
+        header = strings.TrimSpace(header[end+1:])
+        entry  = true
+    }
+
+    open  := strings.Index(header, "(")
+    close := strings.LastIndex(header, ")")
+    if open < 0 || close < open {
+        return header, flags
+    }
+
+    words := []string{}
+    for _, w := range strings.Fields(header[:open]) {
+        if contains(kernelQualifiers[ext], w) {
+            flags = append(flags, w)
+        } else {
+            words = append(words, w)
+        }
+    }
+    if ext == "glsl" && len(words) > 0 && words[len(words)-1] == "main" {
+        entry = true
+    }
+
+    params := []string{}
+    for _, p := range strings.Split(header[open+1:close], ",") {
+        // HLSL semantics: uint3 id : SV_DispatchThreadID
+        if i := strings.Index(p, ":"); i >= 0 && ext == "hlsl" {
+            p = p[:i]
+        }
+        kept := []string{}
+        for _, w := range strings.Fields(p) {
+            if !contains(paramQualifiers[ext], w) {
+                kept = append(kept, w)
+            }
+        }
+        if len(kept) > 0 {
+            params = append(params, strings.Join(kept, " "))
+        }
+    }
+
+    // Return semantic: float4 main(...) : SV_Target
+    tail := header[close+1:]
+    if ext == "hlsl" && strings.HasPrefix(strings.TrimSpace(tail), ":") {
+        semantic := strings.Fields(strings.TrimPrefix(strings.TrimSpace(tail), ":"))
+        if len(semantic) > 0 {
+            flags = append(flags, strings.TrimRight(semantic[0], "{;"))
+        }
+        tail  = ""
+        entry = true
+    }
+
+    if entry {
+        flags = append(flags, EntryPoint)
+    }
+    if len(flags) == 0 {
+        flags = nil
+    }
+    return strings.Join(words, " ") + "(" + strings.Join(params, ", ") + ")" + tail, flags
+}
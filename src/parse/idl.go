@@ -0,0 +1,326 @@
+/*
+    idl.go
+
+    Service methods of Protocol Buffers and Thrift interface definitions, so IDL
+    definitions can be cross-referenced with the functions implementing them.
+
+        service Users {
+            rpc GetUser (GetUserRequest) returns (User);
+        }
+
+        service Users {
+            User getUser(1: i64 id, 2: bool cached) throws (1: NotFound nf),
+        }
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: Protocol Buffers and Thrift
+*/
+
+package parse
+
+import (
+    "bytes"
+    "regexp"
+    "strings"
+)
+
+// Function.Kind of IDL service methods
+const KindRPC = "rpc"
+
+// Flags of streaming and one-way methods
+const (
+    ClientStream = "client-stream"
+    ServerStream = "server-stream"
+    OneWay       = "oneway"
+)
+
+var serviceStart = regexp.MustCompile(`\bservice\s+\w+\s*(?:extends\s+[\w.]+\s*)?\{`)
+
+var (
+    protoRPC  = regexp.MustCompile(`\brpc\s+(\w+)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)`)
+    thriftRPC = regexp.MustCompile(`(?:^|[,;{\n])\s*(oneway\s+)?([\w.]+(?:\s*<[^()]*>)?)\s+(\w+)\s*\(([^)]*)\)(\s*throws\s*\([^)]*\))?`)
+)
+
+// Line comment markers of each IDL, keyed by file extension
+var idlComments = map[string][]string{"proto": {"//"}, "thrift": {"//", "#"}}
+
+func isIDL(ext string) bool {
+    _, ok := idlComments[ext]
+    return ok
+}
+
+/*
+    Parse the service methods of a .proto or .thrift file. Methods are kept when their
+    request and response types are desired, like any other function.
+*/
+func parseIDLFile(path string, fname string, content []byte, ext string, opts Options) (File, error) {
+    code  := stripComments(content, idlComments[ext])
+    lines := lineOffsets(content)
+    funcs := []Function{}
+
+    for _, loc := range serviceStart.FindAllIndex(code, -1) {
+        body := loc[1]
+        end  := body
+        for depth := 1; end < len(code) && depth > 0; end++ {
+            if code[end] == '{' {
+                depth++
+            } else if code[end] == '}' {
+                depth--
+            }
+        }
+
+        var found []Function
+        if ext == "proto" {
+            found = protoMethods(content, code, body, end)
+        } else {
+            found = thriftMethods(content, code, body, end)
+        }
+
+        for _, fn := range found {
+            in, inOk   := desiredTypes(fn.Params, opts.Types)
+            out, outOk := desiredTypes(fn.Returns, opts.Types)
+            if !inOk || !outOk || len(in) == 0 || len(out) == 0 {
+                continue
+            }
+            fn.Params, fn.InType   = in, typeNames(in)
+            fn.Returns, fn.OutType = out, typeNames(out)
+            fn.line = lineOf(lines, fn.line)
+            fn.Id   = hash(fn.Name+fn.Header)
+            fn.locate(lines, len(content))
+            canonicalize(ext, &fn)
+            funcs = append(funcs, fn)
+        }
+    }
+
+    if len(funcs) == 0 {
+        return File{}, ErrNoFuncs
+    }
+    return File{Id: hash(path), Name: fname, Path: path, Funcs: funcs, Backend: Regex}, nil
+}
+
+/*
+    rpc methods between code[start:end]. Function.line temporarily holds the byte offset
+    of the method.
+*/
+func protoMethods(content []byte, code []byte, start int, end int) []Function {
+    funcs := []Function{}
+    for _, m := range protoRPC.FindAllSubmatchIndex(code[start:end], -1) {
+        sub := func(i int) string {
+            if m[2*i] < 0 {
+                return ""
+            }
+            return string(code[start+m[2*i]:start+m[2*i+1]])
+        }
+
+        in, out := ParseType(sub(3)), ParseType(sub(5))
+        flags   := []string{}
+        if sub(2) != "" {
+            in.Raw = "stream " + in.Raw
+            flags  = append(flags, ClientStream)
+        }
+        if sub(4) != "" {
+            out.Raw = "stream " + out.Raw
+            flags   = append(flags, ServerStream)
+        }
+
+        from, to := start+m[0], statementEnd(code, start+m[1])
+        funcs = append(funcs, rpcFunction(sub(1), string(code[from:start+m[1]]), string(content[from:to]),
+                                          []Type{in}, []Type{out}, flags, from, to))
+    }
+    return funcs
+}
+
+/*
+    Thrift service functions between code[start:end]
+*/
+func thriftMethods(content []byte, code []byte, start int, end int) []Function {
+    funcs := []Function{}
+    for _, m := range thriftRPC.FindAllSubmatchIndex(code[start:end], -1) {
+        sub := func(i int) string {
+            if m[2*i] < 0 {
+                return ""
+            }
+            return string(code[start+m[2*i]:start+m[2*i+1]])
+        }
+
+        // 1: required i64 id = 0
+        in := []Type{}
+        for _, p := range splitTopLevel(sub(4)) {
+            if i := strings.Index(p, ":"); i >= 0 {
+                p = p[i+1:]
+            }
+            p = strings.Split(p, "=")[0]
+            words := []string{}
+            for _, w := range strings.Fields(p) {
+                if w != "required" && w != "optional" {
+                    words = append(words, w)
+                }
+            }
+            if len(words) > 1 {
+                in = append(in, ParseType(strings.Join(words[:len(words)-1], " ")))
+            }
+        }
+
+        flags := []string{}
+        if sub(1) != "" {
+            flags = append(flags, OneWay)
+        }
+
+        from := start+m[2*2]
+        if sub(1) != "" {
+            from = start+m[2*1]
+        }
+        to := statementEnd(code, start+m[1])
+        funcs = append(funcs, rpcFunction(sub(3), string(code[from:start+m[1]]), string(content[from:to]),
+                                          in, []Type{ParseType(sub(2))}, flags, from, to))
+    }
+    return funcs
+}
+
+func rpcFunction(name string, header string, source string, in []Type, out []Type, flags []string, from int, to int) Function {
+    if len(flags) == 0 {
+        flags = nil
+    }
+    return Function{
+        Name:    name,
+        Kind:    KindRPC,
+        Header:  strings.Join(strings.Fields(header), " "),
+        InType:  typeNames(in),
+        OutType: typeNames(out),
+        Params:  in,
+        Returns: out,
+        Source:  strings.TrimSpace(source),
+        Flags:   flags,
+        line:    from,
+
+        StartOffset: from,
+        EndOffset:   to,
+    }
+}
+
+/*
+    Index just past the end of the statement whose header ends at i: a ; or , separator,
+    or a { ... } block of options
+*/
+func statementEnd(code []byte, i int) int {
+    j := i
+    for j < len(code) && (code[j] == ' ' || code[j] == '\t' || code[j] == '\n' || code[j] == '\r') {
+        j++
+    }
+    if j >= len(code) {
+        return i
+    }
+
+    switch code[j] {
+    case ';', ',':
+        return j + 1
+    case '{':
+        depth := 0
+        for ; j < len(code); j++ {
+            if code[j] == '{' {
+                depth++
+            } else if code[j] == '}' {
+                depth--
+                if depth == 0 {
+                    return j + 1
+                }
+            }
+        }
+    }
+    return i
+}
+
+/*
+    Split s on commas that aren't inside <>, so map<string, i32> stays one type
+*/
+func splitTopLevel(s string) []string {
+    parts := []string{}
+    depth := 0
+    last  := 0
+    for i, c := range s {
+        switch c {
+        case '<':
+            depth++
+        case '>':
+            depth--
+        case ',':
+            if depth == 0 {
+                parts = append(parts, s[last:i])
+                last  = i + 1
+            }
+        }
+    }
+    if strings.TrimSpace(s[last:]) != "" {
+        parts = append(parts, s[last:])
+    }
+    return parts
+}
+
+/*
+    Replace comments with spaces, keeping offsets and line breaks where they were
+*/
+func stripComments(content []byte, lineComments []string) []byte {
+    code := append([]byte{}, content...)
+    for i := 0; i < len(code); i++ {
+        if code[i] == '"' {
+            for i++; i < len(code) && code[i] != '"' && code[i] != '\n'; i++ {
+            }
+            continue
+        }
+
+        end := -1
+        if bytes.HasPrefix(code[i:], []byte("/*")) {
+            if j := bytes.Index(code[i+2:], []byte("*/")); j >= 0 {
+                end = i + 2 + j + 2
+            } else {
+                end = len(code)
+            }
+        }
+        for _, c := range lineComments {
+            if end < 0 && bytes.HasPrefix(code[i:], []byte(c)) {
+                end = i
+                for end < len(code) && code[end] != '\n' {
+                    end++
+                }
+            }
+        }
+
+        for ; end >= 0 && i < end; i++ {
+            if code[i] != '\n' {
+                code[i] = ' '
+            }
+        }
+        if end >= 0 {
+            i--
+        }
+    }
+    return code
+}
+
+/*
+    1-based line of the byte at offset
+*/
+func lineOf(lines []int, offset int) int {
+    n := 0
+    for n < len(lines) && lines[n] <= offset {
+        n++
+    }
+    return n
+}
+
+/*
+    Return the desired types, and false if any type isn't valid, the way headers are checked
+*/
+func desiredTypes(types []Type, funcTypes map[string]bool) ([]Type, bool) {
+    desired := []Type{}
+    for _, t := range types {
+        want, valid := lookupType(funcTypes, t)
+        if !valid {
+            return nil, false
+        }
+        if want {
+            desired = append(desired, t)
+        }
+    }
+    return desired, true
+}
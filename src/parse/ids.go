@@ -0,0 +1,153 @@
+/*
+    ids.go
+
+    Ids of functions and files. A function's Id is a hash of its text in the file with
+    whitespace collapsed, so it doesn't change with indentation, Flatten or the
+    file it's in, and the same function found twice gets the same Id. Functions whose
+    text isn't known, e.g. with NoSource, fall back to a hash of their scope and header.
+    A file's Id is a hash of its path, within the archive or repository it was read from
+    if any, see File.Origin.
+
+    ContentId hashes the body alone, with comments dropped and whitespace only kept where
+    it separates two words. Unlike Id it's never told apart within a file, so copies of a
+    function, reformatted or with different comments, in whatever file, share it.
+
+    Ids are 63 bits, so they fit the signed 64-bit integers of BSON. That's past the 53
+    bits Javascript numbers hold exactly, clients there should read them as strings.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "crypto/sha256"
+    "encoding/binary"
+    "fmt"
+    "hash/fnv"
+    "strings"
+)
+
+/*
+    Hash Ids are computed with
+*/
+type IdHash string
+
+const (
+    // 64-bit FNV-1a, fast. The default
+    FNV64  IdHash = "fnv64"
+    // First 8 bytes of SHA-256, for when Ids must hold up against crafted collisions
+    SHA256 IdHash = "sha256"
+)
+
+// Top bit cleared, BSON has no unsigned integers
+const idMask = 1<<63 - 1
+
+/*
+    Id of s
+*/
+func (h IdHash) sum(s string) uint64 {
+    if h == SHA256 {
+        sum := sha256.Sum256([]byte(s))
+        return binary.BigEndian.Uint64(sum[:8]) & idMask
+    }
+    f := fnv.New64a()
+    f.Write([]byte(s))
+    return f.Sum64() & idMask
+}
+
+/*
+    The IdHash named name, an error if there is none
+*/
+func ParseIdHash(name string) (IdHash, error) {
+    switch h := IdHash(name); h {
+    case FNV64, SHA256:
+        return h, nil
+    case "":
+        return FNV64, nil
+    }
+    return "", fmt.Errorf("unknown id hash %q, expected %s or %s", name, FNV64, SHA256)
+}
+
+/*
+    Id of file, computed with h over its Origin
+*/
+func FileId(file File, h IdHash) uint64 {
+    return h.sum(file.Origin())
+}
+
+/*
+    Where the file is: its path, prefixed with the repository or archive it was read from
+    if any, e.g. https://github.com/owner/repo:src/Foo.java or
+    src.zip!owner-repo-sha/src/Foo.java, so the same path in two repositories, two
+    archives, or one of them and a directory, is two files. The commit isn't part of it,
+    the file at a later commit is the same file, its removed functions tombstoned.
+*/
+func (f File) Origin() string {
+    if f.Repo != "" {
+        return f.Repo + ":" + f.Path
+    }
+    if f.Archive != "" {
+        return f.Archive + "!" + f.Path
+    }
+    return f.Path
+}
+
+/*
+    Give the file and its functions their final Ids, once bodies and positions are known
+*/
+func assignIds(file *File, content []byte, ext string, h IdHash) {
+    file.Id = FileId(*file, h)
+    for i := range file.Funcs {
+        file.Funcs[i].Id = h.sum(identity(file.Funcs[i], content))
+        if body := normalizedBody(file.Funcs[i], content, ext); body != "" {
+            file.Funcs[i].ContentId = h.sum(body)
+        }
+    }
+    disambiguate(file.Funcs, h)
+}
+
+/*
+    What a function's Id is computed over: its text in content with whitespace collapsed,
+    or its scope and header if its span isn't known
+*/
+func identity(fn Function, content []byte) string {
+    if text := strings.Join(strings.Fields(spanText(fn, content)), " "); text != "" && !fn.Abstract {
+        return text
+    }
+    return fn.scope + "\x00" + strings.Join(strings.Fields(fn.Header), " ")
+}
+
+/*
+    The function's text in content, or its Source if its span isn't known
+*/
+func spanText(fn Function, content []byte) string {
+    if fn.EndOffset > fn.StartOffset && fn.EndOffset <= len(content) {
+        return string(content[fn.StartOffset:fn.EndOffset])
+    }
+    return fn.Source
+}
+
+/*
+    What a function's ContentId is computed over: its text without comments, and without
+    whitespace but between two words. Empty for functions without a body.
+*/
+func normalizedBody(fn Function, content []byte, ext string) string {
+    if fn.Abstract {
+        return ""
+    }
+    code := stripComments([]byte(spanText(fn, content)), []string{lineComment(ext)})
+
+    var b strings.Builder
+    for _, word := range strings.Fields(string(code)) {
+        if b.Len() > 0 && isWordByte(b.String()[b.Len()-1]) && isWordByte(word[0]) {
+            b.WriteByte(' ')
+        }
+        b.WriteString(word)
+    }
+    return b.String()
+}
+
+func isWordByte(c byte) bool {
+    return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,118 @@
+/*
+    imports.go
+
+    What a file imports, includes or requires, e.g. java.util.List, <stdio.h> or ./util.
+    The functions of a file can only call into what it pulls in, so it's the cheapest
+    view of their external dependencies.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, CUDA, Go, Java, Javascript, Kotlin, Python, Ruby,
+                         Rust, Scala and Typescript
+*/
+
+package parse
+
+import (
+    "regexp"
+    "strings"
+)
+
+/*
+    Statements importing something, one match per import. The last group is what's
+    imported.
+*/
+var importPatterns = map[string][]*regexp.Regexp{
+    "java":  {regexp.MustCompile(`^\s*import\s+(?:static\s+)?([\w.]+(?:\.\*)?)\s*;`)},
+    "kt":    {regexp.MustCompile(`^\s*import\s+([\w.]+(?:\.\*)?)`)},
+    "scala": {regexp.MustCompile(`^\s*import\s+([\w.]+(?:\.[_*]|\.\{[^}]*\})?)`)},
+    "cs":    {regexp.MustCompile(`^\s*(?:global\s+)?using\s+(?:static\s+)?(?:\w+\s*=\s*)?([\w.]+)\s*;`)},
+    "c":     {include},
+    "py":    {regexp.MustCompile(`^\s*from\s+([\w.]+)\s+import\b`)},
+    "js":    {esImport, esExport, require},
+    "rb":    {regexp.MustCompile(`^\s*require(?:_relative)?\s*\(?\s*['"]([^'"]+)['"]`)},
+    "rs":    {regexp.MustCompile(`^\s*(?:pub(?:\([\w\s]*\))?\s+)?use\s+(\w+(?:::\w+)*(?:::\{[^}]*\}|::\*)?)`),
+              regexp.MustCompile(`^\s*extern\s+crate\s+(\w+)`)},
+    "go":    {regexp.MustCompile(`^\s*import\s+(?:[\w.]+\s+)?"([^"]+)"`)},
+}
+
+var (
+    include  = regexp.MustCompile(`^\s*#\s*(?:include|import)\s*([<"][^>"]+[>"])`)
+    esImport = regexp.MustCompile(`^\s*import\s+(?:type\s+)?(?:[^'"]*\s+from\s+)?['"]([^'"]+)['"]`)
+    esExport = regexp.MustCompile(`^\s*export\s+[^'"]*\s+from\s+['"]([^'"]+)['"]`)
+    require  = regexp.MustCompile(`\brequire\s*\(\s*['"]([^'"]+)['"]\s*\)`)
+
+    // import a, b.c as d in Python, and the lines of a Go import ( ... ) block
+    pyImport = regexp.MustCompile(`^\s*import\s+([\w.]+(?:\s+as\s+\w+)?(?:\s*,\s*[\w.]+(?:\s+as\s+\w+)?)*)`)
+    goSpec   = regexp.MustCompile(`^\s*(?:[\w.]+\s+)?"([^"]+)"`)
+)
+
+// Extensions sharing the patterns of another language
+var importLangs = map[string]string{"h":"c", "cpp":"c", "hpp":"c", "cu":"c", "cuh":"c", "cl":"c", "hlsl":"c",
+                                    "glsl":"c", "ts":"js", "jsx":"js", "tsx":"js", "mjs":"js"}
+
+/*
+    Everything the file imports in the order it's first imported, nil if the language
+    isn't supported or there is nothing
+*/
+func imports(content []byte, lines []int, ext string) []string {
+    lang := ext
+    if l, ok := importLangs[ext]; ok {
+        lang = l
+    }
+    patterns, ok := importPatterns[lang]
+    if !ok || len(content) == 0 {
+        return nil
+    }
+
+    found := []string{}
+    seen  := map[string]bool{}
+    add   := func(name string) {
+        if name = strings.TrimSpace(name); name != "" && !seen[name] {
+            seen[name] = true
+            found      = append(found, name)
+        }
+    }
+
+    inBlock := false
+    for i := range lines {
+        text := lineText(content, lines, i)
+
+        // Go groups imports in a parenthesized block
+        if lang == "go" {
+            trimmed := strings.TrimSpace(text)
+            switch {
+            case strings.HasPrefix(trimmed, "import") && strings.HasSuffix(trimmed, "("):
+                inBlock = true
+                continue
+            case inBlock && strings.HasPrefix(trimmed, ")"):
+                inBlock = false
+                continue
+            case inBlock:
+                if m := goSpec.FindStringSubmatch(text); m != nil {
+                    add(m[1])
+                }
+                continue
+            }
+        }
+
+        if lang == "py" {
+            if m := pyImport.FindStringSubmatch(text); m != nil {
+                for _, name := range strings.Split(m[1], ",") {
+                    add(strings.Fields(name)[0])
+                }
+                continue
+            }
+        }
+
+        for _, p := range patterns {
+            for _, m := range p.FindAllStringSubmatch(text, -1) {
+                add(m[len(m)-1])
+            }
+        }
+    }
+
+    if len(found) == 0 {
+        return nil
+    }
+    return found
+}
@@ -0,0 +1,171 @@
+/*
+    language.go
+
+    The language of a file when its extension doesn't say: scripts without one are known
+    by their shebang or editor modeline, .h headers using classes or namespaces are C++,
+    and templates like handler.py.j2 or config.h.in are the language of the file they
+    generate.
+
+    The language is given as the extension it would normally have, which is what the
+    rest of the package keys on, and the backend is told to read the file as that.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "io"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+)
+
+// Names of languages, keyed by extension
+var languageNames = map[string]string{"c":"C", "h":"C", "cpp":"C++", "hpp":"C++", "cc":"C++", "cxx":"C++", "hh":"C++",
+                                      "cs":"C#", "erl":"Erlang", "java":"Java", "js":"JavaScript", "ts":"TypeScript",
+                                      "lsp":"Lisp", "lua":"Lua", "py":"Python", "go":"Go", "kt":"Kotlin", "rs":"Rust",
+                                      "rb":"Ruby", "pl":"Perl", "sh":"Shell", "php":"PHP", "r":"R", "scala":"Scala",
+                                      "cu":"CUDA", "cuh":"CUDA", "cl":"OpenCL", "hlsl":"HLSL", "glsl":"GLSL",
+                                      "proto":"Protocol Buffers", "thrift":"Thrift"}
+
+// Suffixes of templates, whose language is that of the extension before
+var templateExts = map[string]bool{"in":true, "j2":true, "jinja":true, "jinja2":true, "tmpl":true, "tpl":true,
+                                   "template":true, "erb":true, "mustache":true}
+
+// Extensions of the interpreters named by shebangs, versions stripped
+var interpreters = map[string]string{"python":"py", "node":"js", "nodejs":"js", "deno":"js", "ts-node":"ts",
+                                     "ruby":"rb", "perl":"pl", "lua":"lua", "luajit":"lua", "sh":"sh", "bash":"sh",
+                                     "zsh":"sh", "dash":"sh", "ksh":"sh", "php":"php", "Rscript":"r", "escript":"erl",
+                                     "scala":"scala"}
+
+var shebang = regexp.MustCompile(`^#!\s*(\S+)(?:\s+(?:-\S+\s+)*(\S+))?`)
+
+// Emacs -*- mode: python -*- and vim: set ft=python lines
+var modeline = regexp.MustCompile(`-\*-\s*(?:mode:\s*)?([\w+#-]+)\s*(?:;.*)?-\*-|\bvim?:.*\b(?:ft|filetype)=([\w+#-]+)`)
+
+var modelineLangs = map[string]string{"ruby":"rb", "perl":"pl", "sh":"sh", "shell-script":"sh", "bash":"sh",
+                                      "js":"js", "c++":"cpp", "python":"py"}
+
+// Syntax C headers don't have, outside of comments
+var cppHeader = regexp.MustCompile(`(?m)^\s*(?:namespace\s+[\w:]*\s*\{|template\s*<|class\s+\w+[^;]*$|` +
+                                   `(?:public|private|protected)\s*:)|\bstd::\w`)
+
+// How much of a file is read to tell its language
+const sniffSize = 16 << 10
+
+/*
+    Extension of the language the file at path is parsed as, empty if none tells. See
+    LanguageName for its name.
+*/
+func DetectLanguage(path string) string {
+    return detectExt(path)
+}
+
+/*
+    True if the file at path is to be parsed as the language of extension, e.g. .py: it
+    ends in extension, or DetectLanguage tells it's in that language, e.g. a script named
+    by its shebang, a template of such a file or a C++ header for .hpp. head is the start
+    of its content if it was read already, nil to read it from path.
+*/
+func HasLanguage(path string, head []byte, extension string) bool {
+    if strings.HasSuffix(path, extension) {
+        return true
+    }
+    return contentExt(path, head) == strings.TrimPrefix(extension, ".")
+}
+
+/*
+    Name of the language of the extension ext, e.g. C++ for hpp, empty if it's not one
+    pakkun knows
+*/
+func LanguageName(ext string) string {
+    return languageNames[strings.TrimPrefix(ext, ".")]
+}
+
+/*
+    Extension of the language of the file at path, its own extension if that's enough
+*/
+func detectExt(path string) string {
+    return contentExt(path, nil)
+}
+
+/*
+    detectExt of the file at path whose content was read already, nil to read what's
+    needed of it
+*/
+func contentExt(path string, content []byte) string {
+    name := filepath.Base(path)
+    ext  := strings.TrimPrefix(filepath.Ext(name), ".")
+    if templateExts[ext] {
+        if inner := strings.TrimPrefix(filepath.Ext(strings.TrimSuffix(name, "."+ext)), "."); inner != "" {
+            return inner
+        }
+    }
+    if ext != "" && ext != "h" {
+        return ext
+    }
+
+    head := content
+    if head == nil {
+        head = readHead(path, sniffSize)
+    } else if len(head) > sniffSize {
+        head = head[:sniffSize]
+    }
+    if ext == "h" {
+        if cppHeader.Match(stripComments(head, []string{"//"})) {
+            return "hpp"
+        }
+        return ext
+    }
+    return sniffExt(head)
+}
+
+/*
+    Extension of the language of a script named by its shebang or modeline, empty if
+    neither says
+*/
+func sniffExt(head []byte) string {
+    lines := strings.SplitN(string(head), "\n", 4)
+    if len(lines) > 3 {
+        lines = lines[:3]
+    }
+    if m := shebang.FindStringSubmatch(lines[0]); m != nil {
+        interpreter := filepath.Base(m[1])
+        if interpreter == "env" {
+            interpreter = m[2]
+        }
+        interpreter = strings.TrimRight(interpreter, "0123456789.")
+        if ext, ok := interpreters[interpreter]; ok {
+            return ext
+        }
+    }
+
+    // Modelines are on the first lines, after the shebang
+    for _, line := range lines {
+        if m := modeline.FindStringSubmatch(line); m != nil {
+            lang := strings.ToLower(m[1] + m[2])
+            if ext, ok := modelineLangs[lang]; ok {
+                return ext
+            }
+            return getLangExt(lang)
+        }
+    }
+    return ""
+}
+
+/*
+    Up to n bytes from the start of the file at path
+*/
+func readHead(path string, n int) []byte {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil
+    }
+    defer f.Close()
+
+    head    := make([]byte, n)
+    read, _ := io.ReadFull(f, head)
+    return head[:read]
+}
@@ -0,0 +1,105 @@
+/*
+    langversion.go
+
+    The language version a file is written for, guessed from the syntax it uses: python2
+    or python3, c++11 to c++20, java7 to java21. Python 2 code in a Python 3 corpus
+    is the usual reason to look, since both share the extension.
+
+    Versions are the oldest that accept everything seen, so a Java file using nothing
+    newer than lambdas is java8 even if it was built with 17. Files using nothing telling
+    have no version.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C++, Java and Python
+*/
+
+package parse
+
+import (
+    "regexp"
+    "sort"
+)
+
+/*
+    Syntax first accepted by a version of its language
+*/
+type versionRule struct {
+    version string
+    syntax  *regexp.Regexp
+}
+
+// Syntax only Python 2 accepts: print and exec statements, except X, e, raise X, msg, <>,
+// long and ur literals
+var python2Rules = regexp.MustCompile(`(?m)^\s*print\s+[^\s(=.,)\]]|^\s*exec\s+["'\w]|except\s+[\w.]+\s*,\s*\w+\s*:|` +
+                                     `\w\s*<>\s*\w|\b\d+[lL]\b|\bur["']|^\s*raise\s+\w+\s*,`)
+
+// Docstrings, whose prose could pass for either
+var docstrings = regexp.MustCompile(`(?s)""".*?"""|'''.*?'''`)
+
+// Syntax only Python 3 accepts: f-strings, annotations, nonlocal, async, yield from,
+// keyword-only parameters and print with keywords
+var python3Rules = regexp.MustCompile(`(?m)\bf["'][^"'\n]*\{|\bdef\s+\w+\s*\([^)]*\)\s*->|\bnonlocal\s+\w|` +
+                                     `\basync\s+def\b|\bawait\s+\w|\byield\s+from\b|\bdef\s+\w+\s*\([^)]*\*\s*,|` +
+                                     `\bprint\s*\(.*\b(?:end|sep|file)\s*=`)
+
+var cppRules = []versionRule{
+    {"c++20", regexp.MustCompile(`\bconcept\s+\w+\s*=|\brequires\s*[({]|\bco_(?:await|return|yield)\b|<=>|\bconsteval\b|\bconstinit\b|std::span\b`)},
+    {"c++17", regexp.MustCompile(`\bif\s+constexpr\b|\bauto\s*&{0,2}\s*\[\w+\s*,|std::(?:optional|variant|string_view|any)\b|\[\[nodiscard\]\]|\binline\s+(?:static|constexpr)\b|\bnamespace\s+\w+::\w+`)},
+    {"c++14", regexp.MustCompile(`std::make_unique\b|\bdecltype\s*\(\s*auto\s*\)|\[[^\]]*\]\s*\(\s*(?:const\s+)?auto\b|\b\d+'\d+\b|\[\[deprecated\]\]`)},
+    {"c++11", regexp.MustCompile(`\bnullptr\b|\bconstexpr\b|\boverride\b|\bstatic_assert\b|\bauto\s+\w+\s*=|std::(?:unique_ptr|shared_ptr|move|thread)\b|\busing\s+\w+\s*=|\[[&=]?\]\s*\(|\bnoexcept\b|\benum\s+class\b`)},
+}
+
+var javaRules = []versionRule{
+    {"java21", regexp.MustCompile(`\bcase\s+\w+(?:<[^>]*>)?\s+\w+\s*(?:when\b|->)|\bcase\s+null\b`)},
+    {"java17", regexp.MustCompile(`\bsealed\s+(?:interface|class|abstract)\b|\bpermits\s+\w`)},
+    {"java16", regexp.MustCompile(`\brecord\s+\w+\s*(?:<[^>]*>)?\s*\(|\binstanceof\s+[\w.<>]+\s+\w+\s*[)&|]`)},
+    {"java15", regexp.MustCompile(`"""`)},
+    {"java14", regexp.MustCompile(`\bcase\s+[^:\n]*->|\byield\s+[\w"]`)},
+    {"java10", regexp.MustCompile(`\bvar\s+\w+\s*=`)},
+    {"java8", regexp.MustCompile(`\)\s*->|\b\w+\s*->\s*[{\w]|\w::\w|\bdefault\s+[\w<>\[\]]+\s+\w+\s*\(`)},
+    {"java7", regexp.MustCompile(`<>\s*\(|\btry\s*\(|\bcatch\s*\([\w.]+\s*\|`)},
+}
+
+var versionRules = map[string][]versionRule{"cpp":cppRules, "cc":cppRules, "cxx":cppRules, "hpp":cppRules, "hh":cppRules,
+                                            "java":javaRules}
+
+/*
+    Every version File.Version can be, sorted
+*/
+func LanguageVersions() []string {
+    versions := []string{"python2", "python3"}
+    for _, rules := range [][]versionRule{cppRules, javaRules} {
+        for _, rule := range rules {
+            versions = append(versions, rule.version)
+        }
+    }
+    sort.Strings(versions)
+    return versions
+}
+
+/*
+    Language version the file content is written for, empty if nothing tells
+*/
+func langVersion(content []byte, ext string) string {
+    code := stripComments(content, []string{lineComment(ext)})
+
+    if ext == "py" {
+        code = docstrings.ReplaceAll(code, nil)
+        switch {
+        case python2Rules.Match(code):
+            return "python2"
+        case python3Rules.Match(code):
+            return "python3"
+        }
+        return ""
+    }
+
+    // Rules go from the newest version down, the first that matches is the oldest that
+    // accepts all of it
+    for _, rule := range versionRules[ext] {
+        if rule.syntax.Match(code) {
+            return rule.version
+        }
+    }
+    return ""
+}
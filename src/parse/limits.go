@@ -0,0 +1,76 @@
+/*
+    limits.go
+
+    Resource limits for parsing untrusted input, such as third-party repositories where a
+    single pathological generated file would otherwise stall a whole indexing run.
+
+    Dependencies:        exuberant ctags
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "errors"
+    "fmt"
+    "time"
+)
+
+/*
+    MaxFileSize - Largest file parsed, in bytes
+    MaxFuncs    - Most functions the backend may report for one file
+    Timeout     - Wall-clock time allowed per file, including running ctags
+
+    Zero means no limit.
+*/
+type Limits struct {
+    MaxFileSize int64
+    MaxFuncs    int
+    Timeout     time.Duration
+}
+
+/*
+    Limit that stopped a file from being parsed
+*/
+type Limit string
+
+const (
+    LimitFileSize Limit = "file size"
+    LimitFuncs    Limit = "function count"
+    LimitTimeout  Limit = "timeout"
+)
+
+/*
+    Returned when a file exceeds one of its Limits. Max and Actual are in bytes, functions
+    or nanoseconds depending on the Limit. Actual is 0 when it isn't known, e.g. for a
+    stream that was only read up to the limit.
+*/
+type LimitError struct {
+    Path   string
+    Limit  Limit
+    Max    int64
+    Actual int64
+}
+
+func (e *LimitError) Error() string {
+    if e.Limit == LimitTimeout {
+        return fmt.Sprintf("%s: %s exceeded, gave up after %v", e.Path, e.Limit, time.Duration(e.Max))
+    }
+    if e.Actual == 0 {
+        return fmt.Sprintf("%s: %s limit exceeded, over %d", e.Path, e.Limit, e.Max)
+    }
+    return fmt.Sprintf("%s: %s limit exceeded, %d > %d", e.Path, e.Limit, e.Actual, e.Max)
+}
+
+/*
+    Returned by ParseFileWith when the file has no function of the desired types
+*/
+var ErrNoFuncs = errors.New("no functions of the desired types")
+
+/*
+    True if err is, or wraps, a LimitError
+*/
+func IsLimit(err error) bool {
+    var limit *LimitError
+    return errors.As(err, &limit)
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+/*
+    mmap_other.go
+
+    Files are always read where pakkun doesn't map them, see content.go.
+*/
+
+package parse
+
+import (
+    "errors"
+)
+
+const canMap = false
+
+func mapFile(path string, size int64) ([]byte, func(), error) {
+    return nil, nil, errors.New("mapping files isn't supported")
+}
@@ -0,0 +1,36 @@
+//go:build linux || darwin
+// +build linux darwin
+
+/*
+    mmap_unix.go
+
+    Mapping files into memory, see content.go.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "os"
+    "syscall"
+)
+
+const canMap = true
+
+/*
+    The first size bytes of the file at path mapped read only, and a function unmapping them
+*/
+func mapFile(path string, size int64) ([]byte, func(), error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer f.Close()
+
+    data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+    if err != nil {
+        return nil, nil, err
+    }
+    return data, func() { syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,81 @@
+/*
+    modifiers.go
+
+    Declaration modifiers in headers, public static final and friends. They are keywords
+    of the declaration, not types, so they're kept apart from the types in Function.Visibility
+    and Function.Modifiers. Not to be confused with Type.Modifiers, the [] and * of a type.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C# and Java
+*/
+
+package parse
+
+import (
+    "strings"
+)
+
+// Modifiers that say who can call the function
+var visibilities = map[string]bool{"public":true, "private":true, "protected":true, "internal":true}
+
+// Declaration modifiers per language, including the visibilities
+var declModifiers = map[string]map[string]bool{
+    "java": {"public":true, "private":true, "protected":true, "static":true, "final":true, "abstract":true,
+             "synchronized":true, "native":true, "strictfp":true, "default":true},
+    "cs":   {"public":true, "private":true, "protected":true, "internal":true, "static":true, "virtual":true,
+             "override":true, "abstract":true, "sealed":true, "async":true, "extern":true, "unsafe":true,
+             "new":true, "partial":true, "readonly":true},
+    "c":    {"static":true, "inline":true, "extern":true, "__inline":true, "__forceinline":true},
+    "cpp":  {"static":true, "inline":true, "extern":true, "virtual":true, "explicit":true, "constexpr":true,
+             "friend":true, "__inline":true, "__forceinline":true},
+}
+
+/*
+    True if w is a declaration modifier in the language of ext
+*/
+func isDeclModifier(ext string, w string) bool {
+    // Headers are taken as C, CUDA, OpenCL and shaders as C++
+    if ext == "h" {
+        ext = "c"
+    } else if cLike[ext] && ext != "c" {
+        ext = "cpp"
+    }
+    return declModifiers[ext][w]
+}
+
+/*
+    Visibility and other modifiers in front of the header, in the order they are written.
+    C# allows two visibilities, protected internal, which are kept together.
+*/
+func headerModifiers(header string, ext string) (string, []string) {
+    words := typeFields(strings.Split(header, "(")[0])
+    if len(words) > 0 {
+        words = words[:len(words)-1]
+    }
+
+    visibility := []string{}
+    modifiers  := []string{}
+    for _, w := range words {
+        if strings.HasPrefix(w, "@") {
+            continue
+        }
+        if !isDeclModifier(ext, w) {
+            break
+        }
+        if visibilities[w] {
+            visibility = append(visibility, w)
+        } else {
+            modifiers = append(modifiers, w)
+        }
+    }
+    return strings.Join(visibility, " "), modifiers
+}
+
+func hasModifier(modifiers []string, m string) bool {
+    for _, w := range modifiers {
+        if w == m {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,71 @@
+/*
+    observe.go
+
+    Progress reporting for long indexing runs. An Observer set in Options hears about
+    every file parsed with those options, so progress bars and throughput logs don't need
+    to wrap each call site.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "fmt"
+    "sync/atomic"
+    "time"
+)
+
+/*
+    Notified as files are parsed. Files may be parsed concurrently, e.g. by ParseStream,
+    so implementations must be safe for concurrent use.
+
+    FileStarted - Called before path is parsed
+    FileDone    - Called once path is parsed with the number of functions extracted and the
+                  error ParseFileWith returned, ErrNoFuncs if it had none
+*/
+type Observer interface {
+    FileStarted(path string)
+    FileDone(path string, funcs int, err error)
+}
+
+/*
+    Observer counting files, functions and errors. Files without functions of the desired
+    types aren't errors, neither are skipped ones, which are counted apart.
+*/
+type Progress struct {
+    Started int64
+    Done    int64
+    Funcs   int64
+    Errors  int64
+    Skipped int64
+    since   time.Time
+}
+
+func NewProgress() *Progress {
+    return &Progress{since: time.Now()}
+}
+
+func (p *Progress) FileStarted(path string) {
+    atomic.AddInt64(&p.Started, 1)
+}
+
+func (p *Progress) FileDone(path string, funcs int, err error) {
+    atomic.AddInt64(&p.Done, 1)
+    atomic.AddInt64(&p.Funcs, int64(funcs))
+    if IsSkipped(err) {
+        atomic.AddInt64(&p.Skipped, 1)
+    } else if err != nil && err != ErrNoFuncs {
+        atomic.AddInt64(&p.Errors, 1)
+    }
+}
+
+/*
+    e.g. 120/124 files, 5301 functions, 2 errors, 3 skipped, 38.5 files/s
+*/
+func (p *Progress) String() string {
+    done := atomic.LoadInt64(&p.Done)
+    rate := float64(done) / time.Since(p.since).Seconds()
+    return fmt.Sprintf("%d/%d files, %d functions, %d errors, %d skipped, %.1f files/s", done, atomic.LoadInt64(&p.Started),
+                       atomic.LoadInt64(&p.Funcs), atomic.LoadInt64(&p.Errors), atomic.LoadInt64(&p.Skipped), rate)
+}
@@ -0,0 +1,176 @@
+/*
+    options.go
+
+    Functional options for ParseFile:
+
+        parse.ParseFile(path, parse.WithTypes(types), parse.WithBackend(parse.Regex))
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+/*
+    An Option sets one field of the Options a file is parsed with
+*/
+type Option func(*Options)
+
+/*
+    Valid types. Valid if the key exists, desired if its value is true
+*/
+func WithTypes(types map[string]bool) Option {
+    return func(o *Options) { o.Types = types }
+}
+
+/*
+    Backend finding the functions, picked automatically if not set
+*/
+func WithBackend(backend Backend) Option {
+    return func(o *Options) { o.Backend = backend }
+}
+
+/*
+    ctags kind letters to extract, keyed by file extension
+*/
+func WithKinds(kinds map[string]string) Option {
+    return func(o *Options) { o.Kinds = kinds }
+}
+
+/*
+    ctags binary to run instead of ctags from $PATH
+*/
+func WithCtagsPath(path string) Option {
+    return func(o *Options) { o.CtagsPath = path }
+}
+
+/*
+    Only extract headers, leaving Function.Source empty
+*/
+func WithoutSource() Option {
+    return func(o *Options) { o.NoSource = true }
+}
+
+/*
+    Size, function count and time limits per file
+*/
+func WithLimits(limits Limits) Option {
+    return func(o *Options) { o.Limits = limits }
+}
+
+/*
+    Skip binary, minified and generated files as rules say, e.g. DefaultSkipRules
+*/
+func WithSkip(rules SkipRules) Option {
+    return func(o *Options) { o.Skip = rules }
+}
+
+/*
+    Notify observer before and after the file is parsed
+*/
+func WithObserver(observer Observer) Option {
+    return func(o *Options) { o.Observer = observer }
+}
+
+/*
+    Flatten function bodies onto one line instead of keeping them verbatim
+*/
+func WithFlatten() Option {
+    return func(o *Options) { o.Flatten = true }
+}
+
+/*
+    Project-defined patterns extracted alongside what the backend finds
+*/
+func WithPatterns(patterns []Pattern) Option {
+    return func(o *Options) { o.Patterns = patterns }
+}
+
+/*
+    Also extract constructors and destructors, with Function.Kind KindConstructor or
+    KindDestructor
+*/
+func WithConstructors() Option {
+    return func(o *Options) { o.Constructors = true }
+}
+
+/*
+    Also list abstract and interface methods, without bodies, e.g. to index an API surface
+*/
+func WithAbstract() Option {
+    return func(o *Options) { o.Abstract = true }
+}
+
+/*
+    Also extract classes, structs, enums and interfaces, and the class of every function
+*/
+func WithClasses() Option {
+    return func(o *Options) { o.Classes = true }
+}
+
+/*
+    Also record the fields of the class of every function and the signatures of its
+    siblings in Function.Context
+*/
+func WithContext() Option {
+    return func(o *Options) { o.Context = true }
+}
+
+/*
+    Also extract global variables, constants, macros and typedefs into File.Symbols
+*/
+func WithSymbols() Option {
+    return func(o *Options) { o.Symbols = true }
+}
+
+/*
+    Count the tokens of every function body with t
+*/
+func WithTokenizer(t Tokenizer) Option {
+    return func(o *Options) { o.Tokenizer = t }
+}
+
+/*
+    Extract exactly these entities, e.g. only methods and classes
+*/
+func WithEntities(entities ...Entity) Option {
+    return func(o *Options) { o.Entities = entities }
+}
+
+/*
+    Compute Ids with h instead of FNV64
+*/
+func WithIdHash(h IdHash) Option {
+    return func(o *Options) { o.IdHash = h }
+}
+
+/*
+    Look parse results up in cache before parsing, and save them there after
+*/
+func WithCache(cache Cache) Option {
+    return func(o *Options) { o.Cache = cache }
+}
+
+/*
+    Pass ParseFiles this many files to each ctags run
+*/
+func WithBatch(files int) Option {
+    return func(o *Options) { o.Batch = files }
+}
+
+/*
+    Return the content ParseFiles read of every file along with what it parsed to
+*/
+func WithContent() Option {
+    return func(o *Options) { o.KeepContent = true }
+}
+
+/*
+    Collect opts into Options
+*/
+func NewOptions(opts ...Option) Options {
+    var o Options
+    for _, opt := range opts {
+        opt(&o)
+    }
+    return o
+}
@@ -0,0 +1,134 @@
+/*
+    package.go
+
+    The package or namespace a file declares its functions in, e.g. java.util or
+    std::chrono. Files with the same name in different packages are otherwise only told
+    apart by their path.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C++, C#, CUDA, Go, Java, Kotlin and Scala
+*/
+
+package parse
+
+import (
+    "path/filepath"
+    "regexp"
+    "strings"
+)
+
+// package clauses of Java, Kotlin, Scala and Go
+var packageClause = regexp.MustCompile(`^\s*package\s+([\w.]+)`)
+
+var packageLangs = map[string]bool{"java":true, "kt":true, "scala":true, "go":true}
+
+// Languages with namespace blocks, and how their names are joined
+var namespaceSeps = map[string]string{"cs":".", "cpp":"::", "hpp":"::", "h":"::", "cu":"::", "cuh":"::"}
+
+/*
+    Package or namespace of the file, empty if it declares none or the language has no
+    such thing
+*/
+func packageName(content []byte, lines []int, ext string) string {
+    if packageLangs[ext] {
+        // Scala chains package clauses, package a.b then package c is a.b.c
+        parts := []string{}
+        for i := range lines {
+            if m := packageClause.FindStringSubmatch(lineText(content, lines, i)); m != nil {
+                parts = append(parts, m[1])
+                if ext != "scala" {
+                    break
+                }
+            }
+        }
+        return strings.Join(parts, ".")
+    }
+    if sep, ok := namespaceSeps[ext]; ok {
+        return namespace(content, ext, sep)
+    }
+    return ""
+}
+
+/*
+    Namespaces opened one directly inside the other from the first one in the file, e.g.
+    a::b for namespace a { namespace b { or namespace a::b {. Stops at the first anonymous
+    namespace or at the end of the outermost one.
+*/
+func namespace(content []byte, ext string, sep string) string {
+    lang  := syntaxFor(ext)
+    names := []string{}
+    depth := 0
+    for i := 0; i < len(content); i++ {
+        if next := lang.skip(content, i); next != i {
+            i = next - 1
+            continue
+        }
+
+        switch c := content[i]; {
+        case c == '{':
+            depth++
+        case c == '}':
+            if depth--; depth < len(names) {
+                return strings.Join(names, sep)
+            }
+        case depth == len(names) && isKeywordAt(content, i, "namespace") && !usingDirective(content, i):
+            rest := content[i+len("namespace"):]
+            end  := strings.IndexAny(string(rest), "{;")
+            if end < 0 {
+                return strings.Join(names, sep)
+            }
+            name := strings.TrimSpace(string(rest[:end]))
+            if name == "" || strings.ContainsAny(name, " \t\n=") {
+                // Anonymous namespaces and aliases, namespace fs = std::filesystem;
+                return strings.Join(names, sep)
+            }
+            names = append(names, strings.Replace(name, "::", sep, -1))
+
+            // C# file-scoped namespaces cover the rest of the file
+            if rest[end] == ';' {
+                return strings.Join(names, sep)
+            }
+            depth++
+            i += len("namespace") + end
+        }
+    }
+    return strings.Join(names, sep)
+}
+
+/*
+    True if the namespace keyword at i follows using, using namespace std;
+*/
+func usingDirective(content []byte, i int) bool {
+    before := strings.TrimRight(string(content[:i]), " \t\n")
+    return strings.HasSuffix(before, "using") && (len(before) == 5 || !isIdent(before[len(before)-6]))
+}
+
+/*
+    True if the word at i of content is keyword, not part of a longer identifier
+*/
+func isKeywordAt(content []byte, i int, keyword string) bool {
+    if i > 0 && isIdent(content[i-1]) {
+        return false
+    }
+    end := i + len(keyword)
+    return end < len(content) && string(content[i:end]) == keyword && !isIdent(content[end])
+}
+
+/*
+    Fully qualified name of fn, a function of file: its package, class and name
+*/
+func (file File) QualifiedName(fn Function) string {
+    sep := "."
+    if s, ok := namespaceSeps[strings.TrimPrefix(filepath.Ext(file.Path), ".")]; ok {
+        sep = s
+    }
+
+    parts := []string{}
+    if file.Package != "" {
+        parts = append(parts, file.Package)
+    }
+    if fn.Class != "" {
+        parts = append(parts, strings.Replace(fn.Class, ".", sep, -1))
+    }
+    return strings.Join(append(parts, fn.Name), sep)
+}
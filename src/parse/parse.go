@@ -17,27 +17,76 @@
 package parse
 
 import (
-	"strings"
-    "os/exec"
     "bufio"
+    "bytes"
+    "errors"
+	"strings"
     "sync"
     "os"
     "io/ioutil"
     "log"
     "fmt"
-    "hash/fnv"
+    "io"
+    "io/fs"
+    "path/filepath"
+    "runtime"
+    "context"
 )
 
 /*
-    Name  - File name
-    Path  - Full path to file
-    Funcs - List of functions that match desired types
+    Id          - Hash of Path, within Repo or Archive if any, see ids.go
+    Name        - File name
+    Path        - Full path to file
+    Funcs       - List of functions that match desired types
+    Repo        - URL of the repository the file was read from, or its directory if it has
+                  no remote, if any
+    Commit      - SHA of the commit the file was read at, if any
+    Archive     - Archive the file was read from, Path being its path inside it, if any
+    Backend     - What found the functions: ctags, or the regex fallback if ctags isn't installed
+    Symbols     - Tags of the non-function kinds selected with Options.Kinds
+    Imports     - Packages, modules and headers the file imports, includes or requires, in order
+    Package     - Package or namespace the file declares, e.g. java.util or std::chrono
+    Version     - Language version the file is written for, e.g. python2 or c++17, empty if
+                  its syntax doesn't tell, see langversion.go
+    Language    - Language the file was read as, e.g. Python or C++. Told from the content
+                  when the extension isn't enough, see language.go
+    Encoding    - Encoding the file was in before it was transcoded to UTF-8, e.g. utf-16le
+                  or latin-1, empty for UTF-8 without a BOM, see encoding.go
+    LineEndings - Line endings the file had before they were turned into \n, crlf or cr,
+                  empty for \n
+    Warnings    - What of the file was left out and why, one per code, see codes.go
 */
 type File struct {
-    Id    uint32 `json:"id" bson:"_id,omitempty"`
+    Id          uint64 `json:"id" bson:"_id,omitempty"`
+    Name        string
+    Path        string
+    Funcs       []Function
+    Repo        string `json:",omitempty" bson:",omitempty"`
+    Commit      string `json:",omitempty" bson:",omitempty"`
+    Archive     string `json:",omitempty" bson:",omitempty"`
+    Backend     Backend
+    Symbols     []Symbol `json:",omitempty" bson:",omitempty"`
+    Classes     []Class `json:",omitempty" bson:",omitempty"`
+    Imports     []string `json:",omitempty" bson:",omitempty"`
+    Package     string `json:",omitempty" bson:",omitempty"`
+    Version     string `json:",omitempty" bson:",omitempty"`
+    Language    string `json:",omitempty" bson:",omitempty"`
+    Encoding    string `json:",omitempty" bson:",omitempty"`
+    LineEndings string `json:",omitempty" bson:",omitempty"`
+    Warnings    []Warning `json:",omitempty" bson:",omitempty"`
+}
+
+/*
+    Name  - Symbol name
+    Kind  - ctags kind, e.g. class or interface
+    Line  - Line the symbol is declared on
+    Scope - Enclosing class, namespace, ..., if the backend reports it
+*/
+type Symbol struct {
     Name  string
-    Path  string
-    Funcs []Function
+    Kind  string
+    Line  int
+    Scope string `json:",omitempty" bson:",omitempty"`
 }
 
 /*
@@ -52,227 +101,1084 @@ func (f *File) GetFuncs() []string {
 }
 
 /*
-    Id     - Relative position in the file. Ctags returns the function headers in order
-             Will need this order later when splitting the file to extract the function source.
-    Name   - Function name
-    InType - Array of input types
-    Output - Array of output types
+    Id          - Hash of the function's text with whitespace collapsed, or of its scope and
+                  header when its text isn't known, see ids.go. Functions that still
+                  collide in a file are told apart by their order
+    ContentId   - Hash of the body without comments and formatting, the same for every
+                  copy of the function wherever it is, see ids.go. 0 without a body
+    Name        - Function name
+    Header      - Header as the backend reported it
+    Signature   - Header as written in the file, from its first character up to the body,
+                  with whitespace normalized. Only set when the body was found
+    Doc         - Javadoc, docstring or comment right above the function, without the
+                  comment markers
+    Annotations - Java annotations, Python decorators and C# attributes on the function,
+                  e.g. @Override or [TestMethod]
+    Throws      - Exceptions in the throws clause of a Java method
+    Visibility  - public, private, protected or internal as written, empty for the
+                  language default, e.g. package-private in Java
+    Modifiers   - Other declaration modifiers in the order written, e.g. static, final
+    Abstract    - Abstract or interface method (or prototype) without a body, only listed
+                  with Options.Abstract. Source is empty
+    Class       - Class, struct or interface the function is declared in, e.g. Outer.Inner.
+                  Only set with Options.Classes
+    InType      - Array of input types
+    Output      - Array of output types
+    Params      - Structured input types, one per entry in InType
+    Returns     - Structured output types, one per entry in OutType
+    Kind        - What the function is when it isn't a plain function or method: KindRPC,
+                  KindScript, KindTarget, KindMacro, KindConstructor, KindDestructor, or
+                  the kind of the Pattern that matched it
+    Flags       - Dialect qualifiers that aren't types, e.g. CUDA __global__ or OpenCL __kernel,
+                  and EntryPoint for shader entry points
+    Highlights  - Syntax highlighting spans over Source, only set when requested
+    StartLine   - Line the function starts on, 1-based
+    StartColumn - Column the function starts at, 1-based, in bytes
+    EndLine     - Line the function ends on
+    StartOffset - Byte offset of the start of the function in the file
+    EndOffset   - Byte offset just past the end of the function. Positions are 0 if unknown,
+                  e.g. the end when source isn't extracted
+    UsageCount  - Call sites of the function in its repo, see CallCounter. Only set when
+                  counted
+    Tokens      - Length of Source in tokens of Options.Tokenizer, 0 if not counted
+    Context     - Fields of its class and signatures of its siblings, only set with
+                  Options.Context
+    AddedIn     - Id of the indexing run that first saw the function
+    RemovedIn   - Id of the indexing run that found the function gone from its file.
+                  Removed functions are kept as tombstones, empty for live functions
+    line        - Line the header is on as reported by the backend, 0 if unknown
+    scope       - Enclosing scope as reported by the backend, empty if unknown
 */
 type Function struct {
-    Id      uint32
-    Name    string
-    Header  string
-    InType  []string
-    OutType []string
-    Source  string
+    Id          uint64
+    ContentId   uint64 `json:",omitempty" bson:",omitempty"`
+    Name        string
+    Header      string
+    Signature   string `json:",omitempty" bson:",omitempty"`
+    Doc         string `json:",omitempty" bson:",omitempty"`
+    Annotations []string `json:",omitempty" bson:",omitempty"`
+    Throws      []string `json:",omitempty" bson:",omitempty"`
+    Visibility  string `json:",omitempty" bson:",omitempty"`
+    Modifiers   []string `json:",omitempty" bson:",omitempty"`
+    Abstract    bool `json:",omitempty" bson:",omitempty"`
+    Class       string `json:",omitempty" bson:",omitempty"`
+    Kind        string `json:",omitempty" bson:",omitempty"`
+    InType      []string
+    OutType     []string
+    Params      []Type
+    Returns     []Type
+    Source      string
+    Flags       []string `json:",omitempty" bson:",omitempty"`
+    StartLine   int `json:",omitempty" bson:",omitempty"`
+    StartColumn int `json:",omitempty" bson:",omitempty"`
+    EndLine     int `json:",omitempty" bson:",omitempty"`
+    StartOffset int `json:",omitempty" bson:",omitempty"`
+    EndOffset   int `json:",omitempty" bson:",omitempty"`
+    Highlights  []Span `json:",omitempty" bson:",omitempty"`
+    UsageCount  int `json:",omitempty" bson:",omitempty"`
+    Tokens      int `json:",omitempty" bson:",omitempty"`
+    Context     *FuncContext `json:",omitempty" bson:",omitempty"`
+    AddedIn     string `json:",omitempty" bson:",omitempty"`
+    RemovedIn   string `json:",omitempty" bson:",omitempty"`
+    line        int
+    scope       string
+}
+
+/*
+    Start - Byte offset of the first byte of the token in Function.Source
+    End   - Byte offset just past the token
+    Type  - Token type, e.g. Keyword or NameFunction
+*/
+type Span struct {
+    Start int
+    End   int
+    Type  string
 }
 
 
 func getLangExt(lang string) string {
     langMap := map[string]string {"c":"c", "c++":"cpp", "cpp":"cpp", "c#":"cs",
                                   "cs":"cs", "erlang":"erl", "java":"java",
-                                  "javascript":"js", "lisp":"lsp", "lua":"lua", "python":"py"}
+                                  "javascript":"js", "lisp":"lsp", "lua":"lua", "python":"py",
+                                  "go":"go", "kotlin":"kt", "rust":"rs", "typescript":"ts",
+                                  "cuda":"cu", "opencl":"cl", "hlsl":"hlsl", "glsl":"glsl",
+                                  "protobuf":"proto", "proto":"proto", "thrift":"thrift"}
     return langMap[strings.TrimSpace(lang)]
 }
 
 func getFuncTerm(ext string) string {
     extMap := map[string]string {"c":"function", "cpp":"function", "cs":"method",
                                  "erl":"function", "java":"method", "js":"function",
-                                 "lsp":"function", "lua":"function", "py":"function"}
+                                 "lsp":"function", "lua":"function", "py":"function",
+                                 "cu":"function", "cuh":"function", "cl":"function", "hlsl":"function",
+                                 "glsl":"function"}
     return extMap[ext]
 }
 
 
 /*
     Caller should always check the ok variable returned. The first three returns values are not always
-    guaranteed to return the correct values.
+    guaranteed to return the correct values. The fourth is the first type not in funcTypes, when
+    that is why it isn't ok.
 */
-func parseJavaFuncHeader(header string, funcTypes map[string]bool) (string, []string, []string, bool) {
+func parseJavaFuncHeader(header string, ext string, funcTypes map[string]bool) (string, []Type, []Type, string, bool) {
     // Ignore single-line comments on function header line and remove trailing spaces
     header = strings.TrimSpace(strings.Split(header, "//")[0])
 
-    // 59 is byte value of ; meaning header is from abstract class and not an actual function header
-    if header[len(header)-1] == 59 {
-        return header, []string{}, []string{}, false
-    }
+    // 59 is byte value of ; meaning header is from abstract class or an interface and not an
+    // actual function header. Only parsed when listing those, see Options.Abstract
+    declaration := header[len(header)-1] == 59
+    header       = strings.TrimRight(header, "; \t")
 
     // Left part contains visibility modifier, return type (can be composed of multiple keywords),
     //      and function name
     // Right part contains input types
 	split := strings.Split(header, "(")
     fname := ""
-    in    := []string{}
-    out   := []string{}
+    in    := []Type{}
+    out   := []Type{}
     ok    := false
+    unknown       := ""
     nonparameters := []string{}
 
 	if len(split) == 2 {
-        var wg sync.WaitGroup
-        halt := false
-
 	    // Check return type
         // If the header is a class header, it will only have a public modifier and the clas name
         // Functions have at least three keywords before the parentheses
-        nonparameters = strings.Split(split[0], " ")
+        // Generic types keep their type arguments: Map<Integer, List<Foo>>
+        nonparameters = typeFields(split[0])
+        if len(nonparameters) == 0 {
+            return fname, in, out, unknown, ok
+        }
         fname         = nonparameters[len(nonparameters)-1]
         nonparameters = nonparameters[:len(nonparameters)-1]
 
-	    if len(nonparameters) > 2 {
+        // Annotations aren't keywords, but @Nullable and friends say the return value may be null
+        var nullable bool
+        nullable, nonparameters = stripAnnotations(nonparameters)
+
+        // C has no visibility modifiers, the return type alone is enough. Neither do interface
+        // methods, which are public anyway
+        minWords := 3
+        if cLike[ext] {
+            nonparameters, fname = cReturnWords(nonparameters, fname)
+            minWords = 1
+        } else if declaration {
+            minWords = 1
+        }
+
+        // Types are checked in order, so In and Out follow the order of the header.
+        // Headers are only a few words long, they are checked in parallel per tag instead.
+        halt := false
+
+        // Type parameters of generic methods, <T extends Foo>, aren't types themselves
+        vars := map[string]string{}
+        for _, t := range nonparameters {
+            if strings.HasPrefix(t, "<") {
+                vars = typeParams(t)
+            }
+        }
+
+	    if len(nonparameters) >= minWords {
 	        for _, t := range nonparameters {
+                // Modifiers aren't types either
+                if strings.HasPrefix(t, "<") || isDeclModifier(ext, t) {
+                    continue
+                }
+
                 // If any types are not valid, not in the map, then stop
                 // All return values must be valid
-                wg.Add(1)
-                go func(t string, halt *bool) {
-                    defer wg.Done()
-                    t = strings.TrimSpace(t)
-    		        if desired, valid := funcTypes[t]; valid && desired {
-                        out = append(out, t)
-                    } else if !valid {
-                        // fmt.Println("Non: ",t)
-                        *halt = true
+                typ := ParseType(t)
+                typ.Nullable = typ.Nullable || nullable
+                eraseTypeVar(&typ, vars)
+    		    if desired, valid := lookupType(funcTypes, typ); valid && desired {
+                    out = append(out, typ)
+                } else if !valid {
+                    halt = true
+                    if unknown == "" {
+                        unknown = typ.Name
                     }
-                }(t, &halt)
+                }
 		    }
 	    }
 
         // Check the input parameters
-        parameters := strings.Split(strings.Split(split[1], ")")[0], " ")
+        parameters := splitTopLevel(strings.Split(split[1], ")")[0])
 
         // Check that all the input types are valid
         // Can ignore the variables names
-        for i, t := range parameters {
-            if i %2 == 0 {
-                wg.Add(1)
-                go func(i int, t string, halt *bool) {
-                    defer wg.Done()
-
-                    // Remove the comma from the type
-                    t = strings.TrimSpace(strings.Split(t, ",")[0])
-                    parameters[i] = t
-
-                    // Save input types if valid (key exists) and desired (key/value = true)
-                    if desired, valid := funcTypes[t]; valid && desired {
-                        in = append(in, t)
-                    } else if !valid {
-                        *halt = true
-                    }
+        for _, p := range parameters {
+            typ := ParseType(paramType(p, ext))
+            eraseTypeVar(&typ, vars)
 
-                }(i, t, &halt)
+            // Save input types if valid (key exists) and desired (key/value = true)
+            if desired, valid := lookupType(funcTypes, typ); valid && desired {
+                in = append(in, typ)
+            } else if !valid {
+                halt = true
+                if unknown == "" {
+                    unknown = typ.Name
+                }
             }
         }
 
-        wg.Wait()
-
         // If encountered an invalid type in the input or output types, or this is not a function header
-        if halt || len(nonparameters) <= 2 {
-            return "", in, out, ok
+        if len(nonparameters) < minWords {
+            return "", in, out, "", ok
+        }
+        if halt {
+            return "", in, out, unknown, ok
         }
 
-        return fname, in, out, true
+        return fname, in, out, "", true
 	} 
 
-	return fname, in, out, ok
+	return fname, in, out, "", ok
+}
+
+/*
+    Type of a parameter declaration without the variable name. Annotations are kept so
+    nullability is captured, declaration modifiers such as final are dropped. C and Java
+    also allow array and pointer modifiers on the name: int a[], int *p
+*/
+func paramType(p string, ext string) string {
+    words := []string{}
+    for _, w := range typeFields(p) {
+        if !isDeclModifier(ext, w) {
+            words = append(words, w)
+        }
+    }
+    if len(words) > 1 {
+        name  := words[len(words)-1]
+        words  = words[:len(words)-1]
+        prefix := name[:len(name)-len(strings.TrimLeft(name, "*&"))]
+        suffix := strings.Repeat("[]", strings.Count(name, "[]"))
+        words  = append(words, prefix+suffix)
+    }
+    return strings.Join(words, " ")
+}
+
+/*
+    What tells overloads apart: the enclosing scope, the name and every parameter type,
+    whether desired or not, e.g. Parser.parse(int, String)
+*/
+func overloadKey(scope string, fname string, header string, ext string) string {
+    params := []string{}
+    if split := strings.SplitN(header, "(", 2); len(split) == 2 {
+        for _, p := range splitTopLevel(strings.Split(split[1], ")")[0]) {
+            params = append(params, ParseType(paramType(p, ext)).Name)
+        }
+    }
+    if scope != "" {
+        fname = scope + "." + fname
+    }
+    return fname + "(" + strings.Join(params, ", ") + ")"
+}
+
+/*
+    Give functions that still share an Id, e.g. the same definition under two #ifdef
+    branches, Ids of their own by hashing in their occurrence. The first keeps its Id.
+*/
+func disambiguate(funcs []Function, h IdHash) {
+    seen := map[uint64]int{}
+    for i := range funcs {
+        id := funcs[i].Id
+        if n := seen[id]; n > 0 {
+            funcs[i].Id = h.sum(fmt.Sprintf("%d#%d", id, n))
+        }
+        seen[id]++
+    }
 }
 
-func hash(s string) uint32 {
-        h := fnv.New32a()
-        h.Write([]byte(s))
-        return h.Sum32()
+/*
+    Provisional Id, until assignIds gives the final ones
+*/
+func hash(s string) uint64 {
+    return FNV64.sum(s)
+}
+
+/*
+    Returns a File struct containing all file and function information. opts pick the
+    types, backend, ..., see options.go:
+
+        file, err := parse.ParseFile(path, parse.WithTypes(types), parse.WithoutSource())
+
+    Errors are the same as ParseFileWith's.
+*/
+func ParseFile(path string, opts ...Option) (File, error) {
+    return ParseFileWith(path, NewOptions(opts...))
+}
+
+/*
+    Same as ParseFile with more control over how the file is parsed. Returns ErrNoFuncs if
+    the file has no function of the desired types, a *LimitError if it exceeds one of
+    opts.Limits, a *SkipError if opts.Skip says it's binary, minified or generated, a
+    *CtagsError if opts.Backend is Ctags and ctags can't be used, see discover.go, or the
+    error from stat if it can't be read.
+*/
+func ParseFileWith(path string, opts Options) (File, error) {
+    opts = opts.withEntities()
+    if opts.Observer != nil {
+        opts.Observer.FileStarted(path)
+    }
+
+    file, err := parseFileWith(path, opts)
+    return finishFile(path, file, err, opts)
 }
 
 /*
-    Returns a File struct containing all file and function information 
-    and bool indicating if extracting the headers is complete
+    What's left once path was parsed: drop the bodies if opts say so and tell the observer
 */
-func ParseFile(path string, funcTypes map[string]bool) (File, bool) {
+func finishFile(path string, file File, err error, opts Options) (File, error) {
+    if opts.NoSource {
+        for i := range file.Funcs {
+            file.Funcs[i].Source = ""
+        }
+    }
+
+    if opts.Observer != nil {
+        opts.Observer.FileDone(path, len(file.Funcs), err)
+    }
+    return file, err
+}
+
+func parseFileWith(path string, opts Options) (File, error) {
+    content, release, mapped, err := openFile(path, opts.Limits)
+    if err != nil {
+        return File{}, err
+    }
+    defer release()
+
+    fname := fileName(path)
+    if mapped {
+        return parseMapped(path, func() (File, error) {
+            return parseCached(path, fname, content, opts)
+        })
+    }
+    return parseCached(path, fname, content, opts)
+}
+
+func fileName(path string) string {
     splits := strings.Split(path, "/")
-    fname  := splits[len(splits)-1]
-
-    // Use ctags to grab function headers and pipe to buff
-    ctags := exec.Command("ctags", "-x", "--c-types=f", path)
-    grep  := exec.Command("grep", getFuncTerm(fname))
-    awk   := exec.Command("awk", "{$1=$2=$3=$4=\"\"; print $0}")
-    grep.Stdin, _ = ctags.StdoutPipe()
-    awk.Stdin, _  = grep.StdoutPipe()
-    awkOut, _    := awk.StdoutPipe()
-    buff := bufio.NewScanner(awkOut)
-
-    _ = grep.Start()
-    _ = awk.Start()
-    _ = ctags.Run()
-    _ = grep.Wait()
-    defer awk.Wait()
-
-    // Collect all function headers in file
-    var ctagHeaders []string
+    return splits[len(splits)-1]
+}
+
+/*
+    The content of the file at path, see readContent, or a *LimitError if it's larger
+    than limits allow
+*/
+func openFile(path string, limits Limits) ([]byte, func(), bool, error) {
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, nil, false, err
+    }
+    if err := tooLarge(path, info.Size(), limits); err != nil {
+        return nil, nil, false, err
+    }
+    return readContent(path, info.Size())
+}
+
+/*
+    A *LimitError if the file at path, size bytes long, is larger than limits allow
+*/
+func tooLarge(path string, size int64, limits Limits) error {
+    if limits.MaxFileSize > 0 && size > limits.MaxFileSize {
+        return &LimitError{Path: path, Limit: LimitFileSize, Max: limits.MaxFileSize, Actual: size}
+    }
+    return nil
+}
+
+/*
+    parseContent, looking the result up in opts.Cache first by the same content. Only
+    results that don't depend on the limits are cached, files with functions and files
+    without any.
+*/
+func parseCached(path string, fname string, content []byte, opts Options) (File, error) {
+    key, file, ok, err := lookupCached(path, fname, content, opts)
+    if ok {
+        return file, err
+    }
+    file, err = parseContent(path, fname, content, opts)
+    storeCached(key, path, file, err, opts)
+    return file, err
+}
+
+/*
+    The key of the file at path in opts.Cache, "" without a cache, and what it parsed
+    to if it's there
+*/
+func lookupCached(path string, fname string, content []byte, opts Options) (string, File, bool, error) {
+    if opts.Cache == nil {
+        return "", File{}, false, nil
+    }
+    key          := cacheKey(path, content, opts)
+    entry, found := opts.Cache.Get(key)
+    if !found {
+        return key, File{}, false, nil
+    }
+    if entry.NoFuncs {
+        return key, File{}, true, ErrNoFuncs
+    }
+    file      := entry.File
+    file.Name  = fname
+    file.Path  = path
+    file.Id    = FileId(file, opts.IdHash)
+    return key, file, true, nil
+}
+
+/*
+    Save what the file at path parsed to under key, unless it depends on the limits
+*/
+func storeCached(key string, path string, file File, err error, opts Options) {
+    if key == "" || (err != nil && err != ErrNoFuncs) {
+        return
+    }
+    if perr := opts.Cache.Put(key, CacheEntry{File: file, NoFuncs: err == ErrNoFuncs}); perr != nil {
+        log.Printf("failed to cache %s: %v\n", path, perr)
+    }
+}
+
+/*
+    parseFileWith on content, that of the file at path, read once for every step. Only
+    ctags reads the file again, see findTags.
+*/
+func parseContent(path string, fname string, content []byte, opts Options) (File, error) {
+    limits := opts.Limits
+    if err := opts.Skip.check(path, content); err != nil {
+        return File{}, err
+    }
+
+    // Files that aren't UTF-8 with \n line endings are parsed from a normalized copy, then
+    // attributed to path. The copy is written out for ctags, but parsed from memory.
+    enc, endings, tmp, normalized, err := normalizeFile(path, content)
+    if err != nil {
+        return File{}, err
+    }
+    if tmp != "" {
+        defer os.RemoveAll(filepath.Dir(tmp))
+        file, err := parseContent(tmp, fname, normalized, opts)
+        if limit, ok := err.(*LimitError); ok {
+            limit.Path = path
+        }
+        if skip, ok := err.(*SkipError); ok {
+            skip.Path = path
+        }
+        if err != nil {
+            return file, err
+        }
+        file.Name, file.Path = fname, path
+        file.Id              = FileId(file, opts.IdHash)
+        file.Encoding, file.LineEndings = enc, endings
+        return file, nil
+    }
+
+    ctx := context.Background()
+    if limits.Timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+        defer cancel()
+    }
+    // Service definitions, CI configs and build files are read directly, no backend knows them
+    ext := contentExt(path, content)
+    if isIDL(ext) || isCI(ext) || buildLang(path) != "" {
+        var file File
+        if isIDL(ext) {
+            file, err = parseIDLFile(path, fname, content, ext, opts)
+        } else if isCI(ext) {
+            file, err = parseCIFile(path, fname, content, opts)
+        } else {
+            file, err = parseBuildFile(path, fname, content, opts)
+        }
+        if err == nil {
+            file.Language = languageNames[ext]
+            assignIds(&file, content, ext, opts.IdHash)
+        }
+        return file, err
+    }
+
+    timedOut := func() error {
+        if ctx.Err() != nil {
+            return &LimitError{Path: path, Limit: LimitTimeout, Max: int64(limits.Timeout)}
+        }
+        return nil
+    }
+
+    // A ctags that can't be used finds nothing, which would pass for a file without functions
+    if opts.Backend == Ctags {
+        if _, err := lookCtags(opts.ctags()); err != nil {
+            return File{}, err
+        }
+    }
+
+    // Grab function headers with the selected backend
     var funcHeaders []Function
 
-    for buff.Scan() {    
-        ctagHeaders = append(ctagHeaders, buff.Text()+"\n")
+    tags, backend, err := findTags(ctx, path, content, ext, opts)
+    symbols            := []Symbol{}
+    if err := timedOut(); err != nil {
+        return File{}, err
+    }
+    if err != nil {
+        return File{}, err
     }
 
-    var wg sync.WaitGroup
+    // Backends only report the first line of a header, which is cut short when the
+    // parameters wrap onto the following lines
+    lines := lineOffsets(content)
+
+    funcTags  := []tag{}
+    classTags := []tag{}
+    for _, t := range tags {
+        if (opts.Classes || opts.Context) && isClassKind(t.Kind) {
+            classTags = append(classTags, t)
+            continue
+        }
+        if !isFuncKind(t.Kind, ext) {
+            symbols = append(symbols, Symbol{Name: t.Name, Kind: t.Kind, Line: t.Line, Scope: t.Scope})
+            continue
+        }
 
-    for _, header := range ctagHeaders {
+        if t.Source == "" {
+            t = fullHeader(content, lines, t, ext)
+        } else if opts.Flatten {
+            t.Source = flatten(t.Source)
+        }
+        funcTags = append(funcTags, t)
+    }
+
+    if limits.MaxFuncs > 0 && len(funcTags) > limits.MaxFuncs {
+        return File{}, &LimitError{Path: path, Limit: LimitFuncs, Max: int64(limits.MaxFuncs), Actual: int64(len(funcTags))}
+    }
+
+    // Headers are parsed by a fixed pool of workers. Each result goes in the slot of its
+    // tag, so functions come out in the order the backend reported them.
+    results := make([]*Function, len(funcTags))
+    unknown := make([]string, len(funcTags))
+    jobs    := make(chan int)
+
+    var wg sync.WaitGroup
+    for w := 0; w < runtime.NumCPU(); w++ {
         wg.Add(1)
-        go func(header string) {
+        go func() {
             defer wg.Done()
-            fname, in, out, ok := parseJavaFuncHeader(header, funcTypes) 
-            if ok && len(in) > 0 && len(out) > 0 {
-                fn := Function{hash(fname+strings.TrimSpace(header)), fname, strings.TrimSpace(strings.Replace(header, "{", "", -1)), in, out, ""}
-                funcHeaders = append(funcHeaders, fn)
+            for i := range jobs {
+                if ctx.Err() == nil {
+                    results[i], unknown[i] = parseFunc(funcTags[i], ext, opts)
+                }
             }
-        }(header)
+        }()
     }
-
+    for i := range funcTags {
+        jobs <- i
+    }
+    close(jobs)
     wg.Wait()
+    if err := timedOut(); err != nil {
+        return File{}, err
+    }
+
+    var warnings []Warning
+    for i, fn := range results {
+        if fn != nil && opts.wantsFunc(funcTags[i], fn) {
+            funcHeaders = append(funcHeaders, *fn)
+        } else if unknown[i] != "" {
+            warnings = warn(warnings, WUnknownType, funcTags[i].Line, unknown[i])
+        }
+    }
+    funcHeaders = append(funcHeaders, patternFuncs(content, lines, ext, opts.Patterns)...)
 
     var file File
 
-    if len(funcHeaders) > 0 {
-        file = File{hash(path), fname, path, funcHeaders}
-        extractFuncSrc(&file)
+    // Files with only classes or variables are kept when those were asked for
+    others := len(opts.Entities) > 0 && (len(symbols) > 0 || (opts.Classes && len(classTags) > 0))
+    if len(funcHeaders) > 0 || others {
+        file = File{Id: hash(path), Name: fname, Path: path, Funcs: funcHeaders, Backend: backend,
+                    Language: languageNames[ext], Warnings: warnings}
+        if len(symbols) > 0 {
+            file.Symbols = symbols
+        }
+        if !opts.NoSource {
+            extractFuncSrc(&file, content, lines, ext, opts.Flatten)
+        } else {
+            for i := range file.Funcs {
+                file.Funcs[i].locate(lines, len(content))
+            }
+        }
+        for i := range file.Funcs {
+            file.Funcs[i].Doc         = docComment(content, lines, file.Funcs[i], ext)
+            file.Funcs[i].Annotations = annotations(content, lines, file.Funcs[i], ext)
+            if opts.Tokenizer != nil {
+                file.Funcs[i].Tokens = opts.Tokenizer.Count(file.Funcs[i].Source)
+            }
+        }
+        file.Imports = imports(content, lines, ext)
+        file.Package = packageName(content, lines, ext)
+        file.Version = langVersion(content, ext)
+        assignIds(&file, content, ext, opts.IdHash)
+        if opts.Classes {
+            file.Classes = buildClasses(classTags, content, lines, ext)
+            attachMethods(&file)
+        }
+        if opts.Context {
+            addContext(&file, classTags, content, lines, ext)
+        }
     } else {
-        return file, false
+        return file, ErrNoFuncs
+    }
+
+    return file, nil
+}
+
+/*
+    Build the Function for the header tagged by t, or nil if it doesn't have the desired
+    types. Then the type that isn't in opts.Types is returned too, if that's why.
+*/
+func parseFunc(t tag, ext string, opts Options) (*Function, string) {
+    header := t.Text+"\n"
+    proto  := header
+    flags  := []string(nil)
+    if cLike[ext] {
+        proto, flags = gpuHeader(t.Text, ext)
+        proto        = cppPrototype(krPrototype(proto))+"\n"
+    }
+    proto = dropAnnotationArgs(proto, ext)
+
+    var throws []string
+    if ext == "java" {
+        proto, throws = throwsClause(proto)
+        proto         = strings.TrimRight(proto, " \t\n") + "\n"
+    }
+
+    // Abstract and interface methods have no body to extract. Abstract declarations that span
+    // lines needn't end with the ; parseJavaFuncHeader looks for
+    visibility, modifiers := headerModifiers(proto, ext)
+    abstract := hasModifier(modifiers, "abstract") || strings.HasSuffix(strings.TrimSpace(strings.Split(proto, "//")[0]), ";")
+    if abstract && !opts.Abstract {
+        return nil, ""
+    }
+
+    fname, in, out, unknown, ok := parseJavaFuncHeader(proto, ext, opts.Types)
+    kind := ""
+    if !ok && opts.Constructors {
+        fname, in, kind, ok = parseConstructor(proto, t.Scope, ext, opts.Types)
+    }
+
+    // Destructors take nothing and constructors return nothing
+    if !ok {
+        return nil, unknown
+    }
+    if (len(in) == 0 && kind != KindDestructor) || (len(out) == 0 && kind == "") {
+        return nil, ""
+    }
+
+    fn := Function{
+        Id:      hash(overloadKey(t.Scope, fname, proto, ext)+strings.TrimSpace(header)),
+        Name:    fname,
+        Header:  strings.TrimSpace(strings.Replace(header, "{", "", -1)),
+        InType:  typeNames(in),
+        OutType: typeNames(out),
+        Params:  in,
+        Returns: out,
+        Source:  t.Source,
+        Flags:   flags,
+        Throws:  throws,
+        Kind:    kind,
+        line:    t.Line,
+        scope:   t.Scope,
+
+        Visibility: visibility,
+        Modifiers:  modifiers,
+
+        StartOffset: t.Start,
+        EndOffset:   t.End,
+    }
+    if abstract {
+        fn.Abstract  = true
+        fn.Source    = ""
+        fn.Signature = normalizeSignature(strings.TrimRight(t.Text, "; \t\n"))
+    } else if t.Source != "" {
+        fn.Signature = normalizeSignature(t.Text)
+    }
+    canonicalize("."+ext, &fn)
+    return &fn, ""
+}
+
+/*
+    Same as ParseFileWith but reads the source from r. name is used as the file path and,
+    with the start of the content, decides the language, see DetectLanguage. Since ctags
+    only works on files, the content is written to a temporary file of the same name
+    first. Errors are ParseFileWith's, naming name, and those reading r.
+*/
+func ParseReader(name string, r io.Reader, opts Options) (File, error) {
+    opts = opts.withEntities()
+    if opts.Observer != nil {
+        opts.Observer.FileStarted(name)
+    }
+
+    file, err := parseReader(name, r, opts)
+    return finishFile(name, file, err, opts)
+}
+
+func parseReader(name string, r io.Reader, opts Options) (File, error) {
+    dir, err := ioutil.TempDir("", "pakkun-")
+    if err != nil {
+        return File{}, fmt.Errorf("%s: %w", name, err)
+    }
+    defer os.RemoveAll(dir)
+
+    tmp := filepath.Join(dir, fileName(name))
+    if err := writeFile(tmp, r, opts.Limits.MaxFileSize); err != nil {
+        return File{}, renamed(err, name)
+    }
+
+    file, err := parseFileWith(tmp, opts)
+    if err != nil {
+        return file, renamed(err, name)
+    }
+
+    // Attribute the result to the original name rather than the temp file
+    file.Name = fileName(name)
+    file.Path = name
+    file.Id   = FileId(file, opts.IdHash)
+
+    return file, nil
+}
+
+/*
+    Write what's left of r to a new file at path, or return a *LimitError once it's past
+    max bytes, if max isn't 0. Nothing past max is read, so a stream inflating to
+    gigabytes costs no more than max.
+*/
+func writeFile(path string, r io.Reader, max int64) error {
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil {
+        return err
+    }
+    if max > 0 {
+        r = io.LimitReader(r, max+1)
+    }
+    n, err := io.Copy(f, r)
+    if err != nil {
+        f.Close()
+        return err
+    }
+    if max > 0 && n > max {
+        f.Close()
+        return &LimitError{Path: path, Limit: LimitFileSize, Max: max}
+    }
+    return f.Close()
+}
+
+/*
+    err of a copy of the file at path, told as path's: limits and skips name it, other
+    errors but ErrNoFuncs are prefixed with it
+*/
+func renamed(err error, path string) error {
+    if limit, ok := err.(*LimitError); ok {
+        limit.Path = path
+        return limit
+    }
+    if skip, ok := err.(*SkipError); ok {
+        skip.Path = path
+        return skip
+    }
+    if err == ErrNoFuncs {
+        return err
+    }
+    return fmt.Errorf("%s: %w", path, err)
+}
+
+/*
+    Same as ParseFileWith but parses content, never touching path, which only names the
+    file and decides its language. Since ctags only works on files, functions are found by
+    the regex backend, or by tree-sitter if opts select it. This is the extractor where
+    there's no file system or ctags, e.g. in the browser, see src/pakkun-wasm.
+*/
+func ParseBytes(path string, content []byte, opts Options) (File, error) {
+    opts = opts.withEntities()
+    if opts.Backend != TreeSitter {
+        opts.Backend = Regex
+    }
+    if opts.Observer != nil {
+        opts.Observer.FileStarted(path)
+    }
+
+    file, err := parseBytes(path, content, opts)
+    return finishFile(path, file, err, opts)
+}
+
+func parseBytes(path string, content []byte, opts Options) (File, error) {
+    if max := opts.Limits.MaxFileSize; max > 0 && int64(len(content)) > max {
+        return File{}, &LimitError{Path: path, Limit: LimitFileSize, Max: max, Actual: int64(len(content))}
     }
 
-    return file, true
+    // Normalized here so parseContent has no copy to write out for ctags
+    enc, endings, content := normalize(content)
+    file, err             := parseCached(path, fileName(path), content, opts)
+    if err != nil {
+        return file, err
+    }
+    file.Encoding, file.LineEndings = enc, endings
+    return file, nil
 }
 
 /*
-    Given a list of functions and the file path, extract function source code.
+    Parse every file in fsys ending in extension with opts, e.g. an embed.FS, zip.Reader or
+    os.DirFS. Only files containing functions of the desired types are returned. A file
+    that can't be parsed doesn't stop the others, the error returned joins the errors of
+    every one, see Errors, but ErrNoFuncs.
 */
-func extractFuncSrc(f *File) {
-    if _, err := os.Stat(f.Path); !os.IsNotExist(err) {
-        var content []byte
-        content, _ = ioutil.ReadFile(f.Path)
-        contentStr := string(content)
+func ParseFS(fsys fs.FS, extension string, opts Options) ([]File, error) {
+    files := []File{}
+    errs  := []error{}
+
+    err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            errs = append(errs, err)
+            return nil
+        }
+        if d.IsDir() {
+            return nil
+        }
 
-        // Convert each header to a byte array and find the offset in the source code byte array
-        // and extract the function
-        funcLen := len(f.Funcs)
-        fi      := 0
-        
-        for fi < funcLen {
-            fn     := f.Funcs[fi]
-            header := []byte(fn.Header)
+        f, err := fsys.Open(path)
+        if err != nil {
+            errs = append(errs, err)
+            return nil
+        }
+        defer f.Close()
 
-            // Should never be true
-            if len(header) == 0 {
-                fmt.Println(header)
-                log.Fatal()
+        // Files whose extension doesn't say are told by their content
+        r       := bufio.NewReaderSize(f, sniffSize)
+        head, _ := r.Peek(sniffSize)
+        if !HasLanguage(path, head, extension) {
+            return nil
+        }
+
+        // Sizes recorded in an archive can lie, ParseReader stops reading past the limit anyway
+        if info, err := d.Info(); err == nil {
+            if err := tooLarge(path, info.Size(), opts.Limits); err != nil {
+                errs = append(errs, err)
+                return nil
             }
+        }
+        file, err := ParseReader(path, r, opts)
+        if err == nil {
+            files = append(files, file)
+        } else if err != ErrNoFuncs {
+            errs = append(errs, err)
+        }
+        return nil
+    })
+    if err != nil {
+        errs = append(errs, err)
+    }
 
-            src := balance(content, strings.Index(contentStr, fn.Header))
-            if len(src) > 0 {
-                f.Funcs[fi].Source = src
-            } else {
-                // If function's curly braces are unbalanced, delete this entry
-                f.Funcs = append(f.Funcs[:fi], f.Funcs[fi+1:]...)
+    return files, errors.Join(errs...)
+}
+
+/*
+    The errors err joins, e.g. those of the files ParseFS or ParseArchive couldn't parse,
+    err alone if it joins none, nil for nil
+*/
+func Errors(err error) []error {
+    if err == nil {
+        return nil
+    }
+    if joined, ok := err.(interface{ Unwrap() []error }); ok {
+        errs := []error{}
+        for _, e := range joined.Unwrap() {
+            errs = append(errs, Errors(e)...)
+        }
+        return errs
+    }
+    return []error{err}
+}
+
+/*
+    Extract the source code of the functions of f from content, the file's content with
+    the given line offsets. ext is the language of the file. Bodies found here are
+    flattened onto one line if flat is set.
+*/
+func extractFuncSrc(f *File, content []byte, lines []int, ext string, flat bool) {
+    // Where to look for each header next, so overloads written the same way each
+    // find their own occurrence
+    next := map[string]int{}
+
+    funcs := f.Funcs[:0]
+    for _, fn := range f.Funcs {
+        // Backends that know the exact boundaries already extracted it. Abstract
+        // functions have nothing to extract
+        if fn.Source == "" && !fn.Abstract {
+            start := -1
+
+            // Go straight to the line the backend reported. Searching for the header text
+            // would find the wrong one when a header appears more than once
+            if fn.line > 0 && fn.line <= len(lines) {
+                start = lines[fn.line-1]
+                for start < len(content) && (content[start] == ' ' || content[start] == '\t') {
+                    start++
+                }
+            } else if i := bytes.Index(content[next[fn.Header]:], []byte(fn.Header)); i >= 0 {
+                start           = next[fn.Header] + i
+                next[fn.Header] = start + len(fn.Header)
+            }
+
+            if start >= 0 {
+                var end int
+                fn.Source, end = balance(content, start, ext)
+                if open := syntaxFor(ext).openBrace(content, start); open >= 0 && end > 0 {
+                    fn.Signature = normalizeSignature(string(content[start:open]))
+                }
+                if flat {
+                    fn.Source = flatten(fn.Source)
+                }
+                fn.StartOffset, fn.EndOffset = start, end
             }
-            fi++
         }
+        fn.locate(lines, len(content))
+
+        // If function's curly braces are unbalanced, drop this entry
+        if len(fn.Source) > 0 || fn.Abstract {
+            funcs = append(funcs, fn)
+        } else {
+            f.Warnings = warn(f.Warnings, WUnbalanced, fn.line, fn.Name)
+        }
+    }
+    f.Funcs = funcs
+}
+
+/*
+    Fill in the line and column positions of fn from its byte offsets. lines are the
+    offsets of the lines of a file size bytes long.
+*/
+func (fn *Function) locate(lines []int, size int) {
+    if fn.EndOffset <= fn.StartOffset || fn.EndOffset > size {
+        if fn.line > 0 {
+            fn.StartLine = fn.line
+        }
+        return
+    }
+    fn.StartLine   = lineOf(lines, fn.StartOffset)
+    fn.StartColumn = fn.StartOffset - lines[fn.StartLine-1] + 1
+    fn.EndLine     = lineOf(lines, fn.EndOffset-1)
+}
+
+/*
+    Byte offsets of the start of line first and just past the end of line last (1-based)
+*/
+func lineSpan(content []byte, lines []int, first int, last int) (int, int) {
+    end := len(content)
+    if last < len(lines) {
+        end = lines[last] - 1
+    } else if end > 0 && content[end-1] == '\n' {
+        end--
     }
+    return lines[first-1], end
+}
+
+/*
+    Return t with the header of its function complete. If the parentheses on the reported
+    line don't balance, lines are read forward until they do and up to the end of that line,
+    so whatever follows the parameters is kept as it would be on a single-line header.
+
+    C definitions are also read back to a return type on the line before the name and
+    forward to the opening brace, past any K&R parameter declarations. Line is moved to the
+    first line of the header.
+*/
+func fullHeader(content []byte, lines []int, t tag, ext string) tag {
+    if t.Line <= 0 || t.Line > len(lines) {
+        return t
+    }
+
+    lang  := syntaxFor(ext)
+    c     := cLike[ext]
+    first := t.Line
+    if c && first > 1 && strings.HasPrefix(t.Text, t.Name) && returnTypeLine(content, lines, first-1) {
+        first--
+    }
+
+    start   := lines[first-1]
+    depth   := 0
+    closed  := -1
+    proto   := false
+    multi   := first != t.Line
+    end     := len(content)
+    lineEnd := -1
+
+    scan:
+    for i := start; i < len(content); i++ {
+        if next := lang.skip(content, i); next != i {
+            i = next - 1
+            continue
+        }
+
+        // Past the line the parameters closed on, only K&R declarations may come before the {
+        kr := c && closed >= 0 && lineEnd >= 0
+
+        switch content[i] {
+        case '(', ')', '=', '}', '#', '"':
+            if kr {
+                end = lineEnd
+                break scan
+            }
+            if content[i] == '(' {
+                depth++
+            } else if content[i] == ')' {
+                depth--
+                if depth == 0 {
+                    closed = i
+                }
+            }
+        case '{':
+            if c && closed >= 0 && depth == 0 {
+                end = i
+                break scan
+            }
+        case ';':
+            if closed >= 0 && depth == 0 && lineEnd < 0 {
+                proto = true
+            }
+        case '\n':
+            // Still inside the parameters, or before them when the return type is on its own line
+            if depth > 0 || (closed < 0 && i < lines[t.Line-1]) {
+                multi = true
+                continue
+            }
+            if closed < 0 || !c || proto {
+                end = i
+                break scan
+            }
+            if lineEnd < 0 {
+                lineEnd = i
+            }
+            multi = true
+        }
+    }
+
+    if !multi {
+        return t
+    }
+    if end == len(content) && lineEnd >= 0 {
+        end = lineEnd
+    }
+
+    t.Text = strings.Join(strings.Fields(string(content[start:end])), " ")
+    t.Line = first
+    return t
+}
+
+/*
+    Return the byte offset of the start of every line
+*/
+func lineOffsets(content []byte) []int {
+    offsets := []int{0}
+    for i, b := range content {
+        if b == '\n' && i+1 < len(content) {
+            offsets = append(offsets, i+1)
+        }
+    }
+    return offsets
 }
 
 func insert(slice []byte, index int, item byte) []byte {
@@ -285,30 +1191,29 @@ func insert(slice []byte, index int, item byte) []byte {
 /*
     Balance the curly braces
     arr - byte array of file
-    m - index of 
+    m   - index of the start of the function header
+    ext - file extension, used to skip comments and literals containing braces
+
+    Returns the source verbatim and the offset just past the closing brace, "" and 0 if
+    the braces don't balance
 */
-func balance(arr []byte, m int) string {
+func balance(arr []byte, m int, ext string) (string, int) {
     start := m
     count := 0
+    lang  := syntaxFor(ext)
 
-    // Find index of first left curly brace { = 123 (byte value)
-    for {
-        if m < len(arr) {
-            if arr[m] == 123 {
-                count++
-                m++
-                break
-            }
-        } else {
-            c   := []byte(fmt.Sprintf("error: m:%d, len(arr): %d%s\n", m, len(arr), string(arr)))
-            err := ioutil.WriteFile("/tmp/dat1", c, 0644)
-            if err != nil {
-                fmt.Println("error writing log to /tmp/dat1")
-            }
-            return ""
+    // Find index of first left curly brace
+    if open := lang.openBrace(arr, m); open >= 0 {
+        count++
+        m = open + 1
+    } else {
+        // Only the text from m on is logged, files can be too large to copy whole
+        c   := []byte(fmt.Sprintf("error: m:%d, len(arr): %d%s\n", m, len(arr), string(arr[m:min(m+4096, len(arr))])))
+        err := ioutil.WriteFile("/tmp/dat1", c, 0644)
+        if err != nil {
+            fmt.Println("error writing log to /tmp/dat1")
         }
-
-        m++
+        return "", 0
     }
 
     // Match left and right curly braces
@@ -318,6 +1223,11 @@ func balance(arr []byte, m int) string {
             break
         }
 
+        if next := lang.skip(arr, m); next != m {
+            m = next
+            continue
+        }
+
         if arr[m] == 123 {
             count++
         }
@@ -335,9 +1245,35 @@ func balance(arr []byte, m int) string {
     // If curly braces are unbalanced, return an empty string
     // Cannot naively append or insert curly braces because most likely would not be syntactically correct.
     if count != 0 {
-        return ""
+        return "", 0
+    }
+
+    return string(arr[start:m+1]), m+1
+}
+
+/*
+    Collapse the whitespace of a header as written in the file, e.g. a signature split
+    over several lines, to single spaces, with none inside parentheses or before commas
+*/
+func normalizeSignature(header string) string {
+    sig := strings.Join(strings.Fields(header), " ")
+    for _, r := range [][2]string{{"( ", "("}, {" )", ")"}, {" ,", ","}} {
+        sig = strings.Replace(sig, r[0], r[1], -1)
     }
+    return sig
+}
 
-    // Ignore the left half (original) part of the slice and return the new string without newlines and tabs
-    return strings.Replace(strings.Replace(string(arr[start:m+1]), "\n", "", -1), "\t", "", -1)
+/*
+    Put function source on one line. Each line break and the indentation around it
+    become a single space, as do other tabs, so the words on either side stay apart:
+    int\nadd(a, b) is int add(a, b)
+*/
+func flatten(src string) string {
+    lines := []string{}
+    for _, line := range strings.Split(src, "\n") {
+        if line = strings.TrimSpace(line); line != "" {
+            lines = append(lines, strings.Replace(line, "\t", " ", -1))
+        }
+    }
+    return strings.Join(lines, " ")
 }
\ No newline at end of file
@@ -0,0 +1,231 @@
+/*
+    patterns.go
+
+    Project-defined extraction patterns, for framework constructs no backend knows about
+    such as Django views, Spark UDFs or test DSL blocks. A pattern is a header regex and a
+    block style saying where the construct ends, loaded from a JSON config:
+
+        {"patterns": [
+            {"name": "django-view", "extensions": ["py"], "kind": "view",
+             "header": "^\\s*def\\s+(\\w+)\\(request\\b", "block": "indent"},
+            {"name": "jest", "extensions": ["js", "ts"], "kind": "test",
+             "header": "^\\s*(?:it|test)\\(['\"](.+?)['\"]", "block": "braces"}
+        ]}
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: any
+*/
+
+package parse
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "regexp"
+    "strings"
+)
+
+// Where a block matched by a Pattern ends
+const (
+    BlockBraces = "braces" // At the } closing the first { after the header
+    BlockIndent = "indent" // Python style: header up to a line ending in :, then the more indented lines
+    BlockLine   = "line"   // The header line alone
+    BlockEnd    = "end"    // At the first line after the header matching Pattern.End
+)
+
+/*
+    Name       - Pattern name, recorded in Function.Flags of everything it extracts
+    Extensions - File extensions the pattern applies to, without the dot. Empty for all
+    Header     - Regex matched against each line. The first capture group, or the whole
+                 match without one, is the function name
+    Block      - BlockBraces, BlockIndent, BlockLine or BlockEnd
+    End        - Regex ending the block for BlockEnd
+    Kind       - Function.Kind of what the pattern extracts, the pattern name if empty
+*/
+type Pattern struct {
+    Name       string   `json:"name"`
+    Extensions []string `json:"extensions"`
+    Header     string   `json:"header"`
+    Block      string   `json:"block"`
+    End        string   `json:"end"`
+    Kind       string   `json:"kind"`
+
+    header *regexp.Regexp
+    end    *regexp.Regexp
+}
+
+/*
+    Read the patterns of a JSON config file
+*/
+func LoadPatterns(path string) ([]Pattern, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var config struct {
+        Patterns []Pattern `json:"patterns"`
+    }
+    if err := json.Unmarshal(data, &config); err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    return CompilePatterns(config.Patterns)
+}
+
+/*
+    Check and compile patterns built in code. Patterns that aren't compiled are compiled
+    again for every file.
+*/
+func CompilePatterns(patterns []Pattern) ([]Pattern, error) {
+    compiled := []Pattern{}
+    for _, p := range patterns {
+        var err error
+        if p.header, p.end, err = p.regexps(); err != nil {
+            return nil, err
+        }
+        compiled = append(compiled, p)
+    }
+    return compiled, nil
+}
+
+func (p Pattern) regexps() (*regexp.Regexp, *regexp.Regexp, error) {
+    if p.header != nil {
+        return p.header, p.end, nil
+    }
+
+    switch p.Block {
+    case BlockBraces, BlockIndent, BlockLine, BlockEnd:
+    default:
+        return nil, nil, fmt.Errorf("pattern %s: unknown block style %q", p.Name, p.Block)
+    }
+
+    header, err := regexp.Compile(p.Header)
+    if err != nil {
+        return nil, nil, fmt.Errorf("pattern %s: %v", p.Name, err)
+    }
+
+    var end *regexp.Regexp
+    if p.Block == BlockEnd {
+        if end, err = regexp.Compile(p.End); err != nil {
+            return nil, nil, fmt.Errorf("pattern %s: %v", p.Name, err)
+        }
+    }
+    return header, end, nil
+}
+
+func (p Pattern) appliesTo(ext string) bool {
+    return len(p.Extensions) == 0 || contains(p.Extensions, ext)
+}
+
+/*
+    Functions matched by the patterns in a file with extension ext. Patterns have no
+    types, so their matches are kept whatever the desired types are.
+*/
+func patternFuncs(content []byte, lines []int, ext string, patterns []Pattern) []Function {
+    funcs := []Function{}
+    for _, p := range patterns {
+        header, end, err := p.regexps()
+        if err != nil || !p.appliesTo(ext) {
+            continue
+        }
+
+        for i := range lines {
+            text := lineText(content, lines, i)
+            m    := header.FindStringSubmatchIndex(text)
+            if m == nil {
+                continue
+            }
+
+            name := text[m[0]:m[1]]
+            if len(m) > 2 && m[2] >= 0 {
+                name = text[m[2]:m[3]]
+            }
+
+            indent := len(text) - len(strings.TrimLeft(text, " \t"))
+            start  := lines[i] + indent
+            stop   := blockEnd(content, lines, i, start, indent, ext, p.Block, end)
+            if stop <= start {
+                continue
+            }
+
+            kind := p.Kind
+            if kind == "" {
+                kind = p.Name
+            }
+            headerText := strings.Join(strings.Fields(text), " ")
+            funcs = append(funcs, Function{
+                Id:     hash(name+headerText),
+                Name:   name,
+                Kind:   kind,
+                Header: headerText,
+                Source: string(content[start:stop]),
+                Flags:  []string{p.Name},
+                line:   i+1,
+
+                StartOffset: start,
+                EndOffset:   stop,
+            })
+        }
+    }
+    return funcs
+}
+
+/*
+    Offset just past the block whose header is line i (0-based), 0 if it doesn't end
+*/
+func blockEnd(content []byte, lines []int, i int, start int, indent int, ext string, block string, end *regexp.Regexp) int {
+    lineEnd := func(j int) int {
+        return lines[j] + len(lineText(content, lines, j))
+    }
+
+    switch block {
+    case BlockLine:
+        return lineEnd(i)
+
+    case BlockBraces:
+        _, stop := balance(content, start, ext)
+        return stop
+
+    case BlockEnd:
+        for j := i + 1; j < len(lines); j++ {
+            if end.MatchString(lineText(content, lines, j)) {
+                return lineEnd(j)
+            }
+        }
+
+    case BlockIndent:
+        // The header may span lines, e.g. decorators, up to the one ending in :
+        j := i
+        for j < len(lines) && !strings.HasSuffix(strings.TrimSpace(lineText(content, lines, j)), ":") {
+            j++
+        }
+        stop := 0
+        if j < len(lines) {
+            stop = lineEnd(j)
+        }
+        for j++; j < len(lines) && stop > 0; j++ {
+            text := lineText(content, lines, j)
+            if strings.TrimSpace(text) == "" {
+                continue
+            }
+            if len(text)-len(strings.TrimLeft(text, " \t")) <= indent {
+                break
+            }
+            stop = lineEnd(j)
+        }
+        return stop
+    }
+    return 0
+}
+
+/*
+    Line i (0-based) of content without its line break
+*/
+func lineText(content []byte, lines []int, i int) string {
+    end := len(content)
+    if i+1 < len(lines) {
+        end = lines[i+1]
+    }
+    return strings.TrimRight(string(content[lines[i]:end]), "\r\n")
+}
@@ -0,0 +1,120 @@
+/*
+    position.go
+
+    Extracting the one function at a position of a source, for editor integrations and
+    for extracting a function again without going back through its repository. The
+    source is parsed in memory, as ParseBytes does, and the innermost function whose
+    span holds the position is returned.
+
+    Positions are byte offsets into the source as pakkun parses it, UTF-8 with \n line
+    endings, the same as Function.StartOffset. Offset turns a line and column, which
+    don't change when the source is normalized, into one.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+/*
+    Returned by ExtractAt when no function of the desired types holds the position
+*/
+var ErrNoFuncAt = errors.New("no function at the position")
+
+/*
+    The function of src holding offset, the innermost if they nest. lang is the language
+    of src, as an extension, e.g. java or .py, or as a name, e.g. Python or C++. Every
+    type is desired unless opts give WithTypes. Bodies are always extracted to find the
+    function's end, WithoutSource only drops it from the result.
+*/
+func ExtractAt(src []byte, lang string, offset int, opts ...Option) (Function, error) {
+    ext, err := langExt(lang)
+    if err != nil {
+        return Function{}, err
+    }
+    if _, _, content := normalize(src); offset < 0 || offset > len(content) {
+        return Function{}, fmt.Errorf("offset %d outside the source, %d bytes", offset, len(content))
+    }
+
+    o         := NewOptions(append([]Option{WithTypes(map[string]bool{AnyType: true})}, opts...)...)
+    noSource  := o.NoSource
+    o.NoSource = false
+
+    file, err := ParseBytes("source."+ext, src, o)
+    if err == ErrNoFuncs {
+        return Function{}, ErrNoFuncAt
+    }
+    if err != nil {
+        return Function{}, err
+    }
+
+    at := -1
+    for i, fn := range file.Funcs {
+        if fn.StartOffset > offset || offset >= fn.EndOffset {
+            continue
+        }
+        if at < 0 || fn.EndOffset-fn.StartOffset < file.Funcs[at].EndOffset-file.Funcs[at].StartOffset {
+            at = i
+        }
+    }
+    if at < 0 {
+        return Function{}, ErrNoFuncAt
+    }
+
+    fn := file.Funcs[at]
+    if noSource {
+        fn.Source = ""
+    }
+    return fn, nil
+}
+
+/*
+    Byte offset of line and column, both 1-based and the column in bytes like
+    Function.StartColumn, in src as pakkun parses it, see ExtractAt. -1 if src has no
+    such line. Columns past the end of the line are clamped to it.
+*/
+func Offset(src []byte, line int, column int) int {
+    _, _, content := normalize(src)
+    lines         := lineOffsets(content)
+    if line < 1 || line > len(lines) || column < 1 {
+        return -1
+    }
+
+    end := len(content)
+    if line < len(lines) {
+        end = lines[line] - 1
+    }
+    if offset := lines[line-1] + column - 1; offset < end {
+        return offset
+    }
+    return end
+}
+
+/*
+    The extension of lang, an extension with or without its dot or a language name
+*/
+func langExt(lang string) (string, error) {
+    ext := strings.ToLower(strings.TrimPrefix(lang, "."))
+    if _, ok := languageNames[ext]; ok {
+        return ext, nil
+    }
+
+    // Languages of several extensions are given the first in order, e.g. c for C, not h
+    exts := []string{}
+    for e, name := range languageNames {
+        if strings.EqualFold(name, lang) {
+            exts = append(exts, e)
+        }
+    }
+    if len(exts) == 0 {
+        return "", fmt.Errorf("unknown language %q", lang)
+    }
+    sort.Strings(exts)
+    return exts[0], nil
+}
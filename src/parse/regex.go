@@ -0,0 +1,99 @@
+/*
+    regex.go
+
+    Fallback function finder used when ctags isn't installed. Each language has a regular
+    expression matching the first line of a function definition; a small state machine
+    skips block comments so commented-out code isn't picked up. C definitions with the
+    return type on a line of its own, as K&R and GNU style write them, are found by their
+    name starting the next line.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, Erlang, Lisp, Lua, Java, Javascript, and Python
+*/
+
+package parse
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "regexp"
+    "strings"
+)
+
+// First capture group is the function name. Keyed by file extension. C++ definitions may
+// lead with [[attributes]] and specifiers such as constexpr
+var funcPatterns = map[string]*regexp.Regexp {
+    "java": regexp.MustCompile(`^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|protected|static|final|abstract|synchronized|native|strictfp)\s+)*[\w<>\[\],.?]+(?:\s*<[^>]*>)?\s+(\w+)\s*\([^;]*$`),
+    "cs":   regexp.MustCompile(`^\s*(?:\[[^\]]*\]\s*)*(?:(?:public|private|protected|internal|static|virtual|override|abstract|sealed|async|extern|unsafe|new)\s+)*[\w<>\[\],.?]+\s+(\w+)\s*(?:<[^>]*>)?\s*\([^;]*$`),
+    "c":    regexp.MustCompile(`^(?:[\w*&]+\s+)+\**\s*(\w+)\s*\([^;]*$`),
+    "cpp":  regexp.MustCompile(`^\s*(?:\[\[.*?\]\]\s*)*(?:(?:constexpr|consteval|inline|static|virtual|explicit|friend)\s+)*(?:[\w*&:<>,]+\s+)+[*&]*\s*([\w:~]+)\s*\([^;]*$`),
+    "py":   regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)\s*\(`),
+    "js":   regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)\s*\(`),
+    "lua":  regexp.MustCompile(`^\s*(?:local\s+)?function\s+([\w.:]+)\s*\(`),
+    "erl":  regexp.MustCompile(`^([a-z]\w*)\s*\(.*->\s*$`),
+    "lsp":  regexp.MustCompile(`^\s*\(defun\s+([^\s()]+)`),
+}
+
+// Name starting the line after a return type of its own: int\nadd(a, b). See returnTypeLine
+var cNameLine = regexp.MustCompile(`^([A-Za-z_][\w:~]*)\s*\([^;]*$`)
+
+// Statements that look like a call followed by a block
+var notFuncs = map[string]bool{"if":true, "for":true, "while":true, "switch":true, "catch":true,
+                               "return":true, "else":true, "do":true, "sizeof":true, "synchronized":true}
+
+// Languages with C style /* */ comments
+var blockComments = map[string]bool{"java":true, "cs":true, "c":true, "cpp":true, "js":true, "cu":true,
+                                    "cuh":true, "cl":true, "hlsl":true, "glsl":true}
+
+func init() {
+    // GPU dialects declare functions like C and C++. HLSL attributes may lead the line.
+    funcPatterns["cu"]   = funcPatterns["cpp"]
+    funcPatterns["cuh"]  = funcPatterns["cpp"]
+    funcPatterns["cl"]   = funcPatterns["c"]
+    funcPatterns["glsl"] = funcPatterns["c"]
+    funcPatterns["hlsl"] = regexp.MustCompile(`^\s*(?:\[[^\]]*\]\s*)*(?:[\w*&:<>,]+\s+)+[*&]*\s*(\w+)\s*\([^;]*$`)
+}
+
+func regexTags(ctx context.Context, content []byte, ext string) []tag {
+    tags    := []tag{}
+    pattern := funcPatterns[ext]
+    if pattern == nil {
+        return tags
+    }
+
+    buff := bufio.NewScanner(bytes.NewReader(content))
+    buff.Buffer(nil, 1024*1024)
+
+    lines     := lineOffsets(content)
+    inComment := false
+    for lineNo := 1; buff.Scan() && ctx.Err() == nil; lineNo++ {
+        line := buff.Text()
+
+        if blockComments[ext] {
+            if inComment {
+                end := strings.Index(line, "*/")
+                if end < 0 {
+                    continue
+                }
+                inComment = false
+                line      = strings.Repeat(" ", end+2) + line[end+2:]
+            }
+            if start := strings.Index(line, "/*"); start >= 0 && !strings.Contains(line[start:], "*/") {
+                inComment = true
+                line      = line[:start]
+            }
+        }
+
+        m := pattern.FindStringSubmatch(line)
+        if m == nil && cLike[ext] && lineNo > 1 && returnTypeLine(content, lines, lineNo-1) {
+            m = cNameLine.FindStringSubmatch(line)
+        }
+        if m == nil || notFuncs[m[1]] {
+            continue
+        }
+
+        tags = append(tags, tag{Name: m[1], Kind: getFuncTerm(ext), Line: lineNo, Text: strings.Join(strings.Fields(line), " ")})
+    }
+    return tags
+}
@@ -0,0 +1,192 @@
+/*
+    skip.go
+
+    Files not worth parsing: binary blobs, minified Javascript and generated code. They
+    take ctags and brace balancing seconds and only add noise, so they're told apart from
+    a look at their name and content before anything runs on them:
+
+        parse.ParseFile(path, parse.WithTypes(types), parse.WithSkip(parse.DefaultSkipRules))
+
+    and returned as a *SkipError.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "path/filepath"
+    "strings"
+)
+
+/*
+    Why a file was skipped
+*/
+type Skip string
+
+const (
+    SkipBinary    Skip = "binary"
+    SkipMinified  Skip = "minified"
+    SkipGenerated Skip = "generated"
+)
+
+/*
+    Binary         - Skip files with a NUL byte in their first 8KB, UTF-16 files excepted
+    MaxLineLength  - Skip files whose lines are longer than this on average, i.e. minified.
+                     0 to not look
+    MinifiedNames  - Globs of names of minified files, e.g. *.min.js
+    Markers        - Text in the first lines of generated files, matched ignoring case
+    GeneratedNames - Globs of names of generated files, e.g. *.pb.go
+
+    The zero value skips nothing.
+*/
+type SkipRules struct {
+    Binary         bool
+    MaxLineLength  int
+    MinifiedNames  []string
+    Markers        []string
+    GeneratedNames []string
+}
+
+// What pakkun skips unless told otherwise
+var DefaultSkipRules = SkipRules{
+    Binary:         true,
+    MaxLineLength:  300,
+    MinifiedNames:  []string{"*.min.js", "*.min.css", "*-min.js", "*.bundle.js"},
+    Markers:        []string{"code generated", "@generated", "<auto-generated", "autogenerated", "automatically generated",
+                             "this file was generated", "generated by the protocol buffer compiler"},
+    GeneratedNames: []string{"*.pb.go", "*.pb.cc", "*.pb.h", "*_pb2.py", "*_pb2_grpc.py", "*.g.dart", "*.designer.cs"},
+}
+
+/*
+    DefaultSkipRules with only the skips listed, comma-separated, e.g. binary,generated.
+    none skips nothing.
+*/
+func ParseSkipRules(list string) (SkipRules, error) {
+    rules := SkipRules{}
+    for _, name := range strings.Split(list, ",") {
+        switch Skip(strings.TrimSpace(name)) {
+        case "none":
+        case SkipBinary:
+            rules.Binary = true
+        case SkipMinified:
+            rules.MaxLineLength = DefaultSkipRules.MaxLineLength
+            rules.MinifiedNames = DefaultSkipRules.MinifiedNames
+        case SkipGenerated:
+            rules.Markers        = DefaultSkipRules.Markers
+            rules.GeneratedNames = DefaultSkipRules.GeneratedNames
+        default:
+            return rules, fmt.Errorf("unknown skip %q, expected %s, %s, %s or none", name, SkipBinary, SkipMinified, SkipGenerated)
+        }
+    }
+    return rules, nil
+}
+
+/*
+    Returned by ParseFileWith for a file Options.Skip says isn't worth parsing
+*/
+type SkipError struct {
+    Path   string
+    Skip   Skip
+    Reason string
+}
+
+func (e *SkipError) Error() string {
+    return fmt.Sprintf("%s: %s, %s", e.Path, e.Skip, e.Reason)
+}
+
+/*
+    True if err is, or wraps, a SkipError
+*/
+func IsSkipped(err error) bool {
+    var skip *SkipError
+    return errors.As(err, &skip)
+}
+
+// How much is looked at for NUL bytes and markers, the same as git for binary files
+const (
+    binarySniff = 8000
+    markerLines = 20
+)
+
+/*
+    A *SkipError if the file at path with content is to be skipped, nil otherwise
+*/
+func (rules SkipRules) check(path string, content []byte) error {
+    name := filepath.Base(path)
+    skip := func(s Skip, reason string, args ...interface{}) error {
+        return &SkipError{Path: path, Skip: s, Reason: fmt.Sprintf(reason, args...)}
+    }
+
+    if rules.Binary {
+        head := content
+        if len(head) > binarySniff {
+            head = head[:binarySniff]
+        }
+        if i := bytes.IndexByte(head, 0); i >= 0 && !isUTF16(head) {
+            return skip(SkipBinary, "NUL byte at %d", i)
+        }
+    }
+
+    if glob := matchName(rules.MinifiedNames, name); glob != "" {
+        return skip(SkipMinified, "named like %s", glob)
+    }
+    if lines := bytes.Count(content, []byte("\n")) + 1; rules.MaxLineLength > 0 && len(content) > 1024 &&
+       len(content)/lines > rules.MaxLineLength {
+        return skip(SkipMinified, "lines are %d bytes long on average", len(content)/lines)
+    }
+
+    if glob := matchName(rules.GeneratedNames, name); glob != "" {
+        return skip(SkipGenerated, "named like %s", glob)
+    }
+    if len(rules.Markers) > 0 {
+        head := content
+        if i := nthIndex(content, '\n', markerLines); i >= 0 {
+            head = content[:i]
+        }
+        head = bytes.ToLower(head)
+        for _, marker := range rules.Markers {
+            if bytes.Contains(head, bytes.ToLower([]byte(marker))) {
+                return skip(SkipGenerated, "marked %q", marker)
+            }
+        }
+    }
+    return nil
+}
+
+/*
+    The first of globs matching name, empty if none does
+*/
+func matchName(globs []string, name string) string {
+    for _, glob := range globs {
+        if ok, _ := filepath.Match(glob, name); ok {
+            return glob
+        }
+    }
+    return ""
+}
+
+/*
+    Index of the nth occurrence of b in s, -1 if there are fewer
+*/
+func nthIndex(s []byte, b byte, n int) int {
+    at := -1
+    for ; n > 0; n-- {
+        i := bytes.IndexByte(s[at+1:], b)
+        if i < 0 {
+            return -1
+        }
+        at += i + 1
+    }
+    return at
+}
+
+/*
+    True if content is UTF-16, whose ASCII characters come with a NUL byte
+*/
+func isUTF16(content []byte) bool {
+    return bytes.HasPrefix(content, bomUTF16LE) || bytes.HasPrefix(content, bomUTF16BE) || sniffUTF16(content) != ""
+}
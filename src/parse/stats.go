@@ -0,0 +1,100 @@
+/*
+    stats.go
+
+    Corpus statistics: how functions are spread over languages, which types they use,
+    and how long they are. Structured so dashboards can consume them as JSON.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "path/filepath"
+    "strings"
+)
+
+// Upper bounds, in lines, of the function size histogram. Longer functions go in a
+// last bucket with no bound.
+var sizeBuckets = []int{5, 10, 25, 50, 100, 250}
+
+/*
+    Max   - Longest function in the bucket, in lines. 0 for the last bucket, which has no bound
+    Count - Functions in the bucket
+*/
+type Bucket struct {
+    Max   int `json:"max"`
+    Count int `json:"count"`
+}
+
+/*
+    Files     - Files with at least one live function
+    Functions - Live functions
+    Languages - Functions per file extension
+    Types     - Uses of each type as an input or output type
+    Sizes     - Histogram of function lengths in lines
+*/
+type Stats struct {
+    Files     int            `json:"files"`
+    Functions int            `json:"functions"`
+    Languages map[string]int `json:"languages"`
+    Types     map[string]int `json:"types"`
+    Sizes     []Bucket       `json:"sizes"`
+}
+
+func NewStats() *Stats {
+    s := &Stats{Languages: map[string]int{}, Types: map[string]int{}}
+    for _, max := range append(sizeBuckets, 0) {
+        s.Sizes = append(s.Sizes, Bucket{Max: max})
+    }
+    return s
+}
+
+/*
+    Add the counts of other, e.g. statistics of another corpus
+*/
+func (s *Stats) Merge(other Stats) {
+    s.Files     += other.Files
+    s.Functions += other.Functions
+    for lang, n := range other.Languages {
+        s.Languages[lang] += n
+    }
+    for t, n := range other.Types {
+        s.Types[t] += n
+    }
+    for i, b := range other.Sizes {
+        if i < len(s.Sizes) && s.Sizes[i].Max == b.Max {
+            s.Sizes[i].Count += b.Count
+        }
+    }
+}
+
+/*
+    Count the live functions of file
+*/
+func (s *Stats) Add(file File) {
+    lang  := strings.TrimPrefix(filepath.Ext(file.Path), ".")
+    funcs := file.FilterFuncs(Alive)
+    if len(funcs) == 0 {
+        return
+    }
+
+    s.Files++
+    for _, fn := range funcs {
+        s.Functions++
+        s.Languages[lang]++
+        for _, t := range append(append([]string{}, fn.InType...), fn.OutType...) {
+            s.Types[t]++
+        }
+
+        lines := strings.Count(fn.Source, "\n") + 1
+        if fn.StartLine > 0 && fn.EndLine >= fn.StartLine {
+            lines = fn.EndLine - fn.StartLine + 1
+        }
+        i := 0
+        for i < len(sizeBuckets) && lines > sizeBuckets[i] {
+            i++
+        }
+        s.Sizes[i].Count++
+    }
+}
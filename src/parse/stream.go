@@ -0,0 +1,58 @@
+/*
+    stream.go
+
+    Streaming parse results, so large corpora can be written to storage file by file
+    instead of being collected into one []File.
+
+    Dependencies:        exuberant ctags
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "runtime"
+    "sync"
+)
+
+/*
+    Path    - File that was parsed
+    File    - Parsed file, only meaningful if Err is nil
+    Err     - ErrNoFuncs if the file has no function of the desired types, a *LimitError if
+              it went over opts.Limits, or the error reading it
+    Content - The file as it was read, only set by ParseFiles with Options.KeepContent.
+              nil if it couldn't be read
+*/
+type Result struct {
+    Path    string
+    File    File
+    Err     error
+    Content []byte
+}
+
+/*
+    Parse every path received on paths and emit one Result per path as soon as it's ready.
+    Files are parsed concurrently, so results don't come out in the order of paths. The
+    returned channel is closed once paths is closed and every file has been emitted.
+*/
+func ParseStream(paths <-chan string, opts Options) <-chan Result {
+    results := make(chan Result)
+
+    var wg sync.WaitGroup
+    for w := 0; w < runtime.NumCPU(); w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for path := range paths {
+                file, err := ParseFileWith(path, opts)
+                results <- Result{Path: path, File: file, Err: err}
+            }
+        }()
+    }
+
+    go func() {
+        wg.Wait()
+        close(results)
+    }()
+    return results
+}
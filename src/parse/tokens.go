@@ -0,0 +1,184 @@
+/*
+    tokens.go
+
+    Length of function bodies in tokens, since whether a function fits a model's context
+    is what most users of the corpus filter on. The tokenizer is pluggable: Approx needs
+    nothing, BPE reads a tiktoken vocabulary (one base64 token and its rank per line, e.g.
+    cl100k_base.tiktoken) and counts what the matching model would:
+
+        bpe, _ := parse.LoadBPE("cl100k_base.tiktoken")
+        parse.ParseFile(path, parse.WithTypes(types), parse.WithTokenizer(bpe))
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import (
+    "bufio"
+    "encoding/base64"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+/*
+    Counts the tokens of a text. Implementations must be safe for concurrent use.
+
+    Name  - Identifies the tokenizer and its vocabulary, recorded with what it counted
+    Count - Number of tokens text encodes to
+*/
+type Tokenizer interface {
+    Name() string
+    Count(text string) int
+}
+
+/*
+    Splits text into the pieces BPE merges within, like the cl100k pattern of tiktoken.
+    Go regular expressions have no lookahead, so a run of spaces before a word isn't split
+    off its last space, which only changes counts around indentation.
+*/
+var preTokens = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\pL\pN]?\pL+|\pN{1,3}| ?[^\s\pL\pN]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+/*
+    Tokenizer estimating about 4 bytes a token without splitting across pre-tokens. Off
+    by a few percent from real vocabularies on code, without needing one.
+*/
+type Approx struct{}
+
+func (Approx) Name() string {
+    return "approx"
+}
+
+func (Approx) Count(text string) int {
+    count := 0
+    for _, piece := range preTokens.FindAllString(text, -1) {
+        count += (len(piece) + 3) / 4
+    }
+    return count
+}
+
+/*
+    Byte pair encoding with a tiktoken vocabulary
+*/
+type BPE struct {
+    name  string
+    ranks map[string]int
+
+    mu    sync.Mutex
+    cache map[string]int
+}
+
+// Pieces whose counts are remembered, identifiers and keywords repeat a lot
+const bpeCacheSize = 1 << 16
+
+/*
+    Load the tiktoken vocabulary at path
+*/
+func LoadBPE(path string) (*BPE, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    bpe     := &BPE{name: "bpe:" + strings.TrimSuffix(filepath.Base(path), ".tiktoken"), ranks: map[string]int{},
+                    cache: map[string]int{}}
+    scanner := bufio.NewScanner(f)
+    for n := 1; scanner.Scan(); n++ {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) == 0 {
+            continue
+        }
+        if len(fields) != 2 {
+            return nil, fmt.Errorf("%s:%d: expected a token and its rank", path, n)
+        }
+        token, err := base64.StdEncoding.DecodeString(fields[0])
+        if err != nil {
+            return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+        }
+        rank, err := strconv.Atoi(fields[1])
+        if err != nil {
+            return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+        }
+        bpe.ranks[string(token)] = rank
+    }
+    return bpe, scanner.Err()
+}
+
+func (b *BPE) Name() string {
+    return b.name
+}
+
+func (b *BPE) Count(text string) int {
+    count := 0
+    for _, piece := range preTokens.FindAllString(text, -1) {
+        count += b.countPiece(piece)
+    }
+    return count
+}
+
+func (b *BPE) countPiece(piece string) int {
+    if _, ok := b.ranks[piece]; ok {
+        return 1
+    }
+
+    b.mu.Lock()
+    n, ok := b.cache[piece]
+    b.mu.Unlock()
+    if ok {
+        return n
+    }
+
+    n = len(b.merge(piece))
+    b.mu.Lock()
+    if len(b.cache) >= bpeCacheSize {
+        b.cache = map[string]int{}
+    }
+    b.cache[piece] = n
+    b.mu.Unlock()
+    return n
+}
+
+/*
+    Merge the bytes of piece pair by pair, always the pair of lowest rank first, until no
+    pair is in the vocabulary
+*/
+func (b *BPE) merge(piece string) []string {
+    parts := make([]string, len(piece))
+    for i := range piece {
+        parts[i] = piece[i:i+1]
+    }
+
+    for len(parts) > 1 {
+        best, at := -1, -1
+        for i := 0; i+1 < len(parts); i++ {
+            if rank, ok := b.ranks[parts[i]+parts[i+1]]; ok && (best < 0 || rank < best) {
+                best, at = rank, i
+            }
+        }
+        if at < 0 {
+            break
+        }
+        parts = append(parts[:at], append([]string{parts[at]+parts[at+1]}, parts[at+2:]...)...)
+    }
+    return parts
+}
+
+/*
+    Keep functions whose body is at most max tokens. Functions counted when they were
+    parsed keep their count, the others are counted with t.
+*/
+func FitsIn(t Tokenizer, max int) Filter {
+    return func(fn Function) bool {
+        tokens := fn.Tokens
+        if tokens == 0 && fn.Source != "" {
+            tokens = t.Count(fn.Source)
+        }
+        return tokens <= max
+    }
+}
@@ -0,0 +1,166 @@
+//go:build treesitter
+// +build treesitter
+
+/*
+    treesitter.go
+
+    tree-sitter backend. Parsing the file into a syntax tree gives exact function
+    boundaries, parameter lists and nested scopes instead of a single header line.
+    Needs cgo, so it's only built with -tags treesitter.
+
+    Dependencies:        go-tree-sitter (https://github.com/smacker/go-tree-sitter)
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, Go, Java, Javascript, Kotlin, Lua, Python, Rust and Typescript
+*/
+
+package parse
+
+import (
+    "context"
+    "strings"
+
+    sitter "github.com/smacker/go-tree-sitter"
+    "github.com/smacker/go-tree-sitter/c"
+    "github.com/smacker/go-tree-sitter/cpp"
+    "github.com/smacker/go-tree-sitter/csharp"
+    "github.com/smacker/go-tree-sitter/golang"
+    "github.com/smacker/go-tree-sitter/java"
+    "github.com/smacker/go-tree-sitter/javascript"
+    "github.com/smacker/go-tree-sitter/kotlin"
+    "github.com/smacker/go-tree-sitter/lua"
+    "github.com/smacker/go-tree-sitter/python"
+    "github.com/smacker/go-tree-sitter/rust"
+    "github.com/smacker/go-tree-sitter/typescript/typescript"
+)
+
+/*
+    Language - tree-sitter grammar
+    Funcs    - Node types of function definitions
+    Scopes   - Node types that enclose functions: classes, namespaces, ...
+*/
+type grammar struct {
+    Language *sitter.Language
+    Funcs    map[string]bool
+    Scopes   map[string]bool
+}
+
+// Keyed by file extension
+var grammars = map[string]grammar {
+    "java": {java.GetLanguage(), set("method_declaration", "constructor_declaration"),
+             set("class_declaration", "interface_declaration", "enum_declaration")},
+    "c":    {c.GetLanguage(), set("function_definition"), set()},
+    "cpp":  {cpp.GetLanguage(), set("function_definition"),
+             set("class_specifier", "struct_specifier", "namespace_definition")},
+    "cs":   {csharp.GetLanguage(), set("method_declaration", "constructor_declaration"),
+             set("class_declaration", "struct_declaration", "interface_declaration", "namespace_declaration")},
+    "go":   {golang.GetLanguage(), set("function_declaration", "method_declaration"), set()},
+    "js":   {javascript.GetLanguage(), set("function_declaration", "method_definition", "generator_function_declaration"),
+             set("class_declaration")},
+    "ts":   {typescript.GetLanguage(), set("function_declaration", "method_definition"),
+             set("class_declaration", "interface_declaration")},
+    "kt":   {kotlin.GetLanguage(), set("function_declaration"), set("class_declaration", "object_declaration")},
+    "lua":  {lua.GetLanguage(), set("function_declaration"), set()},
+    "py":   {python.GetLanguage(), set("function_definition"), set("class_definition")},
+    "rs":   {rust.GetLanguage(), set("function_item"), set("impl_item", "trait_item", "mod_item")},
+}
+
+func set(types ...string) map[string]bool {
+    m := map[string]bool{}
+    for _, t := range types {
+        m[t] = true
+    }
+    return m
+}
+
+func init() {
+    treeSitterTags = sitterTags
+}
+
+/*
+    Return a tag for every function definition in src, the content of the file, with
+    its exact source
+*/
+func sitterTags(src []byte, ext string) ([]tag, bool) {
+    g, ok := grammars[ext]
+    if !ok {
+        return nil, false
+    }
+
+    parser := sitter.NewParser()
+    defer parser.Close()
+    parser.SetLanguage(g.Language)
+
+    tree, err := parser.ParseCtx(context.Background(), nil, src)
+    if err != nil {
+        return nil, false
+    }
+    defer tree.Close()
+
+    tags := []tag{}
+    walk(tree.RootNode(), src, g, []string{}, getFuncTerm(ext), &tags)
+    return tags, true
+}
+
+/*
+    Collect function definitions under node. scope holds the names of the enclosing
+    classes, namespaces, ... outermost first
+*/
+func walk(node *sitter.Node, src []byte, g grammar, scope []string, kind string, tags *[]tag) {
+    if g.Funcs[node.Type()] {
+        *tags = append(*tags, sitterTag(node, src, scope, kind))
+    }
+
+    if g.Scopes[node.Type()] {
+        if name := node.ChildByFieldName("name"); name != nil {
+            scope = append(scope[:len(scope):len(scope)], name.Content(src))
+        }
+    }
+
+    for i := 0; i < int(node.NamedChildCount()); i++ {
+        walk(node.NamedChild(i), src, g, scope, kind, tags)
+    }
+}
+
+func sitterTag(node *sitter.Node, src []byte, scope []string, kind string) tag {
+    // The header is everything before the body
+    end := node.EndByte()
+    if body := node.ChildByFieldName("body"); body != nil {
+        end = body.StartByte()
+    }
+    header := string(src[node.StartByte():end])
+
+    t := tag{
+        Name:   funcName(node, src),
+        Kind:   kind,
+        Line:   int(node.StartPoint().Row) + 1,
+        Text:   strings.Join(strings.Fields(header), " "),
+        Scope:  strings.Join(scope, "."),
+        Source: node.Content(src),
+        Start:  int(node.StartByte()),
+        End:    int(node.EndByte()),
+    }
+    if params := node.ChildByFieldName("parameters"); params != nil {
+        t.Signature = params.Content(src)
+    }
+    return t
+}
+
+/*
+    Most grammars have a name field on the function. C and C++ nest it in declarators:
+    function_definition > pointer_declarator > function_declarator > identifier
+*/
+func funcName(node *sitter.Node, src []byte) string {
+    if name := node.ChildByFieldName("name"); name != nil {
+        return name.Content(src)
+    }
+
+    d := node.ChildByFieldName("declarator")
+    for d != nil {
+        inner := d.ChildByFieldName("declarator")
+        if inner == nil {
+            return d.Content(src)
+        }
+        d = inner
+    }
+    return ""
+}
@@ -0,0 +1,157 @@
+/*
+    typemap.go
+
+    Cross-language type mapping tables. Every language's primitive types are mapped to a
+    portable name (i32, f64, bool, string, ...) so a single signature query can match
+    functions in every supported language.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, CUDA, Go, GLSL, HLSL, Java, Javascript, Kotlin, OpenCL,
+                         Protocol Buffers, Python, Rust, Thrift and Typescript
+*/
+
+package parse
+
+import (
+    "strings"
+)
+
+/*
+    Native type -> portable type, keyed by file extension. C and C++ sizes assume an LP64
+    platform, Python int and Javascript number are mapped to their most common use.
+*/
+var typeMaps = map[string]map[string]string {
+    "java": {"byte":"i8", "short":"i16", "int":"i32", "long":"i64", "float":"f32", "double":"f64",
+             "boolean":"bool", "char":"char", "String":"string", "Byte":"i8", "Short":"i16",
+             "Integer":"i32", "Long":"i64", "Float":"f32", "Double":"f64", "Boolean":"bool",
+             "Character":"char", "void":NoReturn},
+    "cs":   {"sbyte":"i8", "byte":"u8", "short":"i16", "ushort":"u16", "int":"i32", "uint":"u32",
+             "long":"i64", "ulong":"u64", "float":"f32", "double":"f64", "bool":"bool", "char":"char",
+             "string":"string", "String":"string", "Int32":"i32", "Int64":"i64", "void":NoReturn},
+    "c":    {"signed char":"i8", "unsigned char":"u8", "short":"i16", "unsigned short":"u16",
+             "int":"i32", "unsigned":"u32", "unsigned int":"u32", "long":"i64", "unsigned long":"u64",
+             "long long":"i64", "unsigned long long":"u64", "int8_t":"i8", "int16_t":"i16",
+             "int32_t":"i32", "int64_t":"i64", "uint8_t":"u8", "uint16_t":"u16", "uint32_t":"u32",
+             "uint64_t":"u64", "float":"f32", "double":"f64", "_Bool":"bool", "bool":"bool",
+             "char":"char", "void":NoReturn},
+    "go":   {"int8":"i8", "int16":"i16", "int32":"i32", "rune":"i32", "int64":"i64", "int":"i64",
+             "uint8":"u8", "byte":"u8", "uint16":"u16", "uint32":"u32", "uint64":"u64", "uint":"u64",
+             "float32":"f32", "float64":"f64", "bool":"bool", "string":"string"},
+    "kt":   {"Byte":"i8", "Short":"i16", "Int":"i32", "Long":"i64", "UByte":"u8", "UShort":"u16",
+             "UInt":"u32", "ULong":"u64", "Float":"f32", "Double":"f64", "Boolean":"bool",
+             "Char":"char", "String":"string", "Unit":NoReturn},
+    "rs":   {"i8":"i8", "i16":"i16", "i32":"i32", "i64":"i64", "u8":"u8", "u16":"u16", "u32":"u32",
+             "u64":"u64", "f32":"f32", "f64":"f64", "bool":"bool", "char":"char", "String":"string",
+             "str":"string", "()":NoReturn},
+    "py":   {"int":"i64", "float":"f64", "bool":"bool", "str":"string", "None":NoReturn},
+    "thrift": {"byte":"i8", "i8":"i8", "i16":"i16", "i32":"i32", "i64":"i64", "double":"f64", "bool":"bool",
+               "string":"string", "binary":"u8[]", "void":NoReturn},
+    "proto":  {"int32":"i32", "sint32":"i32", "sfixed32":"i32", "int64":"i64", "sint64":"i64", "sfixed64":"i64",
+               "uint32":"u32", "fixed32":"u32", "uint64":"u64", "fixed64":"u64", "float":"f32", "double":"f64",
+               "bool":"bool", "string":"string", "google.protobuf.Empty":NoReturn},
+    "js":   {"number":"f64", "bigint":"i64", "boolean":"bool", "string":"string", "void":NoReturn},
+}
+
+func init() {
+    // Languages sharing a type system with another one
+    typeMaps["cpp"] = map[string]string{"std::string":"string", "string":"string"}
+    for k, v := range typeMaps["c"] {
+        typeMaps["cpp"][k] = v
+    }
+    typeMaps["h"]   = typeMaps["c"]
+    typeMaps["hpp"] = typeMaps["cpp"]
+    typeMaps["ts"]  = typeMaps["js"]
+    typeMaps["cu"]  = typeMaps["cpp"]
+    typeMaps["cuh"] = typeMaps["cpp"]
+    typeMaps["cl"]  = typeMaps["c"]
+
+    // Shading languages add unsigned int as uint
+    typeMaps["glsl"] = map[string]string{"uint":"u32"}
+    for k, v := range typeMaps["c"] {
+        typeMaps["glsl"][k] = v
+    }
+    typeMaps["hlsl"] = typeMaps["glsl"]
+}
+
+/*
+    Return the language-independent name of t in lang (a language name or file extension).
+    Types without a mapping keep their base name. Array, pointer and reference modifiers are
+    kept, so Java int[] becomes i32[].
+*/
+func CanonicalType(lang string, t Type) string {
+    base := t.Base
+    if canon, ok := typeMaps[langKey(lang)][base]; ok {
+        base = canon
+    }
+    return base + strings.Join(t.Modifiers, "")
+}
+
+/*
+    The native types of lang for Options.Types: numbers and booleans are desired, strings,
+    characters and the types meaning no return value are valid but not desired. Empty if
+    lang has no type map.
+*/
+func NativeTypes(lang string) map[string]bool {
+    types := map[string]bool{}
+    for native, canon := range typeMaps[langKey(lang)] {
+        // Multi-word C types aren't single header words
+        if strings.Contains(native, " ") {
+            continue
+        }
+        types[native] = canon != "string" && canon != "char" && canon != NoReturn
+    }
+    return types
+}
+
+func langKey(lang string) string {
+    lang = strings.TrimPrefix(strings.TrimSpace(lang), ".")
+    if ext := getLangExt(strings.ToLower(lang)); ext != "" {
+        return ext
+    }
+    return lang
+}
+
+/*
+    Set the Canonical name of every type of fn written in lang
+*/
+func canonicalize(lang string, fn *Function) {
+    for i := range fn.Params {
+        fn.Params[i].Canonical = CanonicalType(lang, fn.Params[i])
+    }
+    for i := range fn.Returns {
+        fn.Returns[i].Canonical = CanonicalType(lang, fn.Returns[i])
+    }
+}
+
+/*
+    Polyglot query mode: keep functions whose signature is equivalent to in -> out in any
+    language. The query types are written in lang, e.g. Polyglot("java", []string{"int"},
+    []string{"double"}) also matches C# int -> double, Go int32 -> float64 and Rust
+    i32 -> f64. An empty lang means the query already uses portable names.
+*/
+func Polyglot(lang string, in []string, out []string) Filter {
+    canon := func(types []string) []string {
+        names := []string{}
+        for _, t := range types {
+            names = append(names, CanonicalType(lang, ParseType(t)))
+        }
+        return names
+    }
+    qin, qout := canon(in), canon(out)
+
+    return func(fn Function) bool {
+        return sameCanonical(fn.Params, qin) && sameCanonical(fn.Returns, qout)
+    }
+}
+
+func sameCanonical(types []Type, names []string) bool {
+    if len(types) != len(names) {
+        return false
+    }
+    for i, t := range types {
+        if t.Canonical != names[i] {
+            return false
+        }
+    }
+    return true
+}
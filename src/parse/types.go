@@ -0,0 +1,363 @@
+/*
+    types.go
+
+    Normalization of language-specific type names, so consumers can reason about
+    types without per-language string knowledge.
+
+    Operating systems:   GNU Linux, OS X
+    Supported languages: C, C++, C#, Go, Java, Kotlin, Python, Rust and Typescript
+*/
+
+package parse
+
+import (
+    "strings"
+)
+
+/*
+    Canonical marker for functions that don't return a value. Java/C/C++/C# void,
+    Kotlin/Scala Unit, Python None and Rust/Haskell () are all normalized to it.
+*/
+const NoReturn = "void"
+
+var noReturnTypes = map[string]bool{"void":true, "Void":true, "Unit":true, "None":true, "()":true}
+
+/*
+    Return the canonical name of a type. Types without a canonical form are returned trimmed
+    but otherwise unchanged.
+*/
+func NormalizeType(t string) string {
+    t = strings.TrimSpace(t)
+    if noReturnTypes[t] {
+        return NoReturn
+    }
+    return t
+}
+
+/*
+    Name      - Canonical type name with nullability markers removed
+    Raw       - Type as written in the source
+    Nullable  - True if the type was marked as nullable or optional
+    Base      - Element type once array, pointer and reference modifiers are removed
+    Modifiers - [] (array or collection), * (pointer) and & (reference), innermost first,
+                so int*[] is an array of pointers to int
+    Canonical - Language-independent name of the type, e.g. i32[] for Java int[]
+    Erased    - Name without generic type arguments, Map for Map<String, Integer>, and the
+                bound of a method's type variable, Object for T. Empty for other types
+*/
+type Type struct {
+    Name      string
+    Raw       string
+    Nullable  bool
+    Base      string
+    Modifiers []string
+    Canonical string
+    Erased    string
+}
+
+// Collection types that hold a single element type, treated as arrays: Array<Int>, List[int], [Int]
+var arrayWrappers = [][2]string{{"Array<", ">"}, {"ReadonlyArray<", ">"}, {"List<", ">"}, {"Vec<", ">"},
+                                {"std::vector<", ">"}, {"vector<", ">"}, {"List[", "]"}, {"list[", "]"},
+                                {"list<", ">"},
+                                {"[", "]"}}
+
+var modifierSpaces = strings.NewReplacer(" *", "*", " &", "&", " []", "[]")
+
+// Modifiers written after the base type, as in C, C++, C# and Java
+var typeSuffixes = []string{"[]", "...", "**", "*", "&&", "&"}
+
+// Wrappers that make their type argument nullable: C# Nullable<int>, Python Optional[int]
+var nullableWrappers = [][2]string{{"Nullable<", ">"}, {"Optional[", "]"}}
+
+/*
+    Parse a type as written in the source. Nullability markers are captured in Type.Nullable
+    instead of being left in the name:
+
+        Kotlin, C#, Swift  String?, int?
+        TypeScript         number | null, string | undefined
+        Java               @Nullable String, @CheckForNull Integer
+        C#, Python         Nullable<int>, Optional[int]
+*/
+func ParseType(raw string) Type {
+    typ   := Type{Raw: strings.TrimSpace(raw)}
+    words := strings.Fields(typ.Raw)
+
+    // Annotations come before the type
+    nullable, words := stripAnnotations(words)
+    typ.Nullable     = nullable
+    name            := strings.Join(words, " ")
+
+    // Union with null or undefined
+    if strings.Contains(name, "|") {
+        kept := []string{}
+        for _, t := range strings.Split(name, "|") {
+            t = strings.TrimSpace(t)
+            if t == "null" || t == "undefined" {
+                typ.Nullable = true
+            } else {
+                kept = append(kept, t)
+            }
+        }
+        name = strings.Join(kept, " | ")
+    }
+
+    if strings.HasSuffix(name, "?") {
+        typ.Nullable = true
+        name         = strings.TrimSuffix(name, "?")
+    }
+
+    for _, w := range nullableWrappers {
+        if strings.HasPrefix(name, w[0]) && strings.HasSuffix(name, w[1]) {
+            typ.Nullable = true
+            name         = name[len(w[0]):len(name)-len(w[1])]
+        }
+    }
+
+    // int *, int* and int* are the same type
+    typ.Name = NormalizeType(modifierSpaces.Replace(normalizeGenerics(name)))
+    if strings.Contains(typ.Name, "<") {
+        typ.Erased = eraseGenerics(typ.Name)
+    }
+    typ.Base, typ.Modifiers = splitModifiers(typ.Name)
+    return typ
+}
+
+/*
+    Split a type name into its base type and its array/pointer/reference modifiers
+*/
+func splitModifiers(name string) (string, []string) {
+    mods := []string{}
+
+    // Modifiers are peeled outermost first, so each one is prepended
+    for {
+        name = strings.TrimSpace(name)
+        peeled := ""
+
+        // Go writes modifiers before the type: []int, *int
+        if strings.HasPrefix(name, "[]") {
+            peeled, name = "[]", name[2:]
+        } else if strings.HasPrefix(name, "*") {
+            peeled, name = "*", name[1:]
+        }
+
+        for _, s := range typeSuffixes {
+            if peeled == "" && strings.HasSuffix(name, s) && len(name) > len(s) {
+                peeled, name = s, name[:len(name)-len(s)]
+            }
+        }
+
+        for _, w := range arrayWrappers {
+            if peeled == "" && strings.HasPrefix(name, w[0]) && strings.HasSuffix(name, w[1]) &&
+               len(name) > len(w[0])+len(w[1]) {
+                peeled, name = "[]", name[len(w[0]):len(name)-len(w[1])]
+            }
+        }
+
+        switch peeled {
+        case "":
+            return name, mods
+        case "...":
+            // Varargs arrive as an array
+            peeled = "[]"
+        case "**":
+            mods = append([]string{"*"}, mods...)
+            peeled = "*"
+        }
+        mods = append([]string{peeled}, mods...)
+    }
+}
+
+/*
+    Number of array dimensions of the type
+*/
+func (t Type) Dims() int {
+    dims := 0
+    for _, m := range t.Modifiers {
+        if m == "[]" {
+            dims++
+        }
+    }
+    return dims
+}
+
+/*
+    True if t has the same base type and the same array/pointer/reference shape as pattern
+*/
+func (t Type) Matches(pattern Type) bool {
+    if t.Base != pattern.Base || len(t.Modifiers) != len(pattern.Modifiers) {
+        return false
+    }
+    for i, m := range t.Modifiers {
+        if m != pattern.Modifiers[i] {
+            return false
+        }
+    }
+    return true
+}
+
+/*
+    Return a predicate matching any array of base, whatever the notation: int[], int *,
+    Array<int>, []int. Pointers count as arrays since that's how C passes them.
+*/
+func ArrayOf(base string) func(Type) bool {
+    return func(t Type) bool {
+        if t.Base != base || len(t.Modifiers) == 0 {
+            return false
+        }
+        for _, m := range t.Modifiers {
+            if m != "[]" && m != "*" {
+                return false
+            }
+        }
+        return true
+    }
+}
+
+/*
+    Keep functions with at least one parameter matching pred
+*/
+func AnyParam(pred func(Type) bool) Filter {
+    return func(fn Function) bool {
+        for _, t := range fn.Params {
+            if pred(t) {
+                return true
+            }
+        }
+        return false
+    }
+}
+
+/*
+    Keep functions with at least one return type matching pred
+*/
+func AnyReturn(pred func(Type) bool) Filter {
+    return func(fn Function) bool {
+        for _, t := range fn.Returns {
+            if pred(t) {
+                return true
+            }
+        }
+        return false
+    }
+}
+
+/*
+    Remove annotations (@Override, @Nullable, ...) from a list of words and report whether
+    any of them marks a value as nullable
+*/
+func stripAnnotations(words []string) (bool, []string) {
+    nullable := false
+    kept     := []string{}
+    for _, w := range words {
+        if !strings.HasPrefix(w, "@") {
+            kept = append(kept, w)
+            continue
+        }
+
+        // @javax.annotation.Nullable and @Nullable(...) both count
+        name := strings.Split(w[1:], "(")[0]
+        name  = name[strings.LastIndex(name, ".")+1:]
+        if name == "Nullable" || name == "CheckForNull" || name == "NullableDecl" {
+            nullable = true
+        }
+    }
+    return nullable, kept
+}
+
+func typeNames(types []Type) []string {
+    names := []string{}
+    for _, t := range types {
+        names = append(names, t.Name)
+    }
+    return names
+}
+
+/*
+    True if the function doesn't return a value
+*/
+func (fn *Function) IsVoid() bool {
+    for _, t := range fn.OutType {
+        if t != NoReturn {
+            return false
+        }
+    }
+    return true
+}
+
+/*
+    A Filter reports whether a function should be kept
+*/
+type Filter func(fn Function) bool
+
+/*
+    Drop functions that don't return a value
+*/
+func ExcludeVoid(fn Function) bool {
+    return !fn.IsVoid()
+}
+
+// Substrings in a function body that suggest it touches state outside of its parameters
+var sideEffectMarkers = []string{"this.", "self.", "System.out", "System.err", "print", "write", "Write",
+                                 "global ", "static ", "synchronized", "free(", "delete ", "throw "}
+
+/*
+    Keep only functions that look free of side effects: they return a value, take at least
+    one input and their body contains none of the usual markers of I/O or shared state.
+    This is a textual heuristic, not an analysis.
+*/
+func SideEffectFree(fn Function) bool {
+    if fn.IsVoid() || len(fn.InType) == 0 {
+        return false
+    }
+
+    // Skip the header so modifiers like static don't count against the body
+    body := fn.Source
+    if i := strings.Index(body, "{"); i >= 0 {
+        body = body[i:]
+    }
+
+    for _, m := range sideEffectMarkers {
+        if strings.Contains(body, m) {
+            return false
+        }
+    }
+    return true
+}
+
+/*
+    Keep functions that were in the corpus as of the given run. Run ids sort in the order
+    the runs started, so any run id works, including one made up from a date. Functions
+    saved before runs were tracked have no AddedIn and count as always present.
+*/
+func AliveAt(run string) Filter {
+    return func(fn Function) bool {
+        return fn.AddedIn <= run && (fn.RemovedIn == "" || fn.RemovedIn > run)
+    }
+}
+
+/*
+    Keep functions that haven't been removed from their file
+*/
+func Alive(fn Function) bool {
+    return fn.RemovedIn == ""
+}
+
+/*
+    Return the functions in the file that pass every filter
+*/
+func (f *File) FilterFuncs(filters ...Filter) []Function {
+    funcs := []Function{}
+    for _, fn := range f.Funcs {
+        keep := true
+        for _, filter := range filters {
+            if !filter(fn) {
+                keep = false
+                break
+            }
+        }
+        if keep {
+            funcs = append(funcs, fn)
+        }
+    }
+    return funcs
+}
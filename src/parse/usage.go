@@ -0,0 +1,96 @@
+/*
+    usage.go
+
+    How often each function is called within its repo, counted textually over the
+    repo's files, for popularity-weighted sampling and most-used function reports.
+
+        counter := parse.NewCallCounter()
+        // for every file of the repo
+        counter.Add(content)
+        counter.Define(file)
+        // once they've all been seen
+        counter.Count(&file)
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package parse
+
+import "sync"
+
+/*
+    Counts call sites across the files of a repo. Every name followed by ( counts as a
+    call, less the headers defining a function of that name, so calls through an object,
+    overloads and mentions in comments or strings all share a count. Safe for concurrent
+    use.
+*/
+type CallCounter struct {
+    mu    sync.Mutex
+    calls map[string]int
+    defs  map[string]int
+}
+
+func NewCallCounter() *CallCounter {
+    return &CallCounter{calls: map[string]int{}, defs: map[string]int{}}
+}
+
+/*
+    Count the call sites in the content of one file
+*/
+func (c *CallCounter) Add(content []byte) {
+    calls := map[string]int{}
+    for i := 0; i < len(content); {
+        if !isIdent(content[i]) || (content[i] >= '0' && content[i] <= '9') {
+            i++
+            continue
+        }
+        start := i
+        for i < len(content) && isIdent(content[i]) {
+            i++
+        }
+        name := content[start:i]
+
+        j := i
+        for j < len(content) && (content[j] == ' ' || content[j] == '\t') {
+            j++
+        }
+        if j < len(content) && content[j] == '(' {
+            calls[string(name)]++
+        }
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for name, n := range calls {
+        c.calls[name] += n
+    }
+}
+
+/*
+    Record the functions defined in file, whose headers were counted as calls by Add
+*/
+func (c *CallCounter) Define(file File) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for _, fn := range file.Funcs {
+        c.defs[fn.Name]++
+    }
+}
+
+/*
+    Set the UsageCount of the functions of file from everything added so far
+*/
+func (c *CallCounter) Count(file *File) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for i, fn := range file.Funcs {
+        file.Funcs[i].UsageCount = 0
+        if n := c.calls[fn.Name] - c.defs[fn.Name]; n > 0 {
+            file.Funcs[i].UsageCount = n
+        }
+    }
+}
+
+func isIdent(b byte) bool {
+    return b == '_' || b == '$' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
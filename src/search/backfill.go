@@ -0,0 +1,147 @@
+/*
+    backfill.go
+
+    Fill in fields added to the extractor after files were saved, by running only their
+    extractors over the files again and saving them again to Store, or the MongoDB
+    collection. Functions keep their ids, runs and bodies, sealed or not.
+
+    Files are read again from where they came from: the archive they were read from, the
+    commit of their repository, cloned again from its URL unless it's a local path, or
+    else the path they were saved with. Files that changed since are left alone, the next
+    indexing run picks them up. Tombstones are left as they are.
+
+    Dependencies:        git, mongodb driver for go (http://labix.org/mgo)
+    Operating systems:   GNU Linux, OS X
+*/
+
+package search
+
+import (
+    "audit"
+    "fmt"
+    "gitsrc"
+    "io/ioutil"
+    "log"
+    "os"
+    "parse"
+    "store"
+    "strings"
+    "gopkg.in/mgo.v2"
+)
+
+/*
+    Files   - Saved files looked at
+    Patched - Files saved again with the fields filled in
+    Stale   - Files that changed or were gone since they were saved, left as they are
+*/
+type BackfillResult struct {
+    Files   int
+    Patched int
+    Stale   int
+}
+
+/*
+    Run the extractors of fields, see parse.BackfillFields, over every saved file and
+    save it again with what they find. session is only used when there's no Store.
+*/
+func Backfill(session *mgo.Session, fields []string) (BackfillResult, error) {
+    var result BackfillResult
+    if err := parse.Backfill(&parse.File{}, nil, fields); err != nil {
+        return result, err
+    }
+
+    st        := open(session)
+    files, ok := st.(store.Lister)
+    if !ok {
+        return result, fmt.Errorf("the store can't list the files saved to it")
+    }
+
+    src := &sources{repos: map[string]*gitsrc.Repo{}, errs: map[string]error{}}
+    defer src.close()
+
+    err := files.Each(func(file parse.File) error {
+        result.Files++
+
+        content, err := src.read(file)
+        if err == nil {
+            err = parse.Backfill(&file, content, fields)
+        }
+        if err != nil {
+            log.Printf("[%s] not backfilling %s: %v\n", parse.CodeOf(err), file.Path, err)
+            result.Stale++
+            return nil
+        }
+
+        // Docs go through the same redaction as when they're ingested
+        if Redact != nil {
+            for i := range file.Funcs {
+                file.Funcs[i].Doc = Redact.apply(file.Funcs[i].Doc)
+            }
+        }
+
+        if err := st.SaveFile(file); err != nil {
+            return fmt.Errorf("%s: %v", file.Path, err)
+        }
+        record(audit.Backfill, file.Path, strings.Join(fields, ","))
+        result.Patched++
+        return nil
+    })
+    return result, err
+}
+
+/*
+    Where backfilled files are read from, with the repositories opened for them so far,
+    or why they couldn't be, by URL
+*/
+type sources struct {
+    repos  map[string]*gitsrc.Repo
+    errs   map[string]error
+    clones []string
+}
+
+/*
+    The content of file as it was saved
+*/
+func (s *sources) read(file parse.File) ([]byte, error) {
+    switch {
+    case file.Archive != "":
+        return parse.ReadArchiveFile(file.Archive, file.Path)
+    case file.Repo != "" && file.Commit != "":
+        repo, err := s.repo(file.Repo)
+        if err != nil {
+            return nil, err
+        }
+        return repo.ReadFile(file.Commit, file.Path)
+    }
+    return ioutil.ReadFile(file.Path)
+}
+
+/*
+    The repository at url, opened if it's a local one, cloned once otherwise
+*/
+func (s *sources) repo(url string) (*gitsrc.Repo, error) {
+    if repo, ok := s.repos[url]; ok {
+        return repo, nil
+    }
+    if err, ok := s.errs[url]; ok {
+        return nil, err
+    }
+    repo, err := gitsrc.Open(url)
+    if err != nil {
+        if repo, err = gitsrc.Clone(url, ""); err == nil {
+            s.clones = append(s.clones, repo.Dir)
+        }
+    }
+    if err != nil {
+        s.errs[url] = err
+        return nil, err
+    }
+    s.repos[url] = repo
+    return repo, nil
+}
+
+func (s *sources) close() {
+    for _, dir := range s.clones {
+        os.RemoveAll(dir)
+    }
+}
@@ -0,0 +1,122 @@
+/*
+    config.go
+
+    Project configuration, kept with the project in <dir>/.pakkun.json along with its
+    extraction patterns and usually written by pakkun init:
+
+        {
+            "extension": ".py",
+            "types": {"int": true, "float": true, "bool": true, "str": false, "None": false},
+            "exclude": ["vendor", "node_modules", "*.min.js"],
+            "store": {"db": "github_repos", "collection": "source"},
+            "patterns": []
+        }
+
+    Everything is optional, what's left out keeps its default.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package search
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "parse"
+    "path/filepath"
+    "strings"
+)
+
+/*
+    Extension - Extension of the files to index, with the dot
+    Types     - Types functions are matched on, see parse.Options.Types
+    Exclude   - Files and directories left out, see Exclude
+    Store     - Where files are saved, see DB and Collection
+    Patterns  - Extraction patterns, see parse.LoadPatterns
+*/
+type Config struct {
+    Extension string          `json:"extension,omitempty"`
+    Types     map[string]bool `json:"types,omitempty"`
+    Exclude   []string        `json:"exclude,omitempty"`
+    Store     StoreConfig     `json:"store"`
+    Patterns  []parse.Pattern `json:"patterns"`
+}
+
+type StoreConfig struct {
+    DB         string `json:"db,omitempty"`
+    Collection string `json:"collection,omitempty"`
+}
+
+/*
+    Read the project config at path, with its patterns compiled
+*/
+func LoadConfig(path string) (Config, error) {
+    var config Config
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return config, err
+    }
+    if err := json.Unmarshal(data, &config); err != nil {
+        return config, fmt.Errorf("%s: %v", path, err)
+    }
+    if config.Extension != "" && !strings.HasPrefix(config.Extension, ".") {
+        config.Extension = "." + config.Extension
+    }
+    for _, pattern := range config.Exclude {
+        if _, err := filepath.Match(pattern, ""); err != nil {
+            return config, fmt.Errorf("%s: bad exclude %q: %v", path, pattern, err)
+        }
+    }
+    config.Patterns, err = parse.CompilePatterns(config.Patterns)
+    return config, err
+}
+
+/*
+    Set Exclude, Patterns and the store from config, what it leaves out is kept
+*/
+func (config Config) Apply() {
+    if len(config.Exclude) > 0 {
+        Exclude = config.Exclude
+    }
+    if len(config.Patterns) > 0 {
+        Patterns = config.Patterns
+    }
+    if config.Store.DB != "" {
+        DB = config.Store.DB
+    }
+    if config.Store.Collection != "" {
+        Collection = config.Store.Collection
+    }
+}
+
+/*
+    True if path under root is left out by Exclude. Entries match the name of path or of
+    any directory between root and it, entries with a / its path relative to root.
+*/
+func excluded(root string, path string) bool {
+    if len(Exclude) == 0 {
+        return false
+    }
+    rel, err := filepath.Rel(root, path)
+    if err != nil || rel == "." {
+        return false
+    }
+    rel = filepath.ToSlash(rel)
+
+    for _, pattern := range Exclude {
+        pattern = strings.Trim(pattern, "/")
+        if strings.Contains(pattern, "/") {
+            if ok, _ := filepath.Match(pattern, rel); ok || strings.HasPrefix(rel, pattern+"/") {
+                return true
+            }
+            continue
+        }
+        for _, name := range strings.Split(rel, "/") {
+            if ok, _ := filepath.Match(pattern, name); ok {
+                return true
+            }
+        }
+    }
+    return false
+}
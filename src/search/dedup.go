@@ -0,0 +1,182 @@
+/*
+    dedup.go
+
+    Finding near-identical repositories under a directory before it's indexed: mirrors,
+    forks that never diverged and clones of the same template, which would only be parsed
+    to save the same functions again. Repositories are the directories holding a .git.
+    Each is sampled by the SketchSize smallest hashes of the contents of its files, and two
+    are as similar as their samples estimate the share of files they have in common to be
+    (their Jaccard similarity). Files are only read for it, none is parsed.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package search
+
+import (
+    "hash/fnv"
+    "io/ioutil"
+    "os"
+    "parse"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// Repositories under the directory searched at least this similar, 0 to 1, to one found
+// before them are duplicates, see DuplicateRepos. 0 to not look for them
+var DedupThreshold = 0.0
+
+// Skip the files of duplicate repositories. Otherwise they're parsed and saved as usual,
+// and only reported in the log and the summary of the run
+var DedupSkip = true
+
+// What DedupSkip is set from: skip, or mark to only report duplicates
+var DedupActions = []string{"skip", "mark"}
+
+// File hashes sampled per repository
+const SketchSize = 256
+
+/*
+    Repo       - Root of the duplicate repository
+    Of         - Root of the repository it duplicates, found before it in lexical order
+    Similarity - Estimated share of their files the two have in common, 0 to 1
+*/
+type Duplicate struct {
+    Repo       string  `json:"repo"`
+    Of         string  `json:"of"`
+    Similarity float64 `json:"similarity"`
+}
+
+/*
+    The repositories under dir at least threshold similar to one found before them,
+    judging by their files with extension. Each is reported against the most similar
+    repository that isn't a duplicate itself, so the first of a family of copies is kept.
+    Repositories without such files are never duplicates.
+*/
+func DuplicateRepos(dir string, extension string, threshold float64) []Duplicate {
+    roots, sketches := repoSketches(dir, extension)
+
+    // Sampled hashes of the repositories kept, so each is only compared to those sharing one
+    index := map[uint64][]int{}
+    dups  := []Duplicate{}
+    for i, s := range sketches {
+        if len(s) == 0 {
+            continue
+        }
+
+        best, of := 0.0, -1
+        compared := map[int]bool{}
+        for _, h := range s {
+            for _, k := range index[h] {
+                if compared[k] {
+                    continue
+                }
+                compared[k] = true
+                if sim := similarity(s, sketches[k]); sim > best {
+                    best, of = sim, k
+                }
+            }
+        }
+        if of >= 0 && best >= threshold {
+            dups = append(dups, Duplicate{Repo: roots[i], Of: roots[of], Similarity: best})
+            continue
+        }
+        for _, h := range s {
+            index[h] = append(index[h], i)
+        }
+    }
+    return dups
+}
+
+/*
+    The roots of the repositories under dir, in the order they're walked, and the sampled
+    hashes of their files with extension, ascending. Repositories nested in another, e.g.
+    submodules, are sampled with it.
+*/
+func repoSketches(dir string, extension string) ([]string, [][]uint64) {
+    roots  := []string{}
+    hashes := []map[uint64]bool{}
+    cur    := -1
+    filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+        if err != nil || excluded(dir, path) {
+            if f != nil && f.IsDir() {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if cur >= 0 && !within(roots[cur], path) {
+            cur = -1
+        }
+
+        if f.IsDir() {
+            if f.Name() == ".git" {
+                return filepath.SkipDir
+            }
+            if _, err := os.Stat(filepath.Join(path, ".git")); err == nil && cur < 0 {
+                roots  = append(roots, path)
+                hashes = append(hashes, map[uint64]bool{})
+                cur    = len(roots) - 1
+            }
+            return nil
+        }
+        if cur < 0 || !f.Mode().IsRegular() || !parse.HasLanguage(path, nil, extension) {
+            return nil
+        }
+
+        content, err := ioutil.ReadFile(path)
+        if err != nil {
+            return nil
+        }
+        h := fnv.New64a()
+        h.Write(content)
+        hashes[cur][h.Sum64()] = true
+        return nil
+    })
+
+    sketches := make([][]uint64, len(roots))
+    for i, set := range hashes {
+        s := make([]uint64, 0, len(set))
+        for h := range set {
+            s = append(s, h)
+        }
+        sort.Slice(s, func(a, b int) bool { return s[a] < s[b] })
+        if len(s) > SketchSize {
+            s = s[:SketchSize]
+        }
+        sketches[i] = s
+    }
+    return roots, sketches
+}
+
+/*
+    Estimated Jaccard similarity of the sets sampled by sketches a and b: the share of the
+    SketchSize smallest hashes of both that are in each. Exact when the sets are smaller
+    than SketchSize.
+*/
+func similarity(a []uint64, b []uint64) float64 {
+    union, shared := 0, 0
+    for i, j := 0, 0; union < SketchSize && (i < len(a) || j < len(b)); union++ {
+        switch {
+        case j == len(b) || (i < len(a) && a[i] < b[j]):
+            i++
+        case i == len(a) || b[j] < a[i]:
+            j++
+        default:
+            i++
+            j++
+            shared++
+        }
+    }
+    if union == 0 {
+        return 0
+    }
+    return float64(shared) / float64(union)
+}
+
+/*
+    Whether path is root or under it
+*/
+func within(root string, path string) bool {
+    return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
@@ -0,0 +1,175 @@
+/*
+    quota.go
+
+    Storage quotas per namespace, so one repository can't fill the store on a shared
+    deployment. A namespace is the repository a file was read from, File.Repo, or the
+    directory being indexed for local files, as it was given. These cap what the indexer
+    writes; clients of the server only read, and are held back by its rate limiter, see
+    server.RateLimiter.
+
+    Usage is what the namespace has in the store, read from it once a run and kept up to
+    date as files are saved, so quotas hold across runs. A file saved again is charged
+    the difference from what was saved for it.
+
+    Dependencies:        mongodb driver for go (http://labix.org/mgo)
+    Operating systems:   GNU Linux, OS X
+*/
+
+package search
+
+import (
+    "fmt"
+    "parse"
+    "path/filepath"
+    "store"
+    "sync"
+    "gopkg.in/mgo.v2/bson"
+)
+
+/*
+    MaxFiles - Files saved per namespace, no limit if zero
+    MaxBytes - Bytes saved per namespace, as stored, no limit if zero
+*/
+type Quota struct {
+    MaxFiles int
+    MaxBytes int64
+}
+
+// Quota of every namespace. Files over it are logged and skipped. Setting it costs a scan
+// of every file in the store on each run, each marshalled to BSON to size it, when the
+// first file is saved
+var StorageQuota Quota
+
+type usage struct {
+    files int
+    bytes int64
+}
+
+var (
+    usageMu sync.Mutex
+    used    map[string]*usage // Read from the store on the first charge of a run
+    indexed string            // Directory the run indexes, the namespace of its local files
+)
+
+func resetUsage(dir string) {
+    usageMu.Lock()
+    defer usageMu.Unlock()
+    used = nil
+    indexed = filepath.Clean(dir)
+}
+
+/*
+    Namespace of file: its repository, or the directory being indexed for local files
+    under it. Empty for local files indexed from elsewhere, no quota of the run has them.
+*/
+func namespace(file parse.File) string {
+    if file.Repo != "" {
+        return file.Repo
+    }
+    path := file.Path
+    if file.Archive != "" {
+        path = file.Archive
+    }
+    if within(indexed, filepath.Clean(path)) {
+        return indexed
+    }
+    return ""
+}
+
+/*
+    Count file against the quota of its namespace, in place of old, what st has saved for
+    it, or return an error without counting it if it would go over, E_QUOTA, or the
+    usage can't be read, E_STORE
+*/
+func charge(st store.Store, file parse.File, old parse.File) error {
+    if StorageQuota.MaxFiles <= 0 && StorageQuota.MaxBytes <= 0 {
+        return nil
+    }
+
+    usageMu.Lock()
+    defer usageMu.Unlock()
+
+    ns := namespace(file)
+    if ns == "" {
+        return nil
+    }
+
+    if used == nil {
+        loaded, err := storedUsage(st)
+        if err != nil {
+            return parse.WithCode(parse.EStore, fmt.Errorf("%s: failed to read the usage of the quotas: %v", file.Path, err))
+        }
+        used = loaded
+    }
+
+    size, err := storedSize(file)
+    if err != nil {
+        return err
+    }
+    files, bytes := 1, size
+    if old.Path != "" && namespace(old) == ns {
+        oldSize, err := storedSize(old)
+        if err != nil {
+            return err
+        }
+        files, bytes = 0, size-oldSize
+    }
+
+    u := used[ns]
+    if u == nil {
+        u = &usage{}
+        used[ns] = u
+    }
+
+    if StorageQuota.MaxFiles > 0 && files > 0 && u.files+files > StorageQuota.MaxFiles {
+        return parse.WithCode(parse.EQuota, fmt.Errorf("%s: %s is over its quota of %d files", file.Path, ns, StorageQuota.MaxFiles))
+    }
+    if StorageQuota.MaxBytes > 0 && bytes > 0 && u.bytes+bytes > StorageQuota.MaxBytes {
+        return parse.WithCode(parse.EQuota, fmt.Errorf("%s: %s is over its quota of %d bytes", file.Path, ns, StorageQuota.MaxBytes))
+    }
+    u.files += files
+    u.bytes += bytes
+    return nil
+}
+
+/*
+    Files and bytes of every namespace saved in st. Local files from other directories
+    than the one being indexed aren't counted
+*/
+func storedUsage(st store.Store) (map[string]*usage, error) {
+    files, ok := st.(store.Lister)
+    if !ok {
+        return nil, fmt.Errorf("the store can't list its files to tell how much of the quotas is used")
+    }
+    loaded := map[string]*usage{}
+    err    := files.Each(func(file parse.File) error {
+        ns := namespace(file)
+        if ns == "" {
+            return nil
+        }
+        size, err := storedSize(file)
+        if err != nil {
+            return err
+        }
+        u := loaded[ns]
+        if u == nil {
+            u = &usage{}
+            loaded[ns] = u
+        }
+        u.files++
+        u.bytes += size
+        return nil
+    })
+    return loaded, err
+}
+
+/*
+    Size of file as stored, its BSON document
+*/
+func storedSize(file parse.File) (int64, error) {
+    if StorageQuota.MaxBytes <= 0 {
+        return 0, nil
+    }
+    doc, err := bson.Marshal(file)
+    return int64(len(doc)), err
+}
@@ -0,0 +1,109 @@
+/*
+    redact.go
+
+    Deployment-specific redaction of function bodies and docs before they are saved,
+    e.g. internal hostnames or project codenames. Rules are regular expressions and
+    their replacements, applied in order:
+
+        {
+            "version": "2026-10-01",
+            "rules": [
+                {"pattern": "[\\w.-]+\\.corp\\.example\\.com", "replacement": "<host>"},
+                {"pattern": "(?i)project[ _-]?falcon", "replacement": "<codename>"}
+            ]
+        }
+
+    The version is recorded on every run that applied the rules, so it's known which
+    rules a saved function went through.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package search
+
+import (
+    "crypto/sha256"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "parse"
+    "regexp"
+)
+
+/*
+    Pattern     - Regular expression, Go syntax
+    Replacement - What matches are replaced with. $1 and ${name} expand to submatches
+*/
+type RedactionRule struct {
+    Pattern     string `json:"pattern"`
+    Replacement string `json:"replacement"`
+
+    re *regexp.Regexp
+}
+
+/*
+    Version - Version of the rules, recorded in Run.Redaction. Defaults to a hash of
+              the rules file
+    Rules   - Applied in order to Function.Source and Function.Doc
+*/
+type Redaction struct {
+    Version string          `json:"version"`
+    Rules   []RedactionRule `json:"rules"`
+}
+
+// Applied to every file before it's saved, nil to save files as they are
+var Redact *Redaction
+
+/*
+    Load and compile the redaction rules in the JSON file at path
+*/
+func LoadRedaction(path string) (*Redaction, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var r Redaction
+    if err := json.Unmarshal(data, &r); err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    for i := range r.Rules {
+        if r.Rules[i].re, err = regexp.Compile(r.Rules[i].Pattern); err != nil {
+            return nil, fmt.Errorf("%s: rule %d: %v", path, i+1, err)
+        }
+    }
+    if r.Version == "" {
+        r.Version = fmt.Sprintf("sha256:%x", sha256.Sum256(data))[:19]
+    }
+    return &r, nil
+}
+
+/*
+    Apply the rules to the body and doc of every function of file
+*/
+func (r *Redaction) File(file *parse.File) {
+    if r == nil {
+        return
+    }
+    for i := range file.Funcs {
+        file.Funcs[i].Source = r.apply(file.Funcs[i].Source)
+        file.Funcs[i].Doc    = r.apply(file.Funcs[i].Doc)
+    }
+}
+
+func (r *Redaction) apply(s string) string {
+    for _, rule := range r.Rules {
+        s = rule.re.ReplaceAllString(s, rule.Replacement)
+    }
+    return s
+}
+
+/*
+    Version of the rules, empty without any
+*/
+func (r *Redaction) version() string {
+    if r == nil {
+        return ""
+    }
+    return r.Version
+}
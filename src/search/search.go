@@ -18,24 +18,552 @@ package search
 
 import (
     "path/filepath"
-	"strings"
 	"os"
+    "log"
+    "audit"
+    "crypt"
+    "fmt"
+    "highlight"
 	"parse"
+    "store"
     "utils"
+    "time"
+    "watch"
     "gopkg.in/mgo.v2"
 )
 
-func SearchAndSaveFunc(session *mgo.Session, searchDir string, extension string, funcTypes map[string]bool) {
-    // var total int
+// MongoDB database and collection files are saved to, when Store is nil
+var (
+    DB         = "github_repos"
+    Collection = "source"
+)
+
+// Attach syntax highlighting spans to the functions before saving them
+var Highlight = false
+
+// Count the call sites of every function within the directory before saving. Files are
+// held in memory until the whole directory has been seen
+var CountUsages = false
+
+// Flatten function bodies onto one line instead of keeping them verbatim
+var Flatten = false
+
+// Also save constructors and destructors
+var Constructors = false
+
+// Also save abstract and interface methods, without bodies
+var Abstract = false
+
+// Also save the classes of every file, and the class of every function
+var Classes = false
+
+// Also save the global variables, constants, macros and typedefs of every file
+var Symbols = false
+
+// Also save the fields of the class of every function and the signatures of its siblings
+var Context = false
+
+// What to save, see parse.Entity. Overrides Constructors, Classes and Symbols when given
+var Entities []parse.Entity
+
+// Names or globs of the files and directories left out of the walk, e.g. vendor or *.min.js.
+// Entries with a / match paths relative to the directory searched
+var Exclude []string
+
+// Binary, minified and generated files left out before they're parsed, see parse.SkipRules
+var Skip = parse.DefaultSkipRules
+
+// Language versions whose files aren't saved, e.g. python2 to keep a Python 3 corpus clean.
+// See parse.File.Version
+var ExcludeVersions []string
+
+// Hash of function and file Ids, parse.FNV64 if empty
+var IdHash parse.IdHash
+
+// Counts the tokens of every function saved, nil to not count them
+var Tokenizer parse.Tokenizer
+
+// Skip functions longer than this many tokens of Tokenizer, or of parse.Approx without
+// one. 0 for no limit
+var MaxTokens = 0
+
+// Parse results of earlier runs, so unchanged files aren't parsed again. nil to always parse
+var ParseCache parse.Cache
+
+// Records every file saved or removed, nil for no audit log
+var Audit *audit.Log
+
+// Seals function bodies before they are saved, nil to save them in plaintext
+var Encryption *crypt.Cipher
+
+// Per-file limits. Files over a limit are logged and skipped, keeping what was saved for them
+var Limits parse.Limits
+
+// Notified as each file is parsed, e.g. a *parse.Progress
+var Observer parse.Observer
+
+// Files passed to each ctags run, 1 or less to run it once per file
+var CtagsBatch = parse.BatchSize
+
+// ctags binary to run, ctags from $PATH if empty, see parse.Available
+var CtagsPath = ""
+
+// Project-defined patterns extracted from every file, see parse.LoadPatterns
+var Patterns []parse.Pattern
+
+// Id collisions of the current run, see Collisions
+var collisions = parse.NewCollisions()
+
+// Where files are saved, the MongoDB Store over DB and Collection if nil
+var Store store.Store
+
+/*
+    Store, or the MongoDB one on session
+*/
+func open(session *mgo.Session) store.Store {
+    if Store != nil {
+        return Store
+    }
+    return &store.Mongo{Session: session, DB: DB, Collection: Collection}
+}
+
+/*
+    An indexing run, saved to stores that keep them, see store.RunStore
+*/
+type Run = store.Run
+
+/*
+    Return the id of a new indexing run. Functions record the run that first saw them
+    and, once they disappear from their file, the run that noticed, so the corpus can be
+    queried as of any past run.
+*/
+func NewRunId() string {
+    return utils.RunId(time.Now())
+}
+
+func startRun(st store.Store, dir string) Run {
+    resetUsage(dir)
+    collisions = parse.NewCollisions()
+    run := Run{Id: NewRunId(), Dir: dir, Started: time.Now().UTC(), Redaction: Redact.version()}
+    if Tokenizer != nil {
+        run.Tokenizer = Tokenizer.Name()
+    }
+    saveRun(st, run)
+    resetSummary(run)
+    return run
+}
+
+func finishRun(st store.Store, run Run) {
+    run.Finished = time.Now().UTC()
+    run.Codes    = LastRun().Codes
+    saveRun(st, run)
+    count(func(s *Summary) { s.Seconds = run.Finished.Sub(run.Started).Seconds() })
+}
+
+/*
+    Save run to st, if it keeps runs
+*/
+func saveRun(st store.Store, run Run) {
+    runs, ok := st.(store.RunStore)
+    if !ok {
+        return
+    }
+    if err := runs.SaveRun(run); err != nil {
+        log.Printf("[%s] failed to save run %s: %v\n", parse.EStore, run.Id, err)
+    }
+}
+
+/*
+    Walk searchDir and save every file containing functions of the desired types.
+    Archives (zip, tar, tar.gz) found along the way are searched without extracting them.
+    Functions rejected by any of the filters are dropped before saving.
+*/
+func SearchAndSaveFunc(session *mgo.Session, searchDir string, extension string, funcTypes map[string]bool, filters ...parse.Filter) {
+    st  := open(session)
+    r   := startRun(st, searchDir)
+    run := r.Id
+    defer finishRun(st, r)
+
+    // Files are saved as they're parsed, unless usage counts need the whole directory first
+    counter := parse.NewCallCounter()
+    pending := &spillBuffer{}
+    save    := func(file parse.File, content []byte) {
+        for _, w := range file.Warnings {
+            coded(w.Code)
+        }
+        if !CountUsages {
+            saveFile(st, file, filters, run)
+            return
+        }
+        counter.Add(content)
+        counter.Define(file)
+        dropped, err := pending.add(file)
+        if err != nil {
+            log.Printf("[%s] failed to spill %d files to disk: %v\n", parse.ESpill, len(dropped), err)
+        }
+        for _, path := range dropped {
+            failed(path, parse.WithCode(parse.ESpill, err))
+        }
+    }
+    defer pending.close()
+
+    opts            := parseOptions(funcTypes)
+    opts.KeepContent = CountUsages
+    parsed := func(path string, file parse.File, err error, content []byte) {
+        if err == nil {
+            save(file, content)
+        } else if parse.IsLimit(err) {
+            log.Printf("[%s] skipping %v\n", parse.CodeOf(err), err)
+            failed(path, err)
+        } else if parse.IsSkipped(err) {
+            // Unlike limits, it won't change on the next run. Whatever was saved for it goes
+            log.Printf("[%s] skipping %v\n", parse.CodeOf(err), err)
+            count(func(s *Summary) { s.Skipped++ })
+            coded(parse.CodeOf(err))
+            removeFile(st, path, run)
+        } else if err != parse.ErrNoFuncs {
+            // e.g. ctags failing on it, which may not happen next run. What was saved stays
+            log.Printf("[%s] failed to parse %v\n", parse.CodeOf(err), err)
+            failed(path, err)
+        } else {
+            coded(parse.WNoFuncs)
+            removeFile(st, path, run)
+        }
+    }
+
+    // Files are parsed CtagsBatch at a time, so ctags runs once for all of them
+    batch := []string{}
+    flush := func() {
+        for _, r := range parse.ParseFiles(batch, opts) {
+            parsed(r.Path, r.File, r.Err, r.Content)
+        }
+        batch = batch[:0]
+    }
+
+    // Near copies of repositories found before them aren't worth parsing again
+    dups := map[string]Duplicate{}
+    if DedupThreshold > 0 {
+        for _, d := range DuplicateRepos(searchDir, extension, DedupThreshold) {
+            log.Printf("[%s] repository %s is a near copy of %s, %.0f%% of its files alike\n", parse.WDuplicateRepo,
+                       d.Repo, d.Of, 100*d.Similarity)
+            dups[d.Repo] = d
+            count(func(s *Summary) {
+                s.Duplicates = append(s.Duplicates, d)
+                s.Codes[parse.WDuplicateRepo]++
+            })
+        }
+    }
+
     // Walk directory and parse java files as they're found
     filepath.Walk(searchDir, func(path string, f os.FileInfo, err error) error {
-    	if strings.HasSuffix(path, extension) {
-            file, ok := parse.ParseFile(path, funcTypes)
+        if excluded(searchDir, path) {
+            if f != nil && f.IsDir() {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if _, ok := dups[path]; ok && DedupSkip {
+            // Whatever was saved for its files before is kept
+            log.Printf("skipping %s, a duplicate repository\n", path)
+            return filepath.SkipDir
+        }
+    	if f != nil && !f.IsDir() && parse.HasLanguage(path, nil, extension) {
+            count(func(s *Summary) { s.Files++ })
+            if CtagsBatch <= 1 {
+                r := parse.ParseFiles([]string{path}, opts)[0]
+                parsed(path, r.File, r.Err, r.Content)
+                return nil
+            }
+            if batch = append(batch, path); len(batch) >= CtagsBatch {
+                flush()
+            }
+        } else if parse.IsArchive(path) {
+            // Files are saved in the order they're found
+            flush()
+            files, err := parse.ParseArchive(path, extension, opts)
+            for _, err := range parse.Errors(err) {
+                archived(path, err)
+            }
+            count(func(s *Summary) { s.Files += len(files) })
 
-            if ok {
-                utils.SaveMgoDoc("github_repos", "source", file)
+            // Archived files aren't kept around, so their calls are counted in the
+            // function bodies only
+            for _, file := range files {
+                var content []byte
+                for i := 0; CountUsages && i < len(file.Funcs); i++ {
+                    content = append(append(content, file.Funcs[i].Source...), '\n')
+                }
+                save(file, content)
             }
         }
         return nil
     })
+    flush()
+
+    err := pending.each(func(file parse.File) {
+        counter.Count(&file)
+        saveFile(st, file, filters, run)
+    })
+    if err != nil {
+        log.Printf("[%s] failed to read spilled files back: %v\n", parse.ESpill, err)
+        failed(searchDir, parse.WithCode(parse.ESpill, err))
+    }
+}
+
+/*
+    Count err, of a file in the archive at path or of the archive itself, as parsed does
+    for files on disk. Files saved from the archive before are left as they were.
+*/
+func archived(path string, err error) {
+    switch {
+    case parse.IsSkipped(err):
+        log.Printf("[%s] skipping %v in archive %s\n", parse.CodeOf(err), err, path)
+        count(func(s *Summary) { s.Skipped++ })
+        coded(parse.CodeOf(err))
+    case parse.IsLimit(err):
+        log.Printf("[%s] skipping %v in archive %s\n", parse.CodeOf(err), err, path)
+        failed(path, err)
+    default:
+        if parse.CodeOf(err) == parse.EUnknown {
+            err = parse.WithCode(parse.EArchive, err)
+        }
+        log.Printf("[%s] failed to read archive %s: %v\n", parse.CodeOf(err), path, err)
+        failed(path, err)
+    }
+}
+
+/*
+    What files are parsed with, from the settings above
+*/
+func parseOptions(funcTypes map[string]bool) parse.Options {
+    return parse.Options{Types: funcTypes, Limits: Limits, Observer: Observer,
+                         Patterns: Patterns, Flatten: Flatten, Constructors: Constructors,
+                         Abstract: Abstract, Classes: Classes, Symbols: Symbols, Context: Context,
+                         Tokenizer: Tokenizer, Entities: Entities, IdHash: IdHash,
+                         Cache: ParseCache, Skip: Skip, Batch: CtagsBatch, CtagsPath: CtagsPath}
+}
+
+/*
+    A *parse.CollisionError with the Id collisions of the last run, nil if it had none.
+    Files whose Id was already saved for another path are skipped rather than saved
+    over it.
+*/
+func Collisions() error {
+    return collisions.Err()
+}
+
+/*
+    Save the file to st, tombstoning the previously saved functions it no longer has
+*/
+func saveFile(st store.Store, file parse.File, filters []parse.Filter, run string) {
+    for _, version := range ExcludeVersions {
+        if file.Version == version {
+            log.Printf("[%s] skipping %s, written for %s\n", parse.WExcludedVersion, file.Path, version)
+            count(func(s *Summary) {
+                s.Skipped++
+                s.Codes[parse.WExcludedVersion]++
+            })
+            return
+        }
+    }
+
+    if MaxTokens > 0 {
+        var tokenizer parse.Tokenizer = parse.Approx{}
+        if Tokenizer != nil {
+            tokenizer = Tokenizer
+        }
+        filters = append(filters[:len(filters):len(filters)], parse.FitsIn(tokenizer, MaxTokens))
+    }
+    if len(filters) > 0 {
+        file.Funcs = file.FilterFuncs(filters...)
+    }
+
+    // Before highlighting, so the spans cover what's saved
+    Redact.File(&file)
+
+    if Highlight {
+        highlight.File(&file)
+    }
+
+    for _, c := range collisions.Add(file) {
+        log.Printf("[%s] id collision: %v\n", parse.EIdCollision, c)
+        count(func(s *Summary) { s.Collisions++ })
+    }
+
+    // Saving over what can't be read would lose its tombstones
+    old, err := st.FindByID(file.Id)
+    if err != nil && err != store.ErrNotFound {
+        log.Printf("[%s] skipping %s, failed to read what was saved for it: %v\n", parse.EStore, file.Path, err)
+        failed(file.Path, parse.WithCode(parse.EStore, err))
+        return
+    }
+    if old.Path != "" && old.Origin() != file.Origin() {
+        c := parse.Collision{Kind: parse.CollisionFile, Id: file.Id, Paths: [2]string{old.Origin(), file.Origin()}}
+        collisions.Report(c)
+        log.Printf("[%s] skipping %s, its id is taken: %v\n", parse.EIdCollision, file.Path, c)
+        count(func(s *Summary) { s.Collisions++ })
+        failed(file.Path, c)
+        return
+    }
+    file.Funcs = tombstone(old.Funcs, file.Funcs, run)
+
+    if len(file.Funcs) > 0 || len(file.Classes) > 0 || len(file.Symbols) > 0 {
+        // Saved functions are already sealed and left as they are
+        if err := Encryption.SealFuncs(file.Funcs); err != nil {
+            log.Printf("[%s] skipping %s, failed to encrypt it: %v\n", parse.EEncrypt, file.Path, err)
+            failed(file.Path, parse.WithCode(parse.EEncrypt, err))
+            return
+        }
+        if err := charge(st, file, old); err != nil {
+            log.Printf("[%s] skipping %v\n", parse.CodeOf(err), err)
+            failed(file.Path, err)
+            return
+        }
+        if err := st.SaveFile(file); err != nil {
+            log.Printf("[%s] failed to save %s: %v\n", parse.EStore, file.Path, err)
+            failed(file.Path, parse.WithCode(parse.EStore, err))
+            return
+        }
+        count(func(s *Summary) {
+            s.Saved++
+            for _, fn := range file.Funcs {
+                if parse.Alive(fn) {
+                    s.Functions++
+                }
+            }
+        })
+        record(audit.Ingest, file.Path, fmt.Sprintf("%d functions, run %s", len(file.Funcs), run))
+    }
+}
+
+/*
+    Add an event by the user running the indexer to the audit log, if there is one
+*/
+func record(action string, target string, detail string) {
+    if err := Audit.Record(audit.CurrentUser(), action, target, detail); err != nil {
+        log.Printf("failed to write audit log: %v\n", err)
+    }
+}
+
+/*
+    Tombstone every function saved to st for the file at path, e.g. once it's deleted
+*/
+func removeFile(st store.Store, path string, run string) {
+    old, err := st.FindByPath(path)
+    if err == store.ErrNotFound {
+        return
+    }
+    if err == nil {
+        err = st.SaveFunctions(old.Id, tombstone(old.Funcs, nil, run))
+    }
+    if err != nil {
+        log.Printf("[%s] failed to remove %s: %v\n", parse.EStore, path, err)
+        failed(path, parse.WithCode(parse.EStore, err))
+        return
+    }
+    count(func(s *Summary) { s.Removed++ })
+    record(audit.Remove, path, "run "+run)
+}
+
+/*
+    Merge the functions of a re-parsed file with the saved ones. Functions are matched by
+    identity rather than Id, which changes with every edit of the body, so an edited
+    function keeps when it was added. New functions are marked as added in run. Saved
+    functions missing from the new parse are kept, tombstoned with run if they weren't
+    already.
+*/
+func tombstone(old []parse.Function, funcs []parse.Function, run string) []parse.Function {
+    var live []parse.Function
+    for _, fn := range old {
+        if fn.RemovedIn == "" {
+            live = append(live, fn)
+        }
+    }
+    liveKeys := identities(live)
+    added    := map[string]string{}
+    for i, key := range liveKeys {
+        added[key] = live[i].AddedIn
+    }
+
+    kept := map[string]bool{}
+    ids  := map[uint64]bool{}
+    for i, key := range identities(funcs) {
+        kept[key]        = true
+        ids[funcs[i].Id] = true
+        if a, ok := added[key]; ok {
+            funcs[i].AddedIn = a
+        } else {
+            funcs[i].AddedIn = run
+        }
+    }
+
+    for i, key := range liveKeys {
+        if !kept[key] && !ids[live[i].Id] {
+            fn          := live[i]
+            fn.RemovedIn = run
+            funcs        = append(funcs, fn)
+        }
+    }
+    // Tombstones stay unless the function came back as it was
+    for _, fn := range old {
+        if fn.RemovedIn != "" && !ids[fn.Id] {
+            funcs = append(funcs, fn)
+        }
+    }
+    return funcs
+}
+
+/*
+    What each function is across edits of its body: its class and signature, or header
+    without one, and which of the functions sharing them it is, in file order
+*/
+func identities(funcs []parse.Function) []string {
+    seen := map[string]int{}
+    keys := make([]string, len(funcs))
+    for i, fn := range funcs {
+        sig := fn.Signature
+        if sig == "" {
+            sig = fn.Header
+        }
+        key    := fn.Class + "\x00" + sig
+        keys[i] = fmt.Sprintf("%s\x00%d", key, seen[key])
+        seen[key]++
+    }
+    return keys
+}
+
+/*
+    Watch searchDir and keep the saved files in sync with it until the watch fails
+*/
+func WatchAndSaveFunc(session *mgo.Session, searchDir string, extension string, funcTypes map[string]bool) error {
+    w, err := watch.Watch(searchDir, extension, parseOptions(funcTypes))
+    if err != nil {
+        return err
+    }
+    defer w.Close()
+
+    // Every change is incremental, so the whole watch is one run
+    st  := open(session)
+    r   := startRun(st, searchDir)
+    run := r.Id
+    defer finishRun(st, r)
+
+    for {
+        select {
+        case update, ok := <-w.Updates:
+            if !ok {
+                return nil
+            }
+            if excluded(searchDir, update.Path) {
+                continue
+            }
+            if update.Removed {
+                removeFile(st, update.Path, run)
+            } else {
+                saveFile(st, update.File, nil, run)
+            }
+        case err := <-w.Errors:
+            return err
+        }
+    }
 }
\ No newline at end of file
@@ -0,0 +1,64 @@
+package search
+
+import (
+    "fmt"
+    "parse"
+    "sort"
+    "strings"
+    "testing"
+)
+
+func testFunc(name string, id uint64) parse.Function {
+    return parse.Function{Id: id, Name: name, Signature: "int " + name + "()"}
+}
+
+// Each function as name:id:added:removed, sorted
+func funcStates(funcs []parse.Function) string {
+    states := []string{}
+    for _, fn := range funcs {
+        states = append(states, fmt.Sprintf("%s:%d:%s:%s", fn.Name, fn.Id, fn.AddedIn, fn.RemovedIn))
+    }
+    sort.Strings(states)
+    return strings.Join(states, " ")
+}
+
+/*
+    Over successive runs of the same file, edited functions keep when they were added,
+    removed ones are tombstoned once and stay so, and tombstones go when the function
+    comes back as it was
+*/
+func TestTombstoneRuns(t *testing.T) {
+    runs := []struct {
+        run   string
+        funcs []parse.Function
+        want  string
+    }{
+        {"r1", []parse.Function{testFunc("a", 1), testFunc("b", 2)},
+         "a:1:r1: b:2:r1:"},
+        // b's body is edited, its Id changes
+        {"r2", []parse.Function{testFunc("a", 1), testFunc("b", 3)},
+         "a:1:r1: b:3:r1:"},
+        {"r3", []parse.Function{testFunc("a", 1)},
+         "a:1:r1: b:3:r1:r3"},
+        // Still gone, the tombstone keeps the run that found it gone
+        {"r4", []parse.Function{testFunc("a", 1)},
+         "a:1:r1: b:3:r1:r3"},
+        // Back as it was
+        {"r5", []parse.Function{testFunc("a", 1), testFunc("b", 3)},
+         "a:1:r1: b:3:r5:"},
+        // The whole file is gone
+        {"r6", nil,
+         "a:1:r1:r6 b:3:r5:r6"},
+        // Back with b written differently, next to its tombstone
+        {"r7", []parse.Function{testFunc("a", 1), testFunc("b", 4)},
+         "a:1:r7: b:3:r5:r6 b:4:r7:"},
+    }
+
+    var saved []parse.Function
+    for _, r := range runs {
+        saved = tombstone(saved, r.funcs, r.run)
+        if got := funcStates(saved); got != r.want {
+            t.Errorf("%s: got %s, want %s", r.run, got, r.want)
+        }
+    }
+}
@@ -0,0 +1,182 @@
+/*
+    spill.go
+
+    Files waiting to be saved until the whole directory has been seen, e.g. for usage
+    counts. They're held in memory up to SpillMemory, and past it written to gzipped JSON
+    Lines spill files, read back in the order they were found once the walk is done. So
+    a run needs about SpillMemory of memory for them however large the directory, and
+    the disk for the rest, which SpillMaxDisk can bound.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package search
+
+import (
+    "bufio"
+    "compress/gzip"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "parse"
+)
+
+// Bytes of files held in memory while they wait to be saved, estimated from their
+// functions, past which they're spilled to disk. 0 to hold them all in memory
+var SpillMemory int64 = 256 << 20
+
+// Bytes of spill files, compressed, a run may write. Files that would go over it fail
+// rather than being held in memory. 0 for no limit
+var SpillMaxDisk int64 = 0
+
+// Where spill files are written, the system temporary directory if empty
+var SpillDir = ""
+
+/*
+    Files buffered in order, in memory and then in spill files
+*/
+type spillBuffer struct {
+    files  []parse.File
+    size   int64
+    dir    string
+    spills []string
+    disk   int64
+}
+
+/*
+    Rough size of file in memory, its strings and a little for each function's fields
+*/
+func fileSize(file parse.File) int64 {
+    size := int64(len(file.Path) + len(file.Name) + 512)
+    for _, fn := range file.Funcs {
+        size += int64(len(fn.Source) + len(fn.Header) + len(fn.Signature) + len(fn.Doc) + 512)
+    }
+    return size
+}
+
+/*
+    Buffer file. When that spills the buffer and the spill fails, e.g. over SpillMaxDisk,
+    the files buffered in memory are dropped and their paths returned with the error.
+*/
+func (b *spillBuffer) add(file parse.File) ([]string, error) {
+    b.files = append(b.files, file)
+    b.size += fileSize(file)
+    if SpillMemory <= 0 || b.size < SpillMemory {
+        return nil, nil
+    }
+
+    err := b.spill()
+    if err == nil {
+        return nil, nil
+    }
+    paths := make([]string, len(b.files))
+    for i, f := range b.files {
+        paths[i] = f.Path
+    }
+    b.files, b.size = nil, 0
+    return paths, err
+}
+
+/*
+    Write the files in memory to a new spill file
+*/
+func (b *spillBuffer) spill() error {
+    if b.dir == "" {
+        dir, err := ioutil.TempDir(SpillDir, "pakkun-spill-")
+        if err != nil {
+            return err
+        }
+        b.dir = dir
+    }
+
+    path := fmt.Sprintf("%s/spill-%06d.jsonl.gz", b.dir, len(b.spills))
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    gz  := gzip.NewWriter(f)
+    enc := json.NewEncoder(gz)
+    for _, file := range b.files {
+        if err = enc.Encode(file); err != nil {
+            break
+        }
+    }
+    if cerr := gz.Close(); err == nil {
+        err = cerr
+    }
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+
+    var size int64
+    if info, serr := os.Stat(path); serr == nil {
+        size = info.Size()
+    }
+    if err == nil && SpillMaxDisk > 0 && b.disk+size > SpillMaxDisk {
+        err = fmt.Errorf("spilling them would go over the spill quota of %d bytes", SpillMaxDisk)
+    }
+    if err != nil {
+        os.Remove(path)
+        return err
+    }
+
+    b.spills        = append(b.spills, path)
+    b.disk         += size
+    b.files, b.size = nil, 0
+    return nil
+}
+
+/*
+    Call save with every file buffered, in the order they were added, removing each spill
+    file once it's read. The buffer is empty after, even on errors.
+*/
+func (b *spillBuffer) each(save func(file parse.File)) error {
+    defer b.close()
+
+    for _, path := range b.spills {
+        if err := readSpill(path, save); err != nil {
+            return fmt.Errorf("%s: %v", path, err)
+        }
+        os.Remove(path)
+    }
+    for _, file := range b.files {
+        save(file)
+    }
+    return nil
+}
+
+func readSpill(path string, save func(file parse.File)) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    gz, err := gzip.NewReader(bufio.NewReader(f))
+    if err != nil {
+        return err
+    }
+    defer gz.Close()
+
+    dec := json.NewDecoder(gz)
+    for {
+        var file parse.File
+        if err := dec.Decode(&file); err == io.EOF {
+            return nil
+        } else if err != nil {
+            return err
+        }
+        save(file)
+    }
+}
+
+/*
+    Drop the files buffered and remove the spill files
+*/
+func (b *spillBuffer) close() {
+    if b.dir != "" {
+        os.RemoveAll(b.dir)
+    }
+    b.files, b.size, b.spills, b.disk, b.dir = nil, 0, nil, 0, ""
+}
@@ -0,0 +1,96 @@
+package search
+
+import (
+    "fmt"
+    "io/ioutil"
+    "os"
+    "parse"
+    "strings"
+    "testing"
+)
+
+/*
+    Files come back in the order they were added, with their functions, whether they
+    stayed in memory or were spilled, and no spill file is left after
+*/
+func TestSpillBuffer(t *testing.T) {
+    defer func(memory int64, dir string) { SpillMemory, SpillDir = memory, dir }(SpillMemory, SpillDir)
+
+    tests := []struct {
+        name   string
+        memory int64
+        spills int
+    }{
+        {"in memory", 0, 0},
+        {"under the memory", 1 << 30, 0},
+        {"spilled", 8 << 10, 5},
+    }
+
+    for _, test := range tests {
+        dir, err := ioutil.TempDir("", "spill-test-")
+        if err != nil {
+            t.Fatal(err)
+        }
+        SpillMemory, SpillDir = test.memory, dir
+
+        b     := &spillBuffer{}
+        files := []parse.File{}
+        for i := 0; i < 50; i++ {
+            file := parse.File{Path: fmt.Sprintf("f%d.c", i), Funcs: []parse.Function{
+                {Name: "f", Source: strings.Repeat(fmt.Sprint(i), 100)},
+            }}
+            files = append(files, file)
+            if paths, err := b.add(file); err != nil {
+                t.Fatalf("%s: %v %v", test.name, paths, err)
+            }
+        }
+        if len(b.spills) < test.spills || (test.spills == 0 && len(b.spills) > 0) {
+            t.Errorf("%s: got %d spill files, want %d or more, none if 0", test.name, len(b.spills), test.spills)
+        }
+
+        got := []parse.File{}
+        if err := b.each(func(file parse.File) { got = append(got, file) }); err != nil {
+            t.Fatalf("%s: %v", test.name, err)
+        }
+        if len(got) != len(files) {
+            t.Fatalf("%s: got %d files, want %d", test.name, len(got), len(files))
+        }
+        for i := range got {
+            if got[i].Path != files[i].Path || len(got[i].Funcs) != 1 || got[i].Funcs[0].Source != files[i].Funcs[0].Source {
+                t.Errorf("%s: file %d is %s, want %s", test.name, i, got[i].Path, files[i].Path)
+            }
+        }
+
+        if left, _ := ioutil.ReadDir(dir); len(left) > 0 {
+            t.Errorf("%s: %d spill directories left", test.name, len(left))
+        }
+        os.RemoveAll(dir)
+    }
+}
+
+/*
+    Files that would take the spill files over SpillMaxDisk are handed back with an
+    error instead of being kept
+*/
+func TestSpillMaxDisk(t *testing.T) {
+    defer func(memory int64, disk int64, dir string) {
+        SpillMemory, SpillMaxDisk, SpillDir = memory, disk, dir
+    }(SpillMemory, SpillMaxDisk, SpillDir)
+
+    dir, err := ioutil.TempDir("", "spill-test-")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    SpillMemory, SpillMaxDisk, SpillDir = 1, 1, dir
+
+    b := &spillBuffer{}
+    paths, err := b.add(parse.File{Path: "a.c", Funcs: []parse.Function{{Name: "f", Source: "int f() {}"}}})
+    if err == nil || len(paths) != 1 || paths[0] != "a.c" {
+        t.Errorf("got %v, %v, want a.c with an error", paths, err)
+    }
+    if len(b.files) != 0 || len(b.spills) != 0 {
+        t.Errorf("kept %d files and %d spill files", len(b.files), len(b.spills))
+    }
+    b.close()
+}
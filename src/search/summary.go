@@ -0,0 +1,110 @@
+/*
+    summary.go
+
+    Counts of what an indexing run did, so scripts driving pakkun can tell a clean run
+    from one that found nothing or lost files along the way.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package search
+
+import (
+    "fmt"
+    "parse"
+    "sync"
+)
+
+/*
+    Run        - Id of the run
+    Dir        - Directory that was indexed
+    Files      - Files parsed, archived ones included
+    Saved      - Files saved
+    Functions  - Functions in the files saved, tombstones excluded
+    Removed    - Saved files found deleted or without functions, theirs are tombstoned
+    Skipped    - Files left out on purpose, e.g. by Skip or ExcludeVersions
+    Failed     - Files that should have been saved but weren't: parse errors, limits,
+                 quotas, encryption failures and id collisions
+    Collisions - Id collisions found, see Collisions
+    Duplicates - Repositories found to be near copies of others, see DedupThreshold
+    Codes      - Files with each error and warning code, see parse/codes.go. Duplicate
+                 repositories are counted under W_DUPLICATE_REPO
+    Errors     - Why the first of the failed files failed, each with its code
+    Seconds    - How long the run took
+*/
+type Summary struct {
+    Run        string              `json:"run"`
+    Dir        string              `json:"dir"`
+    Files      int                 `json:"files"`
+    Saved      int                 `json:"saved"`
+    Functions  int                 `json:"functions"`
+    Removed    int                 `json:"removed"`
+    Skipped    int                 `json:"skipped"`
+    Failed     int                 `json:"failed"`
+    Collisions int                 `json:"collisions"`
+    Duplicates []Duplicate         `json:"duplicates"`
+    Codes      map[parse.Code]int  `json:"codes"`
+    Errors     []string            `json:"errors"`
+    Seconds    float64             `json:"seconds"`
+}
+
+// Errors kept in a Summary, the others are only counted in Failed
+const maxSummaryErrors = 20
+
+var (
+    summaryMu sync.Mutex
+    summary   = Summary{Duplicates: []Duplicate{}, Codes: map[parse.Code]int{}, Errors: []string{}}
+)
+
+/*
+    What the last run did, or the current one so far
+*/
+func LastRun() Summary {
+    summaryMu.Lock()
+    defer summaryMu.Unlock()
+    s := summary
+    s.Errors     = append([]string{}, summary.Errors...)
+    s.Duplicates = append([]Duplicate{}, summary.Duplicates...)
+    s.Codes      = map[parse.Code]int{}
+    for code, n := range summary.Codes {
+        s.Codes[code] = n
+    }
+    return s
+}
+
+func resetSummary(run Run) {
+    summaryMu.Lock()
+    defer summaryMu.Unlock()
+    summary = Summary{Run: run.Id, Dir: run.Dir, Duplicates: []Duplicate{}, Codes: map[parse.Code]int{},
+                      Errors: []string{}}
+}
+
+/*
+    Update the summary of the current run with count
+*/
+func count(update func(s *Summary)) {
+    summaryMu.Lock()
+    defer summaryMu.Unlock()
+    update(&summary)
+}
+
+/*
+    Count a file that should have been saved but wasn't, and why
+*/
+func failed(path string, err error) {
+    code := parse.CodeOf(err)
+    count(func(s *Summary) {
+        s.Failed++
+        s.Codes[code]++
+        if len(s.Errors) < maxSummaryErrors {
+            s.Errors = append(s.Errors, fmt.Sprintf("[%s] %s: %v", code, path, err))
+        }
+    })
+}
+
+/*
+    Count a file, or repository, with code that didn't fail
+*/
+func coded(code parse.Code) {
+    count(func(s *Summary) { s.Codes[code]++ })
+}
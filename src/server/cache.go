@@ -0,0 +1,60 @@
+/*
+    cache.go
+
+    Read-through cache in front of an Index, so repeated requests for the same
+    function don't hit the store.
+*/
+
+package server
+
+import (
+    "container/list"
+    "sync"
+)
+
+/*
+    Index that keeps the most recently used functions in memory. Searches are not
+    cached since their results change as files are indexed.
+*/
+type Cache struct {
+    Index
+    size  int
+    mu    sync.Mutex
+    order *list.List
+    items map[uint64]*list.Element
+}
+
+/*
+    Return a cache holding at most size functions from index
+*/
+func NewCache(index Index, size int) *Cache {
+    return &Cache{Index: index, size: size, order: list.New(), items: map[uint64]*list.Element{}}
+}
+
+func (c *Cache) Function(id uint64) (Hit, error) {
+    c.mu.Lock()
+    if e, ok := c.items[id]; ok {
+        c.order.MoveToFront(e)
+        hit := e.Value.(Hit)
+        c.mu.Unlock()
+        return hit, nil
+    }
+    c.mu.Unlock()
+
+    hit, err := c.Index.Function(id)
+    if err != nil {
+        return hit, err
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if _, ok := c.items[id]; !ok {
+        c.items[id] = c.order.PushFront(hit)
+        if c.order.Len() > c.size {
+            oldest := c.order.Back()
+            c.order.Remove(oldest)
+            delete(c.items, oldest.Value.(Hit).Function.Id)
+        }
+    }
+    return hit, nil
+}
@@ -0,0 +1,173 @@
+/*
+    client.go
+
+    Go client for the pakkun-server API.
+*/
+
+package server
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "parse"
+    "strconv"
+    "strings"
+    "time"
+)
+
+/*
+    URL  - Base URL of the server, e.g. http://localhost:8080
+    HTTP - Client used for requests, http.DefaultClient if nil
+*/
+type Client struct {
+    URL  string
+    HTTP *http.Client
+}
+
+/*
+    Return which of the ids are already stored on the server. Batches larger than the
+    server accepts are split.
+
+    Like the other calls, the error is a *PartialError if some corpora of a federated
+    server didn't answer. The results of the others are still returned.
+*/
+func (c *Client) Lookup(ids []uint64) (LookupResponse, error) {
+    result := LookupResponse{Present: []uint64{}, Missing: []uint64{}}
+
+    var partial error
+
+    for start := 0; start < len(ids); start += maxLookup {
+        end := start + maxLookup
+        if end > len(ids) {
+            end = len(ids)
+        }
+
+        var resp LookupResponse
+        err := c.post("/functions/lookup", LookupRequest{Ids: ids[start:end]}, &resp)
+        if _, ok := err.(*PartialError); ok {
+            partial = err
+        } else if err != nil {
+            return result, err
+        }
+        result.Present = append(result.Present, resp.Present...)
+        result.Missing = append(result.Missing, resp.Missing...)
+    }
+    return result, partial
+}
+
+/*
+    Return the corpus statistics of the server
+*/
+func (c *Client) Stats() (parse.Stats, error) {
+    var stats parse.Stats
+    r, err := c.httpClient().Get(strings.TrimSuffix(c.URL, "/")+"/stats")
+    if err != nil {
+        return stats, err
+    }
+    err = decode("/stats", r, &stats)
+    return stats, err
+}
+
+/*
+    Search the server and return the matching functions with their file, repository and
+    run metadata
+*/
+func (c *Client) Rows(q Query) ([]Row, error) {
+    params := url.Values{"q": {q.Text}, "mode": {q.Mode}}
+    if q.AsOf != "" {
+        params.Set("asof", q.AsOf)
+    }
+    if q.Version != "" {
+        params.Set("version", q.Version)
+    }
+    if q.Fuzzy {
+        params.Set("fuzzy", "true")
+    }
+    if q.Limit > 0 {
+        params.Set("limit", strconv.Itoa(q.Limit))
+    }
+
+    var rows []Row
+    r, err := c.httpClient().Get(strings.TrimSuffix(c.URL, "/")+"/rows?"+params.Encode())
+    if err != nil {
+        return nil, err
+    }
+    err = decode("/rows", r, &rows)
+    return rows, err
+}
+
+func (c *Client) post(path string, req interface{}, resp interface{}) error {
+    body, err := json.Marshal(req)
+    if err != nil {
+        return err
+    }
+
+    r, err := c.httpClient().Post(strings.TrimSuffix(c.URL, "/")+path, "application/json", bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    return decode(path, r, resp)
+}
+
+func (c *Client) httpClient() *http.Client {
+    if c.HTTP == nil {
+        return http.DefaultClient
+    }
+    return c.HTTP
+}
+
+/*
+    Decode the JSON body of r into resp, or return the error the server sent. A
+    *PartialError if the server left corpora out.
+*/
+func decode(path string, r *http.Response, resp interface{}) error {
+    defer r.Body.Close()
+
+    if r.StatusCode != http.StatusOK {
+        msg, _ := ioutil.ReadAll(r.Body)
+        return fmt.Errorf("%s: %s: %s", path, r.Status, strings.TrimSpace(string(msg)))
+    }
+    if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+        return err
+    }
+    return partialOf(r)
+}
+
+/*
+    The *PartialError in the X-Corpus-Status headers of r, nil if it has none
+*/
+func partialOf(r *http.Response) error {
+    headers := r.Header[corpusStatusHeader]
+    if len(headers) == 0 {
+        return nil
+    }
+
+    partial := &PartialError{}
+    for _, header := range headers {
+        fields    := strings.Split(header, ";")
+        corpus, _ := url.QueryUnescape(strings.TrimSpace(fields[0]))
+        status    := CorpusStatus{Corpus: corpus}
+        for _, field := range fields[1:] {
+            kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+            if len(kv) != 2 {
+                continue
+            }
+            switch kv[0] {
+            case "status":
+                status.Status = kv[1]
+            case "results":
+                status.Results, _ = strconv.Atoi(kv[1])
+            case "elapsed":
+                status.Elapsed, _ = time.ParseDuration(kv[1])
+            case "error":
+                status.Error, _ = url.QueryUnescape(kv[1])
+            }
+        }
+        partial.Statuses = append(partial.Statuses, status)
+    }
+    return partial
+}
@@ -0,0 +1,124 @@
+/*
+    elastic.go
+
+    The Index over an Elasticsearch store, see store.Elastic. Searches are full-text:
+    words are matched rather than substrings, the best matches come first and, with
+    Query.Fuzzy, words a typo away match too.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package server
+
+import (
+    "crypt"
+    "fmt"
+    "parse"
+    "store"
+)
+
+/*
+    Index over the functions saved to Store
+
+    Cipher - Opens function bodies sealed by search.Encryption, nil if they're stored in
+             plaintext. Sealed bodies can't be searched, only names, headers and docs
+*/
+type ElasticIndex struct {
+    Store  *store.Elastic
+    Cipher *crypt.Cipher
+}
+
+// Fields searched in each mode
+var elasticFields = map[string][]string{
+    ByName:      {"name"},
+    BySignature: {"header"},
+    FullText:    {"doc", "source"},
+}
+
+/*
+    Limit counts functions here rather than files
+*/
+func (e *ElasticIndex) Search(q Query) ([]Hit, error) {
+    fields := elasticFields[q.Mode]
+    if fields == nil {
+        fields = elasticFields[ByName]
+    }
+    if q.Limit <= 0 {
+        q.Limit = defaultLimit
+    }
+
+    found, err := e.Store.Search(store.TextQuery{Text: q.Text, Fields: fields, Fuzzy: q.Fuzzy, Version: q.Version,
+                                                 AsOf: q.AsOf, Limit: q.Limit})
+    if err != nil {
+        return nil, err
+    }
+    return e.open(found)
+}
+
+func (e *ElasticIndex) Function(id uint64) (Hit, error) {
+    found, err := e.Store.Functions([]uint64{id}, false)
+    if err != nil {
+        return Hit{}, err
+    }
+    if len(found) == 0 {
+        return Hit{}, store.ErrNotFound
+    }
+    hits, err := e.open(found[:1])
+    if err != nil {
+        return Hit{}, err
+    }
+    return hits[0], nil
+}
+
+/*
+    Return the ids of the batch that are already stored
+*/
+func (e *ElasticIndex) Present(ids []uint64) ([]uint64, error) {
+    // A tombstoned function coming back needs to be stored again
+    found, err := e.Store.Functions(ids, true)
+    if err != nil {
+        return nil, err
+    }
+    stored := map[uint64]bool{}
+    for _, hit := range found {
+        stored[hit.Function.Id] = true
+    }
+    return presentIn(ids, stored), nil
+}
+
+/*
+    Statistics over every live function of the store
+*/
+func (e *ElasticIndex) Stats() (parse.Stats, error) {
+    return ListStats(e.Store, e.Cipher)
+}
+
+/*
+    Statistics over every live function of files, their bodies opened with cipher
+*/
+func ListStats(files store.Lister, cipher *crypt.Cipher) (parse.Stats, error) {
+    stats := parse.NewStats()
+    err   := files.Each(func(file parse.File) error {
+        if err := cipher.OpenFuncs(file.Funcs); err != nil {
+            return fmt.Errorf("%s: %v", file.Path, err)
+        }
+        stats.Add(file)
+        return nil
+    })
+    return *stats, err
+}
+
+/*
+    The hits of the store with their bodies opened
+*/
+func (e *ElasticIndex) open(found []store.Hit) ([]Hit, error) {
+    hits := []Hit{}
+    for _, h := range found {
+        opened := []parse.Function{h.Function}
+        if err := e.Cipher.OpenFuncs(opened); err != nil {
+            return nil, fmt.Errorf("%s: %v", h.File.Path, err)
+        }
+        hits = append(hits, Hit{File: h.File, Function: opened[0]})
+    }
+    return hits, nil
+}
@@ -0,0 +1,203 @@
+/*
+    export.go
+
+    Search results in formats editors and code review tools read, so hits can be jumped
+    to directly:
+
+        quickfix   vim quickfix list, path:line:col: message (:cfile or :cexpr)
+        problems   JSON list of problems for VS Code tasks and extensions
+        sarif      SARIF 2.1.0, for code scanning and review tooling
+*/
+
+package server
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/url"
+    "path/filepath"
+    "strings"
+)
+
+// Export formats
+const (
+    Quickfix = "quickfix"
+    Problems = "problems"
+    SARIF    = "sarif"
+)
+
+// Content type of each export format
+var exportTypes = map[string]string{
+    Quickfix: "text/plain; charset=utf-8",
+    Problems: "application/json",
+    SARIF:    "application/sarif+json",
+}
+
+/*
+    Write hits to w in format, one of Quickfix, Problems or SARIF
+*/
+func Export(w io.Writer, format string, q Query, hits []Hit) error {
+    switch format {
+    case Quickfix:
+        return exportQuickfix(w, hits)
+    case Problems:
+        return exportProblems(w, hits)
+    case SARIF:
+        return exportSARIF(w, q, hits)
+    }
+    return fmt.Errorf("unknown export format %q", format)
+}
+
+/*
+    One line summary of a hit
+*/
+func message(hit Hit) string {
+    if hit.Function.Header != "" {
+        return hit.Function.Name + ": " + hit.Function.Header
+    }
+    return hit.Function.Name
+}
+
+/*
+    Line and column of a hit, 1 if unknown so editors still open the file
+*/
+func position(hit Hit) (int, int) {
+    line, col := hit.Function.StartLine, hit.Function.StartColumn
+    if line <= 0 {
+        line = 1
+    }
+    if col <= 0 {
+        col = 1
+    }
+    return line, col
+}
+
+func exportQuickfix(w io.Writer, hits []Hit) error {
+    for _, hit := range hits {
+        line, col := position(hit)
+        msg       := strings.Replace(message(hit), "\n", " ", -1)
+        if _, err := fmt.Fprintf(w, "%s:%d:%d: %s\n", hit.File.Path, line, col, msg); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+/*
+    File     - Path of the file
+    Line     - Line the function starts on, 1-based
+    Column   - Column the function starts at, 1-based
+    EndLine  - Line the function ends on, 0 if unknown
+    Severity - Always "info", hits aren't problems with the code
+    Message  - Function name and header
+    Code     - Function id
+*/
+type Problem struct {
+    File     string `json:"file"`
+    Line     int    `json:"line"`
+    Column   int    `json:"column"`
+    EndLine  int    `json:"endLine,omitempty"`
+    Severity string `json:"severity"`
+    Message  string `json:"message"`
+    Code     uint64 `json:"code"`
+}
+
+func exportProblems(w io.Writer, hits []Hit) error {
+    problems := []Problem{}
+    for _, hit := range hits {
+        line, col := position(hit)
+        problems   = append(problems, Problem{File: hit.File.Path, Line: line, Column: col, EndLine: hit.Function.EndLine,
+                                              Severity: "info", Message: message(hit), Code: hit.Function.Id})
+    }
+    return json.NewEncoder(w).Encode(problems)
+}
+
+// The subset of SARIF 2.1.0 needed to report locations
+type sarifLog struct {
+    Version string     `json:"version"`
+    Schema  string     `json:"$schema"`
+    Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+    Tool    sarifTool     `json:"tool"`
+    Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+    Driver struct {
+        Name  string      `json:"name"`
+        Rules []sarifRule `json:"rules"`
+    } `json:"driver"`
+}
+
+type sarifRule struct {
+    Id               string       `json:"id"`
+    ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+    Text string `json:"text"`
+}
+
+type sarifResult struct {
+    RuleId              string            `json:"ruleId"`
+    Level               string            `json:"level"`
+    Message             sarifMessage      `json:"message"`
+    Locations           []sarifLocation   `json:"locations"`
+    PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+    PhysicalLocation struct {
+        ArtifactLocation struct {
+            Uri string `json:"uri"`
+        } `json:"artifactLocation"`
+        Region struct {
+            StartLine   int `json:"startLine"`
+            StartColumn int `json:"startColumn"`
+            EndLine     int `json:"endLine,omitempty"`
+        } `json:"region"`
+    } `json:"physicalLocation"`
+}
+
+const sarifRuleId = "pakkun/search-hit"
+
+func exportSARIF(w io.Writer, q Query, hits []Hit) error {
+    run := sarifRun{Results: []sarifResult{}}
+    run.Tool.Driver.Name  = "pakkun"
+    run.Tool.Driver.Rules = []sarifRule{{Id: sarifRuleId, ShortDescription: sarifMessage{fmt.Sprintf("Function matching %q", q.Text)}}}
+
+    for _, hit := range hits {
+        var loc sarifLocation
+        line, col := position(hit)
+        loc.PhysicalLocation.ArtifactLocation.Uri = fileURI(hit.File.Path)
+        loc.PhysicalLocation.Region.StartLine     = line
+        loc.PhysicalLocation.Region.StartColumn   = col
+        loc.PhysicalLocation.Region.EndLine       = hit.Function.EndLine
+
+        run.Results = append(run.Results, sarifResult{
+            RuleId:              sarifRuleId,
+            Level:               "note",
+            Message:             sarifMessage{message(hit)},
+            Locations:           []sarifLocation{loc},
+            PartialFingerprints: map[string]string{"functionId": fmt.Sprint(hit.Function.Id)},
+        })
+    }
+
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(sarifLog{Version: "2.1.0", Schema: "https://json.schemastore.org/sarif-2.1.0.json", Runs: []sarifRun{run}})
+}
+
+/*
+    SARIF locations are URIs, file:// for absolute paths and relative references otherwise
+*/
+func fileURI(path string) string {
+    u := url.URL{Path: filepath.ToSlash(path)}
+    if filepath.IsAbs(path) {
+        u.Scheme = "file"
+    }
+    return u.String()
+}
@@ -0,0 +1,289 @@
+/*
+    federation.go
+
+    One Index over several corpora, e.g. a team's private corpus and a shared public one.
+    Searches go to every corpus at once and their results are merged, each marked with
+    the corpus it came from. A corpus that is down or slower than its timeout doesn't
+    fail the query, the others' results come back with the status of each corpus:
+
+        index := &server.Federation{Corpora: []server.Corpus{{"team", team}, {"public", public}}}
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package server
+
+import (
+    "fmt"
+    "parse"
+    "strings"
+    "sync"
+    "time"
+)
+
+/*
+    Name    - Set as Hit.Corpus on its results
+    Index   - Where the corpus is queried
+    Timeout - Longest wait for its answer, 0 for Federation.Timeout
+*/
+type Corpus struct {
+    Name    string
+    Index   Index
+    Timeout time.Duration
+}
+
+/*
+    Index querying every corpus. Results come in the order of Corpora, a Ranker orders
+    them across corpora.
+
+    A corpus that fails or doesn't answer in time is left out: the others' results are
+    returned along with a *PartialError saying what happened to each corpus. Only when
+    no corpus answers does the query fail.
+
+    Timeout - Longest wait for any corpus without its own, 0 to wait as long as it takes
+*/
+type Federation struct {
+    Corpora []Corpus
+    Timeout time.Duration
+}
+
+const (
+    StatusOK      = "ok"
+    StatusTimeout = "timeout"
+    StatusFailed  = "failed"
+)
+
+/*
+    What became of a query to one corpus
+
+    Corpus  - Name of the corpus
+    Status  - StatusOK, StatusTimeout or StatusFailed
+    Results - Hits, rows or ids it returned
+    Elapsed - Time until it answered or was given up on
+    Error   - Why it failed
+*/
+type CorpusStatus struct {
+    Corpus  string
+    Status  string
+    Results int
+    Elapsed time.Duration
+    Error   string `json:",omitempty"`
+}
+
+/*
+    Returned along with the results of the corpora that answered when others didn't
+*/
+type PartialError struct {
+    Statuses []CorpusStatus
+}
+
+func (e *PartialError) Error() string {
+    return "partial results, " + failures(e.Statuses)
+}
+
+/*
+    The corpora that didn't answer and why, e.g. public: no answer in 2s; team: ...
+*/
+func failures(statuses []CorpusStatus) string {
+    failed := []string{}
+    for _, s := range statuses {
+        if s.Status != StatusOK {
+            failed = append(failed, fmt.Sprintf("%s: %s", s.Corpus, s.Error))
+        }
+    }
+    return strings.Join(failed, "; ")
+}
+
+/*
+    Longest wait for c, 0 for no limit
+*/
+func (f *Federation) timeout(c Corpus) time.Duration {
+    if c.Timeout > 0 {
+        return c.Timeout
+    }
+    return f.Timeout
+}
+
+type answer struct {
+    result interface{}
+    err    error
+}
+
+/*
+    Run query on c, giving up after its timeout. A query given up on keeps running until
+    the index returns, its result is dropped.
+*/
+func (f *Federation) ask(c Corpus, query func(c Corpus) (interface{}, error)) (interface{}, CorpusStatus) {
+    status   := CorpusStatus{Corpus: c.Name, Status: StatusOK}
+    start    := time.Now()
+    answered := make(chan answer, 1)
+    go func() {
+        result, err := query(c)
+        answered <- answer{result, err}
+    }()
+
+    var expired <-chan time.Time
+    if d := f.timeout(c); d > 0 {
+        timer := time.NewTimer(d)
+        defer timer.Stop()
+        expired = timer.C
+    }
+
+    select {
+    case a := <-answered:
+        status.Elapsed = time.Since(start)
+        if a.err != nil {
+            status.Status, status.Error = StatusFailed, a.err.Error()
+            return nil, status
+        }
+        return a.result, status
+    case <-expired:
+        status.Elapsed = time.Since(start)
+        status.Status, status.Error = StatusTimeout, fmt.Sprintf("no answer in %v", f.timeout(c))
+        return nil, status
+    }
+}
+
+/*
+    Run query on every corpus at once and return their results in the order of Corpora,
+    nil for those that didn't answer. The error is a *PartialError if some didn't, it
+    shares statuses so counts filled in later show in it.
+*/
+func (f *Federation) fanOut(query func(c Corpus) (interface{}, error)) ([]interface{}, []CorpusStatus, error) {
+    results  := make([]interface{}, len(f.Corpora))
+    statuses := make([]CorpusStatus, len(f.Corpora))
+
+    var wg sync.WaitGroup
+    for i, c := range f.Corpora {
+        wg.Add(1)
+        go func(i int, c Corpus) {
+            defer wg.Done()
+            results[i], statuses[i] = f.ask(c, query)
+        }(i, c)
+    }
+    wg.Wait()
+
+    ok := 0
+    for _, s := range statuses {
+        if s.Status == StatusOK {
+            ok++
+        }
+    }
+    switch {
+    case ok == len(statuses):
+        return results, statuses, nil
+    case ok == 0:
+        return nil, statuses, fmt.Errorf("no corpus answered, %s", failures(statuses))
+    }
+    return results, statuses, &PartialError{statuses}
+}
+
+func (f *Federation) Search(q Query) ([]Hit, error) {
+    results, statuses, err := f.fanOut(func(c Corpus) (interface{}, error) {
+        hits, err := c.Index.Search(q)
+        for i := range hits {
+            hits[i].Corpus = c.Name
+        }
+        return hits, err
+    })
+    if results == nil {
+        return nil, err
+    }
+
+    hits := []Hit{}
+    for i, r := range results {
+        if r != nil {
+            statuses[i].Results = len(r.([]Hit))
+            hits = append(hits, r.([]Hit)...)
+        }
+    }
+    return hits, err
+}
+
+func (f *Federation) Join(q Query) ([]Row, error) {
+    results, statuses, err := f.fanOut(func(c Corpus) (interface{}, error) {
+        rows, err := Join(c.Index, q)
+        for i := range rows {
+            rows[i].Corpus = c.Name
+        }
+        return rows, err
+    })
+    if results == nil {
+        return nil, err
+    }
+
+    rows := []Row{}
+    for i, r := range results {
+        if r != nil {
+            statuses[i].Results = len(r.([]Row))
+            rows = append(rows, r.([]Row)...)
+        }
+    }
+    return rows, err
+}
+
+/*
+    The function from the first corpus that has it. Ids are content hashes, the same
+    function in several corpora has the same Id.
+*/
+func (f *Federation) Function(id uint64) (Hit, error) {
+    failed := []string{}
+    for _, c := range f.Corpora {
+        result, status := f.ask(c, func(c Corpus) (interface{}, error) {
+            return c.Index.Function(id)
+        })
+        if status.Status == StatusOK {
+            hit       := result.(Hit)
+            hit.Corpus = c.Name
+            return hit, nil
+        }
+        failed = append(failed, fmt.Sprintf("%s: %s", c.Name, status.Error))
+    }
+    return Hit{}, fmt.Errorf("no function %d: %s", id, strings.Join(failed, "; "))
+}
+
+/*
+    Ids stored in any corpus. With a *PartialError, ids only in the corpora that didn't
+    answer are missing.
+*/
+func (f *Federation) Present(ids []uint64) ([]uint64, error) {
+    results, statuses, err := f.fanOut(func(c Corpus) (interface{}, error) {
+        return c.Index.Present(ids)
+    })
+    if results == nil {
+        return nil, err
+    }
+
+    stored := map[uint64]bool{}
+    for i, r := range results {
+        if r != nil {
+            statuses[i].Results = len(r.([]uint64))
+            for _, id := range r.([]uint64) {
+                stored[id] = true
+            }
+        }
+    }
+    return presentIn(ids, stored), err
+}
+
+/*
+    Statistics of every corpus that answered added up. Functions in several corpora count
+    once per corpus.
+*/
+func (f *Federation) Stats() (parse.Stats, error) {
+    results, statuses, err := f.fanOut(func(c Corpus) (interface{}, error) {
+        return c.Index.Stats()
+    })
+    if results == nil {
+        return parse.Stats{}, err
+    }
+
+    total := parse.NewStats()
+    for i, r := range results {
+        if r != nil {
+            statuses[i].Results = r.(parse.Stats).Functions
+            total.Merge(r.(parse.Stats))
+        }
+    }
+    return *total, err
+}
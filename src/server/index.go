@@ -0,0 +1,283 @@
+/*
+    index.go
+
+    The queries the server runs against the function store, and the MongoDB
+    implementation of them.
+
+    Dependencies:        mongodb driver for go (http://labix.org/mgo)
+    Operating systems:   GNU Linux, OS X
+*/
+
+package server
+
+import (
+    "crypt"
+    "fmt"
+    "parse"
+    "regexp"
+    "strings"
+    "gopkg.in/mgo.v2"
+    "gopkg.in/mgo.v2/bson"
+)
+
+// Search modes
+const (
+    ByName      = "name"
+    BySignature = "signature"
+    FullText    = "text"
+)
+
+/*
+    Text    - What to look for, matched case-insensitively
+    Mode    - ByName, BySignature or FullText. Defaults to ByName
+    Limit   - Maximum number of files to look at, 0 for the default
+    AsOf    - Run id to query the corpus as of, empty for its current state
+    Version - Only search files written for this language version, e.g. python3, see
+              parse.File.Version. Empty for all
+    Fuzzy   - Also match words a typo or two away, for indexes searching words, see
+              ElasticIndex. Others ignore it
+*/
+type Query struct {
+    Text    string
+    Mode    string
+    Limit   int
+    AsOf    string
+    Version string
+    Fuzzy   bool
+}
+
+/*
+    A function along with the file it was found in. File.Funcs is left empty.
+
+    Corpus - Name of the corpus the hit came from, only set by a Federation
+*/
+type Hit struct {
+    File     parse.File
+    Function parse.Function
+    Corpus   string `json:",omitempty"`
+}
+
+/*
+    Index is what the server needs from the function store
+*/
+type Index interface {
+    Search(q Query) ([]Hit, error)
+    Function(id uint64) (Hit, error)
+    Present(ids []uint64) ([]uint64, error)
+    Stats() (parse.Stats, error)
+}
+
+const defaultLimit = 100
+
+/*
+    Return the part of fn the query mode searches
+*/
+func (q Query) field(fn parse.Function) string {
+    switch q.Mode {
+    case BySignature:
+        return fn.Header
+    case FullText:
+        return fn.Doc + "\n" + fn.Source
+    }
+    return fn.Name
+}
+
+/*
+    True if fn matches the query
+*/
+func (q Query) Matches(fn parse.Function) bool {
+    return q.Visible(fn) && strings.Contains(strings.ToLower(q.field(fn)), strings.ToLower(q.Text))
+}
+
+/*
+    True if fn was in the corpus at the point the query looks at
+*/
+func (q Query) Visible(fn parse.Function) bool {
+    if q.AsOf == "" {
+        return parse.Alive(fn)
+    }
+    return parse.AliveAt(q.AsOf)(fn)
+}
+
+/*
+    Index over the File documents saved by search.SearchAndSaveFunc
+
+    Cipher - Opens function bodies sealed by search.Encryption, nil if they're stored
+             in plaintext
+    Runs   - Collection of indexing runs in DB, for Join. "runs" if empty
+*/
+type MongoIndex struct {
+    Session    *mgo.Session
+    DB         string
+    Collection string
+    Cipher     *crypt.Cipher
+    Runs       string
+}
+
+func (m *MongoIndex) Search(q Query) ([]Hit, error) {
+    session := m.Session.Copy()
+    defer session.Close()
+
+    field := map[string]string{BySignature:"funcs.header", FullText:"funcs.source"}[q.Mode]
+    if field == "" {
+        field = "funcs.name"
+    }
+    if q.Limit <= 0 {
+        q.Limit = defaultLimit
+    }
+
+    pattern  := bson.RegEx{Pattern: regexp.QuoteMeta(q.Text), Options: "i"}
+    selector := bson.M{field: pattern}
+    if q.Mode == FullText {
+        // Full text covers the documentation too
+        selector = bson.M{"$or": []bson.M{{field: pattern}, {"funcs.doc": pattern}}}
+
+        // Sealed bodies can't be matched by the database, every file is opened and
+        // matched here instead. Limit then counts the files that matched.
+        if m.Cipher != nil {
+            return m.scan(session, q)
+        }
+    }
+    if q.Version != "" {
+        selector["version"] = q.Version
+    }
+
+    var files []parse.File
+    err := session.DB(m.DB).C(m.Collection).Find(selector).Limit(q.Limit).All(&files)
+    if err != nil {
+        return nil, err
+    }
+
+    // Documents hold every function of a file, keep only the ones that matched
+    hits := []Hit{}
+    for _, file := range files {
+        if err := m.Cipher.OpenFuncs(file.Funcs); err != nil {
+            return nil, fmt.Errorf("%s: %v", file.Path, err)
+        }
+        hits = append(hits, matches(q, file)...)
+    }
+    return hits, nil
+}
+
+/*
+    Search every file in the collection until q.Limit of them matched
+*/
+func (m *MongoIndex) scan(session *mgo.Session, q Query) ([]Hit, error) {
+    hits  := []Hit{}
+    files := 0
+    iter  := session.DB(m.DB).C(m.Collection).Find(nil).Iter()
+
+    var file parse.File
+    for files < q.Limit && iter.Next(&file) {
+        if err := m.Cipher.OpenFuncs(file.Funcs); err != nil {
+            iter.Close()
+            return nil, fmt.Errorf("%s: %v", file.Path, err)
+        }
+        if found := matches(q, file); len(found) > 0 {
+            hits = append(hits, found...)
+            files++
+        }
+        file = parse.File{}
+    }
+    return hits, iter.Close()
+}
+
+/*
+    Documents hold every function of a file, keep only the ones that match q
+*/
+func matches(q Query, file parse.File) []Hit {
+    hits      := []Hit{}
+    funcs     := file.Funcs
+    file.Funcs = nil
+    if q.Version != "" && file.Version != q.Version {
+        return hits
+    }
+    for _, fn := range funcs {
+        if q.Matches(fn) {
+            hits = append(hits, Hit{File: file, Function: fn})
+        }
+    }
+    return hits
+}
+
+func (m *MongoIndex) Function(id uint64) (Hit, error) {
+    session := m.Session.Copy()
+    defer session.Close()
+
+    var file parse.File
+    if err := session.DB(m.DB).C(m.Collection).Find(bson.M{"funcs.id": id}).One(&file); err != nil {
+        return Hit{}, err
+    }
+
+    funcs     := file.Funcs
+    file.Funcs = nil
+    for _, fn := range funcs {
+        if fn.Id == id {
+            opened := []parse.Function{fn}
+            err    := m.Cipher.OpenFuncs(opened)
+            return Hit{File: file, Function: opened[0]}, err
+        }
+    }
+    return Hit{}, mgo.ErrNotFound
+}
+
+/*
+    Return the ids of the batch that are already stored
+*/
+func (m *MongoIndex) Present(ids []uint64) ([]uint64, error) {
+    session := m.Session.Copy()
+    defer session.Close()
+
+    var files []parse.File
+    selector := bson.M{"funcs.id": bson.M{"$in": ids}}
+    err      := session.DB(m.DB).C(m.Collection).Find(selector).Select(bson.M{"funcs.id": 1}).All(&files)
+    if err != nil {
+        return nil, err
+    }
+
+    stored := map[uint64]bool{}
+    for _, file := range files {
+        // A tombstoned function coming back needs to be stored again
+        for _, fn := range file.Funcs {
+            if fn.RemovedIn == "" {
+                stored[fn.Id] = true
+            }
+        }
+    }
+    return presentIn(ids, stored), nil
+}
+
+/*
+    Statistics over every live function in the collection
+*/
+func (m *MongoIndex) Stats() (parse.Stats, error) {
+    session := m.Session.Copy()
+    defer session.Close()
+
+    stats := parse.NewStats()
+    iter  := session.DB(m.DB).C(m.Collection).Find(nil).Iter()
+
+    var file parse.File
+    for iter.Next(&file) {
+        if err := m.Cipher.OpenFuncs(file.Funcs); err != nil {
+            iter.Close()
+            return *stats, fmt.Errorf("%s: %v", file.Path, err)
+        }
+        stats.Add(file)
+        file = parse.File{}
+    }
+    return *stats, iter.Close()
+}
+
+/*
+    Return the ids found in stored, in the order they were asked for
+*/
+func presentIn(ids []uint64, stored map[uint64]bool) []uint64 {
+    present := []uint64{}
+    for _, id := range ids {
+        if stored[id] {
+            present = append(present, id)
+        }
+    }
+    return present
+}
@@ -0,0 +1,229 @@
+/*
+    join.go
+
+    Search results joined with the metadata of their file, repository and the run that
+    first saw them, in one query. Clients get everything about a match without looking
+    each file and run up afterwards.
+
+    Indexes that can do the join themselves implement Joiner. MongoDB does it with an
+    aggregation pipeline that unwinds only the matching files and looks the runs up on the
+    server, so the other functions of a file never leave the database.
+
+    Dependencies:        mongodb driver for go (http://labix.org/mgo)
+    Operating systems:   GNU Linux, OS X
+*/
+
+package server
+
+import (
+    "fmt"
+    "parse"
+    "regexp"
+    "time"
+    "gopkg.in/mgo.v2"
+    "gopkg.in/mgo.v2/bson"
+)
+
+/*
+    Function - The function that matched
+    File     - The file it was found in
+    Repo     - The repository and commit the file was read from, empty for local files
+    Run      - The indexing run that first saw the function, nil if it predates runs
+    Corpus   - Name of the corpus the row came from, only set by a Federation
+*/
+type Row struct {
+    Function parse.Function
+    File     FileMeta
+    Repo     RepoMeta
+    Run      *RunMeta `json:",omitempty"`
+    Corpus   string   `json:",omitempty"`
+}
+
+/*
+    A file without its functions
+*/
+type FileMeta struct {
+    Id      uint64
+    Name    string
+    Path    string
+    Backend parse.Backend
+    Imports []string `json:",omitempty"`
+}
+
+type RepoMeta struct {
+    URL    string `json:",omitempty"`
+    Commit string `json:",omitempty"`
+}
+
+/*
+    An indexing run, as saved by search.SearchAndSaveFunc
+*/
+type RunMeta struct {
+    Id       string `bson:"_id"`
+    Dir      string
+    Started  time.Time
+    Finished time.Time
+}
+
+/*
+    Implemented by indexes that join results with their metadata themselves
+*/
+type Joiner interface {
+    Join(q Query) ([]Row, error)
+}
+
+/*
+    Search index and join the hits with their metadata, in the index if it's a Joiner.
+    Other indexes can't tell which run added a function, their rows have no Run.
+*/
+func Join(index Index, q Query) ([]Row, error) {
+    if j, ok := index.(Joiner); ok {
+        return j.Join(q)
+    }
+
+    hits, err := index.Search(q)
+    if err != nil {
+        return nil, err
+    }
+    rows := make([]Row, len(hits))
+    for i, hit := range hits {
+        rows[i] = rowOf(hit)
+    }
+    return rows, nil
+}
+
+func rowOf(hit Hit) Row {
+    file := hit.File
+    return Row{
+        Function: hit.Function,
+        File:     FileMeta{Id: file.Id, Name: file.Name, Path: file.Path, Backend: file.Backend, Imports: file.Imports},
+        Repo:     RepoMeta{URL: file.Repo, Commit: file.Commit},
+        Corpus:   hit.Corpus,
+    }
+}
+
+/*
+    Searches aren't cached, neither are joins
+*/
+func (c *Cache) Join(q Query) ([]Row, error) {
+    return Join(c.Index, q)
+}
+
+/*
+    One function of a file unwound by the pipeline, with the run that added it
+*/
+type joinedDoc struct {
+    Id      uint64 `bson:"_id"`
+    Name    string
+    Path    string
+    Repo    string
+    Commit  string
+    Backend parse.Backend
+    Imports []string
+    Version string
+    Funcs   parse.Function
+    Run     []RunMeta
+}
+
+func (m *MongoIndex) Join(q Query) ([]Row, error) {
+    session := m.Session.Copy()
+    defer session.Close()
+
+    field := map[string]string{BySignature:"funcs.header", FullText:"funcs.source"}[q.Mode]
+    if field == "" {
+        field = "funcs.name"
+    }
+    if q.Limit <= 0 {
+        q.Limit = defaultLimit
+    }
+
+    pattern  := bson.RegEx{Pattern: regexp.QuoteMeta(q.Text), Options: "i"}
+    selector := bson.M{field: pattern}
+    if q.Mode == FullText {
+        selector = bson.M{"$or": []bson.M{{field: pattern}, {"funcs.doc": pattern}}}
+
+        // Sealed bodies are matched here, the runs are then looked up all at once
+        if m.Cipher != nil {
+            hits, err := m.scan(session, q)
+            if err != nil {
+                return nil, err
+            }
+            return m.withRuns(session, hits)
+        }
+    }
+    if q.Version != "" {
+        selector["version"] = q.Version
+    }
+
+    // The selector picks the files, then once they're unwound, their matching functions
+    pipeline := []bson.M{
+        {"$match": selector},
+        {"$limit": q.Limit},
+        {"$project": bson.M{"name": 1, "path": 1, "repo": 1, "commit": 1, "backend": 1, "imports": 1, "version": 1, "funcs": 1}},
+        {"$unwind": "$funcs"},
+        {"$match": selector},
+        {"$lookup": bson.M{"from": m.runs(), "localField": "funcs.addedin", "foreignField": "_id", "as": "run"}},
+    }
+    iter := session.DB(m.DB).C(m.Collection).Pipe(pipeline).AllowDiskUse().Iter()
+
+    rows := []Row{}
+    var doc joinedDoc
+    for iter.Next(&doc) {
+        fn := []parse.Function{doc.Funcs}
+        if err := m.Cipher.OpenFuncs(fn); err != nil {
+            iter.Close()
+            return nil, fmt.Errorf("%s: %v", doc.Path, err)
+        }
+        if q.Matches(fn[0]) {
+            row := Row{
+                Function: fn[0],
+                File:     FileMeta{Id: doc.Id, Name: doc.Name, Path: doc.Path, Backend: doc.Backend, Imports: doc.Imports},
+                Repo:     RepoMeta{URL: doc.Repo, Commit: doc.Commit},
+            }
+            if len(doc.Run) > 0 {
+                row.Run = &doc.Run[0]
+            }
+            rows = append(rows, row)
+        }
+        doc = joinedDoc{}
+    }
+    return rows, iter.Close()
+}
+
+/*
+    Rows of hits, with the runs that added them looked up in a single query
+*/
+func (m *MongoIndex) withRuns(session *mgo.Session, hits []Hit) ([]Row, error) {
+    ids := []string{}
+    for _, hit := range hits {
+        if hit.Function.AddedIn != "" {
+            ids = append(ids, hit.Function.AddedIn)
+        }
+    }
+
+    var runs []RunMeta
+    if len(ids) > 0 {
+        err := session.DB(m.DB).C(m.runs()).Find(bson.M{"_id": bson.M{"$in": ids}}).All(&runs)
+        if err != nil {
+            return nil, err
+        }
+    }
+    byId := map[string]*RunMeta{}
+    for i := range runs {
+        byId[runs[i].Id] = &runs[i]
+    }
+
+    rows := make([]Row, len(hits))
+    for i, hit := range hits {
+        rows[i]     = rowOf(hit)
+        rows[i].Run = byId[hit.Function.AddedIn]
+    }
+    return rows, nil
+}
+
+func (m *MongoIndex) runs() string {
+    if m.Runs == "" {
+        return "runs"
+    }
+    return m.Runs
+}
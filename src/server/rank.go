@@ -0,0 +1,280 @@
+/*
+    rank.go
+
+    Ordering of search results. No single relevance measure suits every team, so rankers
+    are pluggable and can be mixed with weights per deployment:
+
+        pakkun-server -rank bm25=1,recency=0.5,stars=0.2 -stars stars.json
+*/
+
+package server
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "math"
+    "parse"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+/*
+    A Ranker scores each hit of a query, higher scores first. Scores only need to be
+    comparable among the hits of one call.
+*/
+type Ranker interface {
+    Score(q Query, hits []Hit) []float64
+}
+
+/*
+    Order hits by the scores r gives them. Hits with equal scores keep their order.
+*/
+func Rank(r Ranker, q Query, hits []Hit) []Hit {
+    scores := r.Score(q, hits)
+    order  := make([]int, len(hits))
+    for i := range order {
+        order[i] = i
+    }
+    sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+    ranked := make([]Hit, len(hits))
+    for i, j := range order {
+        ranked[i] = hits[j]
+    }
+    return ranked
+}
+
+/*
+    Okapi BM25 over the code tokens of the field the query searches. Document
+    frequencies come from the hits themselves. K1 and B default to 1.2 and 0.75.
+*/
+type BM25 struct {
+    K1 float64
+    B  float64
+}
+
+func (b BM25) Score(q Query, hits []Hit) []float64 {
+    k1, bb := b.K1, b.B
+    if k1 == 0 {
+        k1 = 1.2
+    }
+    if bb == 0 {
+        bb = 0.75
+    }
+
+    terms := tokens(q.Text)
+    docs  := make([]map[string]int, len(hits))
+    lens  := make([]float64, len(hits))
+    df    := map[string]int{}
+    total := 0.0
+    for i, hit := range hits {
+        docs[i] = map[string]int{}
+        for _, t := range tokens(q.field(hit.Function)) {
+            docs[i][t]++
+            lens[i]++
+        }
+        for t := range docs[i] {
+            df[t]++
+        }
+        total += lens[i]
+    }
+
+    scores := make([]float64, len(hits))
+    if len(hits) == 0 || total == 0 {
+        return scores
+    }
+    avg := total / float64(len(hits))
+    n   := float64(len(hits))
+    for i := range hits {
+        for _, t := range terms {
+            tf := float64(docs[i][t])
+            if tf == 0 {
+                continue
+            }
+            idf := math.Log(1 + (n-float64(df[t])+0.5)/(float64(df[t])+0.5))
+            scores[i] += idf * tf * (k1 + 1) / (tf + k1*(1-bb+bb*lens[i]/avg))
+        }
+    }
+    return scores
+}
+
+/*
+    Split code into lowercase tokens at punctuation, underscores and camelCase humps,
+    so parseJavaFuncHeader yields parse, java, func and header
+*/
+func tokens(s string) []string {
+    toks := []string{}
+    word := []rune{}
+    flush := func() {
+        if len(word) > 0 {
+            toks = append(toks, strings.ToLower(string(word)))
+            word = word[:0]
+        }
+    }
+
+    runes := []rune(s)
+    for i, r := range runes {
+        switch {
+        case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+            flush()
+            continue
+        case unicode.IsUpper(r) && len(word) > 0:
+            // New hump: fooBar, or the last capital of an acronym in HTTPServer
+            prev := runes[i-1]
+            if unicode.IsLower(prev) || unicode.IsDigit(prev) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+                flush()
+            }
+        }
+        word = append(word, r)
+    }
+    flush()
+    return toks
+}
+
+/*
+    Recently added functions first, by the run that added them
+*/
+type Recency struct{}
+
+func (Recency) Score(q Query, hits []Hit) []float64 {
+    runs := []string{}
+    for _, hit := range hits {
+        runs = append(runs, hit.Function.AddedIn)
+    }
+    sort.Strings(runs)
+
+    scores := make([]float64, len(hits))
+    for i, hit := range hits {
+        scores[i] = float64(sort.SearchStrings(runs, hit.Function.AddedIn))
+    }
+    return scores
+}
+
+/*
+    Functions from popular repositories first. Stars are keyed by File.Repo
+*/
+type Stars map[string]int
+
+func (s Stars) Score(q Query, hits []Hit) []float64 {
+    scores := make([]float64, len(hits))
+    for i, hit := range hits {
+        scores[i] = math.Log1p(float64(s[hit.File.Repo]))
+    }
+    return scores
+}
+
+/*
+    Read stars per repository from a JSON object, {"<repo url>": <stars>, ...}
+*/
+func LoadStars(path string) (Stars, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    stars := Stars{}
+    if err := json.Unmarshal(data, &stars); err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    return stars, nil
+}
+
+/*
+    Score each function on its own, e.g. with a quality model
+*/
+type Quality func(fn parse.Function) float64
+
+func (f Quality) Score(q Query, hits []Hit) []float64 {
+    scores := make([]float64, len(hits))
+    for i, hit := range hits {
+        scores[i] = f(hit.Function)
+    }
+    return scores
+}
+
+/*
+    Default quality score: documented functions of a readable length that are actually
+    used score higher
+*/
+func DefaultQuality(fn parse.Function) float64 {
+    score := 0.0
+    if fn.Doc != "" {
+        score++
+    }
+    if lines := fn.EndLine - fn.StartLine + 1; fn.StartLine > 0 && lines >= 3 && lines <= 60 {
+        score++
+    }
+    return score + math.Log1p(float64(fn.UsageCount))
+}
+
+/*
+    Ranker and how much it counts in a Weighted ranking
+*/
+type Weight struct {
+    Ranker Ranker
+    Weight float64
+}
+
+/*
+    Weighted sum of rankers. Each ranker's scores are scaled to [0, 1] first, so weights
+    compare rankers and not the ranges of their scores.
+*/
+type Weighted []Weight
+
+func (w Weighted) Score(q Query, hits []Hit) []float64 {
+    total := make([]float64, len(hits))
+    for _, r := range w {
+        scores   := r.Ranker.Score(q, hits)
+        min, max := math.Inf(1), math.Inf(-1)
+        for _, s := range scores {
+            min, max = math.Min(min, s), math.Max(max, s)
+        }
+        for i, s := range scores {
+            if max > min {
+                total[i] += r.Weight * (s - min) / (max - min)
+            }
+        }
+    }
+    return total
+}
+
+/*
+    Build a Weighted ranking from a spec like "bm25=1,recency=0.5". Rankers are bm25,
+    recency, stars and quality. stars are used by the stars ranker, and may be nil.
+*/
+func ParseRanking(spec string, stars Stars) (Weighted, error) {
+    w := Weighted{}
+    for _, part := range strings.Split(spec, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+
+        name, weight := part, 1.0
+        if i := strings.Index(part, "="); i >= 0 {
+            var err error
+            name = part[:i]
+            if weight, err = strconv.ParseFloat(part[i+1:], 64); err != nil {
+                return nil, fmt.Errorf("ranking %q: %v", part, err)
+            }
+        }
+
+        var r Ranker
+        switch name {
+        case "bm25":
+            r = BM25{}
+        case "recency":
+            r = Recency{}
+        case "stars":
+            r = stars
+        case "quality":
+            r = Quality(DefaultQuality)
+        default:
+            return nil, fmt.Errorf("unknown ranker %q", name)
+        }
+        w = append(w, Weight{Ranker: r, Weight: weight})
+    }
+    return w, nil
+}
@@ -0,0 +1,144 @@
+/*
+    ratelimit.go
+
+    Per-token rate limiting, so one runaway client can't saturate the store behind a
+    shared server. Clients are told apart by their bearer token once it's authenticated,
+    or by their address otherwise, so made up tokens don't get a bucket each.
+*/
+
+package server
+
+import (
+    "fmt"
+    "math"
+    "net"
+    "crypto/sha256"
+    "crypto/subtle"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Idle buckets are dropped once there are this many, so the map doesn't grow forever
+const maxBuckets = 10000
+
+type bucket struct {
+    tokens float64
+    last   time.Time
+}
+
+/*
+    Token bucket per client. Each client may make Burst requests at once and Rate
+    requests per second after that.
+
+    Authenticate - Whether a bearer token is one the server accepts. Only those tell
+                   clients apart, nil accepts none and every client is its address
+*/
+type RateLimiter struct {
+    Rate         float64
+    Burst        int
+    Authenticate func(token string) bool
+
+    mu      sync.Mutex
+    buckets map[string]*bucket
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+    if burst < 1 {
+        burst = 1
+    }
+    return &RateLimiter{Rate: rate, Burst: burst, buckets: map[string]*bucket{}}
+}
+
+/*
+    Take a request from the bucket of key. If it's empty, return false and how long
+    until the next request is allowed.
+*/
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := time.Now()
+    b   := l.buckets[key]
+    if b == nil {
+        if len(l.buckets) >= maxBuckets {
+            l.prune(now)
+        }
+        b = &bucket{tokens: float64(l.Burst), last: now}
+        l.buckets[key] = b
+    }
+
+    b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+    b.last   = now
+    if b.tokens >= 1 {
+        b.tokens--
+        return true, 0
+    }
+    return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+}
+
+/*
+    Drop the buckets that have filled up again, their clients are back to a full burst
+*/
+func (l *RateLimiter) prune(now time.Time) {
+    for key, b := range l.buckets {
+        if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= float64(l.Burst) {
+            delete(l.buckets, key)
+        }
+    }
+}
+
+/*
+    Wrap h, answering 429 Too Many Requests with a Retry-After header to clients over
+    their rate
+*/
+func (l *RateLimiter) Wrap(h http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ok, wait := l.Allow(l.clientKey(r))
+        if !ok {
+            w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+            http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+            return
+        }
+        h.ServeHTTP(w, r)
+    })
+}
+
+/*
+    The bearer token of the request if it's authenticated, or its remote address without
+    the port
+*/
+func (l *RateLimiter) clientKey(r *http.Request) string {
+    if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") && l.Authenticate != nil {
+        if token := strings.TrimSpace(auth[len("Bearer "):]); l.Authenticate(token) {
+            return "token:" + token
+        }
+    }
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+    return "addr:" + host
+}
+
+/*
+    Authenticate accepting the tokens, e.g. read from a file of one per line. They're
+    kept as hashes, compared in constant time.
+*/
+func TokenSet(tokens []string) func(token string) bool {
+    sums := [][sha256.Size]byte{}
+    for _, token := range tokens {
+        if token = strings.TrimSpace(token); token != "" {
+            sums = append(sums, sha256.Sum256([]byte(token)))
+        }
+    }
+    return func(token string) bool {
+        sum   := sha256.Sum256([]byte(token))
+        found := 0
+        for _, s := range sums {
+            found |= subtle.ConstantTimeCompare(sum[:], s[:])
+        }
+        return found == 1
+    }
+}
@@ -0,0 +1,252 @@
+/*
+    rpc.go
+
+    JSON-RPC 2.0 over stdio for editor extensions, so they don't need the HTTP server.
+    Messages are framed like the Language Server Protocol, a Content-Length header and a
+    blank line before each JSON body, which is what vscode-jsonrpc speaks.
+
+        search             {"text", "mode", "limit", "asOf"}  -> [Hit]
+        function/body      {"id"}                             -> {"source"}
+        function/metadata  {"id"}                             -> Hit without the source
+        file/parse         {"path", "types"}                  -> parse.File
+        exit                                                  -> stops serving
+*/
+
+package server
+
+import (
+    "audit"
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/textproto"
+    "parse"
+    "strconv"
+    "strings"
+    "utils"
+)
+
+// JSON-RPC error codes
+const (
+    ParseError     = -32700
+    InvalidRequest = -32600
+    MethodNotFound = -32601
+    InvalidParams  = -32602
+    InternalError  = -32603
+)
+
+type rpcRequest struct {
+    JSONRPC string           `json:"jsonrpc"`
+    Id      *json.RawMessage `json:"id"`
+    Method  string           `json:"method"`
+    Params  json.RawMessage  `json:"params"`
+}
+
+type rpcResponse struct {
+    JSONRPC string           `json:"jsonrpc"`
+    Id      *json.RawMessage `json:"id"`
+    Result  interface{}      `json:"result,omitempty"`
+    Error   *RPCError        `json:"error,omitempty"`
+}
+
+/*
+    Code    - JSON-RPC error code, e.g. InvalidParams
+    Message - What went wrong
+    Data    - What went wrong in the index or parser as one of the codes of parse/codes.go,
+              nil for errors in the request
+*/
+type RPCError struct {
+    Code    int        `json:"code"`
+    Message string     `json:"message"`
+    Data    *ErrorData `json:"data,omitempty"`
+}
+
+type ErrorData struct {
+    Code parse.Code `json:"code"`
+}
+
+func (e *RPCError) Error() string {
+    return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+/*
+    Index  - Where queries are answered from
+    Ranker - Orders search results, nil to keep the order of the index
+    Types  - Types file/parse uses when the request doesn't give any
+    Audit  - Where requests are recorded, nil to not record them. The actor is the
+             user running the server, the editor's user.
+*/
+type RPC struct {
+    Index  Index
+    Ranker Ranker
+    Types  map[string]bool
+    Audit  *audit.Log
+}
+
+/*
+    Answer requests read from r on w until r ends or an exit request arrives
+*/
+func (s *RPC) Serve(r io.Reader, w io.Writer) error {
+    in := bufio.NewReader(r)
+    for {
+        body, err := readMessage(in)
+        if err == io.EOF {
+            return nil
+        } else if err != nil {
+            return err
+        }
+
+        var req rpcRequest
+        resp := rpcResponse{JSONRPC: "2.0"}
+        if err := json.Unmarshal(body, &req); err != nil {
+            resp.Error = &RPCError{ParseError, err.Error(), nil}
+        } else if req.JSONRPC != "2.0" || req.Method == "" {
+            resp.Id, resp.Error = req.Id, &RPCError{InvalidRequest, "not a JSON-RPC 2.0 request", nil}
+        } else if req.Method == "exit" {
+            return nil
+        } else {
+            resp.Id = req.Id
+            result, err := s.call(req.Method, req.Params)
+            if rpcErr, ok := err.(*RPCError); ok {
+                resp.Error = rpcErr
+            } else if err != nil {
+                resp.Error = &RPCError{InternalError, err.Error(), &ErrorData{parse.CodeOf(err)}}
+            } else {
+                resp.Result = result
+            }
+
+            // Notifications don't get a response
+            if req.Id == nil {
+                continue
+            }
+        }
+
+        if err := writeMessage(w, resp); err != nil {
+            return err
+        }
+    }
+}
+
+func (s *RPC) call(method string, params json.RawMessage) (interface{}, error) {
+    switch method {
+    case "search":
+        var p struct {
+            Text    string `json:"text"`
+            Mode    string `json:"mode"`
+            Limit   int    `json:"limit"`
+            AsOf    string `json:"asOf"`
+            Version string `json:"version"`
+            Fuzzy   bool   `json:"fuzzy"`
+        }
+        if err := decodeParams(params, &p); err != nil {
+            return nil, err
+        }
+
+        q := Query{Text: p.Text, Mode: p.Mode, Limit: p.Limit, Version: p.Version, Fuzzy: p.Fuzzy}
+        if p.AsOf != "" {
+            run, err := utils.AsOfRun(p.AsOf)
+            if err != nil {
+                return nil, &RPCError{InvalidParams, "invalid asOf: " + err.Error(), nil}
+            }
+            q.AsOf = run
+        }
+        // Partial results of a Federation are better than none while typing
+        hits, err := s.Index.Search(q)
+        if _, partial := err.(*PartialError); err != nil && !partial {
+            return nil, err
+        }
+        if s.Ranker != nil {
+            hits = Rank(s.Ranker, q, hits)
+        }
+        s.record(audit.Query, q.Text, fmt.Sprintf("%d results", len(hits)))
+        return hits, nil
+
+    case "function/body", "function/metadata":
+        var p struct {
+            Id uint64 `json:"id"`
+        }
+        if err := decodeParams(params, &p); err != nil {
+            return nil, err
+        }
+        hit, err := s.Index.Function(p.Id)
+        if err != nil {
+            return nil, &RPCError{InvalidParams, fmt.Sprintf("no function %d", p.Id), nil}
+        }
+        s.record(audit.View, fmt.Sprint(p.Id), hit.Function.Name)
+        if method == "function/body" {
+            return map[string]string{"source": hit.Function.Source}, nil
+        }
+        hit.Function.Source = ""
+        return hit, nil
+
+    case "file/parse":
+        var p struct {
+            Path  string          `json:"path"`
+            Types map[string]bool `json:"types"`
+        }
+        if err := decodeParams(params, &p); err != nil {
+            return nil, err
+        }
+        if p.Types == nil {
+            p.Types = s.Types
+        }
+        file, err := parse.ParseFile(p.Path, parse.WithTypes(p.Types))
+        s.record(audit.Parse, p.Path, fmt.Sprintf("%d functions", len(file.Funcs)))
+        if err == parse.ErrNoFuncs {
+            return parse.File{Path: p.Path, Funcs: []parse.Function{}}, nil
+        }
+        return file, err
+    }
+    return nil, &RPCError{MethodNotFound, "unknown method " + method, nil}
+}
+
+func (s *RPC) record(action string, target string, detail string) {
+    if err := s.Audit.Record(audit.CurrentUser(), action, target, detail); err != nil {
+        log.Printf("failed to write audit log: %v\n", err)
+    }
+}
+
+func decodeParams(params json.RawMessage, v interface{}) error {
+    if len(params) == 0 {
+        return &RPCError{InvalidParams, "missing params", nil}
+    }
+    if err := json.Unmarshal(params, v); err != nil {
+        return &RPCError{InvalidParams, err.Error(), nil}
+    }
+    return nil
+}
+
+/*
+    Read the body of the next message, framed by its Content-Length header
+*/
+func readMessage(r *bufio.Reader) ([]byte, error) {
+    header, err := textproto.NewReader(r).ReadMIMEHeader()
+    if err != nil {
+        if err == io.EOF || (err == io.ErrUnexpectedEOF && len(header) == 0) {
+            return nil, io.EOF
+        }
+        return nil, err
+    }
+
+    length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+    if err != nil || length < 0 {
+        return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+    }
+    body := make([]byte, length)
+    _, err = io.ReadFull(r, body)
+    return body, err
+}
+
+func writeMessage(w io.Writer, v interface{}) error {
+    body, err := json.Marshal(v)
+    if err != nil {
+        return err
+    }
+    if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+        return err
+    }
+    _, err = w.Write(body)
+    return err
+}
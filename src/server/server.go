@@ -0,0 +1,371 @@
+/*
+    server.go
+
+    HTTP server for searching the function index. Serves a minimal web UI so the index
+    can be used without writing queries by hand.
+
+    Dependencies:        mongodb driver for go (http://labix.org/mgo)
+    Operating systems:   GNU Linux, OS X
+*/
+
+package server
+
+import (
+    "audit"
+    "crypto/sha256"
+    "encoding/json"
+    "fmt"
+    "hash/fnv"
+    "html/template"
+    "log"
+    "net"
+    "net/http"
+    "net/url"
+    "parse"
+    "strconv"
+    "strings"
+    "utils"
+)
+
+/*
+    Index  - Where queries are answered from
+    Ranker - Orders search results, nil to keep the order of the index
+    Audit  - Where queries and views are recorded, nil to not record them
+*/
+type Server struct {
+    Index  Index
+    Ranker Ranker
+    Audit  *audit.Log
+
+    // Whether a bearer token is one the server accepts. Only those name the client in
+    // the audit log, nil accepts none and every client is its address
+    Authenticate func(token string) bool
+
+    mux *http.ServeMux
+}
+
+/*
+    Return a server answering queries from index
+*/
+func New(index Index) *Server {
+    s := &Server{Index: index, mux: http.NewServeMux()}
+    s.mux.HandleFunc("/", s.handleSearch)
+    s.mux.HandleFunc("/functions/", s.handleFunction)
+    s.mux.HandleFunc("/functions/lookup", s.handleLookup)
+    s.mux.HandleFunc("/stats", s.handleStats)
+    s.mux.HandleFunc("/rows", s.handleRows)
+    return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.mux.ServeHTTP(w, r)
+}
+
+/*
+    GET /?q=<text>&mode=<name|signature|text>[&asof=<run id|date>][&version=<language version>][&fuzzy=true][&format=<quickfix|problems|sarif>]
+
+    With a format the results are exported instead of shown, see export.go
+*/
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Path != "/" {
+        http.NotFound(w, r)
+        return
+    }
+
+    q    := Query{Text: strings.TrimSpace(r.FormValue("q")), Mode: r.FormValue("mode"), Version: r.FormValue("version"),
+                  Fuzzy: r.FormValue("fuzzy") == "true"}
+    page := searchPage{Query: q}
+
+    // asof takes a run id or a date
+    if asOf := r.FormValue("asof"); asOf != "" {
+        run, err := utils.AsOfRun(asOf)
+        if err != nil {
+            http.Error(w, "invalid asof: "+err.Error(), http.StatusBadRequest)
+            return
+        }
+        q.AsOf    = run
+        page.AsOf = asOf
+    }
+
+    if q.Text != "" {
+        hits, err := s.Index.Search(q)
+        if !answered(w, "search "+strconv.Quote(q.Text), err) {
+            http.Error(w, "search failed", http.StatusInternalServerError)
+            return
+        }
+        if partial, ok := err.(*PartialError); ok {
+            page.Statuses = partial.Statuses
+        }
+        if s.Ranker != nil {
+            hits = Rank(s.Ranker, q, hits)
+        }
+        page.Hits = hits
+    }
+
+    if format := r.FormValue("format"); format != "" {
+        contentType, ok := exportTypes[format]
+        if !ok {
+            http.Error(w, "unknown format "+format, http.StatusBadRequest)
+            return
+        }
+        s.record(r, audit.Export, q.Text, fmt.Sprintf("format %s, %d results", format, len(page.Hits)))
+        w.Header().Set("Content-Type", contentType)
+        if err := Export(w, format, q, page.Hits); err != nil {
+            log.Printf("export of %q failed: %v\n", q.Text, err)
+        }
+        return
+    }
+
+    if q.Text != "" {
+        s.record(r, audit.Query, q.Text, fmt.Sprintf("%d results", len(page.Hits)))
+    }
+    render(w, searchTmpl, page)
+}
+
+/*
+    GET /functions/<id>
+    GET /functions/<id>/source
+*/
+func (s *Server) handleFunction(w http.ResponseWriter, r *http.Request) {
+    path   := strings.TrimPrefix(r.URL.Path, "/functions/")
+    source := strings.HasSuffix(path, "/source")
+
+    id, err := strconv.ParseUint(strings.TrimSuffix(path, "/source"), 10, 63)
+    if err != nil {
+        http.NotFound(w, r)
+        return
+    }
+
+    hit, err := s.Index.Function(id)
+    if err != nil {
+        http.NotFound(w, r)
+        return
+    }
+
+    s.record(r, audit.View, fmt.Sprint(id), hit.Function.Name)
+    if source {
+        serveSource(w, r, hit.Function)
+        return
+    }
+    render(w, functionTmpl, functionPage{Hit: hit})
+}
+
+/*
+    Serve the function body as plain text. The ETag is a hash of the body, so clients
+    sending it back in If-None-Match get a 304 until the function changes.
+*/
+func serveSource(w http.ResponseWriter, r *http.Request, fn parse.Function) {
+    h := fnv.New64a()
+    h.Write([]byte(fn.Source))
+    etag := fmt.Sprintf("\"%x\"", h.Sum64())
+
+    w.Header().Set("ETag", etag)
+    w.Header().Set("Cache-Control", "no-cache")
+
+    for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+        tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+        if tag == etag || tag == "*" {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+    }
+
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    w.Write([]byte(fn.Source))
+}
+
+/*
+    Ids - Function ids (fingerprints) to look up
+*/
+type LookupRequest struct {
+    Ids []uint64 `json:"ids"`
+}
+
+/*
+    Present - Ids already in the index, in request order
+    Missing - Ids not in the index yet
+*/
+type LookupResponse struct {
+    Present []uint64 `json:"present"`
+    Missing []uint64 `json:"missing"`
+}
+
+// Largest batch accepted by /functions/lookup
+const maxLookup = 10000
+
+/*
+    POST /functions/lookup {"ids": [...]}
+
+    Lets ingestion pipelines skip functions that are already stored before shipping them
+*/
+func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var req LookupRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+        return
+    }
+    if len(req.Ids) > maxLookup {
+        http.Error(w, fmt.Sprintf("at most %d ids per request", maxLookup), http.StatusRequestEntityTooLarge)
+        return
+    }
+
+    present, err := s.Index.Present(req.Ids)
+    if !answered(w, fmt.Sprintf("lookup of %d ids", len(req.Ids)), err) {
+        http.Error(w, "lookup failed", http.StatusInternalServerError)
+        return
+    }
+
+    stored := map[uint64]bool{}
+    for _, id := range present {
+        stored[id] = true
+    }
+    resp := LookupResponse{Present: present, Missing: []uint64{}}
+    for _, id := range req.Ids {
+        if !stored[id] {
+            resp.Missing = append(resp.Missing, id)
+        }
+    }
+
+    s.record(r, audit.Lookup, fmt.Sprintf("%d ids", len(req.Ids)), fmt.Sprintf("%d present", len(present)))
+    writeJSON(w, resp)
+}
+
+/*
+    GET /stats
+
+    Language distribution, type frequencies and size histogram of the live functions
+*/
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+    stats, err := s.Index.Stats()
+    if !answered(w, "stats", err) {
+        http.Error(w, "stats failed", http.StatusInternalServerError)
+        return
+    }
+    s.record(r, audit.Stats, "", "")
+    writeJSON(w, stats)
+}
+
+/*
+    GET /rows?q=<text>&mode=<name|signature|text>[&asof=<run id|date>][&version=<language version>][&fuzzy=true][&limit=<files>]
+
+    Matching functions as JSON, each with its file, repository and the run that added it
+*/
+func (s *Server) handleRows(w http.ResponseWriter, r *http.Request) {
+    q := Query{Text: strings.TrimSpace(r.FormValue("q")), Mode: r.FormValue("mode"), Version: r.FormValue("version"),
+               Fuzzy: r.FormValue("fuzzy") == "true"}
+    if q.Text == "" {
+        http.Error(w, "missing q", http.StatusBadRequest)
+        return
+    }
+    if asOf := r.FormValue("asof"); asOf != "" {
+        run, err := utils.AsOfRun(asOf)
+        if err != nil {
+            http.Error(w, "invalid asof: "+err.Error(), http.StatusBadRequest)
+            return
+        }
+        q.AsOf = run
+    }
+    if limit := r.FormValue("limit"); limit != "" {
+        n, err := strconv.Atoi(limit)
+        if err != nil || n < 0 {
+            http.Error(w, "invalid limit "+limit, http.StatusBadRequest)
+            return
+        }
+        q.Limit = n
+    }
+
+    rows, err := Join(s.Index, q)
+    if !answered(w, "rows for "+strconv.Quote(q.Text), err) {
+        http.Error(w, "search failed", http.StatusInternalServerError)
+        return
+    }
+    s.record(r, audit.Query, q.Text, fmt.Sprintf("%d rows", len(rows)))
+    writeJSON(w, rows)
+}
+
+// Header with the status of one corpus of a Federation, see statusHeader
+const corpusStatusHeader = "X-Corpus-Status"
+
+// Header with the code of the error a request failed with, see parse/codes.go
+const errorCodeHeader = "X-Error-Code"
+
+/*
+    False if err leaves nothing to answer with. A *PartialError does: it's logged and the
+    status of every corpus is sent in X-Corpus-Status headers. Otherwise the code of err
+    is sent in an X-Error-Code header.
+*/
+func answered(w http.ResponseWriter, what string, err error) bool {
+    partial, ok := err.(*PartialError)
+    switch {
+    case ok:
+        log.Printf("%s: %v\n", what, err)
+    case err != nil:
+        log.Printf("[%s] %s failed: %v\n", parse.CodeOf(err), what, err)
+        w.Header().Set(errorCodeHeader, string(parse.CodeOf(err)))
+    }
+    if ok {
+        for _, status := range partial.Statuses {
+            w.Header().Add(corpusStatusHeader, statusHeader(status))
+        }
+    }
+    return err == nil || ok
+}
+
+/*
+    status as a header value, e.g. public; status=timeout; results=0; elapsed=2.001s; error=no+answer+in+2s
+*/
+func statusHeader(status CorpusStatus) string {
+    header := fmt.Sprintf("%s; status=%s; results=%d; elapsed=%v", url.QueryEscape(status.Corpus), status.Status,
+                          status.Results, status.Elapsed)
+    if status.Error != "" {
+        header += "; error=" + url.QueryEscape(status.Error)
+    }
+    return header
+}
+
+/*
+    Add an event by the client of r to the audit log, if there is one
+*/
+func (s *Server) record(r *http.Request, action string, target string, detail string) {
+    if err := s.Audit.Record(s.actor(r), action, target, detail); err != nil {
+        log.Printf("failed to write audit log: %v\n", err)
+    }
+}
+
+/*
+    Who sent r: a hash of its bearer token if it's authenticated, so the log doesn't
+    leak tokens, or its remote address without the port
+*/
+func (s *Server) actor(r *http.Request) string {
+    if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") && s.Authenticate != nil {
+        if token := strings.TrimSpace(auth[len("Bearer "):]); s.Authenticate(token) {
+            sum := sha256.Sum256([]byte(token))
+            return fmt.Sprintf("token:%x", sum[:6])
+        }
+    }
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+    return "addr:" + host
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    if err := json.NewEncoder(w).Encode(v); err != nil {
+        log.Printf("failed to write response: %v\n", err)
+    }
+}
+
+func render(w http.ResponseWriter, tmpl *template.Template, data interface{}) {
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    if err := tmpl.Execute(w, data); err != nil {
+        log.Printf("failed to render %s: %v\n", tmpl.Name(), err)
+    }
+}
@@ -0,0 +1,126 @@
+/*
+    ui.go
+
+    Templates for the web UI. They're kept in the binary so the server is a single file
+    to deploy.
+*/
+
+package server
+
+import (
+    "html/template"
+    "strings"
+)
+
+type searchPage struct {
+    Query    Query
+    AsOf     string
+    Hits     []Hit
+    Statuses []CorpusStatus
+}
+
+type functionPage struct {
+    Query Query
+    AsOf  string
+    Hit
+}
+
+// Longest body shown in the result list, the detail page has the rest
+const snippetLen = 400
+
+var funcs = template.FuncMap{
+    "highlight": highlight,
+    "snippet":   snippet,
+    "join":      strings.Join,
+}
+
+/*
+    Escape s and wrap every case-insensitive occurrence of q in <mark>
+*/
+func highlight(s string, q string) template.HTML {
+    if q == "" {
+        return template.HTML(template.HTMLEscapeString(s))
+    }
+
+    var b strings.Builder
+    lower  := strings.ToLower(s)
+    lowerQ := strings.ToLower(q)
+    for {
+        i := strings.Index(lower, lowerQ)
+        if i < 0 || len(lower) != len(s) {
+            break
+        }
+        b.WriteString(template.HTMLEscapeString(s[:i]))
+        b.WriteString("<mark>" + template.HTMLEscapeString(s[i:i+len(q)]) + "</mark>")
+        s, lower = s[i+len(q):], lower[i+len(q):]
+    }
+    b.WriteString(template.HTMLEscapeString(s))
+    return template.HTML(b.String())
+}
+
+func snippet(s string) string {
+    if len(s) <= snippetLen {
+        return s
+    }
+    return s[:snippetLen] + "..."
+}
+
+const layout = `
+{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pakkun</title>
+<style>
+    body { font-family: sans-serif; max-width: 960px; margin: 2em auto; }
+    pre  { background: #f6f8fa; padding: 0.8em; white-space: pre-wrap; word-break: break-all; }
+    mark { background: #ffe58f; }
+    .path { color: #666; font-size: 0.9em; }
+    .hit { margin-bottom: 1.5em; }
+    .partial { background: #fff1f0; padding: 0.5em 0.8em; }
+</style>
+</head>
+<body>
+<form action="/" method="get">
+    <input name="q" size="50" value="{{.Query.Text}}" autofocus>
+    <select name="mode">
+        <option value="name" {{if eq .Query.Mode "name"}}selected{{end}}>Name</option>
+        <option value="signature" {{if eq .Query.Mode "signature"}}selected{{end}}>Signature</option>
+        <option value="text" {{if eq .Query.Mode "text"}}selected{{end}}>Full text</option>
+    </select>
+    <input name="asof" size="12" value="{{.AsOf}}" placeholder="as of">
+    {{if .Query.Version}}<input type="hidden" name="version" value="{{.Query.Version}}">{{end}}
+    <button type="submit">Search</button>
+</form>
+{{end}}
+{{define "foot"}}</body>
+</html>
+{{end}}`
+
+var searchTmpl = template.Must(template.New("search").Funcs(funcs).Parse(layout + `
+{{template "head" .}}
+{{if .Query.Text}}<p>{{len .Hits}} result(s)</p>{{end}}
+{{if .Statuses}}<div class="partial">Some corpora are missing from these results:
+{{range .Statuses}}{{if ne .Status "ok"}}<br><b>{{.Corpus}}</b> {{.Status}}: {{.Error}}{{end}}{{end}}
+</div>{{end}}
+{{range .Hits}}
+<div class="hit">
+    <a href="/functions/{{.Function.Id}}"><b>{{highlight .Function.Name $.Query.Text}}</b></a>
+    <div class="path">{{if .Corpus}}[{{.Corpus}}] {{end}}{{.File.Path}}{{if .Function.StartLine}}:{{.Function.StartLine}}{{end}}</div>
+    <div><code>{{highlight .Function.Header $.Query.Text}}</code></div>
+    <pre>{{highlight (snippet .Function.Source) $.Query.Text}}</pre>
+</div>
+{{end}}
+{{template "foot"}}`))
+
+var functionTmpl = template.Must(template.New("function").Funcs(funcs).Parse(layout + `
+{{template "head" .}}
+<h2>{{.Function.Name}}</h2>
+<div class="path">{{.File.Path}}{{if .Function.StartLine}}:{{.Function.StartLine}}{{if .Function.EndLine}}-{{.Function.EndLine}}{{end}}{{end}}{{if .File.Commit}} @ {{.File.Commit}}{{end}}</div>
+{{if .File.Repo}}<div class="path">{{.File.Repo}}</div>{{end}}
+{{if .Function.RemovedIn}}<p><b>Removed from the file in run {{.Function.RemovedIn}}</b></p>{{end}}
+{{if .Function.Doc}}<p>{{.Function.Doc}}</p>{{end}}
+<p><code>{{.Function.Header}}</code></p>
+<p>In: {{join .Function.InType ", "}}<br>Out: {{join .Function.OutType ", "}}</p>
+<pre>{{.Function.Source}}</pre>
+{{template "foot"}}`))
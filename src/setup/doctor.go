@@ -0,0 +1,272 @@
+/*
+    doctor.go
+
+    pakkun doctor: check the environment pakkun runs in and say what to fix. Most runs
+    that go wrong do so because of it, ctags missing or too old, MongoDB down or read
+    only, a temporary directory that can't be written, rather than because of pakkun, so
+
+        pakkun doctor [dir]
+
+    checks ctags and the kinds it can tag, the project config of dir, the store and the
+    directories pakkun writes to, and extracts the functions of small embedded fixtures
+    with every backend available to make sure they're found.
+
+    Dependencies:        exuberant or universal ctags, MongoDB
+    Operating systems:   GNU Linux, OS X
+*/
+
+package setup
+
+import (
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "parse"
+    "path/filepath"
+    "search"
+    "sort"
+    "strings"
+    "time"
+    "utils"
+)
+
+/*
+    One check of pakkun doctor
+
+    Name    - What was checked, e.g. store
+    Detail  - What was found when it passed, e.g. the ctags version
+    Err     - What's wrong, nil if it passed
+    Fix     - What to do about it
+    Warning - pakkun still runs with Err, only worse, e.g. without ctags
+*/
+type Check struct {
+    Name    string
+    Detail  string
+    Err     error
+    Fix     string
+    Warning bool
+}
+
+// How long the store gets to answer
+var StoreTimeout = 3 * time.Second
+
+/*
+    A file extraction is checked on, and the functions it has
+*/
+type fixture struct {
+    name   string
+    source string
+    funcs  []string
+}
+
+var fixtures = []fixture{
+    {"Doctor.java", `public class Doctor {
+    public static int add(int a, int b) {
+        return a + b;
+    }
+
+    private static boolean even(int n) {
+        return n % 2 == 0;
+    }
+}
+`, []string{"add", "even"}},
+    {"doctor.c", `#include <stdio.h>
+
+static int add(int a, int b) {
+    return a + b;
+}
+
+static double half(double x) {
+    return x / 2;
+}
+`, []string{"add", "half"}},
+}
+
+/*
+    Run every check for the project in dir
+*/
+func Doctor(dir string) []Check {
+    checks := []Check{}
+
+    ctags, ctagsErr := CheckCtags()
+    checks = append(checks, Check{Name: "ctags", Detail: strings.TrimSpace(ctags.Version + " " + ctags.Path),
+                                  Err: ctagsErr, Warning: true})
+    if ctagsErr == nil {
+        checks = append(checks, checkKinds(ctags.Path)...)
+    }
+
+    checks = append(checks, checkConfig(dir))
+
+    err := utils.CheckStore(search.DB, StoreTimeout)
+    checks = append(checks, Check{Name: "store", Detail: "localhost:27017, " + search.DB, Err: err,
+                                  Fix: "Start MongoDB on localhost:27017 and make sure " + search.DB +
+                                       " can be written to, or set another database in " + ConfigName})
+
+    tmp, err := checkWritable(os.TempDir())
+    checks = append(checks, Check{Name: "temporary directory", Detail: tmp, Err: err,
+                                  Fix: "Set $TMPDIR to a writable directory, it's where files are normalized and exports are sorted"})
+    abs, err := checkWritable(dir)
+    checks = append(checks, Check{Name: "project directory", Detail: abs, Err: err, Warning: true,
+                                  Fix: "pakkun init can't write " + ConfigName + " there, make it writable or write it elsewhere and pass -patterns"})
+
+    backends := []parse.Backend{parse.Regex}
+    if ctagsErr == nil {
+        backends = append([]parse.Backend{parse.Ctags}, backends...)
+    }
+    for _, backend := range backends {
+        for _, f := range fixtures {
+            checks = append(checks, checkExtraction(f, backend))
+        }
+    }
+    return checks
+}
+
+/*
+    Write the result of every check for dir to out, with what to do about those that
+    failed. False if any failed that isn't a warning.
+*/
+func RunDoctor(dir string, out io.Writer) bool {
+    ok := true
+    for _, check := range Doctor(dir) {
+        switch {
+        case check.Err == nil:
+            fmt.Fprintf(out, "ok    %s", check.Name)
+            if check.Detail != "" {
+                fmt.Fprintf(out, ": %s", check.Detail)
+            }
+            fmt.Fprintln(out)
+            continue
+        case check.Warning:
+            fmt.Fprintf(out, "warn  %s: %v\n", check.Name, check.Err)
+        default:
+            fmt.Fprintf(out, "FAIL  %s: %v\n", check.Name, check.Err)
+            ok = false
+        }
+        if check.Fix != "" {
+            fmt.Fprintf(out, "      %s\n", check.Fix)
+        }
+    }
+    return ok
+}
+
+/*
+    Whether the ctags at bin lists the kinds pakkun asks it for, for every language of the
+    fixtures
+*/
+func checkKinds(bin string) []Check {
+    exts := map[string]bool{}
+    for _, f := range fixtures {
+        exts[strings.TrimPrefix(filepath.Ext(f.name), ".")] = true
+    }
+    sorted := []string{}
+    for ext := range exts {
+        sorted = append(sorted, ext)
+    }
+    sort.Strings(sorted)
+
+    checks := []Check{}
+    for _, ext := range sorted {
+        check        := Check{Name: "ctags kinds of " + parse.LanguageName(ext), Warning: true}
+        missing, err := parse.MissingCtagsKinds(bin, ext)
+        switch {
+        case err != nil:
+            check.Err = err
+            check.Fix = "ctags may be too old, install universal-ctags"
+        case missing != "":
+            check.Err = fmt.Errorf("ctags doesn't list kind %s, functions of %s files won't be found", missing, ext)
+            check.Fix = "Install a universal-ctags built with the " + parse.LanguageName(ext) + " parser"
+        }
+        checks = append(checks, check)
+    }
+    return checks
+}
+
+/*
+    Whether the project config of dir loads, applying it if it does so the store checked
+    is the one it names
+*/
+func checkConfig(dir string) Check {
+    path  := filepath.Join(dir, ConfigName)
+    check := Check{Name: "project config", Detail: path}
+    if _, err := os.Stat(path); os.IsNotExist(err) {
+        check.Detail = "none, run pakkun init to write one"
+        return check
+    }
+    config, err := search.LoadConfig(path)
+    if err != nil {
+        check.Err = err
+        check.Fix = "Fix " + path + ", or remove it and run pakkun init again"
+        return check
+    }
+    config.Apply()
+    return check
+}
+
+/*
+    dir as an absolute path, and an error if a file can't be written in it
+*/
+func checkWritable(dir string) (string, error) {
+    abs, err := filepath.Abs(dir)
+    if err != nil {
+        return dir, err
+    }
+    f, err := ioutil.TempFile(abs, ".pakkun-doctor-")
+    if err != nil {
+        return abs, err
+    }
+    f.Close()
+    return abs, os.Remove(f.Name())
+}
+
+/*
+    Whether backend finds the functions of f, with their bodies
+*/
+func checkExtraction(f fixture, backend parse.Backend) Check {
+    check := Check{Name: fmt.Sprintf("%s extraction of %s", backend, f.name)}
+    fail  := func(err error, fix string) Check {
+        check.Err = err
+        check.Fix = fix
+        return check
+    }
+
+    dir, err := ioutil.TempDir("", "pakkun-doctor-")
+    if err != nil {
+        return fail(err, "Set $TMPDIR to a writable directory")
+    }
+    defer os.RemoveAll(dir)
+    path := filepath.Join(dir, f.name)
+    if err := ioutil.WriteFile(path, []byte(f.source), 0600); err != nil {
+        return fail(err, "Set $TMPDIR to a writable directory")
+    }
+
+    ext := strings.TrimPrefix(filepath.Ext(f.name), ".")
+    fix := "The regex fallback should always find them, please report it"
+    if backend == parse.Ctags {
+        fix = "ctags can't tag " + parse.LanguageName(ext) + ", install universal-ctags"
+    }
+    file, err := parse.ParseFile(path, parse.WithTypes(parse.NativeTypes(ext)), parse.WithBackend(backend),
+                                parse.WithCtagsPath(search.CtagsPath))
+    if err != nil {
+        return fail(err, fix)
+    }
+
+    found := map[string]bool{}
+    for _, fn := range file.Funcs {
+        if strings.TrimSpace(fn.Source) != "" {
+            found[fn.Name] = true
+        }
+    }
+    missing := []string{}
+    for _, name := range f.funcs {
+        if !found[name] {
+            missing = append(missing, name)
+        }
+    }
+    if len(missing) > 0 {
+        return fail(fmt.Errorf("found %d of %d functions, not %s", len(f.funcs)-len(missing), len(f.funcs),
+                               strings.Join(missing, ", ")), fix)
+    }
+    check.Detail = fmt.Sprintf("%d functions", len(file.Funcs))
+    return check
+}
@@ -0,0 +1,293 @@
+/*
+    setup.go
+
+    pakkun init: look at a project, propose its config and write it to .pakkun.json.
+    The project is walked to find the languages it's written in, how big it is, its
+    version control and the directories not worth indexing, and the ctags installation
+    is checked since pakkun finds fewer functions without it. Every question has a
+    default, so
+
+        pakkun init < /dev/null
+
+    accepts all of them.
+
+    Dependencies:        exuberant or universal ctags
+    Operating systems:   GNU Linux, OS X
+*/
+
+package setup
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "parse"
+    "path/filepath"
+    "search"
+    "sort"
+    "strings"
+)
+
+// Name of the project config, in the project's root
+const ConfigName = ".pakkun.json"
+
+// Directories that are usually dependencies, build output or tooling rather than the
+// project's own code
+var usualExcludes = map[string]bool{"vendor":true, "node_modules":true, "third_party":true, "build":true,
+                                    "dist":true, "target":true, "out":true, "bin":true, "obj":true,
+                                    ".venv":true, "venv":true, "__pycache__":true, ".gradle":true,
+                                    ".idea":true, ".vscode":true}
+
+var vcsDirs = map[string]string{".git":"git", ".hg":"mercurial", ".svn":"subversion", ".bzr":"bazaar"}
+
+/*
+    Files and bytes of one language in a project
+*/
+type Language struct {
+    Ext   string
+    Name  string
+    Files int
+    Bytes int64
+}
+
+/*
+    What pakkun init found in a project
+
+    Dir       - Root of the project
+    VCS       - Version control the project uses, e.g. git, empty if none
+    Languages - Languages of its source files, the most files first
+    Excludes  - Directories found in it that are usually left out, e.g. vendor
+    Files     - Files in it, excluded directories and version control left out
+    Bytes     - Their size
+*/
+type Survey struct {
+    Dir       string
+    VCS       string
+    Languages []Language
+    Excludes  []string
+    Files     int
+    Bytes     int64
+}
+
+/*
+    Walk dir and tell what it's made of
+*/
+func Inspect(dir string) (Survey, error) {
+    survey   := Survey{Dir: dir}
+    byExt    := map[string]*Language{}
+    excludes := map[string]bool{}
+
+    err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return nil
+        }
+        name := info.Name()
+        if info.IsDir() {
+            if path == dir {
+                return nil
+            }
+            if vcs, ok := vcsDirs[name]; ok {
+                if filepath.Dir(path) == filepath.Clean(dir) {
+                    survey.VCS = vcs
+                }
+                return filepath.SkipDir
+            }
+            if usualExcludes[name] {
+                excludes[name] = true
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if !info.Mode().IsRegular() {
+            return nil
+        }
+
+        survey.Files++
+        survey.Bytes += info.Size()
+        ext := parse.DetectLanguage(path)
+        if parse.LanguageName(ext) == "" {
+            return nil
+        }
+        lang, ok := byExt[ext]
+        if !ok {
+            lang       = &Language{Ext: ext, Name: parse.LanguageName(ext)}
+            byExt[ext] = lang
+        }
+        lang.Files++
+        lang.Bytes += info.Size()
+        return nil
+    })
+    if err != nil {
+        return survey, err
+    }
+
+    for _, lang := range byExt {
+        survey.Languages = append(survey.Languages, *lang)
+    }
+    sort.Slice(survey.Languages, func(i, j int) bool {
+        a, b := survey.Languages[i], survey.Languages[j]
+        return a.Files > b.Files || (a.Files == b.Files && a.Ext < b.Ext)
+    })
+    for name := range excludes {
+        survey.Excludes = append(survey.Excludes, name)
+    }
+    sort.Strings(survey.Excludes)
+    return survey, nil
+}
+
+/*
+    The config proposed for what survey found: its most common language, the native
+    types of that language, its usual excludes and the default store
+*/
+func Propose(survey Survey) search.Config {
+    config := search.Config{Exclude: survey.Excludes,
+                            Store:   search.StoreConfig{DB: search.DB, Collection: search.Collection}}
+    if len(survey.Languages) > 0 {
+        config.Extension = "." + survey.Languages[0].Ext
+        config.Types     = parse.NativeTypes(survey.Languages[0].Ext)
+    }
+    return config
+}
+
+/*
+    The ctags pakkun would run, search.CtagsPath or ctags from $PATH, or an error saying
+    what's wrong with it
+*/
+func CheckCtags() (parse.CtagsBinary, error) {
+    binary, err := parse.CtagsInfo(parse.WithCtagsPath(search.CtagsPath))
+    if err != nil {
+        return binary, fmt.Errorf("%v. Until then functions are found by the regex fallback, which misses some", err)
+    }
+    return binary, nil
+}
+
+/*
+    The interactive wizard: inspect dir, check ctags, ask about the proposed config on out,
+    reading answers from in, and write it to dir/.pakkun.json. Settings the config doesn't
+    cover, such as extraction patterns, are kept if the file exists.
+*/
+func Run(dir string, in io.Reader, out io.Writer) error {
+    fmt.Fprintf(out, "Inspecting %s...\n", dir)
+    survey, err := Inspect(dir)
+    if err != nil {
+        return err
+    }
+
+    vcs := survey.VCS
+    if vcs == "" {
+        vcs = "no version control"
+    }
+    fmt.Fprintf(out, "%d files, %s, %s\n", survey.Files, size(survey.Bytes), vcs)
+    for _, lang := range survey.Languages {
+        fmt.Fprintf(out, "    %-16s %6d files  %8s\n", lang.Name, lang.Files, size(lang.Bytes))
+    }
+
+    if binary, err := CheckCtags(); err != nil {
+        fmt.Fprintf(out, "warning: %v\n", err)
+    } else {
+        fmt.Fprintf(out, "ctags: %s\n", binary.Version)
+    }
+
+    config  := Propose(survey)
+    answers := bufio.NewScanner(in)
+    ask     := func(question string, answer string) string {
+        fmt.Fprintf(out, "%s [%s]: ", question, answer)
+        if !answers.Scan() {
+            fmt.Fprintln(out)
+        } else if text := strings.TrimSpace(answers.Text()); text != "" {
+            answer = text
+        }
+        return answer
+    }
+
+    ext := ask("Language to index, by name or extension", strings.TrimPrefix(config.Extension, "."))
+    if ext = languageExt(ext, survey); ext != strings.TrimPrefix(config.Extension, ".") {
+        config.Extension = "." + ext
+        config.Types     = parse.NativeTypes(ext)
+    }
+    if len(config.Types) == 0 {
+        fmt.Fprintf(out, "warning: no types known for .%s, list the types to match in \"types\"\n", ext)
+    }
+
+    exclude := ask("Files and directories to leave out, comma-separated", strings.Join(config.Exclude, ","))
+    config.Exclude = nil
+    for _, name := range strings.Split(exclude, ",") {
+        if name = strings.TrimSpace(name); name != "" && name != "-" {
+            config.Exclude = append(config.Exclude, name)
+        }
+    }
+    config.Store.DB         = ask("MongoDB database", config.Store.DB)
+    config.Store.Collection = ask("MongoDB collection", config.Store.Collection)
+
+    path := filepath.Join(dir, ConfigName)
+    data, err := merge(path, config)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintf(out, "%s\n", data)
+    if answer := ask("Write "+path+"?", "Y"); !strings.HasPrefix(strings.ToLower(answer), "y") {
+        fmt.Fprintln(out, "Not written")
+        return nil
+    }
+    if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+        return err
+    }
+    fmt.Fprintf(out, "Wrote %s, index the project with: pakkun -dir %s\n", path, dir)
+    return nil
+}
+
+/*
+    The extension of answer, a language name or extension, preferring those found in
+    the survey
+*/
+func languageExt(answer string, survey Survey) string {
+    answer = strings.TrimPrefix(answer, ".")
+    for _, lang := range survey.Languages {
+        if strings.EqualFold(lang.Name, answer) || lang.Ext == answer {
+            return lang.Ext
+        }
+    }
+    return answer
+}
+
+/*
+    config as JSON, over the settings of the config already at path if there is one
+*/
+func merge(path string, config search.Config) ([]byte, error) {
+    settings := map[string]json.RawMessage{}
+    if data, err := ioutil.ReadFile(path); err == nil {
+        if err := json.Unmarshal(data, &settings); err != nil {
+            return nil, fmt.Errorf("%s: %v", path, err)
+        }
+    }
+
+    proposed := map[string]json.RawMessage{}
+    data, _  := json.Marshal(config)
+    json.Unmarshal(data, &proposed)
+    for key, value := range proposed {
+        // Patterns aren't proposed, those already there are kept
+        if key == "patterns" {
+            if _, ok := settings[key]; ok {
+                continue
+            }
+            value = json.RawMessage("[]")
+        }
+        settings[key] = value
+    }
+    return json.MarshalIndent(settings, "", "    ")
+}
+
+func size(bytes int64) string {
+    switch {
+    case bytes >= 1<<30:
+        return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+    case bytes >= 1<<20:
+        return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+    case bytes >= 1<<10:
+        return fmt.Sprintf("%.1f KB", float64(bytes)/(1<<10))
+    }
+    return fmt.Sprintf("%d B", bytes)
+}
@@ -0,0 +1,580 @@
+/*
+    elastic.go
+
+    The Elasticsearch Store, for full-text and fuzzy search over the bodies, headers and
+    docs of the corpus rather than exact lookups. It talks to the REST API of
+    Elasticsearch 7 or 8, or OpenSearch, over HTTP.
+
+    Three indices are kept. <Index>-files holds the File of every saved file, with its
+    functions, as the other stores do. <Index>-functions holds one document per function,
+    its name, header, doc and source analyzed as text, its signature, types, path and
+    version as keywords, and the function and its file as they are, so search hits need
+    no second lookup. Function documents are keyed by their file's id and position, so a
+    file saved again overwrites its functions and deletes the ones past its new count.
+    <Index>-runs holds the runs, keyed by their ids.
+
+    Reads by id are realtime, searches see what was written up to a refresh ago, a second
+    by default. Lookups and deletes by path refresh the files index first, so they see
+    the files just saved.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package store
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "parse"
+    "strings"
+)
+
+// Fields of functions Search looks in by default, with their boosts
+var TextFields = []string{"name^3", "header^2", "doc", "source"}
+
+// Hits returned by Search when no limit is given, and documents read per request
+const elasticPage = 100
+
+/*
+    URL   - Base URL of Elasticsearch, e.g. http://localhost:9200, credentials included if
+            it needs them
+    Index - Prefix of the indices, "pakkun" if empty
+    HTTP  - Client used for requests, http.DefaultClient if nil
+*/
+type Elastic struct {
+    URL   string
+    Index string
+    HTTP  *http.Client
+}
+
+/*
+    Text       - Words to look for
+    Fields     - Function fields searched, with optional boosts, e.g. source or name^3.
+                 TextFields if empty
+    Fuzzy      - Also match words an edit or two away, e.g. recieve for receive
+    Version    - Only search functions of files written for this language version, e.g.
+                 python3. Empty for all
+    AsOf       - Run id to search the corpus as of, see parse.AliveAt. Empty for its
+                 current state
+    Limit      - Most hits returned, best first. 100 if 0
+*/
+type TextQuery struct {
+    Text       string
+    Fields     []string
+    Fuzzy      bool
+    Version    string
+    AsOf       string
+    Limit      int
+}
+
+/*
+    An error answered by Elasticsearch
+*/
+type ElasticError struct {
+    Status int
+    Type   string
+    Reason string
+}
+
+func (e *ElasticError) Error() string {
+    if e.Type == "" {
+        return fmt.Sprintf("elasticsearch: %d: %s", e.Status, e.Reason)
+    }
+    return fmt.Sprintf("elasticsearch: %d %s: %s", e.Status, e.Type, e.Reason)
+}
+
+/*
+    The function documents. The File is saved without its functions, and the Function
+    without its source, which is already in Source.
+*/
+type elasticFunction struct {
+    FileId    uint64         `json:"file_id"`
+    Position  int            `json:"position"`
+    Id        uint64         `json:"id"`
+    Name      string         `json:"name"`
+    Header    string         `json:"header"`
+    Signature string         `json:"signature"`
+    Doc       string         `json:"doc"`
+    Source    string         `json:"source"`
+    InType    []string       `json:"in_type"`
+    OutType   []string       `json:"out_type"`
+    Path      string         `json:"path"`
+    Repo      string         `json:"repo"`
+    Version   string         `json:"version"`
+    Language  string         `json:"language"`
+    AddedIn   string         `json:"added_in"`
+    RemovedIn string         `json:"removed_in,omitempty"`
+    File      parse.File     `json:"file"`
+    Function  parse.Function `json:"function"`
+}
+
+var elasticMappings = map[string]string{
+    "files": `{"mappings": {"dynamic": false, "properties": {
+        "id":       {"type": "long"},
+        "Path":     {"type": "keyword"},
+        "Warnings": {"properties": {"Code": {"type": "keyword"}}}}}}`,
+    "functions": `{"mappings": {"dynamic": false, "properties": {
+        "file_id":    {"type": "long"},
+        "position":   {"type": "integer"},
+        "id":         {"type": "long"},
+        "name":       {"type": "text", "fields": {"keyword": {"type": "keyword", "ignore_above": 256}}},
+        "header":     {"type": "text", "fields": {"keyword": {"type": "keyword", "ignore_above": 2048}}},
+        "signature":  {"type": "keyword", "ignore_above": 2048},
+        "doc":        {"type": "text"},
+        "source":     {"type": "text"},
+        "in_type":    {"type": "keyword"},
+        "out_type":   {"type": "keyword"},
+        "path":       {"type": "keyword"},
+        "repo":       {"type": "keyword"},
+        "version":    {"type": "keyword"},
+        "language":   {"type": "keyword"},
+        "added_in":   {"type": "keyword"},
+        "removed_in": {"type": "keyword"},
+        "file":       {"type": "object", "enabled": false},
+        "function":   {"type": "object", "enabled": false}}}}`,
+    "runs": `{"mappings": {"dynamic": false, "properties": {
+        "Id": {"type": "keyword"}}}}`,
+}
+
+/*
+    Create the indices with their mappings, leaving those that already exist as they are
+*/
+func (e *Elastic) CreateIndices() error {
+    for _, name := range []string{"files", "functions", "runs"} {
+        err := e.request("PUT", "/"+e.index(name), strings.NewReader(elasticMappings[name]), nil)
+        if ee, ok := err.(*ElasticError); ok && ee.Type == "resource_already_exists_exception" {
+            continue
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (e *Elastic) SaveFile(file parse.File) error {
+    old, err := e.FindByID(file.Id)
+    if err != nil && err != ErrNotFound {
+        return err
+    }
+
+    var bulk bytes.Buffer
+    bulkOp(&bulk, "index", e.index("files"), fmt.Sprint(file.Id), file)
+    e.functionOps(&bulk, file, file.Funcs, len(old.Funcs))
+    return e.bulk(&bulk)
+}
+
+func (e *Elastic) SaveFunctions(fileId uint64, funcs []parse.Function) error {
+    file, err := e.FindByID(fileId)
+    if err != nil {
+        return err
+    }
+    saved     := len(file.Funcs)
+    file.Funcs = funcs
+
+    var bulk bytes.Buffer
+    bulkOp(&bulk, "index", e.index("files"), fmt.Sprint(file.Id), file)
+    e.functionOps(&bulk, file, funcs, saved)
+    return e.bulk(&bulk)
+}
+
+/*
+    Add to bulk the operations indexing funcs as the functions of file, and deleting the
+    ones past them of the saved functions
+*/
+func (e *Elastic) functionOps(bulk *bytes.Buffer, file parse.File, funcs []parse.Function, saved int) {
+    file.Funcs = nil
+    for i, fn := range funcs {
+        doc := elasticFunction{FileId: file.Id, Position: i, Id: fn.Id, Name: fn.Name, Header: fn.Header,
+                               Signature: fn.Signature, Doc: fn.Doc, Source: fn.Source, InType: fn.InType,
+                               OutType: fn.OutType, Path: file.Path, Repo: file.Repo, Version: file.Version,
+                               Language: file.Language, AddedIn: fn.AddedIn, RemovedIn: fn.RemovedIn, File: file,
+                               Function: fn}
+        doc.Function.Source = ""
+        bulkOp(bulk, "index", e.index("functions"), functionKey(file.Id, i), doc)
+    }
+    for i := len(funcs); i < saved; i++ {
+        bulkOp(bulk, "delete", e.index("functions"), functionKey(file.Id, i), nil)
+    }
+}
+
+func (e *Elastic) FindByID(id uint64) (parse.File, error) {
+    var doc struct {
+        Found  bool       `json:"found"`
+        Source parse.File `json:"_source"`
+    }
+    err := e.request("GET", "/"+e.index("files")+"/_doc/"+fmt.Sprint(id), nil, &doc)
+    if ee, ok := err.(*ElasticError); (ok && ee.Status == http.StatusNotFound) || (err == nil && !doc.Found) {
+        return parse.File{}, ErrNotFound
+    }
+    return doc.Source, err
+}
+
+func (e *Elastic) FindByPath(path string) (parse.File, error) {
+    if err := e.refresh("files"); err != nil {
+        return parse.File{}, err
+    }
+    files, err := e.files(map[string]interface{}{"term": map[string]interface{}{"Path": path}}, 1)
+    if err != nil {
+        return parse.File{}, err
+    }
+    if len(files) == 0 {
+        return parse.File{}, ErrNotFound
+    }
+    return files[0], nil
+}
+
+func (e *Elastic) FindBySignature(signature string) ([]Hit, error) {
+    query := map[string]interface{}{"bool": map[string]interface{}{
+        "should": []interface{}{
+            map[string]interface{}{"term": map[string]interface{}{"signature": signature}},
+            map[string]interface{}{"bool": map[string]interface{}{"filter": []interface{}{
+                map[string]interface{}{"term": map[string]interface{}{"signature": ""}},
+                map[string]interface{}{"term": map[string]interface{}{"header.keyword": signature}},
+            }}},
+        },
+        "minimum_should_match": 1,
+        "must_not":             map[string]interface{}{"exists": map[string]interface{}{"field": "removed_in"}},
+    }}
+
+    hits := []Hit{}
+    err  := e.eachFunction(query, func(doc elasticFunction) {
+        fn       := doc.Function
+        fn.Source = doc.Source
+        hits      = append(hits, Hit{File: doc.File, Function: fn})
+    })
+    return hits, err
+}
+
+func (e *Elastic) DeleteByPath(path string) error {
+    if err := e.refresh("files"); err != nil {
+        return err
+    }
+    files, err := e.files(map[string]interface{}{"term": map[string]interface{}{"Path": path}}, elasticPage)
+    if err != nil {
+        return err
+    }
+
+    var bulk bytes.Buffer
+    for _, file := range files {
+        // Functions may have been saved since the refresh, they're read by id
+        saved, err := e.FindByID(file.Id)
+        if err == ErrNotFound {
+            continue
+        } else if err != nil {
+            return err
+        }
+        bulkOp(&bulk, "delete", e.index("files"), fmt.Sprint(file.Id), nil)
+        for i := range saved.Funcs {
+            bulkOp(&bulk, "delete", e.index("functions"), functionKey(file.Id, i), nil)
+        }
+    }
+    return e.bulk(&bulk)
+}
+
+/*
+    The functions best matching q, with their files
+*/
+func (e *Elastic) Search(q TextQuery) ([]Hit, error) {
+    fields := q.Fields
+    if len(fields) == 0 {
+        fields = TextFields
+    }
+    limit := q.Limit
+    if limit <= 0 {
+        limit = elasticPage
+    }
+
+    match := map[string]interface{}{"query": q.Text, "fields": fields}
+    if q.Fuzzy {
+        match["fuzziness"] = "AUTO"
+    }
+    // Run ids sort in the order of the runs, so they're compared as keywords
+    filter := []interface{}{}
+    if q.Version != "" {
+        filter = append(filter, map[string]interface{}{"term": map[string]interface{}{"version": q.Version}})
+    }
+    query   := map[string]interface{}{"must": map[string]interface{}{"multi_match": match}, "filter": filter}
+    removed := map[string]interface{}{"exists": map[string]interface{}{"field": "removed_in"}}
+    if q.AsOf == "" {
+        query["must_not"] = removed
+    } else {
+        query["filter"] = append(filter,
+            map[string]interface{}{"range": map[string]interface{}{"added_in": map[string]string{"lte": q.AsOf}}},
+            map[string]interface{}{"bool": map[string]interface{}{"minimum_should_match": 1, "should": []interface{}{
+                map[string]interface{}{"bool": map[string]interface{}{"must_not": removed}},
+                map[string]interface{}{"range": map[string]interface{}{"removed_in": map[string]string{"gt": q.AsOf}}},
+            }}})
+    }
+
+    var result searchResult
+    body := map[string]interface{}{"query": map[string]interface{}{"bool": query}, "size": limit}
+    if err := e.search("functions", body, &result); err != nil {
+        return nil, err
+    }
+    hits := []Hit{}
+    for _, h := range result.Hits.Hits {
+        var doc elasticFunction
+        if err := json.Unmarshal(h.Source, &doc); err != nil {
+            return nil, err
+        }
+        fn       := doc.Function
+        fn.Source = doc.Source
+        hits      = append(hits, Hit{File: doc.File, Function: fn})
+    }
+    return hits, nil
+}
+
+/*
+    The functions with the ids, and their files, live ones only if live
+*/
+func (e *Elastic) Functions(ids []uint64, live bool) ([]Hit, error) {
+    query := map[string]interface{}{"filter": map[string]interface{}{"terms": map[string]interface{}{"id": ids}}}
+    if live {
+        query["must_not"] = map[string]interface{}{"exists": map[string]interface{}{"field": "removed_in"}}
+    }
+
+    hits := []Hit{}
+    err  := e.eachFunction(map[string]interface{}{"bool": query}, func(doc elasticFunction) {
+        fn       := doc.Function
+        fn.Source = doc.Source
+        hits      = append(hits, Hit{File: doc.File, Function: fn})
+    })
+    return hits, err
+}
+
+func (e *Elastic) SaveRun(run Run) error {
+    data, err := json.Marshal(run)
+    if err != nil {
+        return err
+    }
+    return e.request("PUT", "/"+e.index("runs")+"/_doc/"+url.PathEscape(run.Id), bytes.NewReader(data), nil)
+}
+
+func (e *Elastic) Runs(n int) ([]Run, error) {
+    // Run ids sort as their start times do
+    var result searchResult
+    body := map[string]interface{}{"size": n, "sort": []interface{}{map[string]string{"Id": "desc"}}}
+    if err := e.search("runs", body, &result); err != nil {
+        return nil, err
+    }
+    runs := []Run{}
+    for _, h := range result.Hits.Hits {
+        var run Run
+        if err := json.Unmarshal(h.Source, &run); err != nil {
+            return nil, err
+        }
+        runs = append(runs, run)
+    }
+    return runs, nil
+}
+
+/*
+    Call fn with every saved file, in the order of their ids, until it returns an error
+*/
+func (e *Elastic) Each(fn func(file parse.File) error) error {
+    var after []json.Number
+    for {
+        body := map[string]interface{}{"size": elasticPage, "sort": []interface{}{map[string]string{"id": "asc"}}}
+        if after != nil {
+            body["search_after"] = after
+        }
+        var result searchResult
+        if err := e.search("files", body, &result); err != nil {
+            return err
+        }
+        for _, h := range result.Hits.Hits {
+            var file parse.File
+            if err := json.Unmarshal(h.Source, &file); err != nil {
+                return err
+            }
+            if err := fn(file); err != nil {
+                return err
+            }
+        }
+        if len(result.Hits.Hits) < elasticPage {
+            return nil
+        }
+        after = result.Hits.Hits[len(result.Hits.Hits)-1].Sort
+    }
+}
+
+/*
+    Call fn with every function document matching query, a page at a time
+*/
+func (e *Elastic) eachFunction(query interface{}, fn func(doc elasticFunction)) error {
+    var after []json.Number
+    for {
+        body := map[string]interface{}{"query": query, "size": elasticPage,
+                                       "sort": []interface{}{map[string]string{"file_id": "asc"}, map[string]string{"position": "asc"}}}
+        if after != nil {
+            body["search_after"] = after
+        }
+        var result searchResult
+        if err := e.search("functions", body, &result); err != nil {
+            return err
+        }
+        for _, h := range result.Hits.Hits {
+            var doc elasticFunction
+            if err := json.Unmarshal(h.Source, &doc); err != nil {
+                return err
+            }
+            fn(doc)
+        }
+        if len(result.Hits.Hits) < elasticPage {
+            return nil
+        }
+        after = result.Hits.Hits[len(result.Hits.Hits)-1].Sort
+    }
+}
+
+/*
+    The first size files matching query
+*/
+func (e *Elastic) files(query interface{}, size int) ([]parse.File, error) {
+    var result searchResult
+    body := map[string]interface{}{"query": query, "size": size, "sort": []interface{}{map[string]string{"id": "asc"}}}
+    if err := e.search("files", body, &result); err != nil {
+        return nil, err
+    }
+    files := []parse.File{}
+    for _, h := range result.Hits.Hits {
+        var file parse.File
+        if err := json.Unmarshal(h.Source, &file); err != nil {
+            return nil, err
+        }
+        files = append(files, file)
+    }
+    return files, nil
+}
+
+/*
+    Sort values are kept as written, they are ids past the 53 bits a float64 holds and
+    are sent back as the search_after of the next page
+*/
+type searchResult struct {
+    Hits struct {
+        Hits []struct {
+            Source json.RawMessage `json:"_source"`
+            Sort   []json.Number   `json:"sort"`
+        } `json:"hits"`
+    } `json:"hits"`
+}
+
+func (e *Elastic) search(index string, body interface{}, result *searchResult) error {
+    data, err := json.Marshal(body)
+    if err != nil {
+        return err
+    }
+    return e.request("POST", "/"+e.index(index)+"/_search", bytes.NewReader(data), result)
+}
+
+/*
+    Make what was written to the index visible to searches
+*/
+func (e *Elastic) refresh(index string) error {
+    return e.request("POST", "/"+e.index(index)+"/_refresh", nil, nil)
+}
+
+/*
+    Send the bulk operations, failing with the first that failed
+*/
+func (e *Elastic) bulk(ops *bytes.Buffer) error {
+    if ops.Len() == 0 {
+        return nil
+    }
+    var result struct {
+        Items []map[string]struct {
+            Status int           `json:"status"`
+            Error  *ElasticError `json:"error"`
+        } `json:"items"`
+    }
+    if err := e.request("POST", "/_bulk", ops, &result); err != nil {
+        return err
+    }
+    for _, item := range result.Items {
+        for _, op := range item {
+            if op.Error != nil {
+                op.Error.Status = op.Status
+                return op.Error
+            }
+        }
+    }
+    return nil
+}
+
+/*
+    Add a bulk operation on the document with id to index, with its source unless it's a
+    delete
+*/
+func bulkOp(bulk *bytes.Buffer, op string, index string, id string, source interface{}) {
+    action, _ := json.Marshal(map[string]interface{}{op: map[string]string{"_index": index, "_id": id}})
+    bulk.Write(action)
+    bulk.WriteByte('\n')
+    if source != nil {
+        doc, _ := json.Marshal(source)
+        bulk.Write(doc)
+        bulk.WriteByte('\n')
+    }
+}
+
+func functionKey(fileId uint64, position int) string {
+    return fmt.Sprintf("%d-%d", fileId, position)
+}
+
+func (e *Elastic) index(name string) string {
+    prefix := e.Index
+    if prefix == "" {
+        prefix = "pakkun"
+    }
+    return prefix + "-" + name
+}
+
+/*
+    Send a request with a JSON body, or NDJSON for bulk requests, and decode the answer
+    into out. Answers other than 2xx are returned as an *ElasticError.
+*/
+func (e *Elastic) request(method string, path string, body io.Reader, out interface{}) error {
+    req, err := http.NewRequest(method, strings.TrimSuffix(e.URL, "/")+path, body)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    if strings.HasSuffix(path, "/_bulk") {
+        req.Header.Set("Content-Type", "application/x-ndjson")
+    }
+
+    client := e.HTTP
+    if client == nil {
+        client = http.DefaultClient
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    data, err := ioutil.ReadAll(resp.Body)
+    if err != nil {
+        return err
+    }
+
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        var answer struct {
+            Error *ElasticError `json:"error"`
+        }
+        if json.Unmarshal(data, &answer) != nil || answer.Error == nil {
+            answer.Error = &ElasticError{Reason: strings.TrimSpace(string(data))}
+        }
+        answer.Error.Status = resp.StatusCode
+        return answer.Error
+    }
+    if out == nil {
+        return nil
+    }
+    return json.Unmarshal(data, out)
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "parse"
+    "testing"
+)
+
+/*
+    Pages of files with ids past 2^53 follow each other exactly, without repeating or
+    skipping a file
+*/
+func TestElasticEachLargeIds(t *testing.T) {
+    ids := []uint64{}
+    for i := 0; i < 2*elasticPage+1; i++ {
+        ids = append(ids, 1<<62+uint64(2*i+1))
+    }
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        data, _ := ioutil.ReadAll(r.Body)
+        d       := json.NewDecoder(bytes.NewReader(data))
+        d.UseNumber()
+        var body struct {
+            After []json.Number `json:"search_after"`
+        }
+        if err := d.Decode(&body); err != nil {
+            t.Error(err)
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+
+        // Hits past the cursor, as Elasticsearch writes them
+        start := 0
+        if len(body.After) > 0 {
+            after := body.After[0].String()
+            for start < len(ids) && fmt.Sprint(ids[start]) != after {
+                start++
+            }
+            if start == len(ids) {
+                t.Errorf("search_after %s isn't an id", after)
+                http.Error(w, "bad search_after", http.StatusBadRequest)
+                return
+            }
+            start++
+        }
+        hits := ""
+        for i := start; i < len(ids) && i < start+elasticPage; i++ {
+            if hits != "" {
+                hits += ","
+            }
+            hits += fmt.Sprintf(`{"_source":{"id":%d,"Path":"f%d"},"sort":[%d]}`, ids[i], i, ids[i])
+        }
+        fmt.Fprintf(w, `{"hits":{"hits":[%s]}}`, hits)
+    }))
+    defer server.Close()
+
+    seen := []uint64{}
+    err  := (&Elastic{URL: server.URL}).Each(func(file parse.File) error {
+        seen = append(seen, file.Id)
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(seen) != len(ids) {
+        t.Fatalf("got %d files, want %d", len(seen), len(ids))
+    }
+    for i := range ids {
+        if seen[i] != ids[i] {
+            t.Fatalf("file %d has id %d, want %d", i, seen[i], ids[i])
+        }
+    }
+}
@@ -0,0 +1,141 @@
+/*
+    mongo.go
+
+    The MongoDB Store: one document per file, its functions embedded in it, as
+    search.SearchAndSaveFunc has always saved them and server.MongoIndex reads them.
+
+    Dependencies:        mongodb driver for go (http://labix.org/mgo)
+    Operating systems:   GNU Linux, OS X
+*/
+
+package store
+
+import (
+    "parse"
+    "gopkg.in/mgo.v2"
+    "gopkg.in/mgo.v2/bson"
+)
+
+/*
+    Store over the File documents of Collection in DB. Each call runs on a copy of
+    Session.
+*/
+type Mongo struct {
+    Session    *mgo.Session
+    DB         string
+    Collection string
+}
+
+/*
+    A copy of the session, to be closed by the caller, and the collection on it
+*/
+func (m *Mongo) collection() (*mgo.Session, *mgo.Collection) {
+    session := m.Session.Copy()
+    return session, session.DB(m.DB).C(m.Collection)
+}
+
+func (m *Mongo) SaveFile(file parse.File) error {
+    session, c := m.collection()
+    defer session.Close()
+
+    _, err := c.UpsertId(file.Id, file)
+    return err
+}
+
+func (m *Mongo) SaveFunctions(fileId uint64, funcs []parse.Function) error {
+    session, c := m.collection()
+    defer session.Close()
+
+    return notFound(c.UpdateId(fileId, bson.M{"$set": bson.M{"funcs": funcs}}))
+}
+
+func (m *Mongo) FindByID(id uint64) (parse.File, error) {
+    return m.findOne(bson.M{"_id": id})
+}
+
+func (m *Mongo) FindByPath(path string) (parse.File, error) {
+    return m.findOne(bson.M{"path": path})
+}
+
+func (m *Mongo) findOne(selector bson.M) (parse.File, error) {
+    session, c := m.collection()
+    defer session.Close()
+
+    var file parse.File
+    if err := c.Find(selector).One(&file); err != nil {
+        return parse.File{}, notFound(err)
+    }
+    return file, nil
+}
+
+func (m *Mongo) FindBySignature(signature string) ([]Hit, error) {
+    session, c := m.collection()
+    defer session.Close()
+
+    var files []parse.File
+    selector := bson.M{"$or": []bson.M{{"funcs.signature": signature}, {"funcs.header": signature}}}
+    if err := c.Find(selector).All(&files); err != nil {
+        return nil, err
+    }
+
+    // Documents hold every function of a file, keep only the ones that matched
+    hits := []Hit{}
+    for _, file := range files {
+        hits = append(hits, BySignature(file, signature)...)
+    }
+    return hits, nil
+}
+
+func (m *Mongo) DeleteByPath(path string) error {
+    session, c := m.collection()
+    defer session.Close()
+
+    _, err := c.RemoveAll(bson.M{"path": path})
+    return err
+}
+
+/*
+    Runs are saved to the runs collection of DB
+*/
+func (m *Mongo) SaveRun(run Run) error {
+    session := m.Session.Copy()
+    defer session.Close()
+
+    _, err := session.DB(m.DB).C("runs").UpsertId(run.Id, run)
+    return err
+}
+
+func (m *Mongo) Runs(n int) ([]Run, error) {
+    session := m.Session.Copy()
+    defer session.Close()
+
+    // Run ids sort as their start times do
+    runs := []Run{}
+    if err := session.DB(m.DB).C("runs").Find(nil).Sort("-_id").Limit(n).All(&runs); err != nil {
+        return nil, err
+    }
+    return runs, nil
+}
+
+func (m *Mongo) Each(fn func(file parse.File) error) error {
+    session, c := m.collection()
+    defer session.Close()
+
+    iter := c.Find(nil).Iter()
+    var file parse.File
+    for iter.Next(&file) {
+        if err := fn(file); err != nil {
+            iter.Close()
+            return err
+        }
+        file = parse.File{}
+    }
+    return iter.Close()
+}
+
+func notFound(err error) error {
+    if err == mgo.ErrNotFound {
+        return ErrNotFound
+    }
+    return err
+}
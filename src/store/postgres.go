@@ -0,0 +1,161 @@
+/*
+    postgres.go
+
+    The PostgreSQL Store, for infrastructure without MongoDB. Files, functions and runs
+    are rows of the tables described in sql.go, their lists JSONB.
+
+    The tables are created and upgraded by Migrate. It's run on every connect, as
+    migrations are only applied once.
+
+    Dependencies:        a PostgreSQL driver for database/sql, e.g. github.com/lib/pq
+    Operating systems:   GNU Linux, OS X
+*/
+
+package store
+
+import (
+    "database/sql"
+    "fmt"
+    "parse"
+)
+
+/*
+    The schema, one migration per version, in order. Migrations are never edited once
+    released, changes to the schema are new ones appended to the end.
+*/
+var Migrations = []string{
+    // 1: files and their functions
+    `CREATE TABLE pakkun_files (
+        id           bigint PRIMARY KEY,
+        name         text NOT NULL,
+        path         text NOT NULL,
+        repo         text NOT NULL DEFAULT '',
+        commit       text NOT NULL DEFAULT '',
+        backend      text NOT NULL DEFAULT '',
+        package      text NOT NULL DEFAULT '',
+        version      text NOT NULL DEFAULT '',
+        language     text NOT NULL DEFAULT '',
+        encoding     text NOT NULL DEFAULT '',
+        line_endings text NOT NULL DEFAULT '',
+        symbols      jsonb,
+        classes      jsonb,
+        imports      jsonb
+    );
+    CREATE INDEX pakkun_files_path ON pakkun_files (path);
+
+    CREATE TABLE pakkun_functions (
+        file_id      bigint NOT NULL REFERENCES pakkun_files (id) ON DELETE CASCADE,
+        position     integer NOT NULL,
+        id           bigint NOT NULL,
+        content_id   bigint NOT NULL DEFAULT 0,
+        name         text NOT NULL,
+        header       text NOT NULL,
+        signature    text NOT NULL DEFAULT '',
+        doc          text NOT NULL DEFAULT '',
+        annotations  jsonb,
+        throws       jsonb,
+        visibility   text NOT NULL DEFAULT '',
+        modifiers    jsonb,
+        abstract     boolean NOT NULL DEFAULT false,
+        class        text NOT NULL DEFAULT '',
+        kind         text NOT NULL DEFAULT '',
+        in_type      jsonb,
+        out_type     jsonb,
+        params       jsonb,
+        returns      jsonb,
+        source       text NOT NULL DEFAULT '',
+        flags        jsonb,
+        start_line   integer NOT NULL DEFAULT 0,
+        start_column integer NOT NULL DEFAULT 0,
+        end_line     integer NOT NULL DEFAULT 0,
+        start_offset integer NOT NULL DEFAULT 0,
+        end_offset   integer NOT NULL DEFAULT 0,
+        highlights   jsonb,
+        usage_count  integer NOT NULL DEFAULT 0,
+        tokens       integer NOT NULL DEFAULT 0,
+        context      jsonb,
+        added_in     text NOT NULL DEFAULT '',
+        removed_in   text NOT NULL DEFAULT '',
+        PRIMARY KEY (file_id, position)
+    );
+    CREATE INDEX pakkun_functions_id ON pakkun_functions (id);
+    CREATE INDEX pakkun_functions_signature ON pakkun_functions (signature);
+    CREATE INDEX pakkun_functions_header ON pakkun_functions (header) WHERE signature = '';`,
+
+    // 2: what of each file was left out and why, see parse/codes.go
+    `ALTER TABLE pakkun_files ADD COLUMN warnings jsonb;`,
+
+    // 3: indexing runs, see Run
+    `CREATE TABLE pakkun_runs (
+        id        text PRIMARY KEY,
+        dir       text NOT NULL DEFAULT '',
+        started   timestamptz NOT NULL,
+        finished  timestamptz NOT NULL,
+        redaction text NOT NULL DEFAULT '',
+        tokenizer text NOT NULL DEFAULT '',
+        codes     jsonb
+    );`,
+
+    // 4: the archive each file was read from, see parse.File
+    `ALTER TABLE pakkun_files ADD COLUMN archive text NOT NULL DEFAULT '';`,
+}
+
+/*
+    Store over the pakkun tables of DB, opened with the driver of the caller's choice,
+    e.g. sql.Open("postgres", dsn) with github.com/lib/pq. Migrate DB before using it.
+*/
+type Postgres struct {
+    DB *sql.DB
+}
+
+var postgres = dialect{param: func(n int) string { return fmt.Sprintf("$%d", n) }, lock: " FOR UPDATE"}
+
+/*
+    Apply the Migrations db doesn't have yet, see SchemaVersion for the one it's at.
+    Each is applied in a transaction of its own along with recording it, so a failed one
+    leaves the schema at the version before it. Fails if db is at a version newer than
+    this pakkun knows.
+*/
+func Migrate(db *sql.DB) error {
+    return migrate(db, postgres, Migrations)
+}
+
+func (p *Postgres) store() *sqlStore {
+    return &sqlStore{db: p.DB, dialect: postgres}
+}
+
+func (p *Postgres) SaveFile(file parse.File) error {
+    return p.store().SaveFile(file)
+}
+
+func (p *Postgres) SaveFunctions(fileId uint64, funcs []parse.Function) error {
+    return p.store().SaveFunctions(fileId, funcs)
+}
+
+func (p *Postgres) FindByID(id uint64) (parse.File, error) {
+    return p.store().FindByID(id)
+}
+
+func (p *Postgres) FindByPath(path string) (parse.File, error) {
+    return p.store().FindByPath(path)
+}
+
+func (p *Postgres) FindBySignature(signature string) ([]Hit, error) {
+    return p.store().FindBySignature(signature)
+}
+
+func (p *Postgres) DeleteByPath(path string) error {
+    return p.store().DeleteByPath(path)
+}
+
+func (p *Postgres) SaveRun(run Run) error {
+    return p.store().SaveRun(run)
+}
+
+func (p *Postgres) Runs(n int) ([]Run, error) {
+    return p.store().Runs(n)
+}
+
+func (p *Postgres) Each(fn func(file parse.File) error) error {
+    return p.store().Each(fn)
+}
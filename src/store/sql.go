@@ -0,0 +1,451 @@
+/*
+    sql.go
+
+    What the relational Stores share. Files are rows of pakkun_files and their functions
+    rows of pakkun_functions, kept in the order of File.Funcs. Scalar fields get a column
+    each, type arrays, parameters and the other lists are JSON. Ids are 63-bit so they
+    fit a 64-bit integer as they are, content ids are stored with the same bits, so
+    negative when the top one is set. Runs are rows of pakkun_runs. Postgres and SQLite
+    differ in their dialect only.
+
+    Schemas are versioned in pakkun_schema, one version per migration applied.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package store
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "parse"
+    "strings"
+)
+
+const fileColumns = `id, name, path, repo, "commit", backend, package, version, language, encoding,
+    line_endings, symbols, classes, imports, warnings, archive`
+
+const runColumns = `id, dir, started, finished, redaction, tokenizer, codes`
+
+// Files read per query by Each
+const sqlPage = 100
+
+const funcColumns = `id, content_id, name, header, signature, doc, annotations, throws, visibility,
+    modifiers, abstract, class, kind, in_type, out_type, params, returns, source, flags,
+    start_line, start_column, end_line, start_offset, end_offset, highlights, usage_count,
+    tokens, context, added_in, removed_in`
+
+/*
+    How a database differs
+
+    param - Placeholder of the nth parameter of a statement, from 1
+    lock  - Appended to a select to lock the rows it reads until the end of the transaction
+    types - Whether pakkun_function_types indexes the InType and OutType of functions
+*/
+type dialect struct {
+    param func(n int) string
+    lock  string
+    types bool
+}
+
+/*
+    Store over the pakkun tables of db, in its dialect
+*/
+type sqlStore struct {
+    db *sql.DB
+    dialect
+}
+
+/*
+    The version of the schema of db, the number of migrations applied, 0 if none are
+*/
+func SchemaVersion(db *sql.DB) (int, error) {
+    if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS pakkun_schema (
+        version integer PRIMARY KEY,
+        applied timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP)`); err != nil {
+        return 0, err
+    }
+    var version int
+    err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM pakkun_schema`).Scan(&version)
+    return version, err
+}
+
+/*
+    Apply the migrations db doesn't have yet, each in a transaction of its own along with
+    recording it, so a failed one leaves the schema at the version before it. Fails if db
+    is at a version newer than migrations know.
+*/
+func migrate(db *sql.DB, d dialect, migrations []string) error {
+    version, err := SchemaVersion(db)
+    if err != nil {
+        return err
+    }
+    if version > len(migrations) {
+        return fmt.Errorf("schema version %d is newer than this pakkun's %d", version, len(migrations))
+    }
+
+    for v := version + 1; v <= len(migrations); v++ {
+        tx, err := db.Begin()
+        if err != nil {
+            return err
+        }
+        if _, err := tx.Exec(migrations[v-1]); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("migration %d: %v", v, err)
+        }
+        if _, err := tx.Exec(`INSERT INTO pakkun_schema (version) VALUES (`+d.param(1)+`)`, v); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("migration %d: %v", v, err)
+        }
+        if err := tx.Commit(); err != nil {
+            return fmt.Errorf("migration %d: %v", v, err)
+        }
+    }
+    return nil
+}
+
+func (s *sqlStore) SaveFile(file parse.File) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    args := []interface{}{int64(file.Id), file.Name, file.Path, file.Repo, file.Commit, string(file.Backend),
+                          file.Package, file.Version, file.Language, file.Encoding, file.LineEndings,
+                          jsonValue(file.Symbols), jsonValue(file.Classes), jsonValue(file.Imports),
+                          jsonValue(file.Warnings), file.Archive}
+    _, err = tx.Exec(`INSERT INTO pakkun_files (`+fileColumns+`) VALUES (`+s.params(1, len(args))+`)
+        ON CONFLICT (id) DO UPDATE SET name = excluded.name, path = excluded.path, repo = excluded.repo,
+            "commit" = excluded."commit", backend = excluded.backend, package = excluded.package,
+            version = excluded.version, language = excluded.language, encoding = excluded.encoding,
+            line_endings = excluded.line_endings, symbols = excluded.symbols, classes = excluded.classes,
+            imports = excluded.imports, warnings = excluded.warnings, archive = excluded.archive`, args...)
+    if err != nil {
+        return err
+    }
+    if err := s.replaceFunctions(tx, file.Id, file.Funcs); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func (s *sqlStore) SaveFunctions(fileId uint64, funcs []parse.Function) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    // Locks the file's row where the database can, so it can't be deleted before its
+    // functions are saved
+    var id int64
+    err = tx.QueryRow(`SELECT id FROM pakkun_files WHERE id = `+s.param(1)+s.lock, int64(fileId)).Scan(&id)
+    if err == sql.ErrNoRows {
+        return ErrNotFound
+    }
+    if err != nil {
+        return err
+    }
+    if err := s.replaceFunctions(tx, fileId, funcs); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+/*
+    Replace the functions of the file with fileId by funcs, in tx. Rows of other tables
+    are deleted explicitly rather than by cascade, which SQLite doesn't do by default.
+*/
+func (s *sqlStore) replaceFunctions(tx *sql.Tx, fileId uint64, funcs []parse.Function) error {
+    if s.types {
+        if _, err := tx.Exec(`DELETE FROM pakkun_function_types WHERE file_id = `+s.param(1), int64(fileId)); err != nil {
+            return err
+        }
+    }
+    if _, err := tx.Exec(`DELETE FROM pakkun_functions WHERE file_id = `+s.param(1), int64(fileId)); err != nil {
+        return err
+    }
+    if len(funcs) == 0 {
+        return nil
+    }
+
+    stmt, err := tx.Prepare(`INSERT INTO pakkun_functions (file_id, position, ` + funcColumns + `)
+        VALUES (` + s.params(1, 32) + `)`)
+    if err != nil {
+        return err
+    }
+    defer stmt.Close()
+
+    var types *sql.Stmt
+    if s.types {
+        types, err = tx.Prepare(`INSERT INTO pakkun_function_types (file_id, position, direction, type)
+            VALUES (` + s.params(1, 4) + `)`)
+        if err != nil {
+            return err
+        }
+        defer types.Close()
+    }
+
+    for i, fn := range funcs {
+        args := []interface{}{int64(fileId), i, int64(fn.Id), int64(fn.ContentId), fn.Name, fn.Header,
+                              fn.Signature, fn.Doc, jsonValue(fn.Annotations), jsonValue(fn.Throws), fn.Visibility,
+                              jsonValue(fn.Modifiers), fn.Abstract, fn.Class, fn.Kind, jsonValue(fn.InType),
+                              jsonValue(fn.OutType), jsonValue(fn.Params), jsonValue(fn.Returns), fn.Source,
+                              jsonValue(fn.Flags), fn.StartLine, fn.StartColumn, fn.EndLine, fn.StartOffset,
+                              fn.EndOffset, jsonValue(fn.Highlights), fn.UsageCount, fn.Tokens,
+                              jsonValue(fn.Context), fn.AddedIn, fn.RemovedIn}
+        if _, err := stmt.Exec(args...); err != nil {
+            return err
+        }
+        if types == nil {
+            continue
+        }
+        for _, t := range fn.InType {
+            if _, err := types.Exec(int64(fileId), i, "in", t); err != nil {
+                return err
+            }
+        }
+        for _, t := range fn.OutType {
+            if _, err := types.Exec(int64(fileId), i, "out", t); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func (s *sqlStore) FindByID(id uint64) (parse.File, error) {
+    return s.findOne(`id = `+s.param(1), int64(id))
+}
+
+func (s *sqlStore) FindByPath(path string) (parse.File, error) {
+    return s.findOne(`path = `+s.param(1), path)
+}
+
+/*
+    The first file matching where, with its functions
+*/
+func (s *sqlStore) findOne(where string, args ...interface{}) (parse.File, error) {
+    files, err := s.findFiles(`SELECT `+fileColumns+` FROM pakkun_files WHERE `+where+` ORDER BY id LIMIT 1`, args...)
+    if err != nil {
+        return parse.File{}, err
+    }
+    if len(files) == 0 {
+        return parse.File{}, ErrNotFound
+    }
+    return files[0], nil
+}
+
+func (s *sqlStore) FindBySignature(signature string) ([]Hit, error) {
+    files, err := s.findFiles(`SELECT `+fileColumns+` FROM pakkun_files WHERE id IN (
+        SELECT file_id FROM pakkun_functions
+        WHERE removed_in = '' AND (signature = `+s.param(1)+` OR (signature = '' AND header = `+s.param(2)+`)))
+        ORDER BY id`, signature, signature)
+    if err != nil {
+        return nil, err
+    }
+
+    // Files are read whole, keep only the functions that matched
+    hits := []Hit{}
+    for _, file := range files {
+        hits = append(hits, BySignature(file, signature)...)
+    }
+    return hits, nil
+}
+
+func (s *sqlStore) DeleteByPath(path string) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    ids := `(SELECT id FROM pakkun_files WHERE path = ` + s.param(1) + `)`
+    if s.types {
+        if _, err := tx.Exec(`DELETE FROM pakkun_function_types WHERE file_id IN `+ids, path); err != nil {
+            return err
+        }
+    }
+    if _, err := tx.Exec(`DELETE FROM pakkun_functions WHERE file_id IN `+ids, path); err != nil {
+        return err
+    }
+    if _, err := tx.Exec(`DELETE FROM pakkun_files WHERE path = `+s.param(1), path); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+/*
+    Files are read a page at a time, by id, with no query open while fn runs, so fn may
+    save to the store
+*/
+func (s *sqlStore) Each(fn func(file parse.File) error) error {
+    after := int64(-1)
+    for {
+        files, err := s.findFiles(`SELECT `+fileColumns+` FROM pakkun_files WHERE id > `+s.param(1)+`
+            ORDER BY id LIMIT `+s.param(2), after, sqlPage)
+        if err != nil {
+            return err
+        }
+        for _, file := range files {
+            if err := fn(file); err != nil {
+                return err
+            }
+        }
+        if len(files) < sqlPage {
+            return nil
+        }
+        after = int64(files[len(files)-1].Id)
+    }
+}
+
+/*
+    Runs are rows of pakkun_runs
+*/
+func (s *sqlStore) SaveRun(run Run) error {
+    args := []interface{}{run.Id, run.Dir, run.Started, run.Finished, run.Redaction, run.Tokenizer, jsonValue(run.Codes)}
+    _, err := s.db.Exec(`INSERT INTO pakkun_runs (`+runColumns+`) VALUES (`+s.params(1, len(args))+`)
+        ON CONFLICT (id) DO UPDATE SET dir = excluded.dir, started = excluded.started, finished = excluded.finished,
+            redaction = excluded.redaction, tokenizer = excluded.tokenizer, codes = excluded.codes`, args...)
+    return err
+}
+
+func (s *sqlStore) Runs(n int) ([]Run, error) {
+    // Run ids sort as their start times do
+    rows, err := s.db.Query(`SELECT `+runColumns+` FROM pakkun_runs ORDER BY id DESC LIMIT `+s.param(1), n)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    runs := []Run{}
+    for rows.Next() {
+        var run Run
+        var codes []byte
+        if err := rows.Scan(&run.Id, &run.Dir, &run.Started, &run.Finished, &run.Redaction, &run.Tokenizer,
+                            &codes); err != nil {
+            return nil, err
+        }
+        if err := decodeJSON(codes, &run.Codes); err != nil {
+            return nil, err
+        }
+        runs = append(runs, run)
+    }
+    return runs, rows.Err()
+}
+
+/*
+    The files query selects, fileColumns of pakkun_files, each with its functions
+*/
+func (s *sqlStore) findFiles(query string, args ...interface{}) ([]parse.File, error) {
+    rows, err := s.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    files := []parse.File{}
+    for rows.Next() {
+        var file parse.File
+        var id int64
+        var backend string
+        var symbols, classes, imports, warnings []byte
+        if err := rows.Scan(&id, &file.Name, &file.Path, &file.Repo, &file.Commit, &backend, &file.Package,
+                            &file.Version, &file.Language, &file.Encoding, &file.LineEndings,
+                            &symbols, &classes, &imports, &warnings, &file.Archive); err != nil {
+            return nil, err
+        }
+        file.Id      = uint64(id)
+        file.Backend = parse.Backend(backend)
+        if err := decodeJSON(symbols, &file.Symbols, classes, &file.Classes, imports, &file.Imports,
+                             warnings, &file.Warnings); err != nil {
+            return nil, err
+        }
+        files = append(files, file)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    for i := range files {
+        if files[i].Funcs, err = s.functions(files[i].Id); err != nil {
+            return nil, err
+        }
+    }
+    return files, nil
+}
+
+/*
+    The functions of the file with fileId, in the order they were saved
+*/
+func (s *sqlStore) functions(fileId uint64) ([]parse.Function, error) {
+    rows, err := s.db.Query(`SELECT `+funcColumns+` FROM pakkun_functions WHERE file_id = `+s.param(1)+`
+        ORDER BY position`, int64(fileId))
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var funcs []parse.Function
+    for rows.Next() {
+        var fn parse.Function
+        var id, contentId int64
+        var annotations, throws, modifiers, inType, outType, params, returns, flags, highlights, context []byte
+        if err := rows.Scan(&id, &contentId, &fn.Name, &fn.Header, &fn.Signature, &fn.Doc, &annotations,
+                            &throws, &fn.Visibility, &modifiers, &fn.Abstract, &fn.Class, &fn.Kind, &inType,
+                            &outType, &params, &returns, &fn.Source, &flags, &fn.StartLine,
+                            &fn.StartColumn, &fn.EndLine, &fn.StartOffset, &fn.EndOffset, &highlights,
+                            &fn.UsageCount, &fn.Tokens, &context, &fn.AddedIn, &fn.RemovedIn); err != nil {
+            return nil, err
+        }
+        fn.Id        = uint64(id)
+        fn.ContentId = uint64(contentId)
+        if err := decodeJSON(annotations, &fn.Annotations, throws, &fn.Throws, modifiers, &fn.Modifiers,
+                          inType, &fn.InType, outType, &fn.OutType, params, &fn.Params, returns, &fn.Returns,
+                          flags, &fn.Flags, highlights, &fn.Highlights, context, &fn.Context); err != nil {
+            return nil, err
+        }
+        funcs = append(funcs, fn)
+    }
+    return funcs, rows.Err()
+}
+
+/*
+    Placeholders of parameters from to from+n-1
+*/
+func (s *sqlStore) params(from int, n int) string {
+    params := make([]string, n)
+    for i := range params {
+        params[i] = s.param(from + i)
+    }
+    return strings.Join(params, ", ")
+}
+
+/*
+    v as a JSON parameter, NULL for nil and empty slices
+*/
+func jsonValue(v interface{}) interface{} {
+    b, err := json.Marshal(v)
+    if err != nil || string(b) == "null" || string(b) == "[]" {
+        return nil
+    }
+    return string(b)
+}
+
+/*
+    Decode pairs of JSON columns and where they go, leaving NULL ones as they are
+*/
+func decodeJSON(pairs ...interface{}) error {
+    for i := 0; i+1 < len(pairs); i += 2 {
+        b := pairs[i].([]byte)
+        if len(b) == 0 {
+            continue
+        }
+        if err := json.Unmarshal(b, pairs[i+1]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
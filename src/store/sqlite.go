@@ -0,0 +1,174 @@
+/*
+    sqlite.go
+
+    The SQLite Store, so a whole corpus lives in one portable .db file with no server,
+    for research on a single machine. Files and functions are rows of the tables
+    described in sql.go, their lists JSON text, queryable with SQLite's JSON functions.
+    Functions are indexed by name, and by the types they take and return through
+    pakkun_function_types, one row per InType (direction in) and OutType (out) entry:
+
+        SELECT f.path, fn.header FROM pakkun_function_types t
+        JOIN pakkun_functions fn ON fn.file_id = t.file_id AND fn.position = t.position
+        JOIN pakkun_files f ON f.id = fn.file_id
+        WHERE t.direction = 'in' AND t.type = 'String' AND fn.removed_in = ''
+
+    Dependencies:        an SQLite driver for database/sql, e.g. github.com/mattn/go-sqlite3
+    Operating systems:   GNU Linux, OS X
+*/
+
+package store
+
+import (
+    "database/sql"
+    "parse"
+)
+
+/*
+    The SQLite schema, one migration per version, in order, as for Migrations
+*/
+var SQLiteMigrations = []string{
+    // 1: files, their functions and the types of the functions
+    `CREATE TABLE pakkun_files (
+        id           INTEGER PRIMARY KEY,
+        name         TEXT NOT NULL,
+        path         TEXT NOT NULL,
+        repo         TEXT NOT NULL DEFAULT '',
+        "commit"     TEXT NOT NULL DEFAULT '',
+        backend      TEXT NOT NULL DEFAULT '',
+        package      TEXT NOT NULL DEFAULT '',
+        version      TEXT NOT NULL DEFAULT '',
+        language     TEXT NOT NULL DEFAULT '',
+        encoding     TEXT NOT NULL DEFAULT '',
+        line_endings TEXT NOT NULL DEFAULT '',
+        symbols      TEXT,
+        classes      TEXT,
+        imports      TEXT
+    );
+    CREATE INDEX pakkun_files_path ON pakkun_files (path);
+
+    CREATE TABLE pakkun_functions (
+        file_id      INTEGER NOT NULL REFERENCES pakkun_files (id) ON DELETE CASCADE,
+        position     INTEGER NOT NULL,
+        id           INTEGER NOT NULL,
+        content_id   INTEGER NOT NULL DEFAULT 0,
+        name         TEXT NOT NULL,
+        header       TEXT NOT NULL,
+        signature    TEXT NOT NULL DEFAULT '',
+        doc          TEXT NOT NULL DEFAULT '',
+        annotations  TEXT,
+        throws       TEXT,
+        visibility   TEXT NOT NULL DEFAULT '',
+        modifiers    TEXT,
+        abstract     BOOLEAN NOT NULL DEFAULT 0,
+        class        TEXT NOT NULL DEFAULT '',
+        kind         TEXT NOT NULL DEFAULT '',
+        in_type      TEXT,
+        out_type     TEXT,
+        params       TEXT,
+        returns      TEXT,
+        source       TEXT NOT NULL DEFAULT '',
+        flags        TEXT,
+        start_line   INTEGER NOT NULL DEFAULT 0,
+        start_column INTEGER NOT NULL DEFAULT 0,
+        end_line     INTEGER NOT NULL DEFAULT 0,
+        start_offset INTEGER NOT NULL DEFAULT 0,
+        end_offset   INTEGER NOT NULL DEFAULT 0,
+        highlights   TEXT,
+        usage_count  INTEGER NOT NULL DEFAULT 0,
+        tokens       INTEGER NOT NULL DEFAULT 0,
+        context      TEXT,
+        added_in     TEXT NOT NULL DEFAULT '',
+        removed_in   TEXT NOT NULL DEFAULT '',
+        PRIMARY KEY (file_id, position)
+    );
+    CREATE INDEX pakkun_functions_id ON pakkun_functions (id);
+    CREATE INDEX pakkun_functions_name ON pakkun_functions (name);
+    CREATE INDEX pakkun_functions_signature ON pakkun_functions (signature);
+    CREATE INDEX pakkun_functions_header ON pakkun_functions (header) WHERE signature = '';
+
+    CREATE TABLE pakkun_function_types (
+        file_id   INTEGER NOT NULL,
+        position  INTEGER NOT NULL,
+        direction TEXT NOT NULL,
+        type      TEXT NOT NULL,
+        FOREIGN KEY (file_id, position) REFERENCES pakkun_functions (file_id, position) ON DELETE CASCADE
+    );
+    CREATE INDEX pakkun_function_types_type ON pakkun_function_types (type, direction);
+    CREATE INDEX pakkun_function_types_function ON pakkun_function_types (file_id, position);`,
+
+    // 2: what of each file was left out and why, see parse/codes.go
+    `ALTER TABLE pakkun_files ADD COLUMN warnings TEXT;`,
+
+    // 3: indexing runs, see Run
+    `CREATE TABLE pakkun_runs (
+        id        TEXT PRIMARY KEY,
+        dir       TEXT NOT NULL DEFAULT '',
+        started   TIMESTAMP NOT NULL,
+        finished  TIMESTAMP NOT NULL,
+        redaction TEXT NOT NULL DEFAULT '',
+        tokenizer TEXT NOT NULL DEFAULT '',
+        codes     TEXT
+    );`,
+
+    // 4: the archive each file was read from, see parse.File
+    `ALTER TABLE pakkun_files ADD COLUMN archive TEXT NOT NULL DEFAULT '';`,
+}
+
+/*
+    Store over the pakkun tables of the SQLite database DB, e.g. opened with
+    sql.Open("sqlite3", "corpus.db") with github.com/mattn/go-sqlite3. MigrateSQLite DB
+    before using it. SQLite takes one writer at a time, so a DB limited to one open
+    connection avoids "database is locked" errors.
+*/
+type SQLite struct {
+    DB *sql.DB
+}
+
+var sqlite = dialect{param: func(n int) string { return "?" }, types: true}
+
+/*
+    Apply the SQLiteMigrations db doesn't have yet, as Migrate does
+*/
+func MigrateSQLite(db *sql.DB) error {
+    return migrate(db, sqlite, SQLiteMigrations)
+}
+
+func (s *SQLite) store() *sqlStore {
+    return &sqlStore{db: s.DB, dialect: sqlite}
+}
+
+func (s *SQLite) SaveFile(file parse.File) error {
+    return s.store().SaveFile(file)
+}
+
+func (s *SQLite) SaveFunctions(fileId uint64, funcs []parse.Function) error {
+    return s.store().SaveFunctions(fileId, funcs)
+}
+
+func (s *SQLite) FindByID(id uint64) (parse.File, error) {
+    return s.store().FindByID(id)
+}
+
+func (s *SQLite) FindByPath(path string) (parse.File, error) {
+    return s.store().FindByPath(path)
+}
+
+func (s *SQLite) FindBySignature(signature string) ([]Hit, error) {
+    return s.store().FindBySignature(signature)
+}
+
+func (s *SQLite) DeleteByPath(path string) error {
+    return s.store().DeleteByPath(path)
+}
+
+func (s *SQLite) SaveRun(run Run) error {
+    return s.store().SaveRun(run)
+}
+
+func (s *SQLite) Runs(n int) ([]Run, error) {
+    return s.store().Runs(n)
+}
+
+func (s *SQLite) Each(fn func(file parse.File) error) error {
+    return s.store().Each(fn)
+}
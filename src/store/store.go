@@ -0,0 +1,117 @@
+/*
+    store.go
+
+    Where parsed files are saved. parse.File and parse.Function are what's stored, a
+    Store keeps them however its backend likes and gives them back the same, so the
+    indexer doesn't depend on the database behind it. See Mongo for the MongoDB one.
+
+    Operating systems:   GNU Linux, OS X
+*/
+
+package store
+
+import (
+    "errors"
+    "parse"
+    "time"
+)
+
+/*
+    Returned by a Store looking up a file it doesn't have
+*/
+var ErrNotFound = errors.New("not found")
+
+/*
+    A function along with the file it was found in. File.Funcs is left empty.
+*/
+type Hit struct {
+    File     parse.File
+    Function parse.Function
+}
+
+/*
+    Store is what the indexer needs to save files and find them again. Files are keyed
+    by File.Id, and every function of a file, tombstones included, is saved with it.
+
+    SaveFile        - Insert the file, or replace the one saved with its Id
+    SaveFunctions   - Replace the functions of the saved file with the id, e.g. once
+                      they're tombstoned. ErrNotFound if there's no such file
+    FindByID        - The file saved with the id, ErrNotFound if there's none
+    FindByPath      - The file saved for path, ErrNotFound if there's none
+    FindBySignature - The live functions whose Signature is signature, or whose Header
+                      is for functions without one, with their files
+    DeleteByPath    - Remove what's saved for the file at path, nothing if there's none.
+                      Unlike tombstoning, no trace of its functions is kept
+*/
+type Store interface {
+    SaveFile(file parse.File) error
+    SaveFunctions(fileId uint64, funcs []parse.Function) error
+    FindByID(id uint64) (parse.File, error)
+    FindByPath(path string) (parse.File, error)
+    FindBySignature(signature string) ([]Hit, error)
+    DeleteByPath(path string) error
+}
+
+/*
+    An indexing run, saved as it starts and again as it finishes
+
+    Id        - Run id, see utils.RunId
+    Dir       - Directory that was indexed
+    Started   - When the run started
+    Finished  - When the run finished, zero while it's still going
+    Redaction - Version of the redaction rules applied to what the run saved, empty if
+                none were
+    Tokenizer - Name of the tokenizer functions were counted with, empty if none
+    Codes     - Files with each error and warning code, as in the summary of the run
+*/
+type Run struct {
+    Id        string `bson:"_id"`
+    Dir       string
+    Started   time.Time
+    Finished  time.Time
+    Redaction string `bson:",omitempty"`
+    Tokenizer string `bson:",omitempty"`
+    Codes     map[parse.Code]int `bson:",omitempty"`
+}
+
+/*
+    Implemented by stores that keep the runs along with the files, so the runs functions
+    were added and removed in can be looked up where they're saved
+
+    SaveRun - Insert the run, or replace the one saved with its Id
+    Runs    - The last n runs saved, the latest first
+*/
+type RunStore interface {
+    SaveRun(run Run) error
+    Runs(n int) ([]Run, error)
+}
+
+/*
+    Implemented by stores that can go through every file they hold, for what reads the
+    whole corpus: -stats, -changelog, -ownership, -docgen, -export and -backfill
+
+    Each - Call fn with every saved file until it returns an error, which Each returns
+*/
+type Lister interface {
+    Each(fn func(file parse.File) error) error
+}
+
+/*
+    The live functions of file whose Signature, or Header if it has none, is signature,
+    for stores that can only narrow the search down to files
+*/
+func BySignature(file parse.File, signature string) []Hit {
+    hits      := []Hit{}
+    funcs     := file.Funcs
+    file.Funcs = nil
+    for _, fn := range funcs {
+        sig := fn.Signature
+        if sig == "" {
+            sig = fn.Header
+        }
+        if sig == signature && parse.Alive(fn) {
+            hits = append(hits, Hit{File: file, Function: fn})
+        }
+    }
+    return hits
+}
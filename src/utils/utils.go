@@ -18,20 +18,99 @@ package utils
 
 import (
 	"log"
+    "strings"
+    "time"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
+// Run ids are UTC timestamps, so sorting them sorts runs by start time
+const runIdLayout = "20060102T150405.000000000Z"
+
+/*
+    Return the id of a run started at t
+*/
+func RunId(t time.Time) string {
+    return t.UTC().Format(runIdLayout)
+}
+
 /*
-	Connect to MongoDB and return the session
+    When the run with id started, see RunId
+*/
+func RunTime(id string) (time.Time, error) {
+    return time.Parse(runIdLayout, id)
+}
+
+/*
+    Turn an "as of" point into a run id. Accepts a run id, an RFC 3339 time, or a date
+    (2006-01-02), which means the end of that day in UTC.
+*/
+func AsOfRun(asOf string) (string, error) {
+    asOf = strings.TrimSpace(asOf)
+    if _, err := time.Parse(runIdLayout, asOf); err == nil {
+        return asOf, nil
+    }
+    if t, err := time.Parse(time.RFC3339, asOf); err == nil {
+        return RunId(t), nil
+    }
+    t, err := time.Parse("2006-01-02", asOf)
+    if err != nil {
+        return "", err
+    }
+    return RunId(t.Add(24*time.Hour - time.Nanosecond)), nil
+}
+
+/*
+	Connect to MongoDB and return the session, or why it couldn't be reached
 	User needs to handle Session.Close()
 */
-func ConnectDB() *mgo.Session {
+func ConnectDB() (*mgo.Session, error) {
 	// Connect to MongoDB
-    session, err := mgo.Dial("localhost:27017")
+    return mgo.Dial("localhost:27017")
+}
+
+/*
+    Collections of every database of MongoDB but its own, keyed by database. Empty if it
+    can't be reached within timeout.
+*/
+func Namespaces(timeout time.Duration) map[string][]string {
+    namespaces := map[string][]string{}
+    session, err := mgo.DialWithTimeout("localhost:27017", timeout)
     if err != nil {
-        panic(err)
+        return namespaces
+    }
+    defer session.Close()
+
+    dbs, _ := session.DatabaseNames()
+    for _, db := range dbs {
+        if db == "admin" || db == "config" || db == "local" {
+            continue
+        }
+        namespaces[db], _ = session.DB(db).CollectionNames()
+    }
+    return namespaces
+}
+
+/*
+    Check MongoDB can be reached within timeout and written to in dbName, by writing a
+    document to a collection of its own and dropping it
+*/
+func CheckStore(dbName string, timeout time.Duration) error {
+    session, err := mgo.DialWithTimeout("localhost:27017", timeout)
+    if err != nil {
+        return err
     }
-    return session
+    defer session.Close()
+    session.SetSocketTimeout(timeout)
+
+    if err := session.Ping(); err != nil {
+        return err
+    }
+    probe := session.DB(dbName).C("pakkun_doctor")
+    if err := probe.Insert(bson.M{"_id": "probe", "at": time.Now()}); err != nil {
+        return err
+    }
+    return probe.DropCollection()
 }
 
 func SaveMgoDoc(dbName string, collectionName string, file interface{}) bool {
@@ -57,4 +136,4 @@ func SaveMgoDoc(dbName string, collectionName string, file interface{}) bool {
     }
 
     return true
-}
\ No newline at end of file
+}
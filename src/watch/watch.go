@@ -0,0 +1,133 @@
+/*
+    watch.go
+
+    Watch a directory tree and re-parse files as they change, to keep an index fresh
+    during development.
+
+    Dependencies:        exuberant ctags, fsnotify (https://github.com/fsnotify/fsnotify)
+    Operating systems:   GNU Linux, OS X
+*/
+
+package watch
+
+import (
+    "log"
+    "os"
+    "parse"
+    "path/filepath"
+    "github.com/fsnotify/fsnotify"
+)
+
+/*
+    Path    - File that changed
+    File    - Parsed file, only set if Removed is false
+    Removed - True if the file was deleted, renamed away, or no longer has matching functions
+*/
+type Update struct {
+    Path    string
+    File    parse.File
+    Removed bool
+}
+
+type Watcher struct {
+    Updates   <-chan Update
+    Errors    <-chan error
+    watcher   *fsnotify.Watcher
+    extension string
+    opts      parse.Options
+}
+
+/*
+    Start watching every directory under dir. Files ending in extension are re-parsed
+    with opts when they're created or written, and an Update is sent for each one. Files
+    over opts.Limits are logged and left as they were. Caller needs to handle
+    Watcher.Close()
+*/
+func Watch(dir string, extension string, opts parse.Options) (*Watcher, error) {
+    fsw, err := fsnotify.NewWatcher()
+    if err != nil {
+        return nil, err
+    }
+
+    updates := make(chan Update)
+    w       := &Watcher{Updates: updates, Errors: fsw.Errors, watcher: fsw, extension: extension, opts: opts}
+
+    // fsnotify isn't recursive, every directory needs its own watch
+    if err := w.addTree(dir); err != nil {
+        fsw.Close()
+        return nil, err
+    }
+
+    go w.run(updates)
+    return w, nil
+}
+
+func (w *Watcher) Close() error {
+    return w.watcher.Close()
+}
+
+func (w *Watcher) addTree(dir string) error {
+    return filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if f.IsDir() {
+            return w.watcher.Add(path)
+        }
+        return nil
+    })
+}
+
+func (w *Watcher) run(updates chan<- Update) {
+    defer close(updates)
+
+    for event := range w.watcher.Events {
+        path := event.Name
+
+        // New directories need watching too, and may already contain files
+        if event.Op&fsnotify.Create == fsnotify.Create {
+            if f, err := os.Stat(path); err == nil && f.IsDir() {
+                w.addTree(path)
+                filepath.Walk(path, func(p string, f os.FileInfo, err error) error {
+                    if err == nil && !f.IsDir() && parse.HasLanguage(p, nil, w.extension) {
+                        if update, ok := w.parse(p); ok {
+                            updates <- update
+                        }
+                    }
+                    return nil
+                })
+                continue
+            }
+        }
+
+        if !parse.HasLanguage(path, nil, w.extension) {
+            continue
+        }
+
+        switch {
+        case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+            updates <- Update{Path: path, Removed: true}
+        case event.Op&(fsnotify.Create|fsnotify.Write) != 0:
+            if update, ok := w.parse(path); ok {
+                updates <- update
+            }
+        }
+    }
+}
+
+/*
+    The Update for the file at path, not ok if it's over a limit and what was indexed
+    for it stays
+*/
+func (w *Watcher) parse(path string) (Update, bool) {
+    file, err := parse.ParseFileWith(path, w.opts)
+    if parse.IsLimit(err) {
+        log.Printf("[%s] skipping %v\n", parse.CodeOf(err), err)
+        return Update{}, false
+    }
+    if err != nil {
+        // Whatever was indexed for this file is stale now
+        return Update{Path: path, Removed: true}, true
+    }
+    return Update{Path: path, File: file}, true
+}